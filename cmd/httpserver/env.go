@@ -31,6 +31,10 @@ func loadEnvConfiguration() {
 	viper.SetDefault("NATSQueueKeyPath", "./certs/key.pem")
 	_ = viper.BindEnv("NATSQueueKeyPath", "NATS_QUEUE_KEY_PATH")
 
+	// Repository backend ("couchdb" or "sqlite")
+	viper.SetDefault("Storage", "couchdb")
+	_ = viper.BindEnv("Storage", "STORAGE")
+
 	// Couch DB
 	viper.SetDefault("CouchDBHost", "localhost")
 	_ = viper.BindEnv("CouchDBHost", "COUCHDB_HOST")
@@ -43,6 +47,10 @@ func loadEnvConfiguration() {
 	viper.SetDefault("CouchDBPasswd", "admin")
 	_ = viper.BindEnv("CouchDBPasswd", "COUCHDB_PASSWD")
 
+	// SQLite database file (":memory:" keeps the data in memory only)
+	viper.SetDefault("SQLitePath", "commenting.db")
+	_ = viper.BindEnv("SQLitePath", "SQLITE_PATH")
+
 	// User service
 	viper.SetDefault("UserServiceGRPCDialTarget", "localhost:50051")
 	_ = viper.BindEnv("UserServiceGRPCDialTarget", "USER_SERVICE_GRPC_DIAL_TARGET")
@@ -51,6 +59,39 @@ func loadEnvConfiguration() {
 	viper.SetDefault("AuthServiceAddress", "localhost:8081")
 	_ = viper.BindEnv("AuthServiceAddress", "AUTH_SERVICE_ADDRESS")
 
+	// Time window the responses of requests with Idempotency-Key header are stored for replay
+	viper.SetDefault("IdempotencyKeyTTL", "24h")
+	_ = viper.BindEnv("IdempotencyKeyTTL", "IDEMPOTENCY_KEY_TTL")
+
+	// Time the Idempotency-Key stays reserved by the request being processed, e.g. if the service is stopped before
+	// the request finishes, the request can be retried with the same key after this timeout
+	viper.SetDefault("IdempotencyPendingTimeout", "1m")
+	_ = viper.BindEnv("IdempotencyPendingTimeout", "IDEMPOTENCY_KEY_PENDING_TIMEOUT")
+
+	// Maximum number of comments/worknotes that can be pinned to the top of one entity thread
+	viper.SetDefault("MaxPinsPerEntity", "3")
+	_ = viper.BindEnv("MaxPinsPerEntity", "MAX_PINS_PER_ENTITY")
+
+	// Number of attempts of an update of the document changed concurrently by another request
+	viper.SetDefault("ConflictRetries", "5")
+	_ = viper.BindEnv("ConflictRetries", "CONFLICT_RETRIES")
+
+	// Delay between two checks of the outbox for events not published yet
+	viper.SetDefault("OutboxRelayInterval", "1s")
+	_ = viper.BindEnv("OutboxRelayInterval", "OUTBOX_RELAY_INTERVAL")
+
+	// Delay between two checks of all CouchDB databases for events not published yet (e.g. by a stopped instance)
+	viper.SetDefault("OutboxScanInterval", "1h")
+	_ = viper.BindEnv("OutboxScanInterval", "OUTBOX_SCAN_INTERVAL")
+
+	// Asset types served by the service (comma separated list, e.g. comment,worknote,resolution_note)
+	viper.SetDefault("AssetTypes", "comment,worknote")
+	_ = viper.BindEnv("AssetTypes", "ASSET_TYPES")
+
+	// Entity kinds allowed by default and per channel with the format of their IDs ("uuid" or regular expression)
+	viper.SetDefault("EntityTypes", `{"default":{"incident":"uuid","request":"uuid","k_request":"uuid"}}`)
+	_ = viper.BindEnv("EntityTypes", "ENTITY_TYPES")
+
 	// Tracing service
 	viper.SetDefault("TracingCollectorEndpoint", "http://zipkin.tracing:9411/api/v2/spans")
 	_ = viper.BindEnv("TracingCollectorEndpoint", "TRACING_COLLECTOR_ENDPOINT")
@@ -11,15 +11,21 @@ import (
 
 	"github.com/KompiTech/go-toolkit/natswatcher"
 	"github.com/KompiTech/go-toolkit/tracing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/locking"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/templating"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/upserting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
-	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	dbvalidation "github.com/KompiTech/itsm-commenting-service/pkg/repository/validation"
 	"github.com/google/uuid"
 	"github.com/opentracing/opentracing-go"
 	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
@@ -37,10 +43,22 @@ func main() {
 
 	loadEnvConfiguration()
 
+	// Asset types registry
+	assetTypes, err := comment.ParseAssetTypes(viper.GetString("AssetTypes"))
+	if err != nil {
+		logger.Fatal("could not load asset types configuration", zap.Error(err))
+	}
+
+	// Entity types registry
+	entityTypes, err := entity.ParseRegistry(viper.GetString("EntityTypes"))
+	if err != nil {
+		logger.Fatal("could not load entity types configuration", zap.Error(err))
+	}
+
 	// DB schema validator
-	v, err := couchdb.NewValidator()
+	v, err := dbvalidation.NewValidator()
 	if err != nil {
-		logger.Fatal("could not create couchDB validation service", zap.Error(err))
+		logger.Fatal("could not create DB schema validation service", zap.Error(err))
 	}
 
 	// NATS client for event service
@@ -61,16 +79,11 @@ func main() {
 		logger.Fatal("could not create NATS client", zap.Error(err))
 	}
 
-	// Couch DB
-	s := couchdb.NewStorage(context.Background(), logger, couchdb.Config{
-		CaPath:       viper.GetString("CouchDBCaPath"),
-		Host:         viper.GetString("CouchDBHost"),
-		Port:         viper.GetString("CouchDBPort"),
-		Username:     viper.GetString("CouchDBUsername"),
-		Passwd:       viper.GetString("CouchDBPasswd"),
-		Validator:    v,
-		EventService: event.NewService(nc),
-	})
+	// Repository backend (Couch DB or SQLite)
+	s, closeStorage, err := newStorage(logger)
+	if err != nil {
+		logger.Fatal("could not create storage", zap.Error(err))
+	}
 
 	// User service fetches user data from external service
 	userService, err := usersvc.NewService()
@@ -81,9 +94,33 @@ func main() {
 	// Auth service provides ACL functionality
 	authService := auth.NewService(logger)
 
-	adder := adding.NewService(s)
+	// Event service prepares events of comment changes stored to the outbox with them
+	events := event.NewService(nc)
+
+	// Outbox relay publishes stored events to NATS
+	relay := event.NewRelay(logger, event.RelayConfig{
+		Client:   nc,
+		Outbox:   s,
+		Interval: viper.GetDuration("OutboxRelayInterval"),
+	})
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayStopped := make(chan struct{})
+	go func() {
+		relay.Run(relayCtx)
+		close(relayStopped)
+	}()
+
+	adder := adding.NewService(s, adding.Config{Validator: v, EventService: events})
 	lister := listing.NewService(s)
-	updater := updating.NewService(s)
+	updater := updating.NewService(s, updating.Config{
+		Validator:        v,
+		EventService:     events,
+		MaxPinsPerEntity: viper.GetInt("MaxPinsPerEntity"),
+	})
+	deleter := deleting.NewService(s, deleting.Config{Validator: v, EventService: events})
+	upserter := upserting.NewService(s, adder, updater)
+	locker := locking.NewService(s)
+	templater := templating.NewService(s)
 
 	// Request payload validator
 	pv, err := validation.NewPayloadValidator()
@@ -93,17 +130,26 @@ func main() {
 
 	// HTTP server
 	server := rest.NewServer(rest.Config{
-		Addr:                    viper.GetString("HTTPBindAddress"),
-		URISchema:               "http://",
-		Logger:                  logger,
-		AuthService:             authService,
-		UserService:             userService,
-		AddingService:           adder,
-		ListingService:          lister,
-		UpdatingService:         updater,
-		RepositoryService:       s,
-		PayloadValidator:        pv,
-		ExternalLocationAddress: viper.GetString("ExternalLocationAddress"),
+		Addr:                      viper.GetString("HTTPBindAddress"),
+		URISchema:                 "http://",
+		AssetTypes:                assetTypes,
+		EntityTypes:               entityTypes,
+		Logger:                    logger,
+		AuthService:               authService,
+		UserService:               userService,
+		AddingService:             adder,
+		ListingService:            lister,
+		UpdatingService:           updater,
+		DeletingService:           deleter,
+		UpsertingService:          upserter,
+		LockingService:            locker,
+		TemplatingService:         templater,
+		RepositoryService:         s,
+		IdempotencyService:        s,
+		IdempotencyKeyTTL:         viper.GetDuration("IdempotencyKeyTTL"),
+		IdempotencyPendingTimeout: viper.GetDuration("IdempotencyPendingTimeout"),
+		PayloadValidator:          pv,
+		ExternalLocationAddress:   viper.GetString("ExternalLocationAddress"),
 	})
 
 	{ // Setup tracing
@@ -147,6 +193,11 @@ func main() {
 		}
 		logger.Info("HTTP server shutdown finished successfully")
 
+		// Stop publishing events, events not published yet are kept in the outbox
+		logger.Info("stopping outbox relay")
+		stopRelay()
+		<-relayStopped
+
 		// Close connection to external user service
 		logger.Info("closing UserService client")
 		if err := userService.Close(); err != nil {
@@ -161,7 +212,7 @@ func main() {
 
 		// Close database client
 		logger.Info("closing database client")
-		if err := s.Client().Close(context.Background()); err != nil {
+		if err := closeStorage(); err != nil {
 			logger.Error("error closing database client", zap.Error(err))
 		}
 
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/locking"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/templating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/sqlite"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// storage is the repository backend used by all domain services and the HTTP server
+type storage interface {
+	adding.Repository
+	listing.Repository
+	updating.Repository
+	deleting.Repository
+	locking.Repository
+	templating.Repository
+	repository.Service
+	repository.IdempotencyService
+	event.Outbox
+}
+
+// newStorage creates the repository backend selected by Storage configuration ("couchdb" or "sqlite")
+// and returns it with the function closing its database client
+func newStorage(logger *zap.Logger) (storage, func() error, error) {
+	switch backend := viper.GetString("Storage"); backend {
+	case "couchdb":
+		s := couchdb.NewStorage(context.Background(), logger, couchdb.Config{
+			CaPath:             viper.GetString("CouchDBCaPath"),
+			Host:               viper.GetString("CouchDBHost"),
+			Port:               viper.GetString("CouchDBPort"),
+			Username:           viper.GetString("CouchDBUsername"),
+			Passwd:             viper.GetString("CouchDBPasswd"),
+			ConflictRetries:    viper.GetInt("ConflictRetries"),
+			OutboxScanInterval: viper.GetDuration("OutboxScanInterval"),
+		})
+
+		return s, func() error { return s.Client().Close(context.Background()) }, nil
+	case "sqlite":
+		s, err := sqlite.NewStorage(context.Background(), logger, sqlite.Config{
+			Path: viper.GetString("SQLitePath"),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s, s.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage '%s' (expected couchdb or sqlite)", backend)
+	}
+}
@@ -677,4 +677,236 @@ var _ = Describe("Comments API calls", func() {
 			})
 		})
 	})
+
+	Describe("PATCH /comments/{uuid}", func() {
+		var resp *http.Response
+		var uuid string
+		var payload []byte
+
+		BeforeEach(func() {
+			destroyTestDatabases(storage)
+			createTestDatabases()
+			payload = []byte(`{"text": "Edited comment"}`)
+		})
+
+		JustBeforeEach(func() {
+			By("request creation")
+			req, err := http.NewRequest(http.MethodPatch, server.URL+"/comments/"+uuid, bytes.NewReader(payload))
+			Expect(err).To(BeNil())
+			req.Header.Set("grpc-metadata-space", testChannelID)
+			req.Header.Set("authorization", bearerToken)
+
+			By("calling the endpoint")
+			c := http.Client{}
+			resp, err = c.Do(req)
+			Expect(err).To(BeNil())
+		})
+
+		When("comment with specified UUID does not exist", func() {
+			BeforeEach(func() {
+				uuid = "95f2af46-0a40-463e-b2c2-87ecd77a825c"
+			})
+
+			It("should return 'Not Found' error response", func() {
+				Expect(resp).To(HaveHTTPStatus(http.StatusNotFound))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(BeNil())
+				Expect(body).To(MatchJSON(`{"error": "Comment with uuid='95f2af46-0a40-463e-b2c2-87ecd77a825c' does not exist"}`))
+			})
+		})
+
+		When("comment exists", func() {
+			BeforeEach(func() {
+				uuid = createComment([]byte(`{
+					"entity":"request:cdfe52ca-0b7a-4afe-ae8d-ccb1446eae4a",
+					"text": "Comment with tpyo"
+				}`))
+			})
+
+			It("should return updated comment", func() {
+				Expect(resp).To(HaveHTTPStatus(http.StatusOK))
+				Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(BeNil())
+
+				bodyMap := mapFromJSON(body)
+				Expect(bodyMap).To(HaveKeyWithValue("uuid", uuid))
+				Expect(bodyMap).To(HaveKeyWithValue("text", "Edited comment"))
+				Expect(bodyMap["history"]).To(HaveLen(1))
+			})
+
+			Describe("comment history", func() {
+				var historyResp *http.Response
+
+				JustBeforeEach(func() {
+					req, err := http.NewRequest(http.MethodGet, server.URL+"/comments/"+uuid+"/history", nil)
+					Expect(err).To(BeNil())
+					req.Header.Set("grpc-metadata-space", testChannelID)
+					req.Header.Set("authorization", bearerToken)
+
+					c := http.Client{}
+					historyResp, err = c.Do(req)
+					Expect(err).To(BeNil())
+				})
+
+				It("should contain the original text", func() {
+					Expect(historyResp).To(HaveHTTPStatus(http.StatusOK))
+
+					body, err := ioutil.ReadAll(historyResp.Body)
+					Expect(err).To(BeNil())
+
+					bodyMap := mapFromJSON(body)
+					Expect(bodyMap["result"]).To(HaveLen(1))
+
+					entry := bodyMap["result"].([]interface{})[0]
+					Expect(entry).To(HaveKeyWithValue("text", "Comment with tpyo"))
+					Expect(entry).To(HaveKey("edited_at"))
+
+					editedBy, err := json.Marshal(entry.(map[string]interface{})["edited_by"])
+					Expect(err).To(BeNil())
+
+					Expect(editedBy).To(MatchJSON(expectedMockUserJSON))
+				})
+			})
+		})
+	})
+
+	Describe("DELETE /comments/{uuid}", func() {
+		var resp *http.Response
+		var uuid string
+
+		BeforeEach(func() {
+			destroyTestDatabases(storage)
+			createTestDatabases()
+		})
+
+		JustBeforeEach(func() {
+			By("request creation")
+			req, err := http.NewRequest(http.MethodDelete, server.URL+"/comments/"+uuid, nil)
+			Expect(err).To(BeNil())
+			req.Header.Set("grpc-metadata-space", testChannelID)
+			req.Header.Set("authorization", bearerToken)
+
+			By("calling the endpoint")
+			c := http.Client{}
+			resp, err = c.Do(req)
+			Expect(err).To(BeNil())
+		})
+
+		When("comment with specified UUID does not exist", func() {
+			BeforeEach(func() {
+				uuid = "95f2af46-0a40-463e-b2c2-87ecd77a825c"
+			})
+
+			It("should return 'Not Found' error response", func() {
+				Expect(resp).To(HaveHTTPStatus(http.StatusNotFound))
+			})
+		})
+
+		When("comment exists", func() {
+			BeforeEach(func() {
+				uuid = createComment([]byte(`{
+					"entity":"request:cdfe52ca-0b7a-4afe-ae8d-ccb1446eae4a",
+					"text": "Comment to be deleted"
+				}`))
+			})
+
+			It("should mark the comment as deleted", func() {
+				Expect(resp).To(HaveHTTPStatus(http.StatusNoContent))
+
+				req, err := http.NewRequest(http.MethodGet, server.URL+"/comments/"+uuid, nil)
+				Expect(err).To(BeNil())
+				req.Header.Set("grpc-metadata-space", testChannelID)
+				req.Header.Set("authorization", bearerToken)
+
+				c := http.Client{}
+				getResp, err := c.Do(req)
+				Expect(err).To(BeNil())
+
+				body, err := ioutil.ReadAll(getResp.Body)
+				Expect(err).To(BeNil())
+
+				bodyMap := mapFromJSON(body)
+				Expect(bodyMap).To(HaveKey("deleted_at"))
+				Expect(bodyMap).To(HaveKey("deleted_by"))
+			})
+
+			Describe("comment restoration", func() {
+				var restoreResp *http.Response
+
+				JustBeforeEach(func() {
+					req, err := http.NewRequest(http.MethodPost, server.URL+"/comments/"+uuid+"/restore", nil)
+					Expect(err).To(BeNil())
+					req.Header.Set("grpc-metadata-space", testChannelID)
+					req.Header.Set("authorization", bearerToken)
+
+					c := http.Client{}
+					restoreResp, err = c.Do(req)
+					Expect(err).To(BeNil())
+				})
+
+				It("should return restored comment", func() {
+					Expect(restoreResp).To(HaveHTTPStatus(http.StatusOK))
+
+					body, err := ioutil.ReadAll(restoreResp.Body)
+					Expect(err).To(BeNil())
+
+					bodyMap := mapFromJSON(body)
+					Expect(bodyMap).To(HaveKeyWithValue("uuid", uuid))
+					Expect(bodyMap).NotTo(HaveKey("deleted_at"))
+					Expect(bodyMap).To(HaveKey("restored_at"))
+					Expect(bodyMap).To(HaveKey("restored_by"))
+				})
+			})
+		})
+	})
+
+	Describe("GET /comments/{uuid}/replies", func() {
+		var resp *http.Response
+		var parentUUID string
+
+		BeforeEach(func() {
+			destroyTestDatabases(storage)
+			createTestDatabases()
+
+			parentUUID = createComment([]byte(`{
+				"entity":"request:cdfe52ca-0b7a-4afe-ae8d-ccb1446eae4a",
+				"text": "Agent question"
+			}`))
+			createComment([]byte(`{
+				"entity":"request:cdfe52ca-0b7a-4afe-ae8d-ccb1446eae4a",
+				"text": "Customer answer",
+				"parent_uuid": "` + parentUUID + `"
+			}`))
+		})
+
+		JustBeforeEach(func() {
+			By("request creation")
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/comments/"+parentUUID+"/replies", nil)
+			Expect(err).To(BeNil())
+			req.Header.Set("grpc-metadata-space", testChannelID)
+			req.Header.Set("authorization", bearerToken)
+
+			By("calling the endpoint")
+			c := http.Client{}
+			resp, err = c.Do(req)
+			Expect(err).To(BeNil())
+		})
+
+		It("should return replies to the comment", func() {
+			Expect(resp).To(HaveHTTPStatus(http.StatusOK))
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+
+			bodyMap := mapFromJSON(body)
+			Expect(bodyMap["result"]).To(HaveLen(1))
+
+			reply := bodyMap["result"].([]interface{})[0]
+			Expect(reply).To(HaveKeyWithValue("text", "Customer answer"))
+			Expect(reply).To(HaveKeyWithValue("parent_uuid", parentUUID))
+		})
+	})
 })
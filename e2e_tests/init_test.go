@@ -53,20 +53,27 @@ func NewMsgQueue(nc *natswatcher.Watcher) (*MsgQueue, error) {
 	return q, err
 }
 
-// LastEvents returns events array from the last published NATS message and clears the queue
+// LastEvents waits for a NATS message published by the outbox relay and returns events array from the last one
+// and clears the queue
 func (q *MsgQueue) LastEvents() []map[string]interface{} {
+	Eventually(q.len).ShouldNot(BeZero())
+
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	if len(q.messages) == 0 {
-		return nil
-	}
-
 	events := q.messages[len(q.messages)-1].Events
 	q.Clear()
 	return events
 }
 
+// len returns the number of messages in the queue
+func (q *MsgQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.messages)
+}
+
 // Clear removes all messages from the queue
 func (q *MsgQueue) Clear() {
 	q.messages = nil
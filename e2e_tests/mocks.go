@@ -6,6 +6,7 @@ import (
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -66,3 +67,18 @@ func (s *UserServiceStub) UserBasicInfo(r *http.Request) (user.BasicInfo, error)
 	}
 	return mockUserData, nil
 }
+
+// UserInfo returns info about user with specified UUID
+func (s *UserServiceStub) UserInfo(r *http.Request, uuid string) (user.BasicInfo, error) {
+	if r.Header.Get("authorization") == "" {
+		return user.BasicInfo{}, status.Error(codes.Unauthenticated, "user service failed - missing authorization token")
+	}
+
+	for _, u := range []user.BasicInfo{mockUserData, mockOnBehalfUserData} {
+		if u.UUID == uuid {
+			return u, nil
+		}
+	}
+
+	return user.BasicInfo{}, usersvc.ErrUserNotFound
+}
@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/repositorytest"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"go.uber.org/zap"
+)
+
+// TestRepositoryConformance runs the repository conformance suite against CouchDB,
+// the in-memory and SQLite repositories run the same suite in their unit tests
+func TestRepositoryConformance(t *testing.T) {
+	logger, cfg := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	loadTestConfiguration()
+
+	storage := newCouchDBStorage(logger, cfg)
+
+	repositorytest.Run(t, storage, func(channelID string) {
+		destroyChannelDatabases(logger, storage, channelID)
+	})
+}
+
+// destroyChannelDatabases deletes all databases of the channel
+func destroyChannelDatabases(logger *zap.Logger, storage *couchdb.DBStorage, channelID string) {
+	c := storage.Client()
+
+	dbs, err := c.AllDBs(context.TODO())
+	if err != nil {
+		logger.Warn("AllDBs", zap.Error(err))
+		return
+	}
+
+	for _, db := range dbs {
+		if !strings.HasPrefix(db, "p_"+channelID+"_") {
+			continue
+		}
+
+		if err := c.DestroyDB(context.TODO(), db); err != nil {
+			logger.Warn("DestroyDB "+db, zap.Error(err))
+		}
+	}
+}
@@ -3,15 +3,21 @@ package e2e
 import (
 	"context"
 	"net/http/httptest"
+	"time"
 
 	"github.com/KompiTech/go-toolkit/natswatcher"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/locking"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/templating"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/upserting"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	dbvalidation "github.com/KompiTech/itsm-commenting-service/pkg/repository/validation"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
@@ -29,12 +35,64 @@ func StartServer() (*httptest.Server, *couchdb.DBStorage, *natswatcher.Watcher)
 	as := new(AuthServiceStub)
 	us := new(UserServiceStub)
 
+	loadTestConfiguration()
+
+	nc := newNATSClient(logger)
+	storage := newCouchDBStorage(logger, cfg)
+
 	// DB schema validator
-	v, err := couchdb.NewValidator()
+	v, err := dbvalidation.NewValidator()
+	if err != nil {
+		panic(err)
+	}
+
+	events := event.NewService(nc)
+
+	// events are published shortly after the response
+	relay := event.NewRelay(logger, event.RelayConfig{Client: nc, Outbox: storage, Interval: 10 * time.Millisecond})
+	go relay.Run(context.Background())
+
+	adder := adding.NewService(storage, adding.Config{Validator: v, EventService: events})
+	lister := listing.NewService(storage)
+	updater := updating.NewService(storage, updating.Config{Validator: v, EventService: events})
+	deleter := deleting.NewService(storage, deleting.Config{Validator: v, EventService: events})
+	upserter := upserting.NewService(storage, adder, updater)
+	locker := locking.NewService(storage)
+	templater := templating.NewService(storage)
+
+	pv, err := validation.NewPayloadValidator()
 	if err != nil {
 		panic(err)
 	}
 
+	server := rest.NewServer(rest.Config{
+		Logger:             logger,
+		AuthService:        as,
+		UserService:        us,
+		AddingService:      adder,
+		ListingService:     lister,
+		UpdatingService:    updater,
+		DeletingService:    deleter,
+		UpsertingService:   upserter,
+		LockingService:     locker,
+		TemplatingService:  templater,
+		RepositoryService:  storage,
+		IdempotencyService: storage,
+		PayloadValidator:   pv,
+	})
+
+	s := httptest.NewUnstartedServer(server)
+
+	// set address of the newly started listener to original handler
+	server.Addr = s.Listener.Addr().String()
+	server.ExternalLocationAddress = "http://" + server.Addr
+	s.Start()
+
+	return s, storage, nc
+}
+
+// loadTestConfiguration loads configuration of CouchDB and NATS used by the tests
+func loadTestConfiguration() {
 	// Couch DB - configuration for tests
 	viper.SetDefault("CouchDBHost", "localhost")
 	_ = viper.BindEnv("CouchDBHost", "TEST_COUCHDB_HOST")
@@ -50,8 +108,10 @@ func StartServer() (*httptest.Server, *couchdb.DBStorage, *natswatcher.Watcher)
 	_ = viper.BindEnv("NATSQueueAddress", "TEST_NATS_QUEUE_ADDRESS")
 	viper.SetDefault("NATSQueuePort", "4222")
 	_ = viper.BindEnv("NATSQueuePort", "TEST_NATS_QUEUE_PORT")
+}
 
-	// NATS client for event service
+// newNATSClient returns NATS client for event service
+func newNATSClient(logger *zap.Logger) *natswatcher.Watcher {
 	nc, err := natswatcher.NewWatcher(&natswatcher.Config{
 		NATS: natswatcher.NatsConfig{
 			Address: viper.GetString("NATSQueueAddress"),
@@ -64,48 +124,20 @@ func StartServer() (*httptest.Server, *couchdb.DBStorage, *natswatcher.Watcher)
 		logger.Fatal("could not create NATS client", zap.Error(err))
 	}
 
+	return nc
+}
+
+// newCouchDBStorage returns storage connected to the test CouchDB
+func newCouchDBStorage(logger *zap.Logger, cfg *zap.Config) *couchdb.DBStorage {
 	// set log level for couchDB initialization to see log output
 	origLevel := cfg.Level.Level()
 	cfg.Level.SetLevel(zap.InfoLevel)
+	defer cfg.Level.SetLevel(origLevel) // restore orig log level
 
-	// Couch DB
-	storage := couchdb.NewStorage(context.Background(), logger, couchdb.Config{
-		Host:         viper.GetString("CouchDBHost"),
-		Port:         viper.GetString("CouchDBPort"),
-		Username:     viper.GetString("CouchDBUsername"),
-		Passwd:       viper.GetString("CouchDBPasswd"),
-		Validator:    v,
-		EventService: event.NewService(nc),
+	return couchdb.NewStorage(context.Background(), logger, couchdb.Config{
+		Host:     viper.GetString("CouchDBHost"),
+		Port:     viper.GetString("CouchDBPort"),
+		Username: viper.GetString("CouchDBUsername"),
+		Passwd:   viper.GetString("CouchDBPasswd"),
 	})
-
-	cfg.Level.SetLevel(origLevel) // restore orig log level
-
-	adder := adding.NewService(storage)
-	lister := listing.NewService(storage)
-	updater := updating.NewService(storage)
-
-	pv, err := validation.NewPayloadValidator()
-	if err != nil {
-		panic(err)
-	}
-
-	server := rest.NewServer(rest.Config{
-		Logger:            logger,
-		AuthService:       as,
-		UserService:       us,
-		AddingService:     adder,
-		ListingService:    lister,
-		UpdatingService:   updater,
-		RepositoryService: storage,
-		PayloadValidator:  pv,
-	})
-
-	s := httptest.NewUnstartedServer(server)
-
-	// set address of the newly started listener to original handler
-	server.Addr = s.Listener.Addr().String()
-	server.ExternalLocationAddress = "http://" + server.Addr
-	s.Start()
-
-	return s, storage, nc
 }
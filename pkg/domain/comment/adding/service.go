@@ -2,31 +2,158 @@ package adding
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 )
 
 // Service provides comment adding operations
 type Service interface {
-	// AddComment adds the given comment to the repository
+	// AddComment adds the given comment to the repository,
+	// it fails with *comment.ThreadLockedError if the entity thread is locked for the asset type
+	// and with 400 Bad Request if the parent of the reply does not exist, is deleted or belongs to a different entity.
+	// The comment with external ID gets UUID derived from the entity and the external ID (see repository.ExternalUUID),
+	// so adding another comment with the same external ID to the entity fails with 409 Conflict.
 	AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType) (comment *comment.Comment, err error)
 }
 
 // Repository provides adding functionality to the comments repository
 type Repository interface {
-	// AddComment persists the given comment to the repository
-	AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType) (comment *comment.Comment, err error)
+	// AddComment persists the given comment (with UUID and created_at already set) to the repository,
+	// it fails with 409 Conflict if the comment with the same UUID already exists. Events function (if not nil)
+	// returns the message of events of the new comment, it is stored to the outbox together with the comment.
+	AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, events func(c comment.Comment) (*event.Message, error)) (comment *comment.Comment, err error)
+
+	// GetComment returns the comment with specified ID, it fails with 404 Not Found if the comment does not exist
+	GetComment(ctx context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error)
+
+	// GetThreadLock returns the lock of the entity thread or nil if the thread is not locked
+	GetThreadLock(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (*comment.ThreadLock, error)
+}
+
+// Config contains dependencies of the adding service
+type Config struct {
+	// Validator validates new comments before they are stored, they are not validated if it is nil
+	Validator comment.Validator
+	// EventService prepares events of new comments stored to the outbox, there are no events if it is nil
+	EventService event.Service
+	// Rand is the source of UUIDs of new comments (crypto/rand if nil)
+	Rand io.Reader
+	// Clock provides creation time of new comments (system time if nil)
+	Clock comment.Clock
 }
 
 // NewService creates an adding service
-func NewService(r Repository) Service {
-	return &service{r}
+func NewService(r Repository, cfg Config) Service {
+	return &service{
+		r:         r,
+		validator: cfg.Validator,
+		events:    cfg.EventService,
+		rand:      cfg.Rand,
+		clock:     cfg.Clock,
+	}
 }
 
 type service struct {
-	r Repository
+	r         Repository
+	validator comment.Validator
+	events    event.Service
+	rand      io.Reader
+	clock     comment.Clock
 }
 
 func (s *service) AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
-	return s.r.AddComment(ctx, c, channelID, assetType)
+	lock, err := s.r.GetThreadLock(ctx, c.Entity, channelID, assetType)
+	if err != nil {
+		return nil, err
+	}
+
+	if lock != nil {
+		return nil, &comment.ThreadLockedError{Lock: *lock, AssetType: assetType}
+	}
+
+	if c.ExternalID != "" {
+		c.UUID = repository.ExternalUUID(c.Entity, c.ExternalID)
+	} else {
+		uuid, err := repository.GenerateUUID(s.rand)
+		if err != nil {
+			return nil, err
+		}
+
+		c.UUID = uuid
+	}
+
+	c.CreatedAt = comment.Timestamp(s.clock)
+
+	if s.validator != nil {
+		if err := s.validator.Validate(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ParentUUID != "" {
+		if err := s.assertParent(ctx, c, channelID, assetType); err != nil {
+			return nil, err
+		}
+	}
+
+	added, err := s.r.AddComment(ctx, c, channelID, assetType, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, c.CreatedBy.OrgID(), func(q event.Queue) error {
+			if err := q.AddCreateEvent(c, assetType); err != nil {
+				return err
+			}
+
+			for _, mentioned := range c.Mentions {
+				if err := q.AddMentionEvent(c, mentioned, assetType); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+
+	var repoErr *repository.Error
+	if c.ExternalID != "" && errors.As(err, &repoErr) && repoErr.StatusCode() == http.StatusConflict {
+		reason := fmt.Sprintf("%s with external_id='%s' already exists for entity '%s' (uuid='%s')", assetType, c.ExternalID, c.Entity, c.UUID)
+		return nil, repository.NewError(fmt.Sprintf("%s could not be added: %s", strings.Title(assetType.String()), reason), http.StatusConflict)
+	}
+
+	return added, err
+}
+
+// assertParent returns error if the parent of the reply does not exist, is deleted or belongs to a different entity
+func (s *service) assertParent(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType) error {
+	title := strings.Title(assetType.String())
+
+	parent, err := s.r.GetComment(ctx, c.ParentUUID, channelID, assetType)
+
+	var repoErr *repository.Error
+	if errors.As(err, &repoErr) && repoErr.StatusCode() == http.StatusNotFound {
+		eMsg := fmt.Sprintf("%s could not be added: parent %s with uuid='%s' does not exist", title, assetType, c.ParentUUID)
+		return repository.NewError(eMsg, http.StatusBadRequest)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if parent.IsDeleted() {
+		eMsg := fmt.Sprintf("%s could not be added: parent %s with uuid='%s' is deleted", title, assetType, c.ParentUUID)
+		return repository.NewError(eMsg, http.StatusBadRequest)
+	}
+
+	if parent.Entity.String() != c.Entity.String() {
+		eMsg := fmt.Sprintf("%s could not be added: parent %s with uuid='%s' belongs to different entity", title, assetType, c.ParentUUID)
+		return repository.NewError(eMsg, http.StatusBadRequest)
+	}
+
+	return nil
 }
@@ -2,14 +2,21 @@ package adding_test
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,10 +42,11 @@ func TestAddCommentService(t *testing.T) {
 		Clock: clock,
 	}
 
-	adder := adding.NewService(mockStorage)
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
 	assetType := comment.AssetTypeComment
 
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	testutils.CreateDatabases(t, mockStorage, channelID)
 
 	ctx := context.Background()
 
@@ -51,3 +59,175 @@ func TestAddCommentService(t *testing.T) {
 	comments := mockStorage.GetAllComments()
 	assert.Len(t, comments, 2)
 }
+
+func TestAddCommentServiceIdentity(t *testing.T) {
+	c := comment.Comment{
+		Text:   "Test 1",
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+	}
+
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{}
+	testutils.CreateDatabases(t, mockStorage, "e27ddcd0-0e1f-4bc5-93df-f6f04155beec")
+
+	// rand is used as deterministic UUID generator
+	rand := strings.NewReader("81aa058d-0b19-43e9-82ae-a7bca2457f10")
+	adder := adding.NewService(mockStorage, adding.Config{Rand: rand, Clock: clock})
+
+	added, err := adder.AddComment(context.Background(), c, "e27ddcd0-0e1f-4bc5-93df-f6f04155beec", comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Equal(t, "38316161-3035-4864-ad30-6231392d3433", added.UUID)
+	assert.Equal(t, clock.NowFormatted(), added.CreatedAt)
+}
+
+func TestAddCommentServiceValidation(t *testing.T) {
+	c := comment.Comment{
+		Text:   "Test 1",
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+	}
+
+	validator := new(mocks.ValidatorMock)
+	validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(errors.New("invalid comment"))
+
+	mockStorage := &memory.Storage{}
+	testutils.CreateDatabases(t, mockStorage, "e27ddcd0-0e1f-4bc5-93df-f6f04155beec")
+	adder := adding.NewService(mockStorage, adding.Config{Validator: validator})
+
+	_, err := adder.AddComment(context.Background(), c, "e27ddcd0-0e1f-4bc5-93df-f6f04155beec", comment.AssetTypeComment)
+	assert.EqualError(t, err, "invalid comment")
+	assert.Empty(t, mockStorage.GetAllComments())
+}
+
+func TestAddCommentServiceEvents(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+
+	mentioned := comment.UserInfo{UUID: "12a0c65d-6efc-4346-b39b-a84cc0384c28", Name: "Alice", Surname: "Cooper"}
+	c := comment.Comment{
+		Text:   "Test 1",
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		CreatedBy: &comment.UserInfo{
+			UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e", Name: "Bob", Surname: "Martin", OrgName: orgID + ".kompitech.com",
+		},
+		Mentions: []comment.UserInfo{mentioned},
+	}
+
+	t.Run("events are stored to the outbox", func(t *testing.T) {
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), comment.AssetTypeComment).Return(nil)
+		queue.On("AddMentionEvent", mock.AnythingOfType("comment.Comment"), mentioned, comment.AssetTypeComment).Return(nil)
+		queue.On("Message").Return(&event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil)
+
+		mockStorage := &memory.Storage{}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		adder := adding.NewService(mockStorage, adding.Config{EventService: events})
+
+		_, err := adder.AddComment(context.Background(), c, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+		assert.Len(t, mockStorage.GetAllComments(), 1)
+		assert.Equal(t, []event.Message{*&event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}}, mockStorage.GetOutboxMessages())
+
+		mock.AssertExpectationsForObjects(t, events, queue)
+	})
+
+	t.Run("comment is not stored if events are not prepared", func(t *testing.T) {
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), comment.AssetTypeComment).Return(nil)
+		queue.On("AddMentionEvent", mock.AnythingOfType("comment.Comment"), mentioned, comment.AssetTypeComment).Return(nil)
+		queue.On("Message").Return(nil, errors.New("invalid event data"))
+
+		mockStorage := &memory.Storage{}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		adder := adding.NewService(mockStorage, adding.Config{EventService: events})
+
+		_, err := adder.AddComment(context.Background(), c, channelID, comment.AssetTypeComment)
+		assert.EqualError(t, err, "could not prepare events: invalid event data")
+		assert.Empty(t, mockStorage.GetAllComments())
+		assert.Empty(t, mockStorage.GetOutboxMessages())
+	})
+}
+
+func TestAddCommentServiceLockedThread(t *testing.T) {
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	c := comment.Comment{
+		Text:   "Test 1",
+		Entity: e,
+	}
+
+	mockStorage := &memory.Storage{
+		Clock: testutils.FixedClock{},
+	}
+
+	adder := adding.NewService(mockStorage, adding.Config{Clock: testutils.FixedClock{}})
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	testutils.CreateDatabases(t, mockStorage, channelID)
+
+	ctx := context.Background()
+
+	_, err := mockStorage.LockThread(ctx, comment.ThreadLock{Entity: e, Reason: "Incident is closed"}, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	_, err = adder.AddComment(ctx, c, channelID, comment.AssetTypeComment)
+	var lockedError *comment.ThreadLockedError
+	require.True(t, errors.As(err, &lockedError))
+	assert.EqualError(t, err, "Comment could not be added: comments of entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444' are locked (Incident is closed)")
+	assert.Empty(t, mockStorage.GetAllComments())
+
+	// worknotes stay open while comments are locked
+	_, err = adder.AddComment(ctx, c, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.Len(t, mockStorage.GetAllComments(), 1)
+}
+
+func TestAddCommentServiceReply(t *testing.T) {
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	assetType := comment.AssetTypeComment
+	ctx := context.Background()
+
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
+
+	parent, err := adder.AddComment(ctx, comment.Comment{Text: "Parent", Entity: e}, channelID, assetType)
+	require.NoError(t, err)
+
+	reply, err := adder.AddComment(ctx, comment.Comment{Text: "Reply", Entity: e, ParentUUID: parent.UUID}, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, parent.UUID, reply.ParentUUID)
+
+	_, err = adder.AddComment(ctx, comment.Comment{Text: "Reply", Entity: e, ParentUUID: parent.UUID}, channelID, comment.AssetTypeWorknote)
+	assert.EqualError(t, err, "Worknote could not be added: parent worknote with uuid='"+parent.UUID+"' does not exist")
+	assertStatusCode(t, http.StatusBadRequest, err)
+
+	another := entity.NewEntity("request", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	_, err = adder.AddComment(ctx, comment.Comment{Text: "Reply", Entity: another, ParentUUID: parent.UUID}, channelID, assetType)
+	assert.EqualError(t, err, "Comment could not be added: parent comment with uuid='"+parent.UUID+"' belongs to different entity")
+	assertStatusCode(t, http.StatusBadRequest, err)
+
+	_, _, err = mockStorage.UpdateComment(ctx, parent.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		c.DeletedAt = clock.NowFormatted()
+		return true, nil
+	}, nil)
+	require.NoError(t, err)
+
+	_, err = adder.AddComment(ctx, comment.Comment{Text: "Reply", Entity: e, ParentUUID: parent.UUID}, channelID, assetType)
+	assert.EqualError(t, err, "Comment could not be added: parent comment with uuid='"+parent.UUID+"' is deleted")
+	assertStatusCode(t, http.StatusBadRequest, err)
+
+	assert.Len(t, mockStorage.GetAllComments(), 2)
+}
+
+func assertStatusCode(t *testing.T, expected int, err error) {
+	t.Helper()
+
+	var repoErr *repository.Error
+	require.ErrorAs(t, err, &repoErr)
+	assert.Equal(t, expected, repoErr.StatusCode())
+}
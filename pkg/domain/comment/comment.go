@@ -1,12 +1,15 @@
 package comment
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 )
 
-// AssetType represents the type of the asset (comment/worknote
+// AssetType represents the type of the asset (comment/worknote/...)
 type AssetType string
 
 // Asset types definitions
@@ -19,6 +22,71 @@ func (a AssetType) String() string {
 	return string(a)
 }
 
+// Plural returns plural form of the asset type used in routes and database names (e.g. worknotes)
+func (a AssetType) Plural() string {
+	return fmt.Sprintf("%ss", a)
+}
+
+// Title returns asset type name in camel case used in action and link names (e.g. ResolutionNote)
+func (a AssetType) Title() string {
+	var b strings.Builder
+	for _, part := range strings.Split(string(a), "_") {
+		b.WriteString(strings.Title(part))
+	}
+
+	return b.String()
+}
+
+// assetTypeRegex restricts asset type names so they are usable in routes and CouchDB database names
+var assetTypeRegex = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// reservedAssetType cannot be registered as its plural form names the database of comment templates
+const reservedAssetType AssetType = "template"
+
+// AssetTypeRegistry is the list of asset types served by the service
+type AssetTypeRegistry []AssetType
+
+// DefaultAssetTypes returns registry with built-in asset types (comment and worknote)
+func DefaultAssetTypes() AssetTypeRegistry {
+	return AssetTypeRegistry{AssetTypeComment, AssetTypeWorknote}
+}
+
+// ParseAssetTypes creates asset type registry from comma separated list of names (e.g. "comment,worknote,resolution_note")
+func ParseAssetTypes(s string) (AssetTypeRegistry, error) {
+	var registry AssetTypeRegistry
+
+	for _, name := range strings.Split(s, ",") {
+		assetType := AssetType(strings.TrimSpace(name))
+
+		if !assetTypeRegex.MatchString(assetType.String()) {
+			return nil, fmt.Errorf("invalid asset type name '%s', only lowercase letters, digits and underscores are allowed", assetType)
+		}
+
+		if assetType == reservedAssetType {
+			return nil, fmt.Errorf("asset type name '%s' is reserved", assetType)
+		}
+
+		if registry.Contains(assetType) {
+			return nil, fmt.Errorf("duplicate asset type name '%s'", assetType)
+		}
+
+		registry = append(registry, assetType)
+	}
+
+	return registry, nil
+}
+
+// Contains returns true if asset type is registered
+func (r AssetTypeRegistry) Contains(assetType AssetType) bool {
+	for _, a := range r {
+		if a == assetType {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Comment object
 // swagger:model
 type Comment struct {
@@ -37,15 +105,30 @@ type Comment struct {
 	// required: true
 	Text string `json:"text,omitempty"`
 
+	// Content type of the text, markdown is rendered to sanitized HTML on request (text/plain if not set)
+	// enum: text/plain,text/markdown
+	ContentType string `json:"content_type,omitempty"`
+
+	// ID of the template the text was rendered from
+	// swagger:strfmt uuid
+	TemplateID string `json:"template_id,omitempty"`
+
 	// ID in external system
 	ExternalID string `json:"external_id,omitempty"`
 
+	// ID of the parent comment this comment replies to
+	// swagger:strfmt uuid
+	ParentUUID string `json:"parent_uuid,omitempty"`
+
 	// Origin of the request
 	Origin string `json:"-"`
 
 	// ReadBy is a list of users who read this comment
 	ReadBy ReadByList `json:"read_by,omitempty"`
 
+	// History is a list of previous versions of the comment text
+	History HistoryList `json:"history,omitempty"`
+
 	// Time when the resource was created
 	// required: true
 	// swagger:strfmt date-time
@@ -54,6 +137,88 @@ type Comment struct {
 	// CreatedBy represents user who created this comment
 	// required: true
 	CreatedBy *UserInfo `json:"created_by,omitempty"`
+
+	// Time when the comment was pinned to the top of its entity thread
+	// swagger:strfmt date-time
+	PinnedAt string `json:"pinned_at,omitempty"`
+
+	// PinnedBy represents user who pinned this comment
+	PinnedBy *UserInfo `json:"pinned_by,omitempty"`
+
+	// Time when the resource was deleted
+	// swagger:strfmt date-time
+	DeletedAt string `json:"deleted_at,omitempty"`
+
+	// DeletedBy represents user who deleted this comment
+	DeletedBy *UserInfo `json:"deleted_by,omitempty"`
+
+	// Time when the resource was last restored after deletion
+	// swagger:strfmt date-time
+	RestoredAt string `json:"restored_at,omitempty"`
+
+	// RestoredBy represents user who last restored this comment after deletion
+	RestoredBy *UserInfo `json:"restored_by,omitempty"`
+
+	// Asset type the resource was converted from (e.g. comment posted as worknote by mistake)
+	ConvertedFrom AssetType `json:"converted_from,omitempty"`
+
+	// Time when the resource was converted from another asset type
+	// swagger:strfmt date-time
+	ConvertedAt string `json:"converted_at,omitempty"`
+
+	// ConvertedBy represents user who converted this comment from another asset type
+	ConvertedBy *UserInfo `json:"converted_by,omitempty"`
+
+	// OriginalEntity is the entity the comment was posted to before the entity was merged into another one
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+	// swagger:strfmt string
+	OriginalEntity *entity.Entity `json:"original_entity,omitempty"`
+
+	// Mentions is a list of users mentioned in this comment
+	Mentions []UserInfo `json:"mentions,omitempty"`
+
+	// Reactions is a list of emoji reactions of users to this comment
+	Reactions ReactionList `json:"reactions,omitempty"`
+}
+
+// Content types of the comment text
+const (
+	ContentTypePlain    = "text/plain"
+	ContentTypeMarkdown = "text/markdown"
+)
+
+// IsMarkdown returns true if comment text is written in markdown
+func (c Comment) IsMarkdown() bool {
+	return c.ContentType == ContentTypeMarkdown
+}
+
+// IsDeleted returns true if comment was (soft) deleted
+func (c Comment) IsDeleted() bool {
+	return c.DeletedAt != ""
+}
+
+// IsPinned returns true if comment is pinned to the top of its entity thread
+func (c Comment) IsPinned() bool {
+	return c.PinnedAt != ""
+}
+
+// mentionRegex matches user mention in the form @<user-uuid>
+var mentionRegex = regexp.MustCompile(`@([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})`)
+
+// MentionedUUIDs returns unique UUIDs of users mentioned in the text in the form @<user-uuid>
+func MentionedUUIDs(text string) []string {
+	var uuids []string
+	seen := map[string]bool{}
+
+	for _, m := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		uuid := strings.ToLower(m[1])
+		if !seen[uuid] {
+			seen[uuid] = true
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	return uuids
 }
 
 // ReadByList is the list of users who read this comment
@@ -68,6 +233,115 @@ type ReadBy struct {
 	User UserInfo `json:"user,omitempty"`
 }
 
+// ReactionList is the list of emoji reactions to this comment
+type ReactionList []Reaction
+
+// Reaction stores the emoji some user reacted with to this comment
+type Reaction struct {
+	// Emoji shortcode (e.g. thumbsup) or emoji character
+	// required: true
+	Emoji string `json:"emoji,omitempty"`
+	// required: true
+	// swagger:strfmt date-time
+	Time string `json:"time,omitempty"`
+	// required: true
+	User UserInfo `json:"user,omitempty"`
+}
+
+// ReactionSummary represents the number of reactions with the same emoji
+type ReactionSummary struct {
+	// required: true
+	Emoji string `json:"emoji"`
+	// Number of users who reacted with the emoji
+	// required: true
+	Count int `json:"count"`
+	// Reacted is true if the invoking user reacted with the emoji
+	// required: true
+	Reacted bool `json:"reacted"`
+}
+
+// Find returns index of the reaction of the user with the emoji or -1 if the user did not react with it
+func (l ReactionList) Find(emoji, userUUID string) int {
+	for i, r := range l {
+		if r.Emoji == emoji && r.User.UUID == userUUID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Summary returns reaction counts per emoji in the order the emojis were first used;
+// userUUID identifies the user whose reactions are flagged
+func (l ReactionList) Summary(userUUID string) []ReactionSummary {
+	var summary []ReactionSummary
+	index := map[string]int{}
+
+	for _, r := range l {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(summary)
+			index[r.Emoji] = i
+			summary = append(summary, ReactionSummary{Emoji: r.Emoji})
+		}
+
+		summary[i].Count++
+		if userUUID != "" && r.User.UUID == userUUID {
+			summary[i].Reacted = true
+		}
+	}
+
+	return summary
+}
+
+// emojiShortcodeRegex matches emoji shortcode without colons (e.g. thumbsup, +1, white_check_mark)
+var emojiShortcodeRegex = regexp.MustCompile(`^[a-z0-9_+-]{1,50}$`)
+
+// maxEmojiLength is the maximum number of runes of emoji character sequence (e.g. family with skin tones)
+const maxEmojiLength = 16
+
+// ValidateEmoji returns error if the value is neither emoji shortcode nor emoji character sequence
+func ValidateEmoji(emoji string) error {
+	if emojiShortcodeRegex.MatchString(emoji) {
+		return nil
+	}
+
+	runes := []rune(emoji)
+	if len(runes) == 0 || len(runes) > maxEmojiLength {
+		return fmt.Errorf("invalid emoji '%s'", emoji)
+	}
+
+	for _, r := range runes {
+		switch {
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r):
+			// emoji symbols and modifiers (e.g. skin tones)
+		case r == '\u200d', unicode.Is(unicode.Variation_Selector, r):
+			// zero width joiner and variation selectors combine emojis
+		default:
+			return fmt.Errorf("invalid emoji '%s'", emoji)
+		}
+	}
+
+	return nil
+}
+
+// HistoryList is the list of previous versions of the comment text
+type HistoryList []HistoryEntry
+
+// HistoryEntry stores the text that was replaced by some user's edit
+type HistoryEntry struct {
+	// Text of the comment before the edit
+	// required: true
+	Text string `json:"text,omitempty"`
+	// Time when the text was replaced
+	// required: true
+	// swagger:strfmt date-time
+	EditedAt string `json:"edited_at,omitempty"`
+	// User who replaced the text
+	// required: true
+	EditedBy UserInfo `json:"edited_by,omitempty"`
+}
+
 // UserInfo represents basic info about user
 type UserInfo struct {
 	// required: true
@@ -85,7 +359,11 @@ type UserInfo struct {
 	OrgName string `json:"org_name,omitempty"`
 }
 
-// OrgID returns org_id based on orgName
+// OrgID returns org_id based on orgName, empty if user is unknown
 func (u *UserInfo) OrgID() string {
+	if u == nil {
+		return ""
+	}
+
 	return strings.SplitN(u.OrgName, ".", 2)[0]
 }
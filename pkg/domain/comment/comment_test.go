@@ -1,6 +1,9 @@
 package comment
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestUserInfo_OrgID(t *testing.T) {
 	ui := UserInfo{
@@ -16,3 +19,130 @@ func TestUserInfo_OrgID(t *testing.T) {
 		t.Errorf("OrgID() = %v, want %v", got, want)
 	}
 }
+
+func TestMentionedUUIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "no mention", text: "Hello world", want: nil},
+		{name: "invalid uuid", text: "Hello @john", want: nil},
+		{
+			name: "more mentions",
+			text: "@2af4f493-0bd5-4513-b440-6cbb465feadb please check it with @8540D943-8CCD-4FF1-8A08-0C3AA338C58E.",
+			want: []string{"2af4f493-0bd5-4513-b440-6cbb465feadb", "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"},
+		},
+		{
+			name: "duplicate mentions",
+			text: "@2af4f493-0bd5-4513-b440-6cbb465feadb, @2af4f493-0bd5-4513-b440-6cbb465feadb!",
+			want: []string{"2af4f493-0bd5-4513-b440-6cbb465feadb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MentionedUUIDs(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MentionedUUIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssetType_Title(t *testing.T) {
+	tests := []struct {
+		assetType AssetType
+		want      string
+	}{
+		{assetType: AssetTypeComment, want: "Comment"},
+		{assetType: AssetTypeWorknote, want: "Worknote"},
+		{assetType: "resolution_note", want: "ResolutionNote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.assetType.String(), func(t *testing.T) {
+			if got := tt.assetType.Title(); got != tt.want {
+				t.Errorf("Title() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAssetTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    AssetTypeRegistry
+		wantErr string
+	}{
+		{name: "default", s: "comment,worknote", want: DefaultAssetTypes()},
+		{
+			name: "additional asset types",
+			s:    "comment, worknote, resolution_note, approval_note",
+			want: AssetTypeRegistry{AssetTypeComment, AssetTypeWorknote, "resolution_note", "approval_note"},
+		},
+		{name: "empty name", s: "comment,,worknote", wantErr: "invalid asset type name '', only lowercase letters, digits and underscores are allowed"},
+		{name: "invalid name", s: "Comment", wantErr: "invalid asset type name 'Comment', only lowercase letters, digits and underscores are allowed"},
+		{name: "duplicate name", s: "comment,worknote,comment", wantErr: "duplicate asset type name 'comment'"},
+		{name: "reserved name", s: "comment,template", wantErr: "asset type name 'template' is reserved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAssetTypes(tt.s)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ParseAssetTypes() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseAssetTypes() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAssetTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEmoji(t *testing.T) {
+	tests := []struct {
+		emoji   string
+		wantErr bool
+	}{
+		{emoji: "thumbsup"},
+		{emoji: "+1"},
+		{emoji: "white_check_mark"},
+		{emoji: "👍"},
+		{emoji: "👍🏽"},
+		{emoji: "❤️"},
+		{emoji: "👩‍💻"},
+		{emoji: "🇸🇰"},
+		{emoji: "", wantErr: true},
+		{emoji: "Thumbs Up", wantErr: true},
+		{emoji: "<script>", wantErr: true},
+		{emoji: "a👍", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.emoji, func(t *testing.T) {
+			if err := ValidateEmoji(tt.emoji); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEmoji() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReactionList_Summary(t *testing.T) {
+	reactions := ReactionList{
+		{Emoji: "thumbsup", User: UserInfo{UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb"}},
+		{Emoji: "tada", User: UserInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}},
+		{Emoji: "thumbsup", User: UserInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}},
+	}
+
+	want := []ReactionSummary{
+		{Emoji: "thumbsup", Count: 2, Reacted: true},
+		{Emoji: "tada", Count: 1, Reacted: false},
+	}
+
+	if got := reactions.Summary("2af4f493-0bd5-4513-b440-6cbb465feadb"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary() = %v, want %v", got, want)
+	}
+}
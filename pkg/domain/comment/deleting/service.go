@@ -0,0 +1,114 @@
+package deleting
+
+import (
+	"context"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+)
+
+// Service provides comment deleting operations
+type Service interface {
+	// DeleteComment marks the comment with given ID as deleted.
+	// It returns true if comment was already deleted before to notify that resource was not changed.
+	DeleteComment(ctx context.Context, id string, deletedBy comment.UserInfo, channelID string, assetType comment.AssetType) (alreadyDeleted bool, error error)
+
+	// RestoreComment brings back the deleted comment with given ID and returns it.
+	// Fields deleted_at and deleted_by are cleared, restored_at and restored_by record who restored it.
+	RestoreComment(ctx context.Context, id string, restoredBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error)
+}
+
+// Repository provides deleting access to the comments repository
+type Repository interface {
+	// UpdateComment lets modify function change the stored comment and stores the changed comment.
+	// Modify function returns false if there is nothing to store, it may be called again if the comment
+	// was changed concurrently. Events function (if not nil) returns the message of events of the change,
+	// it is stored to the outbox together with the changed comment. It returns the comment after the change
+	// and true if it was stored.
+	UpdateComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+		modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (updated comment.Comment, changed bool, err error)
+}
+
+// Config contains dependencies of the deleting service
+type Config struct {
+	// Validator validates changed comments before they are stored, they are not validated if it is nil
+	Validator comment.Validator
+	// EventService prepares events of the changes stored to the outbox, there are no events if it is nil
+	EventService event.Service
+	// Clock provides time of the deletion (system time if nil)
+	Clock comment.Clock
+}
+
+// NewService creates a deleting service
+func NewService(r Repository, cfg Config) Service {
+	return &service{
+		r:         r,
+		validator: cfg.Validator,
+		events:    cfg.EventService,
+		clock:     cfg.Clock,
+	}
+}
+
+type service struct {
+	r         Repository
+	validator comment.Validator
+	events    event.Service
+	clock     comment.Clock
+}
+
+func (s *service) DeleteComment(ctx context.Context, id string, deletedBy comment.UserInfo, channelID string, assetType comment.AssetType) (bool, error) {
+	_, changed, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if c.IsDeleted() {
+			return false, nil
+		}
+
+		c.DeletedAt = comment.Timestamp(s.clock)
+		c.DeletedBy = &deletedBy
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, deletedBy.OrgID(), func(q event.Queue) error {
+			return q.AddDeleteEvent(c, assetType)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !changed, nil
+}
+
+func (s *service) RestoreComment(ctx context.Context, id string, restoredBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
+	c, _, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if !c.IsDeleted() {
+			// nothing to restore
+			return false, nil
+		}
+
+		// the deletion is replaced by the restoration in the audit fields
+		c.DeletedAt = ""
+		c.DeletedBy = nil
+		c.RestoredAt = comment.Timestamp(s.clock)
+		c.RestoredBy = &restoredBy
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, restoredBy.OrgID(), func(q event.Queue) error {
+			return q.AddRestoreEvent(c, assetType)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// validate returns error if the changed comment is not valid
+func (s *service) validate(c comment.Comment) error {
+	if s.validator == nil {
+		return nil
+	}
+
+	return s.validator.Validate(c)
+}
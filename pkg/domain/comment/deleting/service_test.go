@@ -0,0 +1,147 @@
+package deleting_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAndRestoreService(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	c1 := comment.Comment{
+		Text:   "Test 1",
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		CreatedBy: &comment.UserInfo{
+			UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e", Name: "Some user 1",
+		},
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{
+		Clock: clock,
+	}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+
+	assetType := comment.AssetTypeComment
+
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
+
+	com1, err := adder.AddComment(ctx, c1, channelID, assetType)
+	require.NoError(t, err)
+
+	deleter := deleting.NewService(mockStorage, deleting.Config{Clock: clock})
+	lister := listing.NewService(mockStorage)
+
+	user := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	alreadyDeleted, err := deleter.DeleteComment(ctx, com1.UUID, user, channelID, assetType)
+	require.NoError(t, err)
+	assert.False(t, alreadyDeleted)
+
+	stored, err := lister.GetComment(ctx, com1.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, clock.NowFormatted(), stored.DeletedAt)
+	assert.Equal(t, &user, stored.DeletedBy)
+
+	// the second deletion does not change anything
+	alreadyDeleted, err = deleter.DeleteComment(ctx, com1.UUID, user, channelID, assetType)
+	require.NoError(t, err)
+	assert.True(t, alreadyDeleted)
+
+	restored, err := deleter.RestoreComment(ctx, com1.UUID, user, channelID, assetType)
+	require.NoError(t, err)
+	assert.False(t, restored.IsDeleted())
+	assert.Nil(t, restored.DeletedBy)
+	assert.Equal(t, clock.NowFormatted(), restored.RestoredAt)
+	assert.Equal(t, &user, restored.RestoredBy)
+	assert.Equal(t, "Test 1", restored.Text)
+
+	stored, err = lister.GetComment(ctx, com1.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, &user, stored.RestoredBy, "restoration is stored")
+}
+
+func TestDeleteServiceEvents(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+	assetType := comment.AssetTypeComment
+
+	deletedBy := comment.UserInfo{
+		UUID:    "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:    "Joe",
+		OrgName: orgID + ".kompitech.com",
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+
+	t.Run("events are stored to the outbox", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).
+			AddComment(ctx, comment.Comment{Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"), Text: "Test 1"}, channelID, assetType)
+		require.NoError(t, err)
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddDeleteEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
+		queue.On("AddRestoreEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
+		queue.On("Message").Return(&event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil)
+
+		deleter := deleting.NewService(mockStorage, deleting.Config{Clock: clock, EventService: events})
+
+		_, err = deleter.DeleteComment(ctx, c.UUID, deletedBy, channelID, assetType)
+		require.NoError(t, err)
+
+		_, err = deleter.RestoreComment(ctx, c.UUID, deletedBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Len(t, mockStorage.GetOutboxMessages(), 2)
+
+		mock.AssertExpectationsForObjects(t, events, queue)
+	})
+
+	t.Run("deletion is not stored if events are not prepared", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).
+			AddComment(ctx, comment.Comment{Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"), Text: "Test 1"}, channelID, assetType)
+		require.NoError(t, err)
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddDeleteEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
+		queue.On("Message").Return(nil, errors.New("invalid event data"))
+
+		deleter := deleting.NewService(mockStorage, deleting.Config{Clock: clock, EventService: events})
+
+		_, err = deleter.DeleteComment(ctx, c.UUID, deletedBy, channelID, assetType)
+		assert.EqualError(t, err, "could not prepare events: invalid event data")
+
+		stored, err := listing.NewService(mockStorage).GetComment(ctx, c.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.False(t, stored.IsDeleted())
+	})
+}
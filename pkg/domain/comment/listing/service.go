@@ -13,6 +13,9 @@ type Service interface {
 
 	// QueryComments finds documents in the repository using a declarative JSON querying syntax
 	QueryComments(ctx context.Context, query map[string]interface{}, channelID string, assetType comment.AssetType) (QueryResult, error)
+
+	// CountUnread returns the number of comments of each entity not read by the user
+	CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error)
 }
 
 // QueryResult wraps the result returned by querying comments
@@ -28,6 +31,9 @@ type Repository interface {
 
 	// QueryComments finds documents using a declarative JSON querying syntax
 	QueryComments(ctx context.Context, query map[string]interface{}, channelID string, assetType comment.AssetType) (QueryResult, error)
+
+	// CountUnread returns the number of comments of each entity not read by the user
+	CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error)
 }
 
 // NewService creates a listing service
@@ -46,3 +52,7 @@ func (s *service) GetComment(ctx context.Context, id, channelID string, assetTyp
 func (s *service) QueryComments(ctx context.Context, query map[string]interface{}, channelID string, assetType comment.AssetType) (QueryResult, error) {
 	return s.r.QueryComments(ctx, query, channelID, assetType)
 }
+
+func (s *service) CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error) {
+	return s.r.CountUnread(ctx, entities, userUUID, channelID, assetType)
+}
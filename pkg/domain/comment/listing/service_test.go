@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
@@ -33,16 +34,18 @@ func TestGetCommentService(t *testing.T) {
 	mockStorage := &memory.Storage{
 		Clock: clock,
 	}
+	testutils.CreateDatabases(t, mockStorage, channelID)
 
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
 	lister := listing.NewService(mockStorage)
 	assetType := comment.AssetTypeComment
 
 	ctx := context.Background()
 
-	storedComment1, err := mockStorage.AddComment(ctx, c1, channelID, assetType)
+	storedComment1, err := adder.AddComment(ctx, c1, channelID, assetType)
 	require.NoError(t, err)
 
-	storedComment2, err := mockStorage.AddComment(ctx, c2, channelID, assetType)
+	storedComment2, err := adder.AddComment(ctx, c2, channelID, assetType)
 	require.NoError(t, err)
 
 	com1, err := lister.GetComment(ctx, storedComment1.UUID, channelID, assetType)
@@ -60,6 +63,6 @@ func TestGetCommentService(t *testing.T) {
 	assert.Equal(t, clock.NowFormatted(), com2.CreatedAt)
 
 	com3, err := lister.GetComment(ctx, "NonexistentID", channelID, assetType)
-	require.EqualError(t, err, "record was not found")
+	require.EqualError(t, err, "Comment could not be retrieved: Comment with uuid='NonexistentID' does not exist")
 	assert.Empty(t, com3)
 }
@@ -0,0 +1,46 @@
+package comment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+)
+
+// ThreadLock prevents adding new comments of one asset type to the entity thread
+type ThreadLock struct {
+	// Entity represents some external entity reference in the form "&lt;entity&gt;:&lt;UUID&gt;"
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+	// required: true
+	// swagger:strfmt string
+	Entity entity.Entity `json:"entity"`
+
+	// Reason why the thread was locked
+	// example: Incident is closed
+	Reason string `json:"reason,omitempty"`
+
+	// Time when the thread was locked
+	// required: true
+	// swagger:strfmt date-time
+	LockedAt string `json:"locked_at,omitempty"`
+
+	// LockedBy represents user who locked the thread
+	LockedBy *UserInfo `json:"locked_by,omitempty"`
+}
+
+// ThreadLockedError is returned when comment is being added to the locked entity thread
+type ThreadLockedError struct {
+	Lock      ThreadLock
+	AssetType AssetType
+}
+
+func (e *ThreadLockedError) Error() string {
+	msg := fmt.Sprintf("%s could not be added: %s of entity '%s' are locked",
+		strings.Title(e.AssetType.String()), e.AssetType.Plural(), e.Lock.Entity)
+
+	if e.Lock.Reason != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Lock.Reason)
+	}
+
+	return msg
+}
@@ -0,0 +1,45 @@
+package locking
+
+import (
+	"context"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+)
+
+// Service provides entity thread locking operations
+type Service interface {
+	// LockThread prevents adding new comments of the asset type to the entity thread.
+	// It returns true if thread was already locked before to notify that resource was not changed.
+	LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (alreadyLocked bool, err error)
+
+	// UnlockThread allows adding new comments of the asset type to the entity thread again.
+	// It returns true if thread was not locked to notify that resource was not changed.
+	UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (notLocked bool, err error)
+}
+
+// Repository provides access to the thread locks in the comments repository
+type Repository interface {
+	// LockThread stores the lock of the entity thread
+	LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (alreadyLocked bool, err error)
+
+	// UnlockThread removes the lock of the entity thread
+	UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (notLocked bool, err error)
+}
+
+// NewService creates a locking service
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+type service struct {
+	r Repository
+}
+
+func (s *service) LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (bool, error) {
+	return s.r.LockThread(ctx, lock, channelID, assetType)
+}
+
+func (s *service) UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (bool, error) {
+	return s.r.UnlockThread(ctx, e, channelID, assetType)
+}
@@ -0,0 +1,40 @@
+package comment
+
+import (
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+)
+
+// MergeMode specifies whether comments of the merged entity are moved or copied to the target entity
+type MergeMode string
+
+// Merge modes definitions
+const (
+	// MergeModeMove re-parents the comments to the target entity, they keep their UUIDs and read state
+	MergeModeMove MergeMode = "move"
+	// MergeModeCopy creates copies of the comments in the target entity, the source thread stays untouched
+	MergeModeCopy MergeMode = "copy"
+)
+
+func (m MergeMode) String() string {
+	return string(m)
+}
+
+// EntityMerge represents merging of the duplicate entity (e.g. incident) into the master entity
+type EntityMerge struct {
+	// Source is the merged (duplicate) entity
+	Source entity.Entity `json:"source"`
+
+	// Target is the master entity the comments are merged into
+	Target entity.Entity `json:"target"`
+
+	// Mode of the merge (move if not set)
+	Mode MergeMode `json:"mode,omitempty"`
+
+	// MergedBy represents user who merged the entities
+	MergedBy *UserInfo `json:"merged_by,omitempty"`
+}
+
+// IsCopy returns true if comments are copied to the target entity instead of being moved
+func (m EntityMerge) IsCopy() bool {
+	return m.Mode == MergeModeCopy
+}
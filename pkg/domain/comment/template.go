@@ -0,0 +1,100 @@
+package comment
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Template is a canned response of the channel used to create comments with prepared text
+// swagger:model
+type Template struct {
+	// Read Only: true
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid,omitempty"`
+
+	// Name of the template, unique in the channel
+	// example: Password reset
+	// required: true
+	Name string `json:"name"`
+
+	// Text of the template with placeholders in the form {{variable}}
+	// example: Hello, the password of {{entity}} was reset. Regards, {{user.name}} ({{user.org_display_name}})
+	// required: true
+	Text string `json:"text"`
+
+	// Content type of the text, used for comments created from the template (text/plain if not set)
+	// enum: text/plain,text/markdown
+	ContentType string `json:"content_type,omitempty"`
+
+	// Time when the template was created
+	// required: true
+	// swagger:strfmt date-time
+	CreatedAt string `json:"created_at,omitempty"`
+
+	// CreatedBy represents user who created this template
+	// required: true
+	CreatedBy *UserInfo `json:"created_by,omitempty"`
+
+	// Time when the template was last updated
+	// swagger:strfmt date-time
+	UpdatedAt string `json:"updated_at,omitempty"`
+
+	// UpdatedBy represents user who last updated this template
+	UpdatedBy *UserInfo `json:"updated_by,omitempty"`
+}
+
+// placeholderRegex matches template placeholder in the form {{variable}}, spaces around the name are allowed
+var placeholderRegex = regexp.MustCompile(`{{\s*([a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)*)\s*}}`)
+
+// Placeholders returns unique names of the variables used in the template text in order of appearance
+func (t Template) Placeholders() []string {
+	var names []string
+	found := map[string]bool{}
+
+	for _, m := range placeholderRegex.FindAllStringSubmatch(t.Text, -1) {
+		if found[m[1]] {
+			continue
+		}
+
+		found[m[1]] = true
+		names = append(names, m[1])
+	}
+
+	return names
+}
+
+// Render returns the template text with placeholders replaced by the values of the variables.
+// It returns TemplateVariablesError if some of the used variables is not set.
+func (t Template) Render(vars map[string]string) (string, error) {
+	var missing []string
+	for _, name := range t.Placeholders() {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", &TemplateVariablesError{TemplateUUID: t.UUID, Missing: missing}
+	}
+
+	return placeholderRegex.ReplaceAllStringFunc(t.Text, func(p string) string {
+		return vars[placeholderRegex.FindStringSubmatch(p)[1]]
+	}), nil
+}
+
+// TemplateVariablesError is returned when comment is being created from the template without all used variables
+type TemplateVariablesError struct {
+	TemplateUUID string
+	Missing      []string
+}
+
+func (e *TemplateVariablesError) Error() string {
+	missing := append([]string(nil), e.Missing...)
+	sort.Strings(missing)
+
+	return fmt.Sprintf("Template '%s' could not be rendered: missing value of variables: %s",
+		e.TemplateUUID, strings.Join(missing, ", "))
+}
@@ -0,0 +1,63 @@
+package comment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplate_Placeholders(t *testing.T) {
+	tpl := Template{Text: "Hi {{ user.name }}, {{entity}} was closed by {{user.name}}. {{ticket_no}} {{Invalid}} {{user.}}"}
+
+	want := []string{"user.name", "entity", "ticket_no"}
+	if got := tpl.Placeholders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Placeholders() = %v, want %v", got, want)
+	}
+}
+
+func TestTemplate_Render(t *testing.T) {
+	tpl := Template{
+		UUID: "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+		Text: "Hello, {{ entity }} was resolved. Regards, {{user.name}} ({{user.org_display_name}}) {{eta}}",
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "all variables set",
+			vars: map[string]string{
+				"entity":                "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+				"user.name":             "Joe",
+				"user.org_display_name": "Kompitech",
+				"eta":                   "{{user.name}}",
+				"unused":                "value",
+			},
+			want: "Hello, incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444 was resolved. Regards, Joe (Kompitech) {{user.name}}",
+		},
+		{
+			name:    "variables missing",
+			vars:    map[string]string{"user.name": "Joe"},
+			wantErr: "Template 'c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' could not be rendered: missing value of variables: entity, eta, user.org_display_name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpl.Render(tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Render() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
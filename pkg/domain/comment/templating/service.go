@@ -0,0 +1,72 @@
+package templating
+
+import (
+	"context"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+)
+
+// Service provides operations with comment templates of the channel
+type Service interface {
+	// CreateTemplate saves a given template to the repository
+	CreateTemplate(ctx context.Context, t comment.Template, channelID string) (*comment.Template, error)
+
+	// GetTemplate returns the template with given ID
+	GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error)
+
+	// ListTemplates returns all templates of the channel sorted by name
+	ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error)
+
+	// UpdateTemplate replaces name, text and content type of the template with given ID
+	UpdateTemplate(ctx context.Context, id string, t comment.Template, channelID string) (*comment.Template, error)
+
+	// DeleteTemplate removes the template with given ID
+	DeleteTemplate(ctx context.Context, id, channelID string) error
+}
+
+// Repository provides access to the comment templates storage
+type Repository interface {
+	// CreateTemplate saves a given template to the repository
+	CreateTemplate(ctx context.Context, t comment.Template, channelID string) (*comment.Template, error)
+
+	// GetTemplate returns the template with given ID
+	GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error)
+
+	// ListTemplates returns all templates of the channel sorted by name
+	ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error)
+
+	// UpdateTemplate replaces name, text and content type of the template with given ID
+	UpdateTemplate(ctx context.Context, id string, t comment.Template, channelID string) (*comment.Template, error)
+
+	// DeleteTemplate removes the template with given ID
+	DeleteTemplate(ctx context.Context, id, channelID string) error
+}
+
+// NewService creates a templating service
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+type service struct {
+	r Repository
+}
+
+func (s *service) CreateTemplate(ctx context.Context, t comment.Template, channelID string) (*comment.Template, error) {
+	return s.r.CreateTemplate(ctx, t, channelID)
+}
+
+func (s *service) GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error) {
+	return s.r.GetTemplate(ctx, id, channelID)
+}
+
+func (s *service) ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error) {
+	return s.r.ListTemplates(ctx, channelID)
+}
+
+func (s *service) UpdateTemplate(ctx context.Context, id string, t comment.Template, channelID string) (*comment.Template, error) {
+	return s.r.UpdateTemplate(ctx, id, t, channelID)
+}
+
+func (s *service) DeleteTemplate(ctx context.Context, id, channelID string) error {
+	return s.r.DeleteTemplate(ctx, id, channelID)
+}
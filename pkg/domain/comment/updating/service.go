@@ -2,8 +2,14 @@ package updating
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 )
 
 // Service provides comment updating operations
@@ -11,23 +17,345 @@ type Service interface {
 	// MarkAsReadByUser adds user info to 'read_by' array in the stored comment
 	// It returns true if comment was already marked before to notify that resource was not changed.
 	MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (alreadyMarked bool, error error)
+
+	// MarkAllAsReadByUser adds user info to 'read_by' array in all stored comments of the entity created at or before upTo
+	// (all comments if upTo is empty) not read by the user yet. It returns the number of changed comments.
+	MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (marked int, err error)
+
+	// UpdateText replaces the text of the stored comment and keeps the previous text in the comment's history
+	UpdateText(ctx context.Context, id, text string, editedBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error)
+
+	// AddReaction adds the user's emoji reaction to the stored comment
+	// It returns true if the user already reacted with the emoji to notify that resource was not changed.
+	AddReaction(ctx context.Context, id string, reaction comment.Reaction, channelID string, assetType comment.AssetType) (alreadyReacted bool, err error)
+
+	// RemoveReaction removes the user's emoji reaction from the stored comment
+	// It returns true if the user did not react with the emoji to notify that resource was not changed.
+	RemoveReaction(ctx context.Context, id, emoji string, user comment.UserInfo, channelID string, assetType comment.AssetType) (notReacted bool, err error)
+
+	// PinComment pins the stored comment to the top of its entity thread
+	// It returns true if comment was already pinned before to notify that resource was not changed.
+	PinComment(ctx context.Context, id string, pinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (alreadyPinned bool, err error)
+
+	// UnpinComment removes the stored comment from the top of its entity thread
+	// It returns true if comment was not pinned to notify that resource was not changed.
+	UnpinComment(ctx context.Context, id string, unpinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (notPinned bool, err error)
+
+	// ConvertComment moves the stored comment to another asset type (e.g. from comment to worknote),
+	// the comment keeps its UUID, author and read state
+	ConvertComment(ctx context.Context, id string, convertedBy comment.UserInfo, channelID string, from, to comment.AssetType) (*comment.Comment, error)
+
+	// MergeEntity moves (or copies) all stored comments of the merged entity to the target entity,
+	// the original entity is kept in their original_entity field. It returns the number of merged comments.
+	MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType) (merged int, err error)
 }
 
 // Repository provides updating access to the comments repository
 type Repository interface {
-	// MarkAsReadByUser adds user info to read_by array
-	MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (alreadyMarked bool, error error)
+	// GetComment returns the stored comment
+	GetComment(ctx context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error)
+
+	// MarkAsReadByUser adds user info to read_by array. Events function (if not nil) returns the message of events
+	// of the read comment, it is stored to the outbox only if the comment was not read by the user before.
+	MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+		events func(c comment.Comment) (*event.Message, error)) (alreadyMarked bool, error error)
+
+	// MarkAllAsReadByUser adds user info to read_by array of all entity comments not read by the user. Events function
+	// (if not nil) returns the message of events for upTo (the newest comment if empty), it is stored to the outbox
+	// only if some comments were marked.
+	MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+		events func(upTo string) (*event.Message, error)) (marked int, err error)
+
+	// PinComment lets modify function pin the stored comment like UpdateComment does, modify gets the number
+	// of pinned comments of the comment's entity that are not deleted. Pinning of comments of one entity
+	// is serialized, so the number does not change until the changed comment is stored.
+	PinComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+		modify func(c *comment.Comment, pinned int) (bool, error), events func(c comment.Comment) (*event.Message, error)) (updated comment.Comment, changed bool, err error)
+
+	// UpdateComment lets modify function change the stored comment and stores the changed comment.
+	// Modify function returns false if there is nothing to store, it may be called again if the comment
+	// was changed concurrently. Events function (if not nil) returns the message of events of the change,
+	// it is stored to the outbox together with the changed comment. It returns the comment after the change
+	// and true if it was stored.
+	UpdateComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+		modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (updated comment.Comment, changed bool, err error)
+
+	// ConvertComment moves the comment changed by convert function to the storage of another asset type.
+	// Events function (if not nil) returns the message of events of the conversion stored to the outbox with the change.
+	ConvertComment(ctx context.Context, id, channelID string, from, to comment.AssetType,
+		convert func(c *comment.Comment) error, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error)
+
+	// MergeEntity changes entity of all comments of the merged entity (or stores their copies) and sets original_entity field.
+	// Events function (if not nil) returns the message of events of the merged comments stored to the outbox.
+	MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType,
+		events func(uuids []string) (*event.Message, error)) (merged int, err error)
+}
+
+// defaultMaxPinsPerEntity is the default number of comments that can be pinned in one entity thread
+const defaultMaxPinsPerEntity = 3
+
+// Config contains dependencies of the updating service
+type Config struct {
+	// Validator validates changed comments before they are stored, they are not validated if it is nil
+	Validator comment.Validator
+	// EventService prepares events of the changes stored to the outbox, there are no events if it is nil
+	EventService event.Service
+	// Clock provides time of the changes (system time if nil)
+	Clock comment.Clock
+
+	// MaxPinsPerEntity is the number of comments that can be pinned in one entity thread (default 3)
+	MaxPinsPerEntity int
 }
 
 // NewService creates an updating service
-func NewService(r Repository) Service {
-	return &service{r}
+func NewService(r Repository, cfg Config) Service {
+	maxPinsPerEntity := cfg.MaxPinsPerEntity
+	if maxPinsPerEntity == 0 {
+		maxPinsPerEntity = defaultMaxPinsPerEntity
+	}
+
+	return &service{
+		r:                r,
+		validator:        cfg.Validator,
+		events:           cfg.EventService,
+		clock:            cfg.Clock,
+		maxPinsPerEntity: maxPinsPerEntity,
+	}
 }
 
 type service struct {
-	r Repository
+	r         Repository
+	validator comment.Validator
+	events    event.Service
+	clock     comment.Clock
+
+	maxPinsPerEntity int
+}
+
+// MarkAsReadByUser marks the comment as read with READ event if it was not read by the user before
+func (s *service) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (alreadyMarked bool, err error) {
+	return s.r.MarkAsReadByUser(ctx, id, readBy, channelID, assetType, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, readBy.User.OrgID(), func(q event.Queue) error {
+			return q.AddReadEvent(c, readBy, assetType)
+		})
+	})
+}
+
+// MarkAllAsReadByUser marks comments of the entity as read with one READ event for all of them
+// if some were not read by the user before. UpTo is converted to the format of stored timestamps,
+// so it is compared with created_at of the comments regardless of its time zone.
+func (s *service) MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (int, error) {
+	if upTo != "" {
+		normalized, err := comment.ParseTimestamp(upTo)
+		if err != nil {
+			return 0, repository.NewError(fmt.Sprintf("invalid up_to time: %s", err), http.StatusBadRequest)
+		}
+
+		upTo = normalized
+	}
+
+	return s.r.MarkAllAsReadByUser(ctx, e, upTo, readBy, channelID, assetType, func(upTo string) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, readBy.User.OrgID(), func(q event.Queue) error {
+			return q.AddReadAllEvent(e, upTo, readBy, assetType)
+		})
+	})
+}
+
+// UpdateText replaces the text and appends the previous text to the history array.
+// If the text is not changed, the comment is returned as is and no history entry is created.
+func (s *service) UpdateText(ctx context.Context, id, text string, editedBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
+	c, _, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if c.IsDeleted() {
+			return false, deletedError(id, assetType)
+		}
+
+		if c.Text == text {
+			// nothing to change
+			return false, nil
+		}
+
+		c.History = append(c.History, comment.HistoryEntry{
+			Text:     c.Text,
+			EditedAt: comment.Timestamp(s.clock),
+			EditedBy: editedBy,
+		})
+		c.Text = text
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, editedBy.OrgID(), func(q event.Queue) error {
+			return q.AddUpdateEvent(c, editedBy, assetType)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *service) AddReaction(ctx context.Context, id string, reaction comment.Reaction, channelID string, assetType comment.AssetType) (alreadyReacted bool, err error) {
+	_, changed, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if c.IsDeleted() {
+			return false, deletedError(id, assetType)
+		}
+
+		if c.Reactions.Find(reaction.Emoji, reaction.User.UUID) != -1 {
+			// user already reacted with the emoji in the past
+			return false, nil
+		}
+
+		c.Reactions = append(c.Reactions, reaction)
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, reaction.User.OrgID(), func(q event.Queue) error {
+			return q.AddReactEvent(c, reaction, assetType)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !changed, nil
+}
+
+func (s *service) RemoveReaction(ctx context.Context, id, emoji string, user comment.UserInfo, channelID string, assetType comment.AssetType) (notReacted bool, err error) {
+	var removed comment.Reaction
+	_, changed, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if c.IsDeleted() {
+			return false, deletedError(id, assetType)
+		}
+
+		i := c.Reactions.Find(emoji, user.UUID)
+		if i == -1 {
+			// nothing to remove
+			return false, nil
+		}
+
+		removed = c.Reactions[i]
+		c.Reactions = append(c.Reactions[:i:i], c.Reactions[i+1:]...)
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, user.OrgID(), func(q event.Queue) error {
+			return q.AddUnreactEvent(c, removed, assetType)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !changed, nil
+}
+
+// PinComment pins the comment unless the maximum number of comments is already pinned in its entity thread
+func (s *service) PinComment(ctx context.Context, id string, pinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (alreadyPinned bool, err error) {
+	_, changed, err := s.r.PinComment(ctx, id, channelID, assetType, func(c *comment.Comment, pinned int) (bool, error) {
+		if c.IsDeleted() {
+			return false, deletedError(id, assetType)
+		}
+
+		if c.IsPinned() {
+			return false, nil
+		}
+
+		if pinned >= s.maxPinsPerEntity {
+			eMsg := fmt.Sprintf("%s could not be pinned: maximum number of pinned %s (%d) reached for entity '%s'",
+				strings.Title(assetType.String()), assetType.Plural(), s.maxPinsPerEntity, c.Entity)
+			return false, repository.NewError(eMsg, http.StatusConflict)
+		}
+
+		c.PinnedAt = comment.Timestamp(s.clock)
+		c.PinnedBy = &pinnedBy
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, pinnedBy.OrgID(), func(q event.Queue) error {
+			return q.AddPinEvent(c, pinnedBy, assetType)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !changed, nil
+}
+
+func (s *service) UnpinComment(ctx context.Context, id string, unpinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (notPinned bool, err error) {
+	_, changed, err := s.r.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		if c.IsDeleted() {
+			return false, deletedError(id, assetType)
+		}
+
+		if !c.IsPinned() {
+			return false, nil
+		}
+
+		c.PinnedAt = ""
+		c.PinnedBy = nil
+
+		return true, s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, unpinnedBy.OrgID(), func(q event.Queue) error {
+			return q.AddUnpinEvent(c, unpinnedBy, assetType)
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !changed, nil
+}
+
+// ConvertComment moves the comment to another asset type, converted_from, converted_at and converted_by fields
+// record the conversion. The comment is unpinned as pins are counted per asset type. Replies cannot be converted,
+// the thread would be split.
+func (s *service) ConvertComment(ctx context.Context, id string, convertedBy comment.UserInfo, channelID string, from, to comment.AssetType) (*comment.Comment, error) {
+	return s.r.ConvertComment(ctx, id, channelID, from, to, func(c *comment.Comment) error {
+		if c.IsDeleted() {
+			return deletedError(id, from)
+		}
+
+		if c.ParentUUID != "" {
+			eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' is a reply", strings.Title(from.String()), from, id)
+			return repository.NewError(eMsg, http.StatusConflict)
+		}
+
+		c.PinnedAt = ""
+		c.PinnedBy = nil
+		c.ConvertedFrom = from
+		c.ConvertedAt = comment.Timestamp(s.clock)
+		c.ConvertedBy = &convertedBy
+
+		return s.validate(*c)
+	}, func(c comment.Comment) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, convertedBy.OrgID(), func(q event.Queue) error {
+			return q.AddConvertEvent(c, convertedBy, to)
+		})
+	})
+}
+
+// MergeEntity merges comments of the entity with one MERGED event for all of them
+func (s *service) MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType) (int, error) {
+	return s.r.MergeEntity(ctx, m, channelID, assetType, func(uuids []string) (*event.Message, error) {
+		return event.Prepare(s.events, channelID, m.MergedBy.OrgID(), func(q event.Queue) error {
+			return q.AddMergeEvent(m, uuids, assetType)
+		})
+	})
+}
+
+// validate returns error if the changed comment is not valid
+func (s *service) validate(c comment.Comment) error {
+	if s.validator == nil {
+		return nil
+	}
+
+	return s.validator.Validate(c)
 }
 
-func (s *service) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (alreadyMarked bool, error error) {
-	return s.r.MarkAsReadByUser(ctx, id, readBy, channelID, assetType)
+// deletedError returns error of the change of the deleted comment
+func deletedError(id string, assetType comment.AssetType) error {
+	reason := fmt.Sprintf("%s with uuid='%s' is deleted", strings.Title(assetType.String()), id)
+	return repository.NewError(reason, http.StatusConflict)
 }
@@ -2,16 +2,24 @@ package updating_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,10 +47,11 @@ func TestMarkAsReadByUserService(t *testing.T) {
 	mockStorage := &memory.Storage{
 		Clock: clock,
 	}
+	testutils.CreateDatabases(t, mockStorage, channelID)
 
 	assetType := comment.AssetTypeComment
 
-	adder := adding.NewService(mockStorage)
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
 
 	com1ID, err := adder.AddComment(ctx, c1, channelID, assetType)
 	require.NoError(t, err)
@@ -50,7 +59,7 @@ func TestMarkAsReadByUserService(t *testing.T) {
 	com2ID, err := adder.AddComment(ctx, c2, channelID, assetType)
 	require.NoError(t, err)
 
-	updater := updating.NewService(mockStorage)
+	updater := updating.NewService(mockStorage, updating.Config{Clock: clock})
 
 	readBy := comment.ReadBy{
 		Time: "current timestamp",
@@ -96,3 +105,381 @@ func TestMarkAsReadByUserService(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, com2.ReadBy)
 }
+
+func TestMarkAsReadByUserServiceEvents(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	assetType := comment.AssetTypeComment
+
+	readBy := comment.ReadBy{
+		Time: "current timestamp",
+		User: comment.UserInfo{
+			UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+			Name:           "Joe",
+			Surname:        "Potato",
+			OrgName:        orgID + ".kompitech.com",
+			OrgDisplayName: "Kompitech",
+		},
+	}
+
+	msg := event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}
+
+	t.Run("read event is stored only when the comment is marked", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).
+			AddComment(ctx, comment.Comment{Text: "Test 1", Entity: e}, channelID, assetType)
+		require.NoError(t, err)
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil).Once()
+		queue.On("AddReadEvent", mock.AnythingOfType("comment.Comment"), readBy, assetType).Return(nil).Once()
+		queue.On("Message").Return(&msg, nil).Once()
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock, EventService: events})
+
+		alreadyRead, err := updater.MarkAsReadByUser(ctx, c.UUID, readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.False(t, alreadyRead)
+
+		alreadyRead, err = updater.MarkAsReadByUser(ctx, c.UUID, readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.True(t, alreadyRead)
+
+		assert.Equal(t, []event.Message{msg}, mockStorage.GetOutboxMessages())
+		mock.AssertExpectationsForObjects(t, events, queue)
+	})
+
+	t.Run("one read event is stored for all marked comments", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
+		for i := 0; i < 2; i++ {
+			_, err := adder.AddComment(ctx, comment.Comment{Text: fmt.Sprintf("Test %d", i), Entity: e}, channelID, assetType)
+			require.NoError(t, err)
+		}
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil).Once()
+		queue.On("AddReadAllEvent", e, clock.NowFormatted(), readBy, assetType).Return(nil).Once()
+		queue.On("Message").Return(&msg, nil).Once()
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock, EventService: events})
+
+		marked, err := updater.MarkAllAsReadByUser(ctx, e, "", readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 2, marked)
+
+		marked, err = updater.MarkAllAsReadByUser(ctx, e, "", readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 0, marked)
+
+		assert.Equal(t, []event.Message{msg}, mockStorage.GetOutboxMessages())
+		mock.AssertExpectationsForObjects(t, events, queue)
+	})
+}
+
+func TestMarkAllAsReadByUserServiceUpTo(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	assetType := comment.AssetTypeComment
+
+	readBy := comment.ReadBy{
+		Time: "current timestamp",
+		User: comment.UserInfo{UUID: "439e2d19-8d50-405d-ad8e-cd33df344086", Name: "Joe"},
+	}
+
+	// the comment is created at 2021-04-01T10:34:56Z
+	mockStorage := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+	_, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).
+		AddComment(ctx, comment.Comment{Text: "Test 1", Entity: e}, channelID, assetType)
+	require.NoError(t, err)
+
+	updater := updating.NewService(mockStorage, updating.Config{Clock: clock})
+
+	t.Run("with time before the comment in another time zone", func(t *testing.T) {
+		marked, err := updater.MarkAllAsReadByUser(ctx, e, "2021-04-01T11:00:00+01:00", readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 0, marked)
+	})
+
+	t.Run("with invalid time", func(t *testing.T) {
+		_, err := updater.MarkAllAsReadByUser(ctx, e, "yesterday", readBy, channelID, assetType)
+
+		var repoErr *repository.Error
+		require.ErrorAs(t, err, &repoErr)
+		assert.Equal(t, http.StatusBadRequest, repoErr.StatusCode())
+	})
+
+	t.Run("with time of the comment in another time zone", func(t *testing.T) {
+		marked, err := updater.MarkAllAsReadByUser(ctx, e, "2021-04-01T11:34:56+01:00", readBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+	})
+}
+
+func TestUpdateTextService(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	c1 := comment.Comment{
+		Text:   "Test 1 with tpyo",
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		CreatedBy: &comment.UserInfo{
+			UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e", Name: "Some user 1",
+		},
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{
+		Clock: clock,
+	}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+
+	assetType := comment.AssetTypeComment
+
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock})
+
+	com1, err := adder.AddComment(ctx, c1, channelID, assetType)
+	require.NoError(t, err)
+
+	updater := updating.NewService(mockStorage, updating.Config{Clock: clock})
+
+	editedBy := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	updated, err := updater.UpdateText(ctx, com1.UUID, "Test 1 without typo", editedBy, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, "Test 1 without typo", updated.Text)
+
+	expectedHistory := comment.HistoryList{
+		{Text: "Test 1 with tpyo", EditedAt: clock.NowFormatted(), EditedBy: editedBy},
+	}
+	assert.Equal(t, expectedHistory, updated.History)
+
+	// the same text again does not create new history entry
+	updated, err = updater.UpdateText(ctx, com1.UUID, "Test 1 without typo", editedBy, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, expectedHistory, updated.History)
+
+	lister := listing.NewService(mockStorage)
+
+	stored, err := lister.GetComment(ctx, com1.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, "Test 1 without typo", stored.Text)
+	assert.Equal(t, expectedHistory, stored.History)
+}
+
+func TestRemoveReactionService(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	assetType := comment.AssetTypeComment
+
+	user := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+
+	c, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).AddComment(ctx, comment.Comment{
+		Text:      "Test 1",
+		Entity:    entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		CreatedBy: &user,
+	}, channelID, assetType)
+	require.NoError(t, err)
+
+	updater := updating.NewService(mockStorage, updating.Config{Clock: clock})
+
+	_, err = updater.AddReaction(ctx, c.UUID, comment.Reaction{Emoji: "thumbsup", Time: clock.NowFormatted(), User: user}, channelID, assetType)
+	require.NoError(t, err)
+
+	_, err = deleting.NewService(mockStorage, deleting.Config{Clock: clock}).DeleteComment(ctx, c.UUID, user, channelID, assetType)
+	require.NoError(t, err)
+
+	// reactions of deleted comments cannot be changed
+	_, err = updater.RemoveReaction(ctx, c.UUID, "thumbsup", user, channelID, assetType)
+	var repoErr *repository.Error
+	require.True(t, errors.As(err, &repoErr))
+	assert.Equal(t, http.StatusConflict, repoErr.StatusCode())
+	assert.EqualError(t, err, fmt.Sprintf("Comment with uuid='%s' is deleted", c.UUID))
+
+	stored, err := listing.NewService(mockStorage).GetComment(ctx, c.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Len(t, stored.Reactions, 1)
+}
+
+func TestPinCommentService(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	assetType := comment.AssetTypeComment
+
+	pinnedBy := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        orgID + ".kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+
+	addComments := func(t *testing.T, s *memory.Storage, n int) []*comment.Comment {
+		adder := adding.NewService(s, adding.Config{Clock: clock})
+
+		var comments []*comment.Comment
+		for i := 0; i < n; i++ {
+			c, err := adder.AddComment(ctx, comment.Comment{Entity: e, Text: "Test"}, channelID, assetType)
+			require.NoError(t, err)
+			comments = append(comments, c)
+		}
+
+		return comments
+	}
+
+	t.Run("pin limit", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		comments := addComments(t, mockStorage, 3)
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock, MaxPinsPerEntity: 2})
+
+		for _, c := range comments[:2] {
+			alreadyPinned, err := updater.PinComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+			require.NoError(t, err)
+			assert.False(t, alreadyPinned)
+		}
+
+		// pinning the pinned comment again is not limited
+		alreadyPinned, err := updater.PinComment(ctx, comments[0].UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.True(t, alreadyPinned)
+
+		_, err = updater.PinComment(ctx, comments[2].UUID, pinnedBy, channelID, assetType)
+		var repoErr *repository.Error
+		require.ErrorAs(t, err, &repoErr)
+		assert.Equal(t, http.StatusConflict, repoErr.StatusCode())
+		assert.EqualError(t, err, "Comment could not be pinned: maximum number of pinned comments (2) reached for entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444'")
+
+		// deleted comments do not count
+		_, err = deleting.NewService(mockStorage, deleting.Config{Clock: clock}).DeleteComment(ctx, comments[0].UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+
+		_, err = updater.PinComment(ctx, comments[2].UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+
+		_, err = updater.PinComment(ctx, comments[0].UUID, pinnedBy, channelID, assetType)
+		require.ErrorAs(t, err, &repoErr)
+		assert.Equal(t, http.StatusConflict, repoErr.StatusCode())
+		assert.EqualError(t, err, fmt.Sprintf("Comment with uuid='%s' is deleted", comments[0].UUID))
+	})
+
+	t.Run("deleted comment cannot be unpinned", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c := addComments(t, mockStorage, 1)[0]
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock})
+
+		_, err := updater.PinComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+
+		_, err = deleting.NewService(mockStorage, deleting.Config{Clock: clock}).DeleteComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+
+		_, err = updater.UnpinComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+		var repoErr *repository.Error
+		require.ErrorAs(t, err, &repoErr)
+		assert.Equal(t, http.StatusConflict, repoErr.StatusCode())
+		assert.EqualError(t, err, fmt.Sprintf("Comment with uuid='%s' is deleted", c.UUID))
+	})
+
+	t.Run("events are stored to the outbox", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c := addComments(t, mockStorage, 1)[0]
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddPinEvent", mock.AnythingOfType("comment.Comment"), pinnedBy, assetType).Return(nil)
+		queue.On("Message").Return(&event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil)
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock, EventService: events})
+
+		_, err := updater.PinComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, []event.Message{*&event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}}, mockStorage.GetOutboxMessages())
+
+		mock.AssertExpectationsForObjects(t, events, queue)
+	})
+
+	t.Run("pin is not stored if events are not prepared", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		c := addComments(t, mockStorage, 1)[0]
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddPinEvent", mock.AnythingOfType("comment.Comment"), pinnedBy, assetType).Return(nil)
+		queue.On("Message").Return(nil, errors.New("invalid event data"))
+
+		updater := updating.NewService(mockStorage, updating.Config{Clock: clock, EventService: events})
+
+		_, err := updater.PinComment(ctx, c.UUID, pinnedBy, channelID, assetType)
+		assert.EqualError(t, err, "could not prepare events: invalid event data")
+
+		stored, err := listing.NewService(mockStorage).GetComment(ctx, c.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.False(t, stored.IsPinned())
+	})
+}
+
+func TestUpdateTextServiceValidation(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	assetType := comment.AssetTypeComment
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	mockStorage := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+
+	c, err := adding.NewService(mockStorage, adding.Config{Clock: clock}).
+		AddComment(ctx, comment.Comment{Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"), Text: "Test 1"}, channelID, assetType)
+	require.NoError(t, err)
+
+	validator := new(mocks.ValidatorMock)
+	validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(errors.New("invalid comment"))
+
+	updater := updating.NewService(mockStorage, updating.Config{Clock: clock, Validator: validator})
+
+	_, err = updater.UpdateText(ctx, c.UUID, "Test 2", comment.UserInfo{UUID: "439e2d19-8d50-405d-ad8e-cd33df344086"}, channelID, assetType)
+	assert.EqualError(t, err, "invalid comment")
+
+	stored, err := listing.NewService(mockStorage).GetComment(ctx, c.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, "Test 1", stored.Text)
+}
@@ -0,0 +1,81 @@
+package upserting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// Service provides synchronization of comments identified by external ID
+type Service interface {
+	// UpsertComment adds the comment with external ID created by c.CreatedBy or, if the entity already has
+	// the comment with the same external ID (including deleted ones), changes its text. AuthorizeUpdate is called
+	// before the existing comment is changed, its error is returned as is. It returns the stored comment
+	// and true if it was added.
+	UpsertComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, authorizeUpdate func() error) (stored *comment.Comment, created bool, err error)
+}
+
+// Repository provides access to the comments repository
+type Repository interface {
+	// GetComment returns the comment with specified ID
+	GetComment(ctx context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error)
+}
+
+// NewService creates an upserting service, new comments are added by the adding service
+// and the text of the existing ones is changed by the updating service
+func NewService(r Repository, adder adding.Service, updater updating.Service) Service {
+	return &service{
+		r:       r,
+		adder:   adder,
+		updater: updater,
+	}
+}
+
+type service struct {
+	r       Repository
+	adder   adding.Service
+	updater updating.Service
+}
+
+func (s *service) UpsertComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, authorizeUpdate func() error) (*comment.Comment, bool, error) {
+	// the comment with external ID always gets the same UUID, see adding.Service
+	id := repository.ExternalUUID(c.Entity, c.ExternalID)
+
+	_, err := s.r.GetComment(ctx, id, channelID, assetType)
+	if statusCode(err) == http.StatusNotFound {
+		added, err := s.adder.AddComment(ctx, c, channelID, assetType)
+		if statusCode(err) != http.StatusConflict {
+			return added, err == nil, err
+		}
+
+		// the comment was added concurrently, so its text is changed instead
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if err := authorizeUpdate(); err != nil {
+		return nil, false, err
+	}
+
+	updated, err := s.updater.UpdateText(ctx, id, c.Text, *c.CreatedBy, channelID, assetType)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return updated, false, nil
+}
+
+// statusCode returns HTTP status code of the repository error or 0 if err is not a repository error
+func statusCode(err error) int {
+	var repoErr *repository.Error
+	if errors.As(err, &repoErr) {
+		return repoErr.StatusCode()
+	}
+
+	return 0
+}
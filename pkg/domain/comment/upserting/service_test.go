@@ -0,0 +1,197 @@
+package upserting_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/upserting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/validation"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertCommentService(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	assetType := comment.AssetTypeComment
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	user := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+
+	newService := func(s *memory.Storage) upserting.Service {
+		return upserting.NewService(s, adding.NewService(s, adding.Config{Clock: clock}), updating.NewService(s, updating.Config{Clock: clock}))
+	}
+
+	allowed := func() error { return nil }
+
+	t.Run("comment is added and then updated", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		upserter := newService(mockStorage)
+
+		c := comment.Comment{Entity: e, Text: "Synchronized", ExternalID: "SN-0001", CreatedBy: &user}
+
+		created, isNew, err := upserter.UpsertComment(ctx, c, channelID, assetType, func() error {
+			t.Error("new comment must not be authorized for update")
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, repository.ExternalUUID(e, "SN-0001"), created.UUID)
+
+		c.Text = "Synchronized again"
+		updated, isNew, err := upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, created.UUID, updated.UUID)
+		assert.Equal(t, "Synchronized again", updated.Text)
+		assert.Len(t, updated.History, 1)
+	})
+
+	t.Run("existing comment is not changed if update is not authorized", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		upserter := newService(mockStorage)
+
+		c := comment.Comment{Entity: e, Text: "Synchronized", ExternalID: "SN-0001", CreatedBy: &user}
+		created, _, err := upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		require.NoError(t, err)
+
+		c.Text = "Changed"
+		_, _, err = upserter.UpsertComment(ctx, c, channelID, assetType, func() error {
+			return errors.New("forbidden")
+		})
+		assert.EqualError(t, err, "forbidden")
+
+		stored, err := listing.NewService(mockStorage).GetComment(ctx, created.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, "Synchronized", stored.Text)
+	})
+
+	t.Run("deleted comment is not added again", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		upserter := newService(mockStorage)
+
+		c := comment.Comment{Entity: e, Text: "Synchronized", ExternalID: "SN-0001", CreatedBy: &user}
+		created, _, err := upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		require.NoError(t, err)
+
+		_, err = deleting.NewService(mockStorage, deleting.Config{Clock: clock}).DeleteComment(ctx, created.UUID, user, channelID, assetType)
+		require.NoError(t, err)
+
+		_, _, err = upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		var repoErr *repository.Error
+		require.ErrorAs(t, err, &repoErr)
+		assert.Equal(t, http.StatusConflict, repoErr.StatusCode())
+		assert.EqualError(t, err, fmt.Sprintf("Comment with uuid='%s' is deleted", created.UUID))
+	})
+
+	t.Run("concurrent requests add one comment", func(t *testing.T) {
+		mockStorage := &memory.Storage{Clock: clock}
+		testutils.CreateDatabases(t, mockStorage, channelID)
+		upserter := newService(mockStorage)
+
+		const n = 10
+
+		var wg sync.WaitGroup
+		isNew := make([]bool, n)
+		errs := make([]error, n)
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := comment.Comment{Entity: e, Text: fmt.Sprintf("Synchronized %d", i), ExternalID: "SN-0001", CreatedBy: &user}
+				_, isNew[i], errs[i] = upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+			}(i)
+		}
+		wg.Wait()
+
+		var added int
+		for i := 0; i < n; i++ {
+			require.NoError(t, errs[i])
+			if isNew[i] {
+				added++
+			}
+		}
+		assert.Equal(t, 1, added, "only one request adds the comment")
+
+		result, err := mockStorage.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{"entity": e.String()}}, channelID, assetType)
+		require.NoError(t, err)
+		assert.Len(t, result.Result, 1)
+	})
+}
+
+func TestUpsertCommentServiceValidation(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	assetType := comment.AssetTypeComment
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	user := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+
+	// comments with external ID get version 5 UUIDs, the schema of stored comments must accept them
+	validator, err := validation.NewValidator()
+	require.NoError(t, err)
+
+	mockStorage := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, mockStorage, channelID)
+	adder := adding.NewService(mockStorage, adding.Config{Clock: clock, Validator: validator})
+	upserter := upserting.NewService(mockStorage, adder, updating.NewService(mockStorage, updating.Config{Clock: clock, Validator: validator}))
+
+	allowed := func() error { return nil }
+
+	t.Run("comment with external ID is added", func(t *testing.T) {
+		added, err := adder.AddComment(ctx, comment.Comment{Entity: e, Text: "Synchronized", ExternalID: "SN-0001", CreatedBy: &user}, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, repository.ExternalUUID(e, "SN-0001"), added.UUID)
+
+		reply, err := adder.AddComment(ctx, comment.Comment{Entity: e, Text: "Reply", ParentUUID: added.UUID, CreatedBy: &user}, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, added.UUID, reply.ParentUUID)
+	})
+
+	t.Run("comment is upserted", func(t *testing.T) {
+		c := comment.Comment{Entity: e, Text: "Synchronized", ExternalID: "SN-0002", CreatedBy: &user}
+
+		_, isNew, err := upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		require.NoError(t, err)
+		assert.True(t, isNew)
+
+		c.Text = "Synchronized again"
+		updated, isNew, err := upserter.UpsertComment(ctx, c, channelID, assetType, allowed)
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, "Synchronized again", updated.Text)
+	})
+}
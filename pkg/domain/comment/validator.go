@@ -0,0 +1,39 @@
+package comment
+
+import "time"
+
+// Validator validates the comment before it is stored
+type Validator interface {
+	// Validate returns error if the comment does not match the schema of stored comments
+	Validate(c Comment) error
+}
+
+// Clock provides current time, it enables mocking of the timestamps of the changes
+type Clock interface {
+	Now() time.Time
+}
+
+// Timestamp returns current time of the clock (system time if clock is nil) in the format of stored timestamps
+func Timestamp(clock Clock) string {
+	if clock == nil {
+		return FormatTimestamp(time.Now())
+	}
+
+	return FormatTimestamp(clock.Now())
+}
+
+// FormatTimestamp returns the time in the format of stored timestamps: RFC 3339 in UTC, so the timestamps
+// can be compared as strings regardless of the time zone of the server or the client
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ParseTimestamp parses RFC 3339 time (e.g. from a request) and returns it in the format of stored timestamps
+func ParseTimestamp(s string) (string, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatTimestamp(t), nil
+}
@@ -10,6 +10,9 @@ import (
 type Entity struct {
 	entity string
 	uuid   string
+
+	// raw is the reference in another format decoded from stored data, it is kept as is
+	raw string
 }
 
 // NewEntity returns Entity type referencing some <entity> with <uuid>
@@ -20,13 +23,36 @@ func NewEntity(entity, uuid string) Entity {
 	}
 }
 
+// Kind returns lower cased name of the referenced entity kind (e.g. incident)
+func (e Entity) Kind() string {
+	return strings.ToLower(e.entity)
+}
+
+// ID returns ID of the referenced entity
+func (e Entity) ID() string {
+	return e.uuid
+}
+
+// IsValid returns false if the entity reference was decoded from stored data in another format than "<entity>:<UUID>"
+func (e Entity) IsValid() bool {
+	return e.raw == ""
+}
+
 // String return string representation of Entity type
 func (e Entity) String() string {
+	if e.raw != "" {
+		return e.raw
+	}
+
 	return fmt.Sprintf("%s:%s", strings.ToLower(e.entity), e.uuid)
 }
 
 // MarshalJSON returns Entity as the JSON encoding of Entity
 func (e Entity) MarshalJSON() ([]byte, error) {
+	if e.raw != "" {
+		return json.Marshal(e.raw)
+	}
+
 	if e.entity == "" || e.uuid == "" {
 		return []byte(`""`), nil
 	}
@@ -34,7 +60,8 @@ func (e Entity) MarshalJSON() ([]byte, error) {
 	return json.Marshal(e.String())
 }
 
-// UnmarshalJSON sets *Entity values from JSON data
+// UnmarshalJSON sets *Entity values from JSON data. References in another format (e.g. in documents stored
+// before the format was enforced) are kept as is, so they can be read; input is validated by the Registry.
 func (e *Entity) UnmarshalJSON(data []byte) error {
 	var s string
 	err := json.Unmarshal(data, &s)
@@ -42,16 +69,28 @@ func (e *Entity) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	fields := strings.Split(s, ":")
-	if len(fields) != 2 {
+	if s == "" {
+		// empty entity, see MarshalJSON
 		return nil
 	}
 
-	entityName := strings.ToLower(fields[0])
-	entityUUID := fields[1]
+	parsed, err := Parse(s)
+	if err != nil {
+		*e = Entity{raw: s}
+		return nil
+	}
 
-	e.entity = entityName
-	e.uuid = entityUUID
+	*e = parsed
 
 	return nil
 }
+
+// Parse returns Entity from its string representation in the form "<entity>:<UUID>"
+func Parse(s string) (Entity, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+		return Entity{}, fmt.Errorf("invalid entity reference '%s', expected format <kind>:<id>", s)
+	}
+
+	return NewEntity(strings.ToLower(fields[0]), fields[1]), nil
+}
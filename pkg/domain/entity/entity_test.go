@@ -63,3 +63,32 @@ func TestEntity_UnmarshalJSON(t *testing.T) {
 	e := entity.NewEntity("incident", "79ee4c40-e86a-4df4-899d-a26ac5924058")
 	require.Equal(t, e, c.Entity)
 }
+
+func TestEntity_UnmarshalJSON_Invalid(t *testing.T) {
+	for _, e := range []string{"incident", "incident:", ":79ee4c40-e86a-4df4-899d-a26ac5924058", "incident:79ee4c40:e86a"} {
+		JSONData := []byte(`{"entity":"` + e + `","text":""}`)
+		c := comment.Comment{}
+
+		// stored comments with references in another format can be read
+		err := json.Unmarshal(JSONData, &c)
+		require.NoError(t, err)
+		require.False(t, c.Entity.IsValid())
+		require.Equal(t, e, c.Entity.String())
+
+		data, err := json.Marshal(c)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"entity":"`+e+`"}`, string(data), "reference is kept as is")
+
+		err = entity.DefaultRegistry().Validate("e27ddcd0-0e1f-4bc5-93df-f6f04155beec", c.Entity)
+		require.EqualError(t, err, "invalid entity reference '"+e+"', expected format <kind>:<id>")
+	}
+}
+
+func TestParse(t *testing.T) {
+	e, err := entity.Parse("Incident:79ee4c40-e86a-4df4-899d-a26ac5924058")
+	require.NoError(t, err)
+	require.Equal(t, entity.NewEntity("incident", "79ee4c40-e86a-4df4-899d-a26ac5924058"), e)
+
+	_, err = entity.Parse("incident")
+	require.EqualError(t, err, "invalid entity reference 'incident', expected format <kind>:<id>")
+}
@@ -0,0 +1,138 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// IDFormatUUID is the ID format of entities identified by UUID
+const IDFormatUUID = "uuid"
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// RegistryConfig contains allowed entity kinds with the format of their IDs (e.g. {"incident": "uuid"});
+// ID format is either "uuid" or regular expression the whole ID must match.
+// Channels can override default kinds with their own set.
+type RegistryConfig struct {
+	Default  map[string]string            `json:"default"`
+	Channels map[string]map[string]string `json:"channels,omitempty"`
+}
+
+// Registry validates entity references against the allowed entity kinds per channel
+type Registry struct {
+	defaults kinds
+	channels map[string]kinds
+}
+
+// kinds maps entity kind name to the ID format
+type kinds map[string]idFormat
+
+type idFormat struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// DefaultRegistry returns registry allowing built-in entity kinds (incident, request and k_request) identified by UUID
+func DefaultRegistry() *Registry {
+	r, _ := NewRegistry(RegistryConfig{
+		Default: map[string]string{
+			"incident":  IDFormatUUID,
+			"request":   IDFormatUUID,
+			"k_request": IDFormatUUID,
+		},
+	})
+
+	return r
+}
+
+// ParseRegistry creates registry from JSON encoded RegistryConfig
+func ParseRegistry(data string) (*Registry, error) {
+	var cfg RegistryConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("could not decode entity types configuration: %w", err)
+	}
+
+	return NewRegistry(cfg)
+}
+
+// NewRegistry creates registry from the configuration
+func NewRegistry(cfg RegistryConfig) (*Registry, error) {
+	defaults, err := newKinds(cfg.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := map[string]kinds{}
+	for channelID, c := range cfg.Channels {
+		k, err := newKinds(c)
+		if err != nil {
+			return nil, fmt.Errorf("channel '%s': %w", channelID, err)
+		}
+
+		channels[channelID] = k
+	}
+
+	return &Registry{defaults: defaults, channels: channels}, nil
+}
+
+func newKinds(cfg map[string]string) (kinds, error) {
+	if len(cfg) == 0 {
+		return nil, fmt.Errorf("no entity kinds defined")
+	}
+
+	k := kinds{}
+	for name, format := range cfg {
+		if format == IDFormatUUID {
+			k[strings.ToLower(name)] = idFormat{name: format, regex: uuidRegex}
+			continue
+		}
+
+		regex, err := regexp.Compile("^(?:" + format + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID format of entity kind '%s': %w", name, err)
+		}
+
+		k[strings.ToLower(name)] = idFormat{name: format, regex: regex}
+	}
+
+	return k, nil
+}
+
+// Validate returns error if the entity kind is not allowed in the channel or the entity ID has invalid format
+func (r *Registry) Validate(channelID string, e Entity) error {
+	if !e.IsValid() {
+		_, err := Parse(e.raw)
+		return err
+	}
+
+	k, ok := r.channels[channelID]
+	if !ok {
+		k = r.defaults
+	}
+
+	format, ok := k[e.Kind()]
+	if !ok {
+		return fmt.Errorf("unknown entity kind '%s', allowed kinds are: %s", e.Kind(), strings.Join(k.names(), ", "))
+	}
+
+	if !format.regex.MatchString(e.ID()) {
+		return fmt.Errorf("invalid entity '%s': ID '%s' does not match format '%s'", e, e.ID(), format.name)
+	}
+
+	return nil
+}
+
+// names returns sorted names of the entity kinds
+func (k kinds) names() []string {
+	names := make([]string, 0, len(k))
+	for name := range k {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,88 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Validate(t *testing.T) {
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	r, err := entity.ParseRegistry(`{
+		"default": {"incident": "uuid", "request": "uuid"},
+		"channels": {
+			"e27ddcd0-0e1f-4bc5-93df-f6f04155beec": {"incident": "uuid", "change": "CHG[0-9]+"}
+		}
+	}`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		channelID string
+		entity    entity.Entity
+		wantErr   string
+	}{
+		{
+			name:      "default kind",
+			channelID: "97671694-c01a-4294-8852-3500e6e5553e",
+			entity:    entity.NewEntity("request", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		},
+		{
+			name:      "upper case kind",
+			channelID: "97671694-c01a-4294-8852-3500e6e5553e",
+			entity:    entity.NewEntity("INCIDENT", "7E0D38D1-E5F5-4211-B2AA-3B142E4DA80E"),
+		},
+		{
+			name:      "kind not allowed by default",
+			channelID: "97671694-c01a-4294-8852-3500e6e5553e",
+			entity:    entity.NewEntity("change", "CHG0001"),
+			wantErr:   "unknown entity kind 'change', allowed kinds are: incident, request",
+		},
+		{
+			name:      "channel specific kind",
+			channelID: channelID,
+			entity:    entity.NewEntity("change", "CHG0001"),
+		},
+		{
+			name:      "kind not allowed in channel",
+			channelID: channelID,
+			entity:    entity.NewEntity("request", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+			wantErr:   "unknown entity kind 'request', allowed kinds are: change, incident",
+		},
+		{
+			name:      "malformed UUID",
+			channelID: channelID,
+			entity:    entity.NewEntity("incident", "7e0d38d1-e5f5-4211"),
+			wantErr:   "invalid entity 'incident:7e0d38d1-e5f5-4211': ID '7e0d38d1-e5f5-4211' does not match format 'uuid'",
+		},
+		{
+			name:      "ID partially matching pattern",
+			channelID: channelID,
+			entity:    entity.NewEntity("change", "xCHG0001"),
+			wantErr:   "invalid entity 'change:xCHG0001': ID 'xCHG0001' does not match format 'CHG[0-9]+'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(tt.channelID, tt.entity)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestParseRegistry(t *testing.T) {
+	_, err := entity.ParseRegistry(`{"default": {}}`)
+	require.EqualError(t, err, "no entity kinds defined")
+
+	_, err = entity.ParseRegistry(`{"default": {"incident": "uuid"}, "channels": {"e27ddcd0-0e1f-4bc5-93df-f6f04155beec": {"change": "CHG[0-9+"}}}`)
+	require.EqualError(t, err, "channel 'e27ddcd0-0e1f-4bc5-93df-f6f04155beec': invalid ID format of entity kind 'change': error parsing regexp: missing closing ]: `[0-9+)$`")
+
+	_, err = entity.ParseRegistry(`incident`)
+	require.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRelayInterval is the default delay between two checks of the outbox
+	defaultRelayInterval = time.Second
+
+	// defaultRelayBatchSize is the default number of messages read from the outbox at once
+	defaultRelayBatchSize = 100
+
+	// defaultRelayMaxBackoff is the default longest delay before the next attempt when publishing fails
+	defaultRelayMaxBackoff = time.Minute
+)
+
+// Outbox keeps messages of events stored together with the changes they describe until they are published
+type Outbox interface {
+	// PendingMessages returns at most limit messages not marked as sent yet, the oldest first
+	PendingMessages(ctx context.Context, limit int) ([]OutboxMessage, error)
+	// MarkSent marks the message as sent, so it is not returned by PendingMessages anymore
+	MarkSent(ctx context.Context, m OutboxMessage) error
+}
+
+// OutboxMessage is the message stored in the outbox
+type OutboxMessage struct {
+	// ID identifies the message in the outbox
+	ID string
+	Message
+}
+
+// RelayConfig contains dependencies and settings of the outbox relay
+type RelayConfig struct {
+	Client NATSClient
+	Outbox Outbox
+
+	// Interval is the delay between two checks of the outbox (default 1s)
+	Interval time.Duration
+
+	// BatchSize is the number of messages read from the outbox at once (default 100)
+	BatchSize int
+
+	// MaxBackoff is the longest delay before the next attempt when publishing fails, the delay starts
+	// at Interval and is doubled for each failed attempt (default 1m)
+	MaxBackoff time.Duration
+}
+
+// Relay publishes messages stored in the outbox to NATS and marks them as sent. Messages are published
+// at least once: the message published but not marked as sent (e.g. the service stopped in the meantime)
+// is published again. Messages are published in the order they were stored, the first failure stops
+// publishing until the next attempt.
+type Relay struct {
+	client NATSClient
+	outbox Outbox
+	logger *zap.Logger
+
+	interval   time.Duration
+	batchSize  int
+	maxBackoff time.Duration
+}
+
+// NewRelay creates new outbox relay
+func NewRelay(logger *zap.Logger, cfg RelayConfig) *Relay {
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = defaultRelayInterval
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultRelayBatchSize
+	}
+
+	maxBackoff := cfg.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultRelayMaxBackoff
+	}
+
+	return &Relay{
+		client:     cfg.Client,
+		outbox:     cfg.Outbox,
+		logger:     logger,
+		interval:   interval,
+		batchSize:  batchSize,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// Run publishes pending messages of the outbox until the context is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	delay := r.interval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		n, err := r.Flush(ctx)
+		switch {
+		case err != nil:
+			r.logger.Warn(fmt.Sprintf("outbox messages could not be published, next attempt in %s", delay), zap.Error(err))
+			timer.Reset(delay)
+
+			delay *= 2
+			if delay > r.maxBackoff {
+				delay = r.maxBackoff
+			}
+		case n == r.batchSize:
+			// there are probably more pending messages
+			delay = r.interval
+			timer.Reset(0)
+		default:
+			delay = r.interval
+			timer.Reset(r.interval)
+		}
+	}
+}
+
+// Flush publishes one batch of pending messages and marks them as sent. It returns the number of published messages.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	msgs, err := r.outbox.PendingMessages(ctx, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("could not read outbox: %v", err)
+	}
+
+	for i, m := range msgs {
+		if err := publishMessage(r.client, m.Message); err != nil {
+			return i, fmt.Errorf("could not publish events: %v", err)
+		}
+
+		if err := r.outbox.MarkSent(ctx, m); err != nil {
+			// the message is published again by the next attempt
+			return i, fmt.Errorf("could not mark outbox message %s as sent: %v", m.ID, err)
+		}
+	}
+
+	return len(msgs), nil
+}
@@ -0,0 +1,28 @@
+package event
+
+import "fmt"
+
+// Prepare creates new event queue, lets addEvents function fill it with events and returns their message,
+// the message is stored to the outbox together with the change and published by the relay.
+// It returns nil if the service is nil or there are no events.
+func Prepare(s Service, channelID, orgID string, addEvents func(q Queue) error) (*Message, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	q, err := s.NewQueue(UUID(channelID), UUID(orgID))
+	if err != nil {
+		return nil, fmt.Errorf("could not create event queue: %v", err)
+	}
+
+	if err = addEvents(q); err != nil {
+		return nil, fmt.Errorf("could not create event: %v", err)
+	}
+
+	m, err := q.Message()
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare events: %v", err)
+	}
+
+	return m, nil
+}
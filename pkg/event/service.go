@@ -20,10 +20,44 @@ type Service interface {
 type Queue interface {
 	// AddCreateEvent prepares new event of type CREATE
 	AddCreateEvent(c comment.Comment, assetType comment.AssetType) error
+	// AddMentionEvent prepares new event of type MENTIONED for the mentioned user
+	AddMentionEvent(c comment.Comment, mentioned comment.UserInfo, assetType comment.AssetType) error
+	// AddUpdateEvent prepares new event of type UPDATED for the comment with edited text
+	AddUpdateEvent(c comment.Comment, editedBy comment.UserInfo, assetType comment.AssetType) error
+	// AddReactEvent prepares new event of type REACTED for the user's reaction
+	AddReactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error
+	// AddUnreactEvent prepares new event of type UNREACTED for the removed user's reaction
+	AddUnreactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error
+	// AddReadEvent prepares new event of type READ for the comment read by the user
+	AddReadEvent(c comment.Comment, readBy comment.ReadBy, assetType comment.AssetType) error
+	// AddReadAllEvent prepares one event of type READ for all comments of the entity created at or before upTo
+	AddReadAllEvent(e entity.Entity, upTo string, readBy comment.ReadBy, assetType comment.AssetType) error
+	// AddPinEvent prepares new event of type PINNED
+	AddPinEvent(c comment.Comment, pinnedBy comment.UserInfo, assetType comment.AssetType) error
+	// AddUnpinEvent prepares new event of type UNPINNED
+	AddUnpinEvent(c comment.Comment, unpinnedBy comment.UserInfo, assetType comment.AssetType) error
+	// AddDeleteEvent prepares new event of type DELETE
+	AddDeleteEvent(c comment.Comment, assetType comment.AssetType) error
+	// AddRestoreEvent prepares new event of type RESTORE
+	AddRestoreEvent(c comment.Comment, assetType comment.AssetType) error
+	// AddConvertEvent prepares new event of type CONVERTED for the comment converted from another asset type
+	AddConvertEvent(c comment.Comment, convertedBy comment.UserInfo, assetType comment.AssetType) error
+	// AddMergeEvent prepares one event of type MERGED for all comments merged from another entity
+	AddMergeEvent(m comment.EntityMerge, uuids []string, assetType comment.AssetType) error
+	// Message returns the message of all prepared events not published yet and clears the queue,
+	// it returns nil if there are no events
+	Message() (*Message, error)
 	// PublishEvents publishes all prepared events not published yet
 	PublishEvents() error
 }
 
+// Message is the JSON message with the events of one queue, it is published to the service subject
+// and to the subject of the channel (consumed by websocket)
+type Message struct {
+	ChannelID UUID            `json:"channel_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
 // UUID represents UUID value
 type UUID string
 
@@ -47,7 +81,20 @@ type service struct {
 	client NATSClient
 }
 
-const eventCreated = "CREATED"
+const (
+	eventCreated   = "CREATED"
+	eventMentioned = "MENTIONED"
+	eventUpdated   = "UPDATED"
+	eventReacted   = "REACTED"
+	eventUnreacted = "UNREACTED"
+	eventRead      = "READ"
+	eventPinned    = "PINNED"
+	eventUnpinned  = "UNPINNED"
+	eventDeleted   = "DELETED"
+	eventRestored  = "RESTORED"
+	eventConverted = "CONVERTED"
+	eventMerged    = "MERGED"
+)
 
 // NewQueue creates new event queue
 func (s *service) NewQueue(channelID, orgID UUID) (Queue, error) {
@@ -68,24 +115,165 @@ func (s *service) NewQueue(channelID, orgID UUID) (Queue, error) {
 
 // AddCreateEvent prepares new event of type CREATE
 func (q *queue) AddCreateEvent(c comment.Comment, assetType comment.AssetType) error {
+	return q.addEvent(eventCreated, c, assetType)
+}
+
+// AddMentionEvent prepares new event of type MENTIONED for the mentioned user
+func (q *queue) AddMentionEvent(c comment.Comment, mentioned comment.UserInfo, assetType comment.AssetType) error {
+	return q.addUserEvent(eventMentioned, c, mentioned, assetType)
+}
+
+// AddUpdateEvent prepares new event of type UPDATED for the comment with edited text
+func (q *queue) AddUpdateEvent(c comment.Comment, editedBy comment.UserInfo, assetType comment.AssetType) error {
+	return q.addUserEvent(eventUpdated, c, editedBy, assetType)
+}
+
+// AddReactEvent prepares new event of type REACTED for the user's reaction
+func (q *queue) AddReactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error {
+	return q.addReactionEvent(eventReacted, c, reaction, assetType)
+}
+
+// AddUnreactEvent prepares new event of type UNREACTED for the removed user's reaction
+func (q *queue) AddUnreactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error {
+	return q.addReactionEvent(eventUnreacted, c, reaction, assetType)
+}
+
+// addReactionEvent prepares new event related to the user's reaction
+func (q *queue) addReactionEvent(eventType string, c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error {
+	e := newEvent(eventType, c, assetType)
+	e.User = &reaction.User
+	e.Emoji = reaction.Emoji
+
+	q.events = append(q.events, e)
+
+	return nil
+}
+
+// AddReadEvent prepares new event of type READ for the comment read by the user, the event contains the reader
+// and the time the comment was read
+func (q *queue) AddReadEvent(c comment.Comment, readBy comment.ReadBy, assetType comment.AssetType) error {
+	e := newEvent(eventRead, c, assetType)
+	e.User = &readBy.User
+	e.Time = readBy.Time
+
+	q.events = append(q.events, e)
+
+	return nil
+}
+
+// AddReadAllEvent prepares one event of type READ for all comments of the entity created at or before upTo,
+// the event has no comment UUID and contains the reader, the time and read_up_to
+func (q *queue) AddReadAllEvent(e entity.Entity, upTo string, readBy comment.ReadBy, assetType comment.AssetType) error {
+	q.events = append(q.events, event{
+		DocType:   assetType.String(),
+		EventType: eventRead,
+		Entity:    e,
+		User:      &readBy.User,
+		Time:      readBy.Time,
+		ReadUpTo:  upTo,
+	})
+
+	return nil
+}
+
+// AddPinEvent prepares new event of type PINNED
+func (q *queue) AddPinEvent(c comment.Comment, pinnedBy comment.UserInfo, assetType comment.AssetType) error {
+	return q.addUserEvent(eventPinned, c, pinnedBy, assetType)
+}
+
+// AddUnpinEvent prepares new event of type UNPINNED
+func (q *queue) AddUnpinEvent(c comment.Comment, unpinnedBy comment.UserInfo, assetType comment.AssetType) error {
+	return q.addUserEvent(eventUnpinned, c, unpinnedBy, assetType)
+}
+
+// AddDeleteEvent prepares new event of type DELETE
+func (q *queue) AddDeleteEvent(c comment.Comment, assetType comment.AssetType) error {
+	return q.addEvent(eventDeleted, c, assetType)
+}
+
+// AddRestoreEvent prepares new event of type RESTORE
+func (q *queue) AddRestoreEvent(c comment.Comment, assetType comment.AssetType) error {
+	return q.addEvent(eventRestored, c, assetType)
+}
+
+// AddConvertEvent prepares new event of type CONVERTED for the comment converted from another asset type
+func (q *queue) AddConvertEvent(c comment.Comment, convertedBy comment.UserInfo, assetType comment.AssetType) error {
+	e := newEvent(eventConverted, c, assetType)
+	e.User = &convertedBy
+	e.ConvertedFrom = c.ConvertedFrom.String()
+
+	q.events = append(q.events, e)
+
+	return nil
+}
+
+// AddMergeEvent prepares one event of type MERGED for all comments merged from another entity,
+// the event references the target entity and lists UUIDs of the merged comments
+func (q *queue) AddMergeEvent(m comment.EntityMerge, uuids []string, assetType comment.AssetType) error {
 	e := event{
+		DocType:        assetType.String(),
+		EventType:      eventMerged,
+		Entity:         m.Target,
+		User:           m.MergedBy,
+		OriginalEntity: &m.Source,
+		MergeMode:      m.Mode.String(),
+	}
+
+	for _, uuid := range uuids {
+		e.Merged = append(e.Merged, UUID(uuid))
+	}
+
+	q.events = append(q.events, e)
+
+	return nil
+}
+
+func (q *queue) addEvent(eventType string, c comment.Comment, assetType comment.AssetType) error {
+	q.events = append(q.events, newEvent(eventType, c, assetType))
+
+	return nil
+}
+
+// addUserEvent prepares new event related to the user (e.g. who made the change)
+func (q *queue) addUserEvent(eventType string, c comment.Comment, user comment.UserInfo, assetType comment.AssetType) error {
+	e := newEvent(eventType, c, assetType)
+	e.User = &user
+
+	q.events = append(q.events, e)
+
+	return nil
+}
+
+func newEvent(eventType string, c comment.Comment, assetType comment.AssetType) event {
+	return event{
 		DocType:   assetType.String(),
 		UUID:      UUID(c.UUID),
-		EventType: eventCreated,
+		EventType: eventType,
 		Entity:    c.Entity,
 		Text:      c.Text,
 		Origin:    c.Origin,
+		Parent:    UUID(c.ParentUUID),
 	}
+}
 
-	q.events = append(q.events, e)
+// Message returns the message of all prepared events not published yet and clears the queue,
+// it returns nil if there are no events
+func (q *queue) Message() (*Message, error) {
+	m, err := q.message()
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	// clear the events queue
+	q.events = nil
+
+	return m, nil
 }
 
-// PublishEvents publishes all prepared events not published yet
-func (q *queue) PublishEvents() error {
+// message returns the message of all prepared events, nil if the queue is empty
+func (q *queue) message() (*Message, error) {
 	if len(q.events) == 0 { // empty queue
-		return nil
+		return nil, nil
 	}
 
 	type finalEvent struct {
@@ -104,22 +292,20 @@ func (q *queue) PublishEvents() error {
 
 	mEvents, err := json.Marshal(fEvent)
 	if err != nil {
-		return errors.Wrap(err, "unable to marshal event")
+		return nil, errors.Wrap(err, "unable to marshal event")
 	}
 
-	err = q.client.Publish(natswatcher.Message{
-		Subject: "service",
-		Data:    mEvents,
-	})
-	if err != nil {
+	return &Message{ChannelID: q.channelID, Data: mEvents}, nil
+}
+
+// PublishEvents publishes all prepared events not published yet
+func (q *queue) PublishEvents() error {
+	m, err := q.message()
+	if err != nil || m == nil {
 		return err
 	}
 
-	err = q.client.Publish(natswatcher.Message{
-		Subject: string(q.channelID),
-		Data:    mEvents,
-	})
-	if err != nil {
+	if err := publishMessage(q.client, *m); err != nil {
 		return err
 	}
 
@@ -129,6 +315,22 @@ func (q *queue) PublishEvents() error {
 	return nil
 }
 
+// publishMessage publishes the message to the service subject and to the subject of the channel
+func publishMessage(client NATSClient, m Message) error {
+	err := client.Publish(natswatcher.Message{
+		Subject: "service",
+		Data:    m.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.Publish(natswatcher.Message{
+		Subject: string(m.ChannelID),
+		Data:    m.Data,
+	})
+}
+
 type queue struct {
 	client    NATSClient
 	channelID UUID
@@ -137,10 +339,23 @@ type queue struct {
 }
 
 type event struct {
-	DocType   string        `json:"docType"`
-	UUID      UUID          `json:"uuid"`
-	EventType string        `json:"event"`
-	Entity    entity.Entity `json:"entity"`
-	Text      string        `json:"text"`
-	Origin    string        `json:"origin"`
+	DocType   string            `json:"docType"`
+	UUID      UUID              `json:"uuid"`
+	EventType string            `json:"event"`
+	Entity    entity.Entity     `json:"entity"`
+	Text      string            `json:"text"`
+	Origin    string            `json:"origin"`
+	Parent    UUID              `json:"parent_uuid,omitempty"`
+	User      *comment.UserInfo `json:"user,omitempty"`
+	Emoji     string            `json:"emoji,omitempty"`
+	// Time is the time the comment was read for READ event
+	Time string `json:"time,omitempty"`
+	// ReadUpTo is set for READ event of all comments of the entity created at or before it
+	ReadUpTo string `json:"read_up_to,omitempty"`
+	// ConvertedFrom is the previous asset type (docType) of the converted comment
+	ConvertedFrom string `json:"converted_from,omitempty"`
+	// OriginalEntity is the merged entity, MergeMode and Merged (UUIDs of merged comments) are set for MERGED event
+	OriginalEntity *entity.Entity `json:"original_entity,omitempty"`
+	MergeMode      string         `json:"merge_mode,omitempty"`
+	Merged         []UUID         `json:"merged,omitempty"`
 }
@@ -1,7 +1,11 @@
 package event_test
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/KompiTech/go-toolkit/natswatcher"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
@@ -11,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func Test_Events_Publishing(t *testing.T) {
@@ -82,3 +87,559 @@ func Test_Events_Publishing(t *testing.T) {
 
 	client.AssertExpectations(t)
 }
+
+func Test_Delete_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"DELETED",
+					"text":"Test comment 1",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":""
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	c := comment.Comment{
+		UUID:   "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:   "Test comment 1",
+		Entity: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		// the rest is omitted
+	}
+
+	err = q.AddDeleteEvent(c, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_Mention_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"worknote",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"CREATED",
+					"text":"Hello @2af4f493-0bd5-4513-b440-6cbb465feadb",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":""
+				},
+				{
+					"docType":"worknote",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"MENTIONED",
+					"text":"Hello @2af4f493-0bd5-4513-b440-6cbb465feadb",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":"",
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	mentioned := comment.UserInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	c := comment.Comment{
+		UUID:     "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:     "Hello @2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Entity:   entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		Mentions: []comment.UserInfo{mentioned},
+		// the rest is omitted
+	}
+
+	err = q.AddCreateEvent(c, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+
+	err = q.AddMentionEvent(c, mentioned, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_React_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"REACTED",
+					"text":"Customer update",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":"",
+					"emoji":"thumbsup",
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	reaction := comment.Reaction{
+		Emoji: "thumbsup",
+		Time:  "2021-04-01T12:34:56+02:00",
+		User: comment.UserInfo{
+			UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+			Name:           "Joe",
+			Surname:        "Potato",
+			OrgName:        "23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+			OrgDisplayName: "Kompitech",
+		},
+	}
+
+	c := comment.Comment{
+		UUID:      "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:      "Customer update",
+		Entity:    entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		Reactions: comment.ReactionList{reaction},
+		// the rest is omitted
+	}
+
+	err = q.AddReactEvent(c, reaction, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_Read_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"READ",
+					"text":"Customer update",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":"",
+					"time":"2021-04-01T12:34:56+02:00",
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				},
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"READ",
+					"text":"",
+					"uuid":"",
+					"origin":"",
+					"time":"2021-04-01T12:34:56+02:00",
+					"read_up_to":"2021-04-01T10:00:00Z",
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	readBy := comment.ReadBy{
+		Time: "2021-04-01T12:34:56+02:00",
+		User: comment.UserInfo{
+			UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+			Name:           "Joe",
+			Surname:        "Potato",
+			OrgName:        "23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+			OrgDisplayName: "Kompitech",
+		},
+	}
+
+	c := comment.Comment{
+		UUID:   "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:   "Customer update",
+		Entity: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		// the rest is omitted
+	}
+
+	err = q.AddReadEvent(c, readBy, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	err = q.AddReadAllEvent(c.Entity, "2021-04-01T10:00:00Z", readBy, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_Convert_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"worknote",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"CONVERTED",
+					"text":"Internal note",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":"",
+					"converted_from":"comment",
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	convertedBy := comment.UserInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	c := comment.Comment{
+		UUID:          "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:          "Internal note",
+		Entity:        entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		ConvertedFrom: comment.AssetTypeComment,
+		ConvertedBy:   &convertedBy,
+		// the rest is omitted
+	}
+
+	err = q.AddConvertEvent(c, convertedBy, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_Merge_Event_Publishing(t *testing.T) {
+	client := new(mocks.NATSClientMock)
+	expectedData := []byte(`
+		{
+			"events":[
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"MERGED",
+					"text":"",
+					"uuid":"",
+					"origin":"",
+					"original_entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+					"merge_mode":"move",
+					"merged":["8de32c9d-8578-45a9-ab4b-32dd5c3008c7","0ac5ebce-17e7-4edc-9552-fefe16e127fb"],
+					"user":{
+						"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+						"name":"Joe",
+						"surname":"Potato",
+						"org_name":"23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+						"org_display_name":"Kompitech"
+					}
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`)
+
+	client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+		msgs := args.Get(0).([]natswatcher.Message)
+		assert.JSONEqf(t, string(expectedData), string(msgs[0].Data), "event queue message data is not correct")
+	}).Twice()
+
+	es := event.NewService(client)
+
+	q, err := es.NewQueue("97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234")
+	require.NoError(t, err)
+
+	m := comment.EntityMerge{
+		Source: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		Target: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+		Mode:   comment.MergeModeMove,
+		MergedBy: &comment.UserInfo{
+			UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+			Name:           "Joe",
+			Surname:        "Potato",
+			OrgName:        "23d1ddf9-107d-4555-a740-87ec5dd78234.kompitech.com",
+			OrgDisplayName: "Kompitech",
+		},
+	}
+
+	err = q.AddMergeEvent(m, []string{"8de32c9d-8578-45a9-ab4b-32dd5c3008c7", "0ac5ebce-17e7-4edc-9552-fefe16e127fb"}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	err = q.PublishEvents()
+	require.NoError(t, err)
+
+	client.AssertExpectations(t)
+}
+
+func Test_Prepare(t *testing.T) {
+	c := comment.Comment{
+		UUID:   "8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+		Text:   "Test comment 1",
+		Entity: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+	}
+
+	t.Run("events are prepared", func(t *testing.T) {
+		client := new(mocks.NATSClientMock)
+
+		m, err := event.Prepare(event.NewService(client), "97671694-c01a-4294-8852-3500e6e5553e", "23d1ddf9-107d-4555-a740-87ec5dd78234",
+			func(q event.Queue) error {
+				return q.AddCreateEvent(c, comment.AssetTypeComment)
+			})
+		require.NoError(t, err)
+		require.NotNil(t, m)
+
+		assert.Equal(t, event.UUID("97671694-c01a-4294-8852-3500e6e5553e"), m.ChannelID)
+		assert.JSONEq(t, `{
+			"events":[
+				{
+					"docType":"comment",
+					"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+					"event":"CREATED",
+					"text":"Test comment 1",
+					"uuid":"8de32c9d-8578-45a9-ab4b-32dd5c3008c7",
+					"origin":""
+				}
+			],
+			"source":"itsm",
+			"space_id":"97671694-c01a-4294-8852-3500e6e5553e",
+			"org_id":"23d1ddf9-107d-4555-a740-87ec5dd78234"
+		}`, string(m.Data))
+
+		client.AssertNotCalled(t, "Publish")
+	})
+
+	t.Run("invalid org ID", func(t *testing.T) {
+		client := new(mocks.NATSClientMock)
+
+		_, err := event.Prepare(event.NewService(client), "97671694-c01a-4294-8852-3500e6e5553e", "", func(q event.Queue) error {
+			return q.AddCreateEvent(c, comment.AssetTypeComment)
+		})
+		assert.EqualError(t, err, "could not create event queue: empty or invalid orgID param")
+	})
+
+	t.Run("nil service", func(t *testing.T) {
+		m, err := event.Prepare(nil, "97671694-c01a-4294-8852-3500e6e5553e", "", func(q event.Queue) error {
+			t.Fatal("no events are expected")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+	})
+}
+
+// outboxStub keeps messages of the outbox in memory
+type outboxStub struct {
+	mu   sync.Mutex
+	msgs []event.OutboxMessage
+	sent map[string]bool
+}
+
+func (o *outboxStub) PendingMessages(_ context.Context, limit int) ([]event.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []event.OutboxMessage
+	for _, m := range o.msgs {
+		if !o.sent[m.ID] && len(pending) < limit {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+func (o *outboxStub) MarkSent(_ context.Context, m event.OutboxMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sent[m.ID] = true
+	return nil
+}
+
+func Test_Relay(t *testing.T) {
+	newOutbox := func() *outboxStub {
+		return &outboxStub{
+			msgs: []event.OutboxMessage{
+				{ID: "1", Message: event.Message{ChannelID: "97671694-c01a-4294-8852-3500e6e5553e", Data: []byte(`{"events":[1]}`)}},
+				{ID: "2", Message: event.Message{ChannelID: "97671694-c01a-4294-8852-3500e6e5553e", Data: []byte(`{"events":[2]}`)}},
+			},
+			sent: make(map[string]bool),
+		}
+	}
+
+	t.Run("messages are published in order and marked as sent", func(t *testing.T) {
+		outbox := newOutbox()
+
+		var published []string
+		client := new(mocks.NATSClientMock)
+		client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil).Run(func(args mock.Arguments) {
+			msg := args.Get(0).([]natswatcher.Message)[0]
+			published = append(published, msg.Subject+" "+string(msg.Data))
+		})
+
+		relay := event.NewRelay(zap.NewNop(), event.RelayConfig{Client: client, Outbox: outbox})
+
+		n, err := relay.Flush(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []string{
+			`service {"events":[1]}`,
+			`97671694-c01a-4294-8852-3500e6e5553e {"events":[1]}`,
+			`service {"events":[2]}`,
+			`97671694-c01a-4294-8852-3500e6e5553e {"events":[2]}`,
+		}, published)
+		assert.Equal(t, map[string]bool{"1": true, "2": true}, outbox.sent)
+
+		n, err = relay.Flush(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("failed message stops publishing and is kept in the outbox", func(t *testing.T) {
+		outbox := newOutbox()
+
+		client := new(mocks.NATSClientMock)
+		client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(errors.New("nats: connection closed"))
+
+		relay := event.NewRelay(zap.NewNop(), event.RelayConfig{Client: client, Outbox: outbox})
+
+		n, err := relay.Flush(context.Background())
+		assert.EqualError(t, err, "could not publish events: nats: connection closed")
+		assert.Equal(t, 0, n)
+		assert.Empty(t, outbox.sent)
+		client.AssertNumberOfCalls(t, "Publish", 1)
+	})
+
+	t.Run("pending messages are published until the relay is stopped", func(t *testing.T) {
+		outbox := newOutbox()
+
+		client := new(mocks.NATSClientMock)
+		client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(errors.New("nats: timeout")).Once()
+		client.On("Publish", mock.AnythingOfType("[]natswatcher.Message")).Return(nil)
+
+		relay := event.NewRelay(zap.NewNop(), event.RelayConfig{Client: client, Outbox: outbox, Interval: time.Millisecond})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			relay.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			pending, _ := outbox.PendingMessages(ctx, 10)
+			return len(pending) == 0
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		<-done
+	})
+}
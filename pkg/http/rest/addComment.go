@@ -1,14 +1,17 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
 	"github.com/julienschmidt/httprouter"
@@ -16,25 +19,35 @@ import (
 )
 
 // swagger:route POST /comments comments AddComment
-// Creates a new comment
+// Creates a new comment; retried request with the same Idempotency-Key header replays the original response
 // responses:
 //	201: commentCreatedResponse
 //	400: errorResponse400
 //	401: errorResponse401
 //  403: errorResponse403
 //	409: errorResponse409
+//	422: errorResponse422
 
 // swagger:route POST /worknotes worknotes AddWorknote
-// Creates a new worknote
+// Creates a new worknote; retried request with the same Idempotency-Key header replays the original response
 // responses:
 //	201: commentCreatedResponse
 //	400: errorResponse400
 //	401: errorResponse401
 //	403: errorResponse403
 //	409: errorResponse409
+//	422: errorResponse422
 
 // AddComment returns handler for creating single comment|worknote
 func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	type requestBody struct {
+		comment.Comment
+		// UUIDs of mentioned users
+		Mentions []string `json:"mentions"`
+		// values of the custom template variables
+		Variables map[string]string `json:"variables"`
+	}
+
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		s.logger.Info("AddComment handler called")
 
@@ -50,8 +63,6 @@ func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
-		var newComment comment.Comment
-
 		err = s.payloadValidator.ValidatePayload(payload, "add_comment.yaml")
 		if err != nil {
 			var errGeneral *validation.ErrGeneral
@@ -66,7 +77,8 @@ func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
-		err = json.Unmarshal(payload, &newComment)
+		var request requestBody
+		err = json.Unmarshal(payload, &request)
 		if err != nil {
 			eMsg := "could not decode JSON from request"
 			s.logger.Warn(eMsg, zap.Error(err))
@@ -74,11 +86,27 @@ func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
+		newComment := request.Comment
+
+		if newComment.TemplateID != "" && newComment.Text != "" {
+			eMsg := "'text' cannot be used together with 'template_id', the text is rendered from the template"
+			s.logger.Warn("invalid payload", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
 		channelID, err := s.assertChannelID(w, r)
 		if err != nil {
 			return
 		}
 
+		err = s.entityTypes.Validate(channelID, newComment.Entity)
+		if err != nil {
+			s.logger.Warn("invalid entity", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		user, ok := s.UserInfoFromRequest(r)
 		if !ok {
 			eMsg := "could not get invoking user from context"
@@ -97,8 +125,56 @@ func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWri
 			OrgDisplayName: user.OrgDisplayName,
 		}
 
+		if newComment.TemplateID != "" {
+			err = s.applyTemplate(r.Context(), &newComment, request.Variables, channelID, assetType)
+			if err != nil {
+				var variablesError *comment.TemplateVariablesError
+				if errors.As(err, &variablesError) {
+					s.logger.Warn("AddComment handler failed", zap.Error(err))
+					s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				s.writeRepositoryError("AddComment", w, err)
+				return
+			}
+		}
+
+		idempotencyRecord, ok := s.reserveIdempotencyKey(w, r, payload, user.UUID, channelID, assetType)
+		if !ok {
+			return
+		}
+
+		if idempotencyRecord != nil {
+			defer func() {
+				if idempotencyRecord.IsPending() {
+					s.releaseIdempotencyKey(r, *idempotencyRecord, channelID, assetType)
+				}
+			}()
+		}
+
+		newComment.Mentions, err = s.resolveMentions(r, append(request.Mentions, comment.MentionedUUIDs(newComment.Text)...))
+		if err != nil {
+			if errors.Is(err, usersvc.ErrUserNotFound) {
+				s.logger.Warn("AddComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			s.logger.Error("AddComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		storedComment, err := s.adder.AddComment(r.Context(), newComment, channelID, assetType)
 		if err != nil {
+			var lockedError *comment.ThreadLockedError
+			if errors.As(err, &lockedError) {
+				s.logger.Warn("AddComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusConflict)
+				return
+			}
+
 			var httpError *repository.Error
 			if errors.As(err, &httpError) {
 				s.logger.Warn("AddComment handler failed", zap.Error(err))
@@ -111,22 +187,93 @@ func (s *Server) AddComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
-		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, pluralize(assetType), storedComment.UUID)
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, assetType.Plural(), storedComment.UUID)
 
-		w.Header().Set("Location", assetURI)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-
-		err = json.NewEncoder(w).Encode(storedComment)
+		body, err := json.Marshal(storedComment)
 		if err != nil {
 			eMsg := "could not encode JSON response"
 			s.logger.Error(eMsg, zap.Error(err))
 			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
 			return
 		}
+
+		if idempotencyRecord != nil {
+			idempotencyRecord.UUID = storedComment.UUID
+			idempotencyRecord.StatusCode = http.StatusCreated
+			idempotencyRecord.Location = assetURI
+			idempotencyRecord.Body = string(body)
+			s.completeIdempotencyKey(r, *idempotencyRecord, channelID, assetType)
+		}
+
+		w.Header().Set("Location", assetURI)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintln(w, string(body))
+	}
+}
+
+// applyTemplate renders text of the new comment from its template using the custom variables of the request
+// and the built-in variables of the entity and the invoking user (built-in variables cannot be overridden)
+func (s *Server) applyTemplate(ctx context.Context, c *comment.Comment, variables map[string]string, channelID string, assetType comment.AssetType) error {
+	t, err := s.templater.GetTemplate(ctx, c.TemplateID, channelID)
+	if err != nil {
+		var httpError *repository.Error
+		if errors.As(err, &httpError) && httpError.StatusCode() == http.StatusNotFound {
+			eMsg := fmt.Sprintf("%s could not be added: template with uuid='%s' does not exist", strings.Title(assetType.String()), c.TemplateID)
+			return repository.NewError(eMsg, http.StatusBadRequest)
+		}
+
+		return err
+	}
+
+	vars := make(map[string]string, len(variables)+5)
+	for name, value := range variables {
+		vars[name] = value
 	}
+
+	vars["entity"] = c.Entity.String()
+	vars["user.name"] = c.CreatedBy.Name
+	vars["user.surname"] = c.CreatedBy.Surname
+	vars["user.org_name"] = c.CreatedBy.OrgName
+	vars["user.org_display_name"] = c.CreatedBy.OrgDisplayName
+
+	c.Text, err = t.Render(vars)
+	if err != nil {
+		return err
+	}
+
+	if c.ContentType == "" {
+		c.ContentType = t.ContentType
+	}
+
+	return nil
 }
 
-func pluralize(assetType comment.AssetType) string {
-	return fmt.Sprintf("%ss", assetType)
+// resolveMentions returns info about each mentioned user, duplicate UUIDs are skipped
+func (s *Server) resolveMentions(r *http.Request, uuids []string) ([]comment.UserInfo, error) {
+	var mentions []comment.UserInfo
+	resolved := map[string]bool{}
+
+	for _, uuid := range uuids {
+		uuid = strings.ToLower(uuid)
+		if resolved[uuid] {
+			continue
+		}
+
+		u, err := s.userService.UserInfo(r, uuid)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve mentioned user '%s': %w", uuid, err)
+		}
+
+		resolved[uuid] = true
+		mentions = append(mentions, comment.UserInfo{
+			UUID:           u.UUID,
+			Name:           u.Name,
+			Surname:        u.Surname,
+			OrgName:        u.OrgName,
+			OrgDisplayName: u.OrgDisplayName,
+		})
+	}
+
+	return mentions, nil
 }
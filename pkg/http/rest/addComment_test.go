@@ -3,19 +3,24 @@ package rest
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
 	pvalidation "github.com/KompiTech/itsm-commenting-service/pkg/validation"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
@@ -332,6 +337,279 @@ func TestAddCommentHandler(t *testing.T) {
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 
+	t.Run("when entity thread is locked", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		lock := comment.ThreadLock{
+			Entity: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+			Reason: "Incident is closed",
+		}
+
+		adder := new(mocks.AddingMock)
+		adder.On("AddComment", mock.AnythingOfType("comment.Comment"), channelID, assetType).
+			Return("", &comment.ThreadLockedError{Lock: lock, AssetType: assetType})
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "test with entity 1"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment could not be added: comments of entity 'incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' are locked (Incident is closed)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment is created from the template", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("GetTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", channelID).
+			Return(comment.Template{
+				UUID:        "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+				Name:        "Resolved",
+				Text:        "{{entity}} was resolved in {{ minutes }} minutes. Regards, {{user.name}} ({{user.org_display_name}})",
+				ContentType: comment.ContentTypeMarkdown,
+			}, nil)
+
+		adder := new(mocks.AddingMock)
+		adder.On("AddComment", mock.MatchedBy(func(c comment.Comment) bool {
+			return c.Text == "incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e was resolved in 15 minutes. Regards, Some test user 1 (Kompitech)" &&
+				c.TemplateID == "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52" &&
+				c.ContentType == comment.ContentTypeMarkdown
+		}), channelID, assetType).
+			Return("38316161-3035-4864-ad30-6231392d3433", nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			TemplatingService:       templater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"template_id":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+			"variables":{"minutes":"15","entity":"overridden"}
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		adder.AssertExpectations(t)
+	})
+
+	t.Run("when template variables are missing", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("GetTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", channelID).
+			Return(comment.Template{
+				UUID: "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+				Text: "{{entity}} was resolved in {{minutes}} minutes",
+			}, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			Logger:            logger,
+			AuthService:       as,
+			UserService:       us,
+			TemplatingService: templater,
+			PayloadValidator:  pv,
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"template_id":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Template 'c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' could not be rendered: missing value of variables: minutes"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when template does not exist", func(t *testing.T) {
+		assetType := comment.AssetTypeWorknote
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("GetTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", channelID).
+			Return(comment.Template{}, couchdb.ErrorNorFound("Template could not be retrieved: Template with uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' does not exist"))
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			Logger:            logger,
+			AuthService:       as,
+			UserService:       us,
+			TemplatingService: templater,
+			PayloadValidator:  pv,
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"template_id":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/worknotes", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Worknote could not be added: template with uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when both text and template are set", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      us,
+			PayloadValidator: pv,
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "test with entity 1",
+			"template_id":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"'text' cannot be used together with 'template_id', the text is rendered from the template"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
 	t.Run("when repository returns some other general error", func(t *testing.T) {
 		assetType := comment.AssetTypeComment
 		as := new(mocks.AuthServiceMock)
@@ -341,10 +619,230 @@ func TestAddCommentHandler(t *testing.T) {
 		us := new(mocks.UserServiceMock)
 		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
 			Return(mockUserData, nil)
-
-		adder := new(mocks.AddingMock)
-		adder.On("AddComment", mock.AnythingOfType("comment.Comment"), channelID, assetType).
-			Return("", errors.New("some error occurred"))
+
+		adder := new(mocks.AddingMock)
+		adder.On("AddComment", mock.AnythingOfType("comment.Comment"), channelID, assetType).
+			Return("", errors.New("some error occurred"))
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "test with entity 1"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{"error":"some error occurred"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when events could not be prepared (event queue returns error)", func(t *testing.T) {
+		orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		validator := new(mocks.ValidatorMock)
+		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
+		queue.On("Message").Return(nil, errors.New("invalid event data"))
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		mocks.ExpectThreadNotLocked(couchMock, testutils.DatabaseName(channelID, assetType), "incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
+
+		// the comment is not stored
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, assetType)).WillReturn(db)
+
+		adder := adding.NewService(s, adding.Config{Validator: validator, EventService: events, Rand: mocks.NewRand()})
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "test with entity 1"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{"error":"could not prepare events: invalid event data"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when users are mentioned in the text and in the payload", func(t *testing.T) {
+		orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+
+		mentionedInText := user.BasicInfo{
+			UUID:           "8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+			Name:           "Alice",
+			Surname:        "Cooper",
+			OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+			OrgDisplayName: "Kompitech",
+		}
+		mentionedInPayload := user.BasicInfo{
+			UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+			Name:           "Joe",
+			Surname:        "Potato",
+			OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+			OrgDisplayName: "Kompitech",
+		}
+
+		assetType := comment.AssetTypeWorknote
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+		us.On("UserInfo", mock.AnythingOfType("*http.Request"), mentionedInPayload.UUID).
+			Return(mentionedInPayload, nil).Once()
+		us.On("UserInfo", mock.AnythingOfType("*http.Request"), mentionedInText.UUID).
+			Return(mentionedInText, nil).Once()
+
+		validator := new(mocks.ValidatorMock)
+		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
+
+		events := new(mocks.EventServiceMock)
+		queue := new(mocks.QueueMock)
+		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
+		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil).Once()
+		queue.On("AddMentionEvent", mock.AnythingOfType("comment.Comment"), comment.UserInfo(mentionedInPayload), assetType).Return(nil).Once()
+		queue.On("AddMentionEvent", mock.AnythingOfType("comment.Comment"), comment.UserInfo(mentionedInText), assetType).Return(nil).Once()
+		queue.On("Message").Return(nil, nil)
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		mocks.ExpectThreadNotLocked(couchMock, testutils.DatabaseName(channelID, assetType), "incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, assetType)).WillReturn(db)
+		db.ExpectPut().WithDocID(mocks.GeneratedCommentUUID)
+
+		adder := adding.NewService(s, adding.Config{Validator: validator, EventService: events, Rand: mocks.NewRand()})
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "@8540d943-8ccd-4ff1-8a08-0c3aa338c58e could you check it with @439e2d19-8d50-405d-ad8e-cd33df344086?",
+			"mentions": ["439e2d19-8d50-405d-ad8e-cd33df344086"]
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/worknotes", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+
+		var created comment.Comment
+		err = json.Unmarshal(b, &created)
+		require.NoError(t, err)
+		assert.Equal(t, []comment.UserInfo{comment.UserInfo(mentionedInPayload), comment.UserInfo(mentionedInText)}, created.Mentions)
+
+		us.AssertExpectations(t)
+		queue.AssertExpectations(t)
+	})
+
+	t.Run("when mentioned user does not exist", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+		us.On("UserInfo", mock.AnythingOfType("*http.Request"), "8540d943-8ccd-4ff1-8a08-0c3aa338c58e").
+			Return(user.BasicInfo{}, usersvc.ErrUserNotFound)
 
 		pv, err := validation.NewPayloadValidator()
 		require.NoError(t, err)
@@ -354,14 +852,13 @@ func TestAddCommentHandler(t *testing.T) {
 			Logger:                  logger,
 			AuthService:             as,
 			UserService:             us,
-			AddingService:           adder,
 			PayloadValidator:        pv,
 			ExternalLocationAddress: "http://service.url",
 		})
 
 		payload := []byte(`{
 			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
-			"text": "test with entity 1"
+			"text": "Hello @8540d943-8ccd-4ff1-8a08-0c3aa338c58e"
 		}`)
 
 		body := bytes.NewReader(payload)
@@ -379,16 +876,70 @@ func TestAddCommentHandler(t *testing.T) {
 			t.Fatalf("could not read response: %v", err)
 		}
 
-		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Status code")
-		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
 
-		expectedJSON := `{"error":"some error occurred"}`
+		expectedJSON := `{"error":"could not resolve mentioned user '8540d943-8ccd-4ff1-8a08-0c3aa338c58e': user not found"}`
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 
-	t.Run("when event could not be published (event service returns error)", func(t *testing.T) {
-		orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
+	t.Run("when entity kind is not allowed in the channel", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		entityTypes, err := entity.NewRegistry(entity.RegistryConfig{
+			Default: map[string]string{"incident": entity.IDFormatUUID},
+			Channels: map[string]map[string]string{
+				channelID: {"incident": entity.IDFormatUUID, "request": entity.IDFormatUUID},
+			},
+		})
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			EntityTypes:             entityTypes,
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"change:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text": "test with entity 1"
+		}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"unknown entity kind 'change', allowed kinds are: incident, request"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
 
+	t.Run("when entity ID has invalid format", func(t *testing.T) {
 		assetType := comment.AssetTypeComment
 		as := new(mocks.AuthServiceMock)
 		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
@@ -398,40 +949,86 @@ func TestAddCommentHandler(t *testing.T) {
 		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
 			Return(mockUserData, nil)
 
-		validator := new(mocks.ValidatorMock)
-		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
 
-		events := new(mocks.EventServiceMock)
-		queue := new(mocks.QueueMock)
-		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
-		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
-		queue.On("PublishEvents").Return(errors.New("some NATS error"))
+		entityTypes, err := entity.NewRegistry(entity.RegistryConfig{
+			Default: map[string]string{"incident": entity.IDFormatUUID},
+			Channels: map[string]map[string]string{
+				channelID: {"incident": entity.IDFormatUUID, "request": entity.IDFormatUUID},
+			},
+		})
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			EntityTypes:             entityTypes,
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity":"incident:7e0d38d1",
+			"text": "test with entity 1"
+		}`)
 
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, events)
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/comments", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
 
-		db := couchMock.NewDB()
-		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, assetType)).WillReturn(db)
-		expRev := "6067f156-c811-4b36-acfe-c9f4d1c491bc"
-		db.ExpectPut().WithDocID(mocks.GeneratedCommentUUID).WillReturn(expRev)
-		db.ExpectDelete().WithDocID(mocks.GeneratedCommentUUID).WithRev(expRev)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"invalid entity 'incident:7e0d38d1': ID '7e0d38d1' does not match format 'uuid'"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when entity reference is malformed", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
 
-		adder := adding.NewService(s)
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
 
 		pv, err := validation.NewPayloadValidator()
 		require.NoError(t, err)
 
+		entityTypes, err := entity.NewRegistry(entity.RegistryConfig{
+			Default: map[string]string{"incident": entity.IDFormatUUID},
+			Channels: map[string]map[string]string{
+				channelID: {"incident": entity.IDFormatUUID, "request": entity.IDFormatUUID},
+			},
+		})
+		require.NoError(t, err)
+
 		server := NewServer(Config{
 			Addr:                    "service.url",
+			EntityTypes:             entityTypes,
 			Logger:                  logger,
 			AuthService:             as,
 			UserService:             us,
-			AddingService:           adder,
 			PayloadValidator:        pv,
 			ExternalLocationAddress: "http://service.url",
 		})
 
 		payload := []byte(`{
-			"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"entity":"incident:7e0d38d1:e5f5",
 			"text": "test with entity 1"
 		}`)
 
@@ -450,10 +1047,9 @@ func TestAddCommentHandler(t *testing.T) {
 			t.Fatalf("could not read response: %v", err)
 		}
 
-		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Status code")
-		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
 
-		expectedJSON := `{"error":"could not publish events: some NATS error"}`
+		expectedJSON := `{"error":"/entity: regexp pattern ^[^:\\s]+:[^:\\s]+$ mismatch on string: incident:7e0d38d1:e5f5"}`
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 
@@ -545,3 +1141,198 @@ func TestAddCommentHandler(t *testing.T) {
 		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), "Location header")
 	})
 }
+
+func TestAddCommentHandlerIdempotency(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+	assetType := comment.AssetTypeComment
+	idempotencyKey := "5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10"
+
+	payload := []byte(`{"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e","text":"test with entity 1"}`)
+	// sha256 of the payload
+	requestHash := "e11b893646e234aa3ad7145fa9ee26b14963160bf0b3136875bc054697d495b9"
+
+	newServer := func(adder *mocks.AddingMock, idempotency *mocks.IdempotencyMock) *Server {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		return NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			AddingService:           adder,
+			IdempotencyService:      idempotency,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+	}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "/comments", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+		return req
+	}
+
+	isReserved := func(r repository.IdempotencyRecord) bool {
+		// pending reservation expires after the default pending timeout, not the whole TTL
+		return r.Key == idempotencyKey && r.UserUUID == mockUserData.UUID && r.RequestHash == requestHash && r.IsPending() &&
+			r.ExpiresAt.Before(time.Now().Add(defaultIdempotencyPendingTimeout+time.Second))
+	}
+
+	t.Run("when idempotency key is used for the first time", func(t *testing.T) {
+		adder := new(mocks.AddingMock)
+		adder.On("AddComment", mock.AnythingOfType("comment.Comment"), channelID, assetType).
+			Return("38316161-3035-4864-ad30-6231392d3433", nil)
+
+		idempotency := new(mocks.IdempotencyMock)
+		idempotency.On("ReserveIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(nil, nil)
+		idempotency.On("CompleteIdempotencyKey", mock.MatchedBy(func(r repository.IdempotencyRecord) bool {
+			return r.Key == idempotencyKey &&
+				r.UserUUID == mockUserData.UUID &&
+				r.RequestHash == requestHash &&
+				r.ExpiresAt.After(time.Now().Add(defaultIdempotencyKeyTTL-time.Minute)) &&
+				r.UUID == "38316161-3035-4864-ad30-6231392d3433" &&
+				r.StatusCode == http.StatusCreated &&
+				r.Location == "http://service.url/comments/38316161-3035-4864-ad30-6231392d3433" &&
+				r.Body != ""
+		}), channelID, assetType).Return(nil)
+
+		server := newServer(adder, idempotency)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, newRequest())
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		assert.Empty(t, resp.Header.Get("Idempotent-Replayed"), "Idempotent-Replayed header")
+
+		idempotency.AssertExpectations(t)
+	})
+
+	t.Run("when request with the same idempotency key is retried", func(t *testing.T) {
+		adder := new(mocks.AddingMock)
+
+		idempotency := new(mocks.IdempotencyMock)
+		idempotency.On("ReserveIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(&repository.IdempotencyRecord{
+				Key:         idempotencyKey,
+				RequestHash: requestHash,
+				UUID:        "38316161-3035-4864-ad30-6231392d3433",
+				StatusCode:  http.StatusCreated,
+				Location:    "http://service.url/comments/38316161-3035-4864-ad30-6231392d3433",
+				Body:        `{"uuid":"38316161-3035-4864-ad30-6231392d3433","entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e","text":"test with entity 1"}`,
+			}, nil)
+
+		server := newServer(adder, idempotency)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, newRequest())
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		assert.Equal(t, "http://service.url/comments/38316161-3035-4864-ad30-6231392d3433", resp.Header.Get("Location"), "Location header")
+		assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"), "Idempotent-Replayed header")
+
+		expectedJSON := `{"uuid":"38316161-3035-4864-ad30-6231392d3433","entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e","text":"test with entity 1"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		adder.AssertNotCalled(t, "AddComment", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("when request with the same idempotency key is still being processed", func(t *testing.T) {
+		idempotency := new(mocks.IdempotencyMock)
+		idempotency.On("ReserveIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(&repository.IdempotencyRecord{Key: idempotencyKey, RequestHash: requestHash}, nil)
+
+		server := newServer(new(mocks.AddingMock), idempotency)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, newRequest())
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"request with Idempotency-Key '5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10' is already being processed"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when idempotency key was used for a different request", func(t *testing.T) {
+		idempotency := new(mocks.IdempotencyMock)
+		idempotency.On("ReserveIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(&repository.IdempotencyRecord{Key: idempotencyKey, RequestHash: "someOtherHash", StatusCode: http.StatusCreated}, nil)
+
+		server := newServer(new(mocks.AddingMock), idempotency)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, newRequest())
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Idempotency-Key '5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10' was already used for a different request"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment could not be added (eg. events could not be published)", func(t *testing.T) {
+		adder := new(mocks.AddingMock)
+		adder.On("AddComment", mock.AnythingOfType("comment.Comment"), channelID, assetType).
+			Return("", errors.New("could not publish events: nats: timeout"))
+
+		idempotency := new(mocks.IdempotencyMock)
+		idempotency.On("ReserveIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(nil, nil)
+		idempotency.On("ReleaseIdempotencyKey", mock.MatchedBy(isReserved), channelID, assetType).
+			Return(nil)
+
+		server := newServer(adder, idempotency)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, newRequest())
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Status code")
+
+		idempotency.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route POST /comments/{uuid}/convert comments ConvertComment
+// Converts specified comment to worknote (or to asset type given by 'to' query param), the comment keeps its UUID
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route POST /worknotes/{uuid}/convert worknotes ConvertWorknote
+// Converts specified worknote to comment (or to asset type given by 'to' query param), the worknote keeps its UUID
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// ConvertComment returns handler for converting comment|worknote to another asset type
+func (s *Server) ConvertComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("ConvertComment handler called")
+
+		target, err := s.convertTarget(assetType, r.URL.Query().Get("to"))
+		if err != nil {
+			s.logger.Warn("ConvertComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// user has to be allowed to read the source and to create the target asset
+		if err := s.authorize("ConvertComment", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		if err := s.authorize("ConvertComment", target.String(), auth.CreateAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("ConvertComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		convertedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		converted, err := s.updater.ConvertComment(r.Context(), id, convertedBy, channelID, assetType, target)
+		if err != nil {
+			s.writeRepositoryError("ConvertComment", w, err)
+			return
+		}
+
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, target.Plural(), id)
+
+		w.Header().Set("Location", assetURI)
+
+		s.presenter.WriteGetResponse(r, w, *converted, target)
+	}
+}
+
+// convertTarget returns the asset type the comment is converted to, comments and worknotes are converted
+// to each other by default, other asset types require the target to be specified
+func (s *Server) convertTarget(assetType comment.AssetType, to string) (comment.AssetType, error) {
+	target := comment.AssetType(to)
+
+	if target == "" {
+		switch assetType {
+		case comment.AssetTypeComment:
+			target = comment.AssetTypeWorknote
+		case comment.AssetTypeWorknote:
+			target = comment.AssetTypeComment
+		default:
+			return "", fmt.Errorf("missing 'to' query param")
+		}
+	}
+
+	if !s.assetTypes.Contains(target) {
+		return "", fmt.Errorf("invalid 'to' query param: unknown asset type '%s'", target)
+	}
+
+	if target == assetType {
+		return "", fmt.Errorf("invalid 'to' query param: %s cannot be converted to %s", assetType, target)
+	}
+
+	return target, nil
+}
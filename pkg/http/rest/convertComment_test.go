@@ -0,0 +1,209 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	convertedBy := comment.UserInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+	uuid := "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+
+	t.Run("when user is not authorized to CREATE the worknote", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "worknote", auth.CreateAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/"+uuid+"/convert", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (worknote, create)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment is converted to worknote", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "worknote", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		converted := &comment.Comment{
+			UUID:          uuid,
+			Entity:        entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			Text:          "Internal note",
+			ConvertedFrom: comment.AssetTypeComment,
+			ConvertedAt:   "2021-04-01T12:34:56+02:00",
+			ConvertedBy:   &convertedBy,
+		}
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("ConvertComment", uuid, convertedBy, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote).
+			Return(converted, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/comments/"+uuid+"/convert", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "http://service.url/worknotes/"+uuid, resp.Header.Get("Location"), "Location header")
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "comment", body["converted_from"])
+		assert.Contains(t, body["_links"], "self")
+
+		as.AssertExpectations(t)
+		updater.AssertExpectations(t)
+	})
+
+	t.Run("when target asset type is not registered", func(t *testing.T) {
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/worknotes/"+uuid+"/convert?to=resolution_note", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"invalid 'to' query param: unknown asset type 'resolution_note'"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when worknote has replies", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("ConvertComment", uuid, convertedBy, channelID, comment.AssetTypeWorknote, comment.AssetTypeComment).
+			Return(nil, couchdb.ErrorConflict("Worknote could not be converted: worknote with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' has replies"))
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("POST", "/worknotes/"+uuid+"/convert", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Worknote could not be converted: worknote with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' has replies"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// maxUnreadEntities limits the number of entities counted in one request
+const maxUnreadEntities = 100
+
+// swagger:route GET /comments/unread comments CountUnreadComments
+// Returns the number of comments of each entity the calling user has not read yet
+// responses:
+//	200: unreadCountsResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// swagger:route GET /worknotes/unread worknotes CountUnreadWorknotes
+// Returns the number of worknotes of each entity the calling user has not read yet
+// responses:
+//	200: unreadCountsResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// CountUnread returns handler for counting comments|worknotes not read by the calling user
+func (s *Server) CountUnread(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.logger.Info("CountUnread handler called")
+
+		if err := s.authorize("CountUnread", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		param := r.URL.Query().Get("entity")
+		if param == "" {
+			eMsg := "missing 'entity' query param"
+			s.logger.Warn("CountUnread handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		var entities []string
+		seen := map[string]bool{}
+		for _, v := range strings.Split(param, ",") {
+			e, err := entity.Parse(strings.TrimSpace(v))
+			if err != nil {
+				s.logger.Warn("CountUnread handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			err = s.entityTypes.Validate(channelID, e)
+			if err != nil {
+				s.logger.Warn("invalid entity", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if !seen[e.String()] {
+				seen[e.String()] = true
+				entities = append(entities, e.String())
+			}
+		}
+
+		if len(entities) > maxUnreadEntities {
+			eMsg := fmt.Sprintf("too many entities: at most %d entities can be counted at once", maxUnreadEntities)
+			s.logger.Warn("CountUnread handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		unread, err := s.lister.CountUnread(r.Context(), entities, user.UUID, channelID, assetType)
+		if err != nil {
+			s.writeRepositoryError("CountUnread", w, err)
+			return
+		}
+
+		s.presenter.WriteUnreadResponse(r, w, unread, assetType)
+	}
+}
@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCountUnreadHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when entity param is missing", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("GET", "/comments/unread", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"missing 'entity' query param"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when entity is invalid", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("GET", "/comments/unread?entity=incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444,invalid", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+	})
+
+	t.Run("when unread worknotes are counted", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		entities := []string{
+			"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+		}
+
+		lister := new(mocks.ListingMock)
+		lister.On("CountUnread", entities, mockUserData.UUID, channelID, comment.AssetTypeWorknote).
+			Return(map[string]int{entities[0]: 3, entities[1]: 0}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/worknotes/unread?entity=incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444,request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e,incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"result": {
+				"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444": 3,
+				"request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e": 0
+			},
+			"_links": {
+				"self": {"href": "http://service.url/worknotes/unread?entity=incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444,request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e,incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
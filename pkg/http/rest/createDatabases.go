@@ -7,7 +7,6 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
@@ -16,7 +15,7 @@ import (
 )
 
 // swagger:route POST /databases databases CreateDatabases
-// Creates new databases for channel; if databases already exist it just returns 204 No Content
+// Creates new databases for channel; if databases already exist it migrates read state stored in comments and returns 204 No Content
 //
 // responses:
 //	201: databasesCreatedResponse
@@ -69,11 +68,9 @@ func (s *Server) CreateDatabases() func(w http.ResponseWriter, r *http.Request,
 			return
 		}
 
-		assetTypes := [2]comment.AssetType{comment.AssetTypeComment, comment.AssetTypeWorknote}
+		allExisted := true
 
-		bothExisted := true
-
-		for _, assetType := range assetTypes {
+		for _, assetType := range s.assetTypes {
 			alreadyExisted, err := s.repositoryService.CreateDatabase(r.Context(), request.ChannelID, assetType)
 			if err != nil {
 				var httpError *repository.Error
@@ -88,11 +85,39 @@ func (s *Server) CreateDatabases() func(w http.ResponseWriter, r *http.Request,
 				return
 			}
 			if !alreadyExisted {
-				bothExisted = false
+				allExisted = false
+				continue
+			}
+
+			// read_by lists stored in comments of existing databases are moved to the read state database
+			migrated, err := s.repositoryService.MigrateReadState(r.Context(), request.ChannelID, assetType)
+			if err != nil {
+				s.writeRepositoryError("CreateDatabases", w, err)
+				return
+			}
+			if migrated > 0 {
+				s.logger.Info("read state migrated", zap.Int("comments", migrated), zap.String("assetType", assetType.String()))
 			}
 		}
 
-		if bothExisted {
+		alreadyExisted, err := s.repositoryService.CreateTemplateDatabase(r.Context(), request.ChannelID)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Error("CreateDatabases handler failed", zap.Error(err), zap.String("database", "templates"))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("CreateDatabases handler failed", zap.Error(err), zap.String("database", "templates"))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !alreadyExisted {
+			allExisted = false
+		}
+
+		if allExisted {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
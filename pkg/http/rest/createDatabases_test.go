@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
@@ -102,9 +103,14 @@ func TestCreateDatabasesHandler(t *testing.T) {
 	})
 
 	t.Run("when databases already exist", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "comment")).WillReturn(true)
+		mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, "comment"))
+		mocks.ExpectReadStateMigrated(couchMock, testutils.DatabaseName(channelID, "comment"), testutils.ReadStateDatabaseName(channelID, "comment"))
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "worknote")).WillReturn(true)
+		mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, "worknote"))
+		mocks.ExpectReadStateMigrated(couchMock, testutils.DatabaseName(channelID, "worknote"), testutils.ReadStateDatabaseName(channelID, "worknote"))
+		couchMock.ExpectDBExists().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(true)
 
 		as := new(mocks.AuthServiceMock)
 		as.On("Enforce", "database", auth.UpdateAction, channelID, bearerToken).
@@ -142,8 +148,69 @@ func TestCreateDatabasesHandler(t *testing.T) {
 		assert.Empty(t, b)
 	})
 
+	t.Run("when additional asset type is configured", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "comment")).WillReturn(true)
+		mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, "comment"))
+		mocks.ExpectReadStateMigrated(couchMock, testutils.DatabaseName(channelID, "comment"), testutils.ReadStateDatabaseName(channelID, "comment"))
+		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "worknote")).WillReturn(true)
+		mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, "worknote"))
+		mocks.ExpectReadStateMigrated(couchMock, testutils.DatabaseName(channelID, "worknote"), testutils.ReadStateDatabaseName(channelID, "worknote"))
+
+		// resolution notes
+		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "resolution_note")).WillReturn(false)
+		couchMock.ExpectCreateDB().WithName(testutils.DatabaseName(channelID, "resolution_note"))
+		db := mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, "resolution_note"))
+		db.ExpectPut().WithDocID("_design/counters")
+		mocks.ExpectReadStateDatabaseCreated(couchMock, testutils.ReadStateDatabaseName(channelID, "resolution_note"))
+
+		couchMock.ExpectDBExists().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(true)
+
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "database", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		assetTypes, err := comment.ParseAssetTypes("comment,worknote,resolution_note")
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			AssetTypes:        assetTypes,
+			Logger:            logger,
+			AuthService:       as,
+			RepositoryService: s,
+			PayloadValidator:  pv,
+		})
+
+		payload := []byte(`{"channel_id":"e27ddcd0-0e1f-4bc5-93df-f6f04155beec"}`)
+
+		body := bytes.NewReader(payload)
+		req := httptest.NewRequest("POST", "/databases", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"message":"databases were successfully created"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
 	t.Run("when databases do not exist", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		// comments
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "comment")).WillReturn(false)
@@ -154,6 +221,13 @@ func TestCreateDatabasesHandler(t *testing.T) {
 		db.ExpectCreateIndex()
 		db.ExpectCreateIndex()
 		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectPut().WithDocID("_design/counters")
+		mocks.ExpectReadStateDatabaseCreated(couchMock, testutils.ReadStateDatabaseName(channelID, "comment"))
 
 		// worknotes
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, "worknote")).WillReturn(false)
@@ -163,6 +237,19 @@ func TestCreateDatabasesHandler(t *testing.T) {
 		db.ExpectCreateIndex()
 		db.ExpectCreateIndex()
 		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectCreateIndex()
+		db.ExpectPut().WithDocID("_design/counters")
+		mocks.ExpectReadStateDatabaseCreated(couchMock, testutils.ReadStateDatabaseName(channelID, "worknote"))
+
+		// templates
+		couchMock.ExpectDBExists().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(false)
+		couchMock.ExpectCreateDB().WithName(testutils.TemplateDatabaseName(channelID))
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		db.ExpectCreateIndex()
 
 		as := new(mocks.AuthServiceMock)
 		as.On("Enforce", "database", auth.UpdateAction, channelID, bearerToken).
@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route DELETE /comments/{uuid} comments DeleteComment
+// Marks specified comment as deleted, the comment is kept in the repository and can be restored
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route DELETE /worknotes/{uuid} worknotes DeleteWorknote
+// Marks specified worknote as deleted, the worknote is kept in the repository and can be restored
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// DeleteComment returns handler for soft deleting comment|worknote
+func (s *Server) DeleteComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("DeleteComment handler called")
+
+		if err := s.authorize("DeleteComment", assetType.String(), auth.DeleteAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("DeleteComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		deletedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		_, err = s.deleter.DeleteComment(r.Context(), id, deletedBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("DeleteComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("DeleteComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RestoreComment route
+const RestoreComment ActionType = "/comments/{uuid}/restore"
+
+// swagger:route POST /comments/{uuid}/restore comments RestoreComment
+// Restores specified deleted comment
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// RestoreWorknote route
+const RestoreWorknote ActionType = "/worknotes/{uuid}/restore"
+
+// swagger:route POST /worknotes/{uuid}/restore worknotes RestoreWorknote
+// Restores specified deleted worknote
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// RestoreComment returns handler for restoring deleted comment|worknote
+func (s *Server) RestoreComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("RestoreComment handler called")
+
+		// user can restore comment if he is allowed to delete it
+		if err := s.authorize("RestoreComment", assetType.String(), auth.DeleteAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("RestoreComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		restoredBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		restoredComment, err := s.deleter.RestoreComment(r.Context(), id, restoredBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("RestoreComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("RestoreComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.presenter.WriteGetResponse(r, w, *restoredComment, assetType)
+	}
+}
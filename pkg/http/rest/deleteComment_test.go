@@ -0,0 +1,325 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Some test user 1",
+		Surname:        "Some surname",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	deletedBy := comment.UserInfo{
+		UUID:           mockUserData.UUID,
+		Name:           mockUserData.Name,
+		Surname:        mockUserData.Surname,
+		OrgName:        mockUserData.OrgName,
+		OrgDisplayName: mockUserData.OrgDisplayName,
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when user is not authorized to DELETE the comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.DeleteAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (comment, delete)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when worknote is being deleted on behalf of other user", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.DeleteOnBehalfAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		deleter := new(mocks.DeletingMock)
+		deleter.On("DeleteComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", deletedBy, channelID, comment.AssetTypeWorknote).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			DeletingService: deleter,
+		})
+
+		req := httptest.NewRequest("DELETE", "/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+		req.Header.Set("on_behalf", mockUserData.UUID)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+
+		deleter.AssertExpectations(t)
+	})
+
+	t.Run("when comment does not exist", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.DeleteAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		deleter := new(mocks.DeletingMock)
+		deleter.On("DeleteComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", deletedBy, channelID, comment.AssetTypeComment).
+			Return(false, couchdb.ErrorNorFound("Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"))
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			DeletingService: deleter,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment is being deleted", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.DeleteAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		deleter := new(mocks.DeletingMock)
+		deleter.On("DeleteComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", deletedBy, channelID, comment.AssetTypeComment).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			DeletingService: deleter,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+	})
+}
+
+func TestRestoreCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Some test user 1",
+		Surname:        "Some surname",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	restoredBy := comment.UserInfo{
+		UUID:           mockUserData.UUID,
+		Name:           mockUserData.Name,
+		Surname:        mockUserData.Surname,
+		OrgName:        mockUserData.OrgName,
+		OrgDisplayName: mockUserData.OrgDisplayName,
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when user is not authorized to DELETE the comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.DeleteAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/restore", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (comment, delete)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment is being restored", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.DeleteAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		uuid := "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		restoredC := &comment.Comment{
+			UUID:   uuid,
+			Text:   "Restored text",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			CreatedBy: &comment.UserInfo{
+				UUID:           "8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+				Name:           "Alice",
+				Surname:        "Cooper",
+				OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				OrgDisplayName: "Kompitech",
+			},
+			CreatedAt: "2021-04-01T12:34:56+02:00",
+		}
+
+		deleter := new(mocks.DeletingMock)
+		deleter.On("RestoreComment", uuid, restoredBy, channelID, comment.AssetTypeComment).
+			Return(restoredC, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			DeletingService:         deleter,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/comments/"+uuid+"/restore", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"uuid":"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text":"Restored text",
+			"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"created_by":{
+				"uuid":"8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+				"name":"Alice",
+				"surname":"Cooper",
+				"org_name":"a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				"org_display_name":"Kompitech"
+			},
+			"created_at":"2021-04-01T12:34:56+02:00",
+			"_links":{
+				"self":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"},
+				"MarkCommentAsReadByUser":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/read_by"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
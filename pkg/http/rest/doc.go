@@ -61,6 +61,10 @@ type errorResponseWrapper404 errorResponseWrapper
 // swagger:response errorResponse409
 type errorResponseWrapper409 errorResponseWrapper
 
+// Unprocessable Entity
+// swagger:response errorResponse422
+type errorResponseWrapper422 errorResponseWrapper
+
 // Created
 // swagger:response createdResponse
 type createdResponseWrapper struct {
@@ -85,6 +89,9 @@ type commentCreatedResponseWrapper struct {
 	// example: http://localhost:8080/comments/2af4f493-0bd5-4513-b440-6cbb465feadb
 	// in: header
 	Location string
+	// Present with value true when the response of previous request with the same Idempotency-Key is replayed
+	// in: header
+	IdempotentReplayed string `json:"Idempotent-Replayed"`
 	// in: body
 	Body comment.Comment
 }
@@ -125,10 +132,92 @@ type commentResponseWrapper struct {
 	// in: body
 	Body struct {
 		comment.Comment
+		// Reaction counts per emoji
+		Reactions []comment.ReactionSummary `json:"reactions,omitempty"`
+		Links     HypermediaLinks           `json:"_links"`
+	}
+}
+
+// Created
+// swagger:response templateCreatedResponse
+type templateCreatedResponseWrapper struct {
+	// URI of the resource
+	// example: http://localhost:8080/templates/2af4f493-0bd5-4513-b440-6cbb465feadb
+	// in: header
+	Location string
+	// in: body
+	Body struct {
+		comment.Template
 		Links HypermediaLinks `json:"_links"`
 	}
 }
 
+// Data structure representing a single comment template
+// swagger:response templateResponse
+type templateResponseWrapper struct {
+	// in: body
+	Body struct {
+		comment.Template
+		Links HypermediaLinks `json:"_links"`
+	}
+}
+
+// A list of comment templates
+// swagger:response templateListResponse
+type templateListResponseWrapper struct {
+	// in: body
+	Body struct {
+		// required: true
+		Result []comment.Template `json:"result"`
+		Links  HypermediaLinks    `json:"_links"`
+	}
+}
+
+// Number of comments or worknotes marked as read
+// swagger:response markedResponse
+type markedResponseWrapper struct {
+	// in: body
+	Body struct {
+		// required: true
+		// example: 12
+		Marked int `json:"marked"`
+	}
+}
+
+// Number of merged comments of each asset type
+// swagger:response mergedResponse
+type mergedResponseWrapper struct {
+	// in: body
+	Body struct {
+		// required: true
+		// example: {"comment": 12, "worknote": 3}
+		Merged map[string]int `json:"merged"`
+	}
+}
+
+// Number of unread comments or worknotes of each requested entity
+// swagger:response unreadCountsResponse
+type unreadCountsResponseWrapper struct {
+	// in: body
+	Body struct {
+		// required: true
+		// example: {"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444": 3}
+		Result map[string]int  `json:"result"`
+		Links  HypermediaLinks `json:"_links"`
+	}
+}
+
+// Edit history of a comment or worknote
+// swagger:response historyResponse
+type historyResponseWrapper struct {
+	// in: body
+	Body struct {
+		// required: true
+		Result comment.HistoryList `json:"result"`
+		Links  HypermediaLinks     `json:"_links"`
+	}
+}
+
 // AuthorizationHeaders represents general authorization header parameters used in many API calls
 type AuthorizationHeaders struct {
 	// Bearer token
@@ -142,7 +231,7 @@ type AuthorizationHeaders struct {
 	ChannelID string `json:"grpc-metadata-space"`
 }
 
-// swagger:parameters GetComment GetWorknote MarkCommentAsReadByUser MarkWorknoteAsReadByUser
+// swagger:parameters MarkCommentAsReadByUser MarkWorknoteAsReadByUser GetCommentHistory GetWorknoteHistory
 type commentIDParameterWrapper struct {
 	AuthorizationHeaders
 
@@ -153,6 +242,22 @@ type commentIDParameterWrapper struct {
 	UUID string `json:"uuid"`
 }
 
+// swagger:parameters GetComment GetWorknote
+type getCommentParameterWrapper struct {
+	AuthorizationHeaders
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+
+	// Return text of the comment/worknote as sanitized HTML fragment instead of JSON
+	// in: query
+	// enum: html
+	Render string `json:"render"`
+}
+
 // swagger:parameters ListComments ListWorknotes
 type listCommentsParameterWrapper struct {
 	AuthorizationHeaders
@@ -163,6 +268,82 @@ type listCommentsParameterWrapper struct {
 	// swagger:strfmt string
 	Entity entity.Entity `json:"entity"`
 
+	// ID in external system
+	// in: query
+	ExternalID string `json:"external_id"`
+
+	// Amount of records to be returned (pagination)
+	// default: 25
+	// in: query
+	Limit int `json:"limit"`
+
+	// Pagination bookmark
+	// in: query
+	Bookmark string `json:"bookmark"`
+
+	// Include deleted comments/worknotes in the list, they are hidden from custom queries (query param) as well by default
+	// default: false
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+
+	// Extend each listed comment/worknote with the number of its replies (replies_count)
+	// or with the replies themselves (replies), in the latter case only top level comments/worknotes are listed
+	// in: query
+	// enum: count,nest
+	Replies string `json:"replies"`
+
+	// List only pinned (true) or only not pinned (false) comments/worknotes, pinned ones are sorted by pinned_at descending.
+	// When not set and entity is specified, pinned comments/worknotes are listed first on the first page
+	// in: query
+	Pinned *bool `json:"pinned"`
+}
+
+// swagger:parameters MarkAllCommentsAsReadByUser MarkAllWorknotesAsReadByUser
+type markAllAsReadParameterWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// Entity represents some external entity reference in the form "&lt;entity&gt;:&lt;UUID&gt;"
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+	// in: query
+	// required: true
+	// swagger:strfmt string
+	Entity entity.Entity `json:"entity"`
+
+	// Only comments/worknotes created at or before this time are marked
+	// in: query
+	// swagger:strfmt date-time
+	UpTo string `json:"up_to"`
+}
+
+// swagger:parameters CountUnreadComments CountUnreadWorknotes
+type countUnreadParameterWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// Comma separated list of entities in the form "&lt;entity&gt;:&lt;UUID&gt;" (at most 100)
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444,request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e
+	// in: query
+	// required: true
+	Entity string `json:"entity"`
+}
+
+// swagger:parameters ListCommentReplies ListWorknoteReplies
+type listRepliesParameterWrapper struct {
+	AuthorizationHeaders
+
+	// ID of the parent comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+
 	// Amount of records to be returned (pagination)
 	// default: 25
 	// in: query
@@ -186,6 +367,12 @@ type commentParamWrapper struct {
 	// example: ServiceNow
 	XOrigin string `json:"X-Origin"`
 
+	// Unique key of the request, retried request with the same key replays the original response
+	// instead of creating a duplicate
+	// in: header
+	// example: 5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10
+	IdempotencyKey string `json:"Idempotency-Key"`
+
 	// Comment/Worknote data structure to create
 	// in: body
 	Body struct {
@@ -198,12 +385,267 @@ type commentParamWrapper struct {
 		// required: false
 		ExternalID string `json:"external_id"`
 
+		// ID of the parent comment/worknote this one replies to
+		// required: false
+		// swagger:strfmt uuid
+		ParentUUID string `json:"parent_uuid"`
+
+		// UUIDs of mentioned users, users mentioned in the text in the form @&lt;UUID&gt; are added automatically
+		// required: false
+		Mentions []string `json:"mentions"`
+
+		// Content of the comment/worknote, required unless template_id is set
+		// required: false
+		Text string `json:"text"`
+
+		// Content type of the text, text/plain (or content type of the template) if not set
+		// required: false
+		// enum: text/plain,text/markdown
+		ContentType string `json:"content_type"`
+
+		// ID of the template the text is rendered from, it cannot be used together with text
+		// required: false
+		// swagger:strfmt uuid
+		TemplateID string `json:"template_id"`
+
+		// Values of the custom template variables; built-in variables entity, user.name, user.surname,
+		// user.org_name and user.org_display_name cannot be overridden
+		// required: false
+		// example: {"minutes": "15"}
+		Variables map[string]string `json:"variables"`
+	}
+}
+
+// swagger:parameters UpdateComment UpdateWorknote
+type updateCommentParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+
+	// New content of the comment/worknote
+	// in: body
+	Body struct {
 		// Content of the comment/worknote
 		// required: true
 		Text string `json:"text"`
 	}
 }
 
+// swagger:parameters UpsertComment UpsertWorknote
+type upsertCommentParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// Origin of the request (will be present in event message)
+	// in: header
+	// example: ServiceNow
+	XOrigin string `json:"X-Origin"`
+
+	// ID in external system, unique per entity
+	// in: path
+	// required: true
+	ExternalID string `json:"external_id"`
+
+	// Comment/Worknote data structure to create or update
+	// in: body
+	Body struct {
+		// Entity represents some external entity reference in the form "&lt;entity&gt;:&lt;UUID&gt;"
+		// required: true
+		// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+		Entity string `json:"entity"`
+
+		// ID of the parent comment/worknote this one replies to, used only when it is created
+		// required: false
+		// swagger:strfmt uuid
+		ParentUUID string `json:"parent_uuid"`
+
+		// Content of the comment/worknote
+		// required: true
+		Text string `json:"text"`
+
+		// Content type of the text, text/plain if not set, used only when it is created
+		// required: false
+		// enum: text/plain,text/markdown
+		ContentType string `json:"content_type"`
+	}
+}
+
+// swagger:parameters AddCommentReaction AddWorknoteReaction RemoveCommentReaction RemoveWorknoteReaction
+type reactionParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+
+	// Emoji shortcode (e.g. thumbsup) or URL encoded emoji character
+	// in: path
+	// required: true
+	Emoji string `json:"emoji"`
+}
+
+// swagger:parameters PinComment PinWorknote UnpinComment UnpinWorknote
+type pinParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+}
+
+// swagger:parameters ConvertComment ConvertWorknote
+type convertParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+
+	// Asset type the comment/worknote is converted to (worknote for comment and comment for worknote if not set)
+	// in: query
+	To string `json:"to"`
+}
+
+// swagger:parameters LockThread UnlockThread
+type threadLockParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// Entity reference in the form "&lt;entity&gt;:&lt;UUID&gt;"
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+	// in: path
+	// required: true
+	Entity string `json:"entity"`
+
+	// Asset type (comment/worknote) the thread is locked for
+	// in: query
+	// required: true
+	AssetType string `json:"asset_type"`
+}
+
+// swagger:parameters LockThread
+type lockThreadParamWrapper struct {
+	// Optional reason of the lock returned when comment/worknote is being added to the locked thread
+	// in: body
+	Body struct {
+		// Reason why the thread is locked
+		// example: Incident is closed
+		Reason string `json:"reason"`
+	}
+}
+
+// swagger:parameters MergeEntity
+type mergeEntityParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// Reference of the merged (duplicate) entity in the form "&lt;entity&gt;:&lt;UUID&gt;"
+	// example: incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444
+	// in: path
+	// required: true
+	Entity string `json:"entity"`
+
+	// in: body
+	Body struct {
+		// Reference of the entity the comments are merged into
+		// example: incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e
+		// required: true
+		Target string `json:"target"`
+
+		// Comments are moved by default, copy mode keeps the merged entity thread untouched
+		// enum: move,copy
+		Mode string `json:"mode"`
+	}
+}
+
+// swagger:parameters ListTemplates CreateTemplate
+type templatesParamWrapper struct {
+	AuthorizationHeaders
+}
+
+// swagger:parameters GetTemplate UpdateTemplate DeleteTemplate
+type templateIDParamWrapper struct {
+	AuthorizationHeaders
+
+	// ID of the template
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+}
+
+// swagger:parameters CreateTemplate UpdateTemplate
+type templateParamWrapper struct {
+	// Template data structure
+	// in: body
+	Body struct {
+		// Name of the template, unique in the channel
+		// required: true
+		// example: Password reset
+		Name string `json:"name"`
+
+		// Text of the template with placeholders in the form {{variable}}
+		// required: true
+		// example: Hello, the password was reset. Regards, {{user.name}} ({{user.org_display_name}})
+		Text string `json:"text"`
+
+		// Content type of the text, text/plain if not set
+		// required: false
+		// enum: text/plain,text/markdown
+		ContentType string `json:"content_type"`
+	}
+}
+
+// swagger:parameters DeleteComment DeleteWorknote RestoreComment RestoreWorknote
+type deleteCommentParamWrapper struct {
+	AuthorizationHeaders
+
+	// in: header
+	// swagger:strfmt uuid
+	OnBehalf string `json:"on_behalf"`
+
+	// ID of the comment/worknote
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	UUID string `json:"uuid"`
+}
+
 // swagger:parameters CreateDatabases
 type databasesParamWrapper struct {
 	// Bearer token
@@ -2,7 +2,9 @@ package rest
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
@@ -16,6 +18,14 @@ const GetComment ActionType = "/comments/{uuid}"
 
 // swagger:route GET /comments/{uuid} comments GetComment
 // Returns a single comment from the repository
+//
+// Text of the comment is returned as sanitized HTML fragment (text/html) when 'render=html' query param is used
+// or text/html is preferred in Accept header.
+//
+// produces:
+// - application/json
+// - text/html
+//
 // responses:
 //	200: commentResponse
 //	400: errorResponse400
@@ -28,6 +38,14 @@ const GetWorknote ActionType = "/worknotes/{uuid}"
 
 // swagger:route GET /worknotes/{uuid} worknotes GetWorknote
 // Returns a single worknote from the repository
+//
+// Text of the worknote is returned as sanitized HTML fragment (text/html) when 'render=html' query param is used
+// or text/html is preferred in Accept header.
+//
+// produces:
+// - application/json
+// - text/html
+//
 // responses:
 //	200: commentResponse
 //	400: errorResponse400
@@ -52,6 +70,13 @@ func (s *Server) GetComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
+		renderHTML, err := renderHTMLRequested(r)
+		if err != nil {
+			s.logger.Warn("GetComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		channelID, err := s.assertChannelID(w, r)
 		if err != nil {
 			return
@@ -71,6 +96,100 @@ func (s *Server) GetComment(assetType comment.AssetType) func(w http.ResponseWri
 			return
 		}
 
-		s.presenter.WriteGetResponse(r, w, asset, assetType)
+		if renderHTML {
+			s.presenter.WriteHTMLResponse(w, asset)
+			return
+		}
+
+		s.presenter.WriteGetResponse(s.withUserInfo(r), w, asset, assetType)
+	}
+}
+
+// renderHTMLRequested returns true if the comment text should be returned as sanitized HTML,
+// either by 'render=html' query param or by preferring text/html in Accept header
+func renderHTMLRequested(r *http.Request) (bool, error) {
+	switch render := r.URL.Query().Get("render"); render {
+	case "html":
+		return true, nil
+	case "":
+	default:
+		return false, fmt.Errorf("invalid 'render' param value '%s', allowed values are: html", render)
+	}
+
+	// the first of the listed media types wins, so clients preferring JSON still get JSON
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0])
+		switch mediaType {
+		case "text/html":
+			return true, nil
+		case "application/json", "application/*", "*/*":
+			return false, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetCommentHistory route
+const GetCommentHistory ActionType = "/comments/{uuid}/history"
+
+// swagger:route GET /comments/{uuid}/history comments GetCommentHistory
+// Returns previous versions of the comment text
+// responses:
+//	200: historyResponse
+//	400: errorResponse400
+//  401: errorResponse401
+//  403: errorResponse403
+//	404: errorResponse404
+
+// GetWorknoteHistory route
+const GetWorknoteHistory ActionType = "/worknotes/{uuid}/history"
+
+// swagger:route GET /worknotes/{uuid}/history worknotes GetWorknoteHistory
+// Returns previous versions of the worknote text
+// responses:
+//	200: historyResponse
+//	400: errorResponse400
+//  401: errorResponse401
+//  403: errorResponse403
+//	404: errorResponse404
+
+// GetCommentHistory returns handler for getting edit history of single comment|worknote
+func (s *Server) GetCommentHistory(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("GetCommentHistory handler called")
+
+		if err := s.authorize("GetCommentHistory", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("GetCommentHistory handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		asset, err := s.lister.GetComment(r.Context(), id, channelID, assetType)
+		if err != nil {
+			s.logger.Warn("GetCommentHistory handler failed", zap.Error(err))
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("GetCommentHistory handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.presenter.WriteHistoryResponse(r, w, asset, assetType)
 	}
 }
@@ -9,11 +9,13 @@ import (
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetCommentHandler(t *testing.T) {
@@ -187,6 +189,237 @@ func TestGetCommentHandler(t *testing.T) {
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 
+	t.Run("when comment has reactions", func(t *testing.T) {
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+		retC := comment.Comment{
+			Text:      "Test comment 1",
+			Entity:    entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			UUID:      uuid,
+			CreatedAt: "2021-04-01T12:34:56+02:00",
+			Reactions: comment.ReactionList{
+				{Emoji: "thumbsup", Time: "2021-04-01T12:40:00+02:00", User: comment.UserInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}},
+				{Emoji: "tada", Time: "2021-04-01T12:41:00+02:00", User: comment.UserInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}},
+				{Emoji: "thumbsup", Time: "2021-04-01T12:42:00+02:00", User: comment.UserInfo{UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb"}},
+			},
+		}
+
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(user.BasicInfo{UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb"}, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", uuid, channelID, assetType).
+			Return(retC, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments/"+uuid, nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"uuid":"cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0",
+			"text":"Test comment 1",
+			"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"created_at":"2021-04-01T12:34:56+02:00",
+			"reactions":[
+				{"emoji":"thumbsup","count":2,"reacted":true},
+				{"emoji":"tada","count":1,"reacted":false}
+			],
+			"_links":{
+				"self":{"href":"http://service.url/comments/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"},
+				"MarkCommentAsReadByUser":{"href":"http://service.url/comments/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0/read_by"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when markdown comment is requested as HTML", func(t *testing.T) {
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+		retC := comment.Comment{
+			Text:        "**Fixed** in [release notes](https://example.com/notes) <script>alert(1)</script>",
+			ContentType: comment.ContentTypeMarkdown,
+			Entity:      entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			UUID:        uuid,
+			CreatedAt:   "2021-04-01T12:34:56+02:00",
+		}
+
+		for name, setup := range map[string]func(r *http.Request){
+			"by render param": func(r *http.Request) {
+				r.URL.RawQuery = "render=html"
+			},
+			"by Accept header": func(r *http.Request) {
+				r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				assetType := comment.AssetTypeComment
+				as := new(mocks.AuthServiceMock)
+				as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+					Return(true, nil)
+
+				lister := new(mocks.ListingMock)
+				lister.On("GetComment", uuid, channelID, assetType).
+					Return(retC, nil)
+
+				server := NewServer(Config{
+					Addr:                    "service.url",
+					Logger:                  logger,
+					AuthService:             as,
+					ListingService:          lister,
+					ExternalLocationAddress: "http://service.url",
+				})
+
+				req := httptest.NewRequest("GET", "/comments/"+uuid, nil)
+				req.Header.Set("grpc-metadata-space", channelID)
+				req.Header.Set("authorization", bearerToken)
+				setup(req)
+
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+				resp := w.Result()
+
+				defer func() { _ = resp.Body.Close() }()
+
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("could not read response: %v", err)
+				}
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+				assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"), "Content-Type header")
+
+				expectedHTML := `<p><strong>Fixed</strong> in <a href="https://example.com/notes" rel="nofollow noopener" target="_blank">release notes</a> </p>` + "\n"
+				assert.Equal(t, expectedHTML, string(b), "response does not match")
+			})
+		}
+	})
+
+	t.Run("when render param is not valid", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+		})
+
+		req := httptest.NewRequest("GET", "/comments/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0?render=pdf", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"invalid 'render' param value 'pdf', allowed values are: html"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when additional asset type is configured", func(t *testing.T) {
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+		retC := comment.Comment{
+			Text:      "Test resolution note 1",
+			Entity:    entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			UUID:      uuid,
+			CreatedAt: "2021-04-01T12:34:56+02:00",
+		}
+
+		assetType := comment.AssetType("resolution_note")
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "resolution_note", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", uuid, channelID, assetType).
+			Return(retC, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			AssetTypes:              comment.AssetTypeRegistry{comment.AssetTypeComment, assetType},
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/resolution_notes/"+uuid, nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"uuid":"cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0",
+			"text":"Test resolution note 1",
+			"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"created_at":"2021-04-01T12:34:56+02:00",
+			"_links":{
+				"self":{"href":"http://service.url/resolution_notes/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"},
+				"MarkResolutionNoteAsReadByUser":{"href":"http://service.url/resolution_notes/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0/read_by"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		// worknotes are not served when not configured
+		req = httptest.NewRequest("GET", "/worknotes/"+uuid, nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "Status code")
+	})
+
 	t.Run("when comment does not exist", func(t *testing.T) {
 		uuid := "someNonexistentUUID"
 		assetType := comment.AssetTypeComment
@@ -342,3 +575,173 @@ func TestGetCommentHandler(t *testing.T) {
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 }
+
+func TestGetCommentHistoryHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when comment was edited", func(t *testing.T) {
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+		retC := comment.Comment{
+			Text:   "Test comment 1",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			UUID:   uuid,
+			History: comment.HistoryList{
+				{
+					Text:     "Test coment 1",
+					EditedAt: "2021-04-02T10:00:00+02:00",
+					EditedBy: comment.UserInfo{
+						UUID:           "8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+						Name:           "Alice",
+						Surname:        "Cooper",
+						OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+						OrgDisplayName: "Kompitech",
+					},
+				},
+			},
+			CreatedAt: "2021-04-01T12:34:56+02:00",
+		}
+
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", uuid, channelID, assetType).
+			Return(retC, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments/"+uuid+"/history", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"result":[{
+				"text":"Test coment 1",
+				"edited_at":"2021-04-02T10:00:00+02:00",
+				"edited_by":{
+					"uuid":"8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+					"name":"Alice",
+					"surname":"Cooper",
+					"org_name":"a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					"org_display_name":"Kompitech"
+				}
+			}],
+			"_links":{
+				"self":{"href":"http://service.url/comments/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0/history"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when worknote was never edited", func(t *testing.T) {
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+		assetType := comment.AssetTypeWorknote
+
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", uuid, channelID, assetType).
+			Return(comment.Comment{UUID: uuid, Text: "Test worknote 1"}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/worknotes/"+uuid+"/history", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"result":[],
+			"_links":{
+				"self":{"href":"http://service.url/worknotes/cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0/history"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment does not exist", func(t *testing.T) {
+		uuid := "someNonexistentUUID"
+		assetType := comment.AssetTypeComment
+
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", uuid, channelID, assetType).
+			Return(comment.Comment{}, couchdb.ErrorNorFound("comment not found"))
+
+		server := NewServer(Config{
+			Addr:           "service.url",
+			Logger:         logger,
+			AuthService:    as,
+			ListingService: lister,
+		})
+
+		req := httptest.NewRequest("GET", "/comments/"+uuid+"/history", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"comment not found"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
@@ -3,15 +3,16 @@ package rest_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
@@ -50,9 +51,11 @@ func TestAddCommentDBMock(t *testing.T) {
 	queue := new(mocks.QueueMock)
 	events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
 	queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
-	queue.On("PublishEvents").Return(nil)
+	queue.On("Message").Return(nil, nil)
 
-	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, events)
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	mocks.ExpectThreadNotLocked(couchMock, testutils.DatabaseName(channelID, assetType), "incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
 
 	db := couchMock.NewDB()
 	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, assetType)).WillReturn(db)
@@ -73,7 +76,7 @@ func TestAddCommentDBMock(t *testing.T) {
 	us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
 		Return(mockUserData, nil)
 
-	adder := adding.NewService(s)
+	adder := adding.NewService(s, adding.Config{Validator: validator, EventService: events, Rand: mocks.NewRand(), Clock: testutils.FixedClock{}})
 
 	pv, err := validation.NewPayloadValidator()
 	require.NoError(t, err)
@@ -113,19 +116,9 @@ func TestGetCommentDBMock(t *testing.T) {
 
 	bearerToken := "some valid Bearer token"
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
-	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
 	assetType := comment.AssetTypeComment
 
-	validator := new(mocks.ValidatorMock)
-	validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
-
-	events := new(mocks.EventServiceMock)
-	queue := new(mocks.QueueMock)
-	events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
-	queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), assetType).Return(nil)
-	queue.On("PublishEvents").Return(nil)
-
-	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, events)
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 	db := couchMock.NewDB()
 	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, assetType)).WillReturn(db)
@@ -152,8 +145,10 @@ func TestGetCommentDBMock(t *testing.T) {
 	require.NoError(t, err)
 
 	db.ExpectGet().WithDocID("38316161-3035-4864-ad30-6231392d3433").WillReturn(doc)
+	mocks.ExpectEmptyReadState(couchMock, testutils.ReadStateDatabaseName(channelID, assetType))
 
 	c1 := comment.Comment{
+		UUID: "38316161-3035-4864-ad30-6231392d3433",
 		Text: "Test comment 1",
 		CreatedBy: &comment.UserInfo{
 			UUID:           "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
@@ -168,7 +163,7 @@ func TestGetCommentDBMock(t *testing.T) {
 	as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
 		Return(true, nil)
 
-	storedComment, err := s.AddComment(context.Background(), c1, channelID, assetType)
+	storedComment, err := s.AddComment(context.Background(), c1, channelID, assetType, nil)
 	require.NoError(t, err)
 
 	lister := listing.NewService(s)
@@ -225,12 +220,9 @@ func TestAddCommentMemoryStorage(t *testing.T) {
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
 	bearerToken := "some valid Bearer token"
 
-	rand := strings.NewReader("81aa058d-0b19-43e9-82ae-a7bca2457f10") // pseudo-random seed
-	s := &memory.Storage{
-		Clock: testutils.FixedClock{},
-		Rand:  rand,
-	}
-	adder := adding.NewService(s)
+	s := &memory.Storage{}
+	testutils.CreateDatabases(t, s, channelID)
+	adder := adding.NewService(s, adding.Config{Rand: mocks.NewRand(), Clock: testutils.FixedClock{}})
 
 	as := new(mocks.AuthServiceMock)
 	as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
@@ -277,26 +269,25 @@ func TestGetCommentMemoryStorage(t *testing.T) {
 	logger, _ := testutils.NewTestLogger()
 	defer func() { _ = logger.Sync() }()
 
-	rand := strings.NewReader("81aa058d-0b19-43e9-82ae-a7bca2457f10") // pseudo-random seed
-	s := &memory.Storage{
-		Clock: testutils.FixedClock{},
-		Rand:  rand,
-	}
+	s := &memory.Storage{}
 
 	c1 := comment.Comment{
-		Text:   "Test comment 1",
-		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		UUID:      mocks.GeneratedCommentUUID,
+		CreatedAt: testutils.FixedClock{}.NowFormatted(),
+		Text:      "Test comment 1",
+		Entity:    entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
 	}
 
 	bearerToken := "some valid Bearer token"
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	testutils.CreateDatabases(t, s, channelID)
 	assetType := comment.AssetTypeComment
 
 	as := new(mocks.AuthServiceMock)
 	as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
 		Return(true, nil)
 
-	storedComment, err := s.AddComment(context.Background(), c1, channelID, assetType)
+	storedComment, err := s.AddComment(context.Background(), c1, channelID, assetType, nil)
 	require.NoError(t, err)
 
 	lister := listing.NewService(s)
@@ -330,7 +321,7 @@ func TestGetCommentMemoryStorage(t *testing.T) {
 		"uuid":"38316161-3035-4864-ad30-6231392d3433",
 		"text":"Test comment 1",
 		"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
-		"created_at":"2021-04-01T12:34:56+02:00",
+		"created_at":"2021-04-01T10:34:56Z",
 		"_links":{
 			"self":{"href":"http://service.url/comments/38316161-3035-4864-ad30-6231392d3433"},
 			"MarkCommentAsReadByUser":{"href":"http://service.url/comments/38316161-3035-4864-ad30-6231392d3433/read_by"}
@@ -338,3 +329,68 @@ func TestGetCommentMemoryStorage(t *testing.T) {
 	}`
 	require.JSONEq(t, expectedJSON, string(b), "response does not match")
 }
+
+func TestQueryCommentsMemoryStorage(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	s := &memory.Storage{}
+	adder := adding.NewService(s, adding.Config{Clock: testutils.FixedClock{}})
+	updater := updating.NewService(s, updating.Config{Clock: testutils.FixedClock{}})
+
+	bearerToken := "some valid Bearer token"
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	ctx := context.Background()
+
+	first, err := adder.AddComment(ctx, comment.Comment{Entity: e, Text: "first"}, channelID, assetType)
+	require.NoError(t, err)
+	_, err = adder.AddComment(ctx, comment.Comment{Entity: e, Text: "reply", ParentUUID: first.UUID}, channelID, assetType)
+	require.NoError(t, err)
+	pinned, err := adder.AddComment(ctx, comment.Comment{Entity: e, Text: "pinned"}, channelID, assetType)
+	require.NoError(t, err)
+	_, err = updater.PinComment(ctx, pinned.UUID, comment.UserInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}, channelID, assetType)
+	require.NoError(t, err)
+	_, err = adder.AddComment(ctx, comment.Comment{Entity: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"), Text: "other"}, channelID, assetType)
+	require.NoError(t, err)
+
+	as := new(mocks.AuthServiceMock)
+	as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+		Return(true, nil)
+
+	server := rest.NewServer(rest.Config{
+		Addr:                    "service.url",
+		Logger:                  logger,
+		AuthService:             as,
+		ListingService:          listing.NewService(s),
+		ExternalLocationAddress: "http://service.url",
+	})
+
+	req := httptest.NewRequest("GET", "/comments?entity="+e.String()+"&replies=nest", nil)
+	req.Header.Set("grpc-metadata-space", channelID)
+	req.Header.Set("authorization", bearerToken)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	resp := w.Result()
+
+	defer func() { _ = resp.Body.Close() }()
+	var body struct {
+		Result []struct {
+			Text    string `json:"text"`
+			Replies []struct {
+				Text string `json:"text"`
+			} `json:"replies"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+	require.Len(t, body.Result, 2, "pinned comment and top level comment of the entity are listed")
+	assert.Equal(t, "pinned", body.Result[0].Text)
+	assert.Equal(t, "first", body.Result[1].Text)
+	require.Len(t, body.Result[1].Replies, 1)
+	assert.Equal(t, "reply", body.Result[1].Replies[0].Text)
+}
@@ -5,18 +5,16 @@ import (
 )
 
 // AllowedLinksForComment returns allowed hypermedia link names based on Comment state
-func AllowedLinksForComment(_ comment.Comment, assetType comment.AssetType) []string {
-	// here might be some logic based on business state of the resource, in this case there is none
-
+// (e.g. MarkWorknoteAsReadByUser for worknote asset type)
+func AllowedLinksForComment(c comment.Comment, assetType comment.AssetType) []string {
 	var links []string
 
-	name := "MarkCommentAsReadByUser"
-
-	if assetType == comment.AssetTypeWorknote {
-		name = "MarkWorknoteAsReadByUser"
+	if c.IsDeleted() {
+		// deleted comment can only be restored
+		return append(links, "Restore"+assetType.Title())
 	}
 
-	links = append(links, name)
+	links = append(links, "Mark"+assetType.Title()+"AsReadByUser")
 
 	return links
 }
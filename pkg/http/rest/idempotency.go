@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"go.uber.org/zap"
+)
+
+// idempotencyKeyHeader is the request header with the key making POST request idempotent
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// defaultIdempotencyKeyTTL is the default time window the result of the request with idempotency key is stored
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// defaultIdempotencyPendingTimeout is the default time the key stays reserved by the request being processed,
+// the key reserved by the request which never finished (e.g. the service was stopped) can be used again after it
+const defaultIdempotencyPendingTimeout = time.Minute
+
+// idempotencyKeyRegex allows up to 255 printable ASCII characters
+var idempotencyKeyRegex = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// reserveIdempotencyKey reserves the key from Idempotency-Key header (if any) of the user for the request and returns
+// the reserved record to be completed with the response. If the key was already used, the stored response is replayed.
+// It returns false if the response was written and the handler must not continue.
+func (s *Server) reserveIdempotencyKey(w http.ResponseWriter, r *http.Request, payload []byte, userUUID, channelID string, assetType comment.AssetType) (*repository.IdempotencyRecord, bool) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || s.idempotency == nil {
+		return nil, true
+	}
+
+	if !idempotencyKeyRegex.MatchString(key) {
+		eMsg := fmt.Sprintf("invalid '%s' header, up to 255 printable ASCII characters are allowed", idempotencyKeyHeader)
+		s.logger.Warn(eMsg)
+		s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+		return nil, false
+	}
+
+	hash := sha256.Sum256(payload)
+	record := repository.IdempotencyRecord{
+		Key:         key,
+		UserUUID:    userUUID,
+		RequestHash: hex.EncodeToString(hash[:]),
+		ExpiresAt:   time.Now().Add(s.idempotencyPendingTimeout).UTC(),
+	}
+
+	stored, err := s.idempotency.ReserveIdempotencyKey(r.Context(), record, channelID, assetType)
+	if err != nil {
+		var httpError *repository.Error
+		if errors.As(err, &httpError) {
+			s.logger.Warn("Idempotency-Key reservation failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+			return nil, false
+		}
+
+		s.logger.Error("Idempotency-Key reservation failed", zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if stored == nil {
+		return &record, true
+	}
+
+	if stored.RequestHash != record.RequestHash {
+		eMsg := fmt.Sprintf("%s '%s' was already used for a different request", idempotencyKeyHeader, key)
+		s.logger.Warn(eMsg)
+		s.presenter.WriteError(w, eMsg, http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	if stored.IsPending() {
+		eMsg := fmt.Sprintf("request with %s '%s' is already being processed", idempotencyKeyHeader, key)
+		s.logger.Warn(eMsg)
+		s.presenter.WriteError(w, eMsg, http.StatusConflict)
+		return nil, false
+	}
+
+	s.logger.Info("replaying response of the request with Idempotency-Key", zap.String("key", key), zap.String("uuid", stored.UUID))
+
+	if stored.Location != "" {
+		w.Header().Set("Location", stored.Location)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	_, _ = fmt.Fprintln(w, stored.Body)
+
+	return nil, false
+}
+
+// completeIdempotencyKey stores the response of the request made with the reserved key for the whole TTL
+func (s *Server) completeIdempotencyKey(r *http.Request, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) {
+	record.ExpiresAt = time.Now().Add(s.idempotencyKeyTTL).UTC()
+
+	err := s.idempotency.CompleteIdempotencyKey(r.Context(), record, channelID, assetType)
+	if err != nil {
+		// the request itself succeeded, so only the replay of the response will not be possible
+		s.logger.Error("Idempotency-Key could not be completed", zap.Error(err), zap.String("key", record.Key))
+	}
+}
+
+// releaseIdempotencyKey removes the key reserved by the failed request, so it can be retried
+func (s *Server) releaseIdempotencyKey(r *http.Request, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) {
+	err := s.idempotency.ReleaseIdempotencyKey(r.Context(), record, channelID, assetType)
+	if err != nil {
+		s.logger.Error("Idempotency-Key could not be released", zap.Error(err), zap.String("key", record.Key))
+	}
+}
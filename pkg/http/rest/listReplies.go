@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// ListCommentReplies route
+const ListCommentReplies ActionType = "/comments/{uuid}/replies"
+
+// swagger:route GET /comments/{uuid}/replies comments ListCommentReplies
+// Returns a list of replies to the specified comment, the oldest first
+// responses:
+//	200: commentsListResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+
+// ListWorknoteReplies route
+const ListWorknoteReplies ActionType = "/worknotes/{uuid}/replies"
+
+// swagger:route GET /worknotes/{uuid}/replies worknotes ListWorknoteReplies
+// Returns a list of replies to the specified worknote, the oldest first
+// responses:
+//	200: commentsListResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+
+// ListReplies returns handler for listing replies to comment|worknote
+func (s *Server) ListReplies(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("ListReplies handler called")
+
+		if err := s.authorize("ListReplies", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("ListReplies handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		// parent must exist
+		_, err = s.lister.GetComment(r.Context(), id, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("ListReplies handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("ListReplies handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		query := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"parent_uuid": id,
+				"deleted_at":  map[string]interface{}{"$exists": false},
+			},
+			"sort":   []map[string]string{{"created_at": "asc"}},
+			"fields": listFields(),
+		}
+
+		paginate(query, r.URL.Query())
+
+		qResult, err := s.lister.QueryComments(r.Context(), query, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Error("Repository error", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("ListReplies handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.presenter.WriteRepliesResponse(s.withUserInfo(r), w, id, qResult, assetType)
+	}
+}
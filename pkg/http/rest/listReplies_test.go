@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRepliesHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+	parentID := "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+
+	t.Run("when parent comment does not exist", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", parentID, channelID, assetType).
+			Return(comment.Comment{}, couchdb.ErrorNorFound("Comment could not be retrieved: Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"))
+
+		server := NewServer(Config{
+			Addr:           "service.url",
+			Logger:         logger,
+			AuthService:    as,
+			ListingService: lister,
+		})
+
+		req := httptest.NewRequest("GET", "/comments/"+parentID+"/replies", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment could not be retrieved: Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when worknote has some replies", func(t *testing.T) {
+		assetType := comment.AssetTypeWorknote
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		expectedQuery := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"parent_uuid": parentID,
+				"deleted_at":  map[string]interface{}{"$exists": false},
+			},
+			"sort":   []map[string]string{{"created_at": "asc"}},
+			"fields": []string{"created_at", "created_by", "text", "content_type", "template_id", "entity", "original_entity", "uuid", "external_id", "read_by", "parent_uuid", "mentions", "reactions", "pinned_at", "pinned_by", "converted_from", "converted_at", "converted_by"},
+			"limit":  float64(2),
+		}
+
+		lister := new(mocks.ListingMock)
+		lister.On("GetComment", parentID, channelID, assetType).
+			Return(comment.Comment{UUID: parentID}, nil)
+		lister.On("QueryComments", expectedQuery, channelID, assetType).
+			Return(listing.QueryResult{
+				Result: []map[string]interface{}{
+					{"uuid": "916c984f-e3fe-4638-8683-71f05501491f", "text": "reply 1", "parent_uuid": parentID},
+					{"uuid": "0ac5ebce-17e7-4edc-9552-fefe16e127fb", "text": "reply 2", "parent_uuid": parentID},
+				},
+				Bookmark: "g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYorpJiaWRolGxrpWpgYp-",
+			}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/worknotes/"+parentID+"/replies?limit=2", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"result":[
+				{"uuid":"916c984f-e3fe-4638-8683-71f05501491f","text":"reply 1","parent_uuid":"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"},
+				{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb","text":"reply 2","parent_uuid":"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}
+			],
+			"bookmark":"g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYorpJiaWRolGxrpWpgYp-",
+			"_links":{
+				"self":{"href":"http://service.url/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/replies?limit=2"},
+				"next":{"href":"http://service.url/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/replies?limit=2&bookmark=g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYorpJiaWRolGxrpWpgYp-"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		lister.AssertExpectations(t)
+	})
+}
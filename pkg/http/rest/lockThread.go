@@ -0,0 +1,188 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route POST /entities/{entity}/lock entities LockThread
+// Locks the entity thread against new comments/worknotes of the asset type
+// responses:
+//	201: createdResponse
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// LockThread returns handler for locking entity thread
+func (s *Server) LockThread() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	type requestBody struct {
+		Reason string `json:"reason"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("LockThread handler called")
+
+		e, assetType, err := s.lockParams("LockThread", w, r, params)
+		if err != nil {
+			return
+		}
+
+		if err := s.authorize("LockThread", assetType.String(), auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		defer func() { _ = r.Body.Close() }()
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.logger.Error("could not read request body", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var request requestBody
+
+		// request body is optional
+		if len(payload) > 0 {
+			err = s.payloadValidator.ValidatePayload(payload, "lock_thread.yaml")
+			if err != nil {
+				var errGeneral *validation.ErrGeneral
+				if errors.As(err, &errGeneral) {
+					s.logger.Error("payload validation", zap.Error(err))
+					s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				s.logger.Warn("invalid payload", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			err = json.Unmarshal(payload, &request)
+			if err != nil {
+				s.logger.Error("could not decode JSON from request", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		err = s.entityTypes.Validate(channelID, e)
+		if err != nil {
+			s.logger.Warn("invalid entity", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		lock := comment.ThreadLock{
+			Entity: e,
+			Reason: request.Reason,
+			LockedBy: &comment.UserInfo{
+				UUID:           user.UUID,
+				Name:           user.Name,
+				Surname:        user.Surname,
+				OrgName:        user.OrgName,
+				OrgDisplayName: user.OrgDisplayName,
+			},
+		}
+
+		alreadyLocked, err := s.locker.LockThread(r.Context(), lock, channelID, assetType)
+		if err != nil {
+			s.writeRepositoryError("LockThread", w, err)
+			return
+		}
+
+		if alreadyLocked {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// swagger:route DELETE /entities/{entity}/lock entities UnlockThread
+// Unlocks the entity thread, so new comments/worknotes of the asset type can be added again
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// UnlockThread returns handler for unlocking entity thread
+func (s *Server) UnlockThread() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("UnlockThread handler called")
+
+		e, assetType, err := s.lockParams("UnlockThread", w, r, params)
+		if err != nil {
+			return
+		}
+
+		if err := s.authorize("UnlockThread", assetType.String(), auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		_, err = s.locker.UnlockThread(r.Context(), e, channelID, assetType)
+		if err != nil {
+			s.writeRepositoryError("UnlockThread", w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// lockParams returns entity from URL path and asset type from 'asset_type' query param of the thread lock request,
+// otherwise it writes error message to response and returns error to notify calling handler to stop execution
+func (s *Server) lockParams(handlerName string, w http.ResponseWriter, r *http.Request, params httprouter.Params) (entity.Entity, comment.AssetType, error) {
+	e, err := entity.Parse(params.ByName("entity"))
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("%s handler failed", handlerName), zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+		return entity.Entity{}, "", err
+	}
+
+	assetType := comment.AssetType(r.URL.Query().Get("asset_type"))
+	if !s.assetTypes.Contains(assetType) {
+		names := make([]string, 0, len(s.assetTypes))
+		for _, a := range s.assetTypes {
+			names = append(names, a.String())
+		}
+
+		eMsg := fmt.Sprintf("invalid 'asset_type' param value '%s', allowed values are: %s", assetType, strings.Join(names, ", "))
+		s.logger.Warn(fmt.Sprintf("%s handler failed", handlerName), zap.String("error", eMsg))
+		s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+		return entity.Entity{}, "", errors.New(eMsg)
+	}
+
+	return e, assetType, nil
+}
@@ -0,0 +1,253 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockThreadHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	pv, err := validation.NewPayloadValidator()
+	require.NoError(t, err)
+
+	t.Run("when thread is being locked", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		lock := comment.ThreadLock{
+			Entity: e,
+			Reason: "Incident is closed",
+			LockedBy: &comment.UserInfo{
+				UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+				Name: "Some test user 1",
+			},
+		}
+
+		locker := new(mocks.LockingMock)
+		locker.On("LockThread", lock, channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      us,
+			LockingService:   locker,
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"reason":"Incident is closed"}`)
+		req := httptest.NewRequest("POST", "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/lock?asset_type=comment", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		locker.AssertExpectations(t)
+	})
+
+	t.Run("when thread is already locked", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		locker := new(mocks.LockingMock)
+		locker.On("LockThread", mock.AnythingOfType("comment.ThreadLock"), channelID, comment.AssetTypeWorknote).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      us,
+			LockingService:   locker,
+			PayloadValidator: pv,
+		})
+
+		req := httptest.NewRequest("POST", "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/lock?asset_type=worknote", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+	})
+
+	t.Run("when asset_type param is not valid", func(t *testing.T) {
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			UserService:      us,
+			PayloadValidator: pv,
+		})
+
+		req := httptest.NewRequest("POST", "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/lock", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+		expectedJSON := `{"error":"invalid 'asset_type' param value '', allowed values are: comment, worknote"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when entity is not valid", func(t *testing.T) {
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			UserService:      us,
+			PayloadValidator: pv,
+		})
+
+		req := httptest.NewRequest("POST", "/entities/incident/lock?asset_type=comment", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+		expectedJSON := `{"error":"invalid entity reference 'incident', expected format <kind>:<id>"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when payload is not valid", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      us,
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"reason":"Incident is closed","until":"tomorrow"}`)
+		req := httptest.NewRequest("POST", "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/lock?asset_type=comment", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+	})
+}
+
+func TestUnlockThreadHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when thread is being unlocked", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		locker := new(mocks.LockingMock)
+		locker.On("UnlockThread", entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"), channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:           "service.url",
+			Logger:         logger,
+			AuthService:    as,
+			UserService:    us,
+			LockingService: locker,
+		})
+
+		req := httptest.NewRequest("DELETE", "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/lock?asset_type=comment", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+		locker.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route POST /entities/{entity}/merge entities MergeEntity
+// Merges the duplicate entity into the target entity, comments and worknotes of all asset types are moved
+// (or copied) to the target entity and keep the merged entity in original_entity field
+// responses:
+//	200: mergedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	409: errorResponse409
+
+// MergeEntity returns handler for merging comments of the duplicate entity into the target entity
+func (s *Server) MergeEntity() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	type requestBody struct {
+		Target string `json:"target"`
+		Mode   string `json:"mode"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("MergeEntity handler called")
+
+		source, err := entity.Parse(params.ByName("entity"))
+		if err != nil {
+			s.logger.Warn("MergeEntity handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer func() { _ = r.Body.Close() }()
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.logger.Error("could not read request body", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.payloadValidator.ValidatePayload(payload, "merge_entity.yaml")
+		if err != nil {
+			var errGeneral *validation.ErrGeneral
+			if errors.As(err, &errGeneral) {
+				s.logger.Error("payload validation", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.logger.Warn("invalid payload", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var request requestBody
+		err = json.Unmarshal(payload, &request)
+		if err != nil {
+			s.logger.Error("could not decode JSON from request", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		target, err := entity.Parse(request.Target)
+		if err != nil {
+			s.logger.Warn("MergeEntity handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if target.String() == source.String() {
+			eMsg := fmt.Sprintf("entity '%s' cannot be merged into itself", source)
+			s.logger.Warn("MergeEntity handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		mode := comment.MergeModeMove
+		if request.Mode != "" {
+			mode = comment.MergeMode(request.Mode)
+		}
+
+		// moved comments are updated, copies are created in the target entity
+		action := auth.UpdateAction
+		if mode == comment.MergeModeCopy {
+			action = auth.CreateAction
+		}
+
+		for _, assetType := range s.assetTypes {
+			if err := s.authorize("MergeEntity", assetType.String(), action, w, r); err != nil {
+				return
+			}
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		for _, e := range []entity.Entity{source, target} {
+			err = s.entityTypes.Validate(channelID, e)
+			if err != nil {
+				s.logger.Warn("invalid entity", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		m := comment.EntityMerge{
+			Source: source,
+			Target: target,
+			Mode:   mode,
+			MergedBy: &comment.UserInfo{
+				UUID:           user.UUID,
+				Name:           user.Name,
+				Surname:        user.Surname,
+				OrgName:        user.OrgName,
+				OrgDisplayName: user.OrgDisplayName,
+			},
+		}
+
+		merged := make(map[string]int, len(s.assetTypes))
+		for _, assetType := range s.assetTypes {
+			n, err := s.updater.MergeEntity(r.Context(), m, channelID, assetType)
+			if err != nil {
+				s.writeRepositoryError("MergeEntity", w, err)
+				return
+			}
+
+			merged[assetType.String()] = n
+		}
+
+		s.presenter.WriteMergedResponse(w, merged)
+	}
+}
@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeEntityHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+	path := "/entities/incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444/merge"
+
+	pv, err := validation.NewPayloadValidator()
+	require.NoError(t, err)
+
+	newUserService := func() *mocks.UserServiceMock {
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+		return us
+	}
+
+	t.Run("when comments and worknotes are moved", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "worknote", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		m := comment.EntityMerge{
+			Source: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			Target: entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"),
+			Mode:   comment.MergeModeMove,
+			MergedBy: &comment.UserInfo{
+				UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+				Name: "Some test user 1",
+			},
+		}
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("MergeEntity", m, channelID, comment.AssetTypeComment).Return(3, nil)
+		updater.On("MergeEntity", m, channelID, comment.AssetTypeWorknote).Return(1, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      newUserService(),
+			UpdatingService:  updater,
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"target":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}`)
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.JSONEq(t, `{"merged":{"comment":3,"worknote":1}}`, string(b), "response does not match")
+
+		updater.AssertExpectations(t)
+	})
+
+	t.Run("when user is not authorized to CREATE worknote copies", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "worknote", auth.CreateAction, channelID, bearerToken).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      newUserService(),
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"target":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e","mode":"copy"}`)
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+		as.AssertExpectations(t)
+	})
+
+	t.Run("when entity is merged into itself", func(t *testing.T) {
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			UserService:      newUserService(),
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"target":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"}`)
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+		assert.JSONEq(t, `{"error":"entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444' cannot be merged into itself"}`, string(b))
+	})
+
+	t.Run("when comments were changed concurrently", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", mock.Anything, auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("MergeEntity", mock.AnythingOfType("comment.EntityMerge"), channelID, comment.AssetTypeComment).
+			Return(0, couchdb.ErrorConflict("Comments of entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444' could not be merged"))
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      newUserService(),
+			UpdatingService:  updater,
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"target":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}`)
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+		updater.AssertExpectations(t)
+	})
+}
@@ -50,3 +50,20 @@ func (s Server) UserInfoFromRequest(r *http.Request) (*user.BasicInfo, bool) {
 	u, ok := r.Context().Value(userKey).(*user.BasicInfo)
 	return u, ok
 }
+
+// withUserInfo returns the request with info about invoking user stored in its context, if it is not there yet.
+// It is used by read-only handlers to personalize the response (e.g. reactions of the user),
+// so the failure of user service is only logged and the request is returned unchanged.
+func (s Server) withUserInfo(r *http.Request) *http.Request {
+	if _, ok := s.UserInfoFromRequest(r); ok || s.userService == nil {
+		return r
+	}
+
+	userData, err := s.userService.UserBasicInfo(r)
+	if err != nil || userData.UUID == "" {
+		s.logger.Warn("could not retrieve invoking user info, response is not personalized", zap.Error(err))
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), userKey, &userData))
+}
@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route POST /comments/{uuid}/pin comments PinComment
+// Pins specified comment to the top of its entity thread
+// responses:
+//	201: createdResponse
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route POST /worknotes/{uuid}/pin worknotes PinWorknote
+// Pins specified worknote to the top of its entity thread
+// responses:
+//	201: createdResponse
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// PinComment returns handler for pinning comment|worknote
+func (s *Server) PinComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("PinComment handler called")
+
+		if err := s.authorize("PinComment", assetType.String(), auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("PinComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		pinnedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		alreadyPinned, err := s.updater.PinComment(r.Context(), id, pinnedBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("PinComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("PinComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, assetType.Plural(), id)
+
+		w.Header().Set("Location", assetURI)
+
+		if alreadyPinned {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// swagger:route DELETE /comments/{uuid}/pin comments UnpinComment
+// Removes specified comment from the top of its entity thread
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route DELETE /worknotes/{uuid}/pin worknotes UnpinWorknote
+// Removes specified worknote from the top of its entity thread
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// UnpinComment returns handler for unpinning comment|worknote
+func (s *Server) UnpinComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("UnpinComment handler called")
+
+		if err := s.authorize("UnpinComment", assetType.String(), auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("UnpinComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		unpinnedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		_, err = s.updater.UnpinComment(r.Context(), id, unpinnedBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("UnpinComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("UnpinComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,214 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPinCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	pinnedBy := comment.UserInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when user is not authorized to UPDATE the comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/pin", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (comment, update)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment is being pinned", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("PinComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", pinnedBy, channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/pin", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		expectedLocation := "http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), "Location header")
+	})
+
+	t.Run("when worknote is already pinned", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("PinComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", pinnedBy, channelID, comment.AssetTypeWorknote).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/pin", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+	})
+
+	t.Run("when maximum number of pinned comments is reached", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		eMsg := "Comment could not be pinned: maximum number of pinned comments (3) reached for entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444'"
+		updater := new(mocks.UpdatingMock)
+		updater.On("PinComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", pinnedBy, channelID, comment.AssetTypeComment).
+			Return(false, couchdb.ErrorConflict(eMsg))
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/pin", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+		assert.JSONEq(t, `{"error":"`+eMsg+`"}`, string(b), "response does not match")
+	})
+
+	t.Run("when comment is being unpinned", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("UnpinComment", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", pinnedBy, channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/pin", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+		updater.AssertExpectations(t)
+	})
+}
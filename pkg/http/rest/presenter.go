@@ -3,12 +3,15 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/hypermedia"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/render"
 	"go.uber.org/zap"
 )
 
@@ -23,6 +26,14 @@ func (a ActionType) String() string {
 type Presenter interface {
 	WriteGetResponse(r *http.Request, w http.ResponseWriter, comment comment.Comment, assetType comment.AssetType)
 	WriteListResponse(r *http.Request, w http.ResponseWriter, list listing.QueryResult, assetType comment.AssetType)
+	WriteRepliesResponse(r *http.Request, w http.ResponseWriter, parentID string, list listing.QueryResult, assetType comment.AssetType)
+	WriteHistoryResponse(r *http.Request, w http.ResponseWriter, comment comment.Comment, assetType comment.AssetType)
+	WriteHTMLResponse(w http.ResponseWriter, comment comment.Comment)
+	WriteTemplateResponse(w http.ResponseWriter, template comment.Template)
+	WriteTemplateListResponse(w http.ResponseWriter, templates []comment.Template)
+	WriteUnreadResponse(r *http.Request, w http.ResponseWriter, unread map[string]int, assetType comment.AssetType)
+	WriteMarkedResponse(w http.ResponseWriter, marked int)
+	WriteMergedResponse(w http.ResponseWriter, merged map[string]int)
 	WriteError(w http.ResponseWriter, error string, code int)
 }
 
@@ -39,14 +50,8 @@ type presenter struct {
 	serverAddr string
 }
 
-func (p presenter) WriteGetResponse(_ *http.Request, w http.ResponseWriter, c comment.Comment, assetType comment.AssetType) {
-	var action ActionType
-	switch assetType {
-	case comment.AssetTypeComment:
-		action = GetComment
-	case comment.AssetTypeWorknote:
-		action = GetWorknote
-	}
+func (p presenter) WriteGetResponse(r *http.Request, w http.ResponseWriter, c comment.Comment, assetType comment.AssetType) {
+	action := assetTypeAction(assetType, "/{uuid}")
 
 	resourceURI := fmt.Sprintf("%s%s", p.serverAddr, strings.ReplaceAll(action.String(), "{uuid}", c.UUID))
 
@@ -56,7 +61,7 @@ func (p presenter) WriteGetResponse(_ *http.Request, w http.ResponseWriter, c co
 
 	allowedLinks := hypermedia.AllowedLinksForComment(c, assetType)
 	for _, linkName := range allowedLinks {
-		action, err := p.mapLinkNameToAction(linkName)
+		action, err := p.mapLinkNameToAction(linkName, assetType)
 		if err != nil {
 			p.WriteError(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -68,19 +73,25 @@ func (p presenter) WriteGetResponse(_ *http.Request, w http.ResponseWriter, c co
 		}
 	}
 
-	p.encodeJSON(w, resourceContainer{Comment: c, Links: links})
+	p.encodeJSON(w, resourceContainer{Comment: c, Reactions: c.Reactions.Summary(userUUID(r)), Links: links})
 }
 
 func (p presenter) WriteListResponse(r *http.Request, w http.ResponseWriter, list listing.QueryResult, assetType comment.AssetType) {
-	var action ActionType
-	switch assetType {
-	case comment.AssetTypeComment:
-		action = ListComments
-	case comment.AssetTypeWorknote:
-		action = ListWorknotes
-	}
+	action := assetTypeAction(assetType, "")
 	resourceURI := fmt.Sprintf("%s%s", p.serverAddr, action)
 
+	p.writeList(r, w, resourceURI, list)
+}
+
+func (p presenter) WriteRepliesResponse(r *http.Request, w http.ResponseWriter, parentID string, list listing.QueryResult, assetType comment.AssetType) {
+	action := assetTypeAction(assetType, "/{uuid}/replies")
+	resourceURI := fmt.Sprintf("%s%s", p.serverAddr, strings.ReplaceAll(action.String(), "{uuid}", parentID))
+
+	p.writeList(r, w, resourceURI, list)
+}
+
+// writeList writes the list with hypermedia links to the resource and to the next page, if any
+func (p presenter) writeList(r *http.Request, w http.ResponseWriter, resourceURI string, list listing.QueryResult) {
 	delimiter := "?"
 
 	if r.URL.RawQuery != "" {
@@ -99,9 +110,66 @@ func (p presenter) WriteListResponse(r *http.Request, w http.ResponseWriter, lis
 		}
 	}
 
+	for _, item := range list.Result {
+		if reactions, ok := item["reactions"]; ok {
+			item["reactions"] = p.reactionSummary(reactions, userUUID(r))
+		}
+	}
+
 	p.encodeJSON(w, listContainer{QueryResult: list, Links: links})
 }
 
+func (p presenter) WriteHistoryResponse(_ *http.Request, w http.ResponseWriter, c comment.Comment, assetType comment.AssetType) {
+	action := assetTypeAction(assetType, "/{uuid}/history")
+
+	resourceURI := fmt.Sprintf("%s%s", p.serverAddr, strings.ReplaceAll(action.String(), "{uuid}", c.UUID))
+
+	links := map[string]interface{}{
+		"self": map[string]string{"href": resourceURI},
+	}
+
+	history := c.History
+	if history == nil {
+		history = comment.HistoryList{}
+	}
+
+	p.encodeJSON(w, historyContainer{Result: history, Links: links})
+}
+
+func (p presenter) WriteTemplateResponse(w http.ResponseWriter, t comment.Template) {
+	links := map[string]interface{}{
+		"self": map[string]string{"href": fmt.Sprintf("%s/templates/%s", p.serverAddr, t.UUID)},
+	}
+
+	p.encodeJSON(w, templateContainer{Template: t, Links: links})
+}
+
+func (p presenter) WriteTemplateListResponse(w http.ResponseWriter, templates []comment.Template) {
+	links := map[string]interface{}{
+		"self": map[string]string{"href": p.serverAddr + "/templates"},
+	}
+
+	p.encodeJSON(w, templateListContainer{Result: templates, Links: links})
+}
+
+func (p presenter) WriteUnreadResponse(r *http.Request, w http.ResponseWriter, unread map[string]int, assetType comment.AssetType) {
+	action := assetTypeAction(assetType, "/unread")
+
+	links := map[string]interface{}{
+		"self": map[string]string{"href": fmt.Sprintf("%s%s?%s", p.serverAddr, action, r.URL.RawQuery)},
+	}
+
+	p.encodeJSON(w, unreadContainer{Result: unread, Links: links})
+}
+
+func (p presenter) WriteMarkedResponse(w http.ResponseWriter, marked int) {
+	p.encodeJSON(w, map[string]int{"marked": marked})
+}
+
+func (p presenter) WriteMergedResponse(w http.ResponseWriter, merged map[string]int) {
+	p.encodeJSON(w, map[string]map[string]int{"merged": merged})
+}
+
 // WriteError replies to the request with the specified error message and HTTP code.
 // It does not otherwise end the request; the caller should ensure no further writes are done to 'w'.
 // The error message should be plain text.
@@ -120,6 +188,12 @@ func (p presenter) sendErrorJSON(w http.ResponseWriter, error string, code int)
 	_, _ = fmt.Fprintf(w, `{"error":%s}`+"\n", errorJSON)
 }
 
+// WriteHTMLResponse writes text of the comment rendered to sanitized HTML
+func (p presenter) WriteHTMLResponse(w http.ResponseWriter, c comment.Comment) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, render.HTML(c))
+}
+
 // encodeJSON encodes 'v' to JSON and writes it to the 'w'. Also sets correct Content-Type header.
 // It does not otherwise end the request; the caller should ensure no further writes are done to 'w'.
 func (p presenter) encodeJSON(w http.ResponseWriter, v interface{}) {
@@ -133,10 +207,35 @@ func (p presenter) encodeJSON(w http.ResponseWriter, v interface{}) {
 	}
 }
 
-func (p presenter) mapLinkNameToAction(name string) (ActionType, error) {
+// reactionSummary converts reactions of the listed comment to reaction counts
+func (p presenter) reactionSummary(v interface{}, userUUID string) []comment.ReactionSummary {
+	var reactions comment.ReactionList
+
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, &reactions)
+	}
+	if err != nil {
+		p.logger.Error("could not decode reactions", zap.Error(err))
+	}
+
+	return reactions.Summary(userUUID)
+}
+
+// userUUID returns UUID of the invoking user stored in request context or empty string if it is not known
+func userUUID(r *http.Request) string {
+	u, ok := r.Context().Value(userKey).(*user.BasicInfo)
+	if !ok {
+		return ""
+	}
+
+	return u.UUID
+}
+
+func (p presenter) mapLinkNameToAction(name string, assetType comment.AssetType) (ActionType, error) {
 	m := map[string]ActionType{
-		"MarkCommentAsReadByUser":  MarkCommentAsReadByUser,
-		"MarkWorknoteAsReadByUser": MarkWorknoteAsReadByUser,
+		"Mark" + assetType.Title() + "AsReadByUser": assetTypeAction(assetType, "/{uuid}/read_by"),
+		"Restore" + assetType.Title():               assetTypeAction(assetType, "/{uuid}/restore"),
 	}
 
 	action, ok := m[name]
@@ -147,12 +246,39 @@ func (p presenter) mapLinkNameToAction(name string) (ActionType, error) {
 	return action, nil
 }
 
+// assetTypeAction returns action route of the asset type (e.g. /worknotes/{uuid}/read_by for worknote and "/{uuid}/read_by")
+func assetTypeAction(assetType comment.AssetType, path string) ActionType {
+	return ActionType("/" + assetType.Plural() + path)
+}
+
 type resourceContainer struct {
 	comment.Comment
-	Links map[string]interface{} `json:"_links"`
+	// reaction counts replace the stored reactions
+	Reactions []comment.ReactionSummary `json:"reactions,omitempty"`
+	Links     map[string]interface{}    `json:"_links"`
 }
 
 type listContainer struct {
 	listing.QueryResult
 	Links map[string]interface{} `json:"_links"`
 }
+
+type historyContainer struct {
+	Result comment.HistoryList    `json:"result"`
+	Links  map[string]interface{} `json:"_links"`
+}
+
+type templateContainer struct {
+	comment.Template
+	Links map[string]interface{} `json:"_links"`
+}
+
+type templateListContainer struct {
+	Result []comment.Template     `json:"result"`
+	Links  map[string]interface{} `json:"_links"`
+}
+
+type unreadContainer struct {
+	Result map[string]int         `json:"result"`
+	Links  map[string]interface{} `json:"_links"`
+}
@@ -1,15 +1,18 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/julienschmidt/httprouter"
@@ -75,28 +78,92 @@ func (s *Server) QueryComments(assetType comment.AssetType) func(w http.Response
 			}
 		}
 
+		replies := queryValues.Get("replies")
+		if replies != "" && replies != repliesCount && replies != repliesNest {
+			eMsg := fmt.Sprintf("invalid 'replies' param value '%s', allowed values are: %s, %s", replies, repliesCount, repliesNest)
+			s.logger.Warn(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		pinned := queryValues.Get("pinned")
+		if pinned != "" && pinned != "true" && pinned != "false" {
+			eMsg := fmt.Sprintf("invalid 'pinned' param value '%s', allowed values are: true, false", pinned)
+			s.logger.Warn(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		// query of pinned comments listed before the others in the entity thread
+		var pinnedFirstQuery map[string]interface{}
+
 		// no query param => we create our query
 		if len(query) == 0 {
+			selector := map[string]interface{}{}
 			entity := queryValues.Get("entity")
+			externalID := queryValues.Get("external_id")
 			if entity != "" {
 				// list all comments that belongs to one entity
-				query["selector"] = map[string]string{"entity": entity}
-			} else {
+				selector["entity"] = entity
+			}
+			if externalID != "" {
+				// list comments with the ID in external system
+				selector["external_id"] = externalID
+			}
+			if entity == "" && externalID == "" {
 				// list all comments
-				query["selector"] = map[string]interface{}{"_id": map[string]interface{}{"$gt": nil}}
+				selector["_id"] = map[string]interface{}{"$gt": nil}
 			}
-			limit := queryValues.Get("limit")
-			if limit != "" {
-				l, _ := strconv.ParseFloat(limit, 64)
-				query["limit"] = l
+			if replies == repliesNest {
+				// replies are nested in their parents, so list only top level comments
+				selector["parent_uuid"] = map[string]interface{}{"$exists": false}
+			}
+			fields := listFields()
+			if queryValues.Get("include_deleted") == "true" {
+				fields = append(fields, "deleted_at", "deleted_by", "restored_at", "restored_by")
+			} else {
+				// deleted comments are hidden by default
+				selector["deleted_at"] = map[string]interface{}{"$exists": false}
 			}
-			bookmark := queryValues.Get("bookmark")
-			if bookmark != "" {
-				query["bookmark"] = bookmark
+			sortField := "created_at"
+			switch {
+			case pinned == "true":
+				selector["pinned_at"] = map[string]interface{}{"$exists": true}
+				sortField = "pinned_at"
+			case pinned == "false":
+				selector["pinned_at"] = map[string]interface{}{"$exists": false}
+			case entity != "" && pageLimit(queryValues) > 1:
+				// pinned comments are listed first (on the first page) of the entity thread, they take at most
+				// all but one place of the page, so the next page continues after the first not pinned comment
+				if queryValues.Get("bookmark") == "" {
+					pinnedSelector := map[string]interface{}{"pinned_at": map[string]interface{}{"$exists": true}}
+					for k, v := range selector {
+						pinnedSelector[k] = v
+					}
+
+					pinnedFirstQuery = map[string]interface{}{
+						"selector": pinnedSelector,
+						"sort":     []map[string]string{{"pinned_at": "desc"}},
+						"fields":   fields,
+						"limit":    math.Min(pinnedPageSize, pageLimit(queryValues)-1),
+					}
+				}
+				selector["pinned_at"] = map[string]interface{}{"$exists": false}
 			}
+			query["selector"] = selector
+
+			paginate(query, queryValues)
 
-			query["sort"] = []map[string]string{{"created_at": "desc"}}
-			query["fields"] = []string{"created_at", "created_by", "text", "entity", "uuid", "read_by"}
+			query["sort"] = []map[string]string{{sortField: "desc"}}
+			query["fields"] = fields
+		} else if selector, ok := query["selector"]; ok && queryValues.Get("include_deleted") != "true" {
+			// deleted comments are hidden from custom queries as well
+			query["selector"] = map[string]interface{}{
+				"$and": []interface{}{
+					selector,
+					map[string]interface{}{"deleted_at": map[string]interface{}{"$exists": false}},
+				},
+			}
 		}
 
 		channelID, err := s.assertChannelID(w, r)
@@ -104,7 +171,19 @@ func (s *Server) QueryComments(assetType comment.AssetType) func(w http.Response
 			return
 		}
 
-		qResult, err := s.lister.QueryComments(r.Context(), query, channelID, assetType)
+		var qResult listing.QueryResult
+		if pinnedFirstQuery != nil {
+			qResult, err = s.lister.QueryComments(r.Context(), pinnedFirstQuery, channelID, assetType)
+
+			// pinned comments count against the limit of the page
+			query["limit"] = pageLimit(queryValues) - float64(len(qResult.Result))
+		}
+		if err == nil {
+			var result listing.QueryResult
+			result, err = s.lister.QueryComments(r.Context(), query, channelID, assetType)
+			result.Result = append(qResult.Result, result.Result...)
+			qResult = result
+		}
 		if err != nil {
 			var httpError *repository.Error
 			if errors.As(err, &httpError) {
@@ -118,6 +197,133 @@ func (s *Server) QueryComments(assetType comment.AssetType) func(w http.Response
 			return
 		}
 
-		s.presenter.WriteListResponse(r, w, qResult, assetType)
+		if replies != "" {
+			err = s.addReplies(r.Context(), qResult, replies, channelID, assetType)
+			if err != nil {
+				var httpError *repository.Error
+				if errors.As(err, &httpError) {
+					s.logger.Error("Repository error", zap.Error(err))
+					s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+					return
+				}
+
+				s.logger.Error("QueryComments handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		s.presenter.WriteListResponse(s.withUserInfo(r), w, qResult, assetType)
+	}
+}
+
+// Values of 'replies' query param
+const (
+	repliesCount = "count"
+	repliesNest  = "nest"
+)
+
+// repliesPageSize is the amount of replies fetched from repository at once
+const repliesPageSize = 100
+
+// pinnedPageSize is the maximum amount of pinned comments listed first in the entity thread
+const pinnedPageSize = 100
+
+// defaultPageSize is the default limit of the page of listed comments (as in CouchDB)
+const defaultPageSize = 25
+
+// addReplies extends each listed comment with the number of its replies ('count')
+// or with the replies themselves ('nest'), deleted replies are omitted
+func (s *Server) addReplies(ctx context.Context, list listing.QueryResult, replies, channelID string, assetType comment.AssetType) error {
+	var parentIDs []string
+	for _, doc := range list.Result {
+		if id, ok := doc["uuid"].(string); ok {
+			parentIDs = append(parentIDs, id)
+		}
+	}
+
+	if len(parentIDs) == 0 {
+		return nil
+	}
+
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"parent_uuid": map[string]interface{}{"$in": parentIDs},
+			"deleted_at":  map[string]interface{}{"$exists": false},
+		},
+		"sort":   []map[string]string{{"created_at": "asc"}},
+		"fields": listFields(),
+		"limit":  float64(repliesPageSize),
+	}
+
+	byParent := map[string][]map[string]interface{}{}
+	for {
+		qResult, err := s.lister.QueryComments(ctx, query, channelID, assetType)
+		if err != nil {
+			return err
+		}
+
+		for _, reply := range qResult.Result {
+			parentID, _ := reply["parent_uuid"].(string)
+			byParent[parentID] = append(byParent[parentID], reply)
+		}
+
+		if qResult.Bookmark == "" {
+			break
+		}
+
+		query["bookmark"] = qResult.Bookmark
+	}
+
+	for _, doc := range list.Result {
+		id, ok := doc["uuid"].(string)
+		if !ok {
+			continue
+		}
+
+		switch replies {
+		case repliesCount:
+			doc["replies_count"] = len(byParent[id])
+		case repliesNest:
+			nested := byParent[id]
+			if nested == nil {
+				nested = []map[string]interface{}{}
+			}
+			doc["replies"] = nested
+		}
+	}
+
+	return nil
+}
+
+// listFields returns the fields of comment returned in lists by default
+func listFields() []string {
+	return []string{
+		"created_at", "created_by", "text", "content_type", "template_id", "entity", "original_entity", "uuid", "external_id",
+		"read_by", "parent_uuid", "mentions", "reactions", "pinned_at", "pinned_by", "converted_from", "converted_at", "converted_by",
+	}
+}
+
+// pageLimit returns the limit of the page requested by the request, defaultPageSize if it is not set
+func pageLimit(queryValues url.Values) float64 {
+	limit := queryValues.Get("limit")
+	if limit == "" {
+		return defaultPageSize
+	}
+
+	l, _ := strconv.ParseFloat(limit, 64)
+	return l
+}
+
+// paginate sets pagination params of the query from the request
+func paginate(query map[string]interface{}, queryValues url.Values) {
+	limit := queryValues.Get("limit")
+	if limit != "" {
+		l, _ := strconv.ParseFloat(limit, 64)
+		query["limit"] = l
+	}
+	bookmark := queryValues.Get("bookmark")
+	if bookmark != "" {
+		query["bookmark"] = bookmark
 	}
 }
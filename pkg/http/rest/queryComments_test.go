@@ -11,12 +11,14 @@ import (
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestQueryCommentsHandler(t *testing.T) {
@@ -26,6 +28,13 @@ func TestQueryCommentsHandler(t *testing.T) {
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
 	bearerToken := "some valid Bearer token"
 
+	// pinned comments are queried first when comments of the entity are listed
+	isPinnedFirstQuery := func(query map[string]interface{}) bool {
+		selector, _ := query["selector"].(map[string]interface{})
+		pinned, _ := selector["pinned_at"].(map[string]interface{})
+		return pinned["$exists"] == true
+	}
+
 	// TODO add tests that the service is called with correct queries
 
 	t.Run("when channelID is not set (ie. grpc-metadata-space header is missing)", func(t *testing.T) {
@@ -82,6 +91,8 @@ func TestQueryCommentsHandler(t *testing.T) {
 			Return(true, nil)
 
 		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
 		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
 			Return(listing.QueryResult{Result: result}, nil)
 
@@ -117,6 +128,81 @@ func TestQueryCommentsHandler(t *testing.T) {
 			}
 		}`
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		expectedFields := []string{
+			"created_at", "created_by", "text", "content_type", "template_id", "entity", "original_entity", "uuid", "external_id",
+			"read_by", "parent_uuid", "mentions", "reactions", "pinned_at", "pinned_by", "converted_from", "converted_at", "converted_by",
+		}
+		for _, call := range lister.Calls {
+			query := call.Arguments.Get(0).(map[string]interface{})
+			assert.Equal(t, expectedFields, query["fields"], "fields")
+		}
+	})
+
+	t.Run("when found comments have reactions", func(t *testing.T) {
+		result := []map[string]interface{}{
+			{
+				"text": "test 1",
+				"uuid": "916c984f-e3fe-4638-8683-71f05501491f",
+				"reactions": []interface{}{
+					map[string]interface{}{
+						"emoji": "thumbsup",
+						"time":  "2021-04-12T21:20:00+02:00",
+						"user":  map[string]interface{}{"uuid": "2af4f493-0bd5-4513-b440-6cbb465feadb"},
+					},
+				},
+			},
+		}
+
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(user.BasicInfo{UUID: "8540d943-8ccd-4ff1-8a08-0c3aa338c58e"}, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{Result: result}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"result":[{
+				"text":"test 1",
+				"uuid":"916c984f-e3fe-4638-8683-71f05501491f",
+				"reactions":[{"emoji":"thumbsup","count":1,"reacted":false}]
+			}],
+			"_links":{
+				"self":{"href":"http://service.url/comments"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
 
 	t.Run("when bookmark is returned", func(t *testing.T) {
@@ -340,6 +426,8 @@ func TestQueryCommentsHandler(t *testing.T) {
 		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
 			Return(true, nil)
 		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
 
 		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
 			Return(listing.QueryResult{Result: result}, nil)
@@ -378,4 +466,485 @@ func TestQueryCommentsHandler(t *testing.T) {
 
 		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
 	})
+
+	t.Run("when deleted comments are requested too", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		for includeDeleted, expectedSelector := range map[string]map[string]interface{}{
+			"false": {
+				"entity":     "request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+				"deleted_at": map[string]interface{}{"$exists": false},
+				"pinned_at":  map[string]interface{}{"$exists": false},
+			},
+			"true": {
+				"entity":    "request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+				"pinned_at": map[string]interface{}{"$exists": false},
+			},
+		} {
+			req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&include_deleted="+includeDeleted, nil)
+			req.Header.Set("grpc-metadata-space", channelID)
+			req.Header.Set("authorization", bearerToken)
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			resp := w.Result()
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+			calls := lister.Calls
+			query := calls[len(calls)-1].Arguments.Get(0).(map[string]interface{})
+			assert.Equal(t, expectedSelector, query["selector"], "selector for include_deleted=%s", includeDeleted)
+		}
+	})
+
+	t.Run("when custom query is used", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		selector := map[string]interface{}{"entity": "incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}
+		query := url.QueryEscape(`{"selector":{"entity":"incident:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"},"sort":[{"created_at":"desc"}]}`)
+
+		for includeDeleted, expectedSelector := range map[string]interface{}{
+			"": map[string]interface{}{
+				"$and": []interface{}{
+					selector,
+					map[string]interface{}{"deleted_at": map[string]interface{}{"$exists": false}},
+				},
+			},
+			"true": selector,
+		} {
+			req := httptest.NewRequest("GET", "/comments?query="+query+"&include_deleted="+includeDeleted, nil)
+			req.Header.Set("grpc-metadata-space", channelID)
+			req.Header.Set("authorization", bearerToken)
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			resp := w.Result()
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+			calls := lister.Calls
+			q := calls[len(calls)-1].Arguments.Get(0).(map[string]interface{})
+			assert.Equal(t, expectedSelector, q["selector"], "selector for include_deleted=%s", includeDeleted)
+		}
+	})
+
+	t.Run("when comments are filtered by external ID", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		for params, expectedSelector := range map[string]map[string]interface{}{
+			"external_id=SN-0001": {
+				"external_id": "SN-0001",
+				"deleted_at":  map[string]interface{}{"$exists": false},
+			},
+			"entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&external_id=SN-0001": {
+				"entity":      "request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+				"external_id": "SN-0001",
+				"deleted_at":  map[string]interface{}{"$exists": false},
+				"pinned_at":   map[string]interface{}{"$exists": false},
+			},
+		} {
+			req := httptest.NewRequest("GET", "/comments?"+params, nil)
+			req.Header.Set("grpc-metadata-space", channelID)
+			req.Header.Set("authorization", bearerToken)
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			resp := w.Result()
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+			calls := lister.Calls
+			query := calls[len(calls)-1].Arguments.Get(0).(map[string]interface{})
+			assert.Equal(t, expectedSelector, query["selector"], "selector for %s", params)
+		}
+	})
+
+	t.Run("when entity thread has pinned comments", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{Result: []map[string]interface{}{
+				{"uuid": "0ac5ebce-17e7-4edc-9552-fefe16e127fb", "text": "workaround", "pinned_at": "2021-04-11T00:50:00+02:00"},
+			}}, nil)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{Result: []map[string]interface{}{
+				{"uuid": "916c984f-e3fe-4638-8683-71f05501491f", "text": "test 1"},
+			}}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"result":[
+				{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb","text":"workaround","pinned_at":"2021-04-11T00:50:00+02:00"},
+				{"uuid":"916c984f-e3fe-4638-8683-71f05501491f","text":"test 1"}
+			],
+			"_links":{
+				"self":{"href":"http://service.url/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		pinnedQuery := lister.Calls[0].Arguments.Get(0).(map[string]interface{})
+		assert.Equal(t, []map[string]string{{"pinned_at": "desc"}}, pinnedQuery["sort"], "sort of pinned comments")
+		assert.Equal(t, float64(24), pinnedQuery["limit"], "limit of pinned comments")
+
+		query := lister.Calls[1].Arguments.Get(0).(map[string]interface{})
+		assert.Equal(t, float64(24), query["limit"], "pinned comment counts against the default limit")
+	})
+
+	t.Run("when limit of the page is set", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+			Return(listing.QueryResult{Result: []map[string]interface{}{
+				{"uuid": "0ac5ebce-17e7-4edc-9552-fefe16e127fb", "text": "workaround", "pinned_at": "2021-04-11T00:50:00Z"},
+				{"uuid": "3a5e2f10-4c0d-4f4e-a7d8-8b2c6f1e9d07", "text": "cause", "pinned_at": "2021-04-10T00:50:00Z"},
+			}}, nil)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{Result: []map[string]interface{}{
+				{"uuid": "916c984f-e3fe-4638-8683-71f05501491f", "text": "test 1"},
+			}, Bookmark: "g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYor"}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&limit=3", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		var body struct {
+			Result []map[string]interface{} `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(b, &body))
+		assert.Len(t, body.Result, 3, "pinned comments count against the limit")
+
+		pinnedQuery := lister.Calls[0].Arguments.Get(0).(map[string]interface{})
+		assert.Equal(t, float64(2), pinnedQuery["limit"], "at least one place is left for not pinned comments")
+
+		query := lister.Calls[1].Arguments.Get(0).(map[string]interface{})
+		assert.Equal(t, float64(1), query["limit"], "limit of not pinned comments")
+		assert.Contains(t, string(b), "g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYor", "next page continues after not pinned comments")
+
+		// the next page contains not pinned comments only
+		req = httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&limit=3&bookmark=g1AAAAB4eJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYor", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		_ = w.Result().Body.Close()
+
+		lister.AssertNumberOfCalls(t, "QueryComments", 3)
+		query = lister.Calls[2].Arguments.Get(0).(map[string]interface{})
+		assert.Equal(t, float64(3), query["limit"], "limit of the next page")
+		assert.Equal(t, map[string]interface{}{"$exists": false}, query["selector"].(map[string]interface{})["pinned_at"], "pinned comments are excluded")
+	})
+
+	t.Run("when limit of the page leaves no place for pinned comments", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&limit=1", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		_ = w.Result().Body.Close()
+
+		lister.AssertNumberOfCalls(t, "QueryComments", 1)
+		query := lister.Calls[0].Arguments.Get(0).(map[string]interface{})
+		assert.NotContains(t, query["selector"], "pinned_at", "pinned comments are listed in order of creation")
+	})
+
+	t.Run("when only pinned comments are requested", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		lister := new(mocks.ListingMock)
+		lister.On("QueryComments", mock.AnythingOfType("map[string]interface {}"), channelID, assetType).
+			Return(listing.QueryResult{}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			ListingService:          lister,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&pinned=true", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		lister.AssertNumberOfCalls(t, "QueryComments", 1)
+		query := lister.Calls[0].Arguments.Get(0).(map[string]interface{})
+		expectedSelector := map[string]interface{}{
+			"entity":     "request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"deleted_at": map[string]interface{}{"$exists": false},
+			"pinned_at":  map[string]interface{}{"$exists": true},
+		}
+		assert.Equal(t, expectedSelector, query["selector"], "selector")
+		assert.Equal(t, []map[string]string{{"pinned_at": "desc"}}, query["sort"], "sort")
+	})
+
+	t.Run("when pinned param is not valid", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+		})
+
+		req := httptest.NewRequest("GET", "/comments?pinned=yes", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"invalid 'pinned' param value 'yes', allowed values are: true, false"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when replies are requested", func(t *testing.T) {
+		isRepliesQuery := func(query map[string]interface{}) bool {
+			selector, _ := query["selector"].(map[string]interface{})
+			parent, _ := selector["parent_uuid"].(map[string]interface{})
+			_, ok := parent["$in"]
+			return ok
+		}
+
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		for replies, expectedResult := range map[string]string{
+			"count": `[
+				{"uuid":"916c984f-e3fe-4638-8683-71f05501491f","text":"test 1","replies_count":2},
+				{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb","text":"test 2","replies_count":0}
+			]`,
+			"nest": `[
+				{"uuid":"916c984f-e3fe-4638-8683-71f05501491f","text":"test 1","replies":[
+					{"uuid":"455e652a-5f5f-4c25-bb67-c0fb479fd5b1","text":"reply 1","parent_uuid":"916c984f-e3fe-4638-8683-71f05501491f"},
+					{"uuid":"8ae72bd6-4a77-4d57-bc2c-b5c5b0bd12c6","text":"reply 2","parent_uuid":"916c984f-e3fe-4638-8683-71f05501491f"}
+				]},
+				{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb","text":"test 2","replies":[]}
+			]`,
+		} {
+			lister := new(mocks.ListingMock)
+			lister.On("QueryComments", mock.MatchedBy(isPinnedFirstQuery), channelID, assetType).
+				Return(listing.QueryResult{}, nil)
+			lister.On("QueryComments", mock.MatchedBy(func(q map[string]interface{}) bool { return !isRepliesQuery(q) }), channelID, assetType).
+				Return(listing.QueryResult{Result: []map[string]interface{}{
+					{"uuid": "916c984f-e3fe-4638-8683-71f05501491f", "text": "test 1"},
+					{"uuid": "0ac5ebce-17e7-4edc-9552-fefe16e127fb", "text": "test 2"},
+				}}, nil)
+			lister.On("QueryComments", mock.MatchedBy(isRepliesQuery), channelID, assetType).
+				Return(listing.QueryResult{Result: []map[string]interface{}{
+					{"uuid": "455e652a-5f5f-4c25-bb67-c0fb479fd5b1", "text": "reply 1", "parent_uuid": "916c984f-e3fe-4638-8683-71f05501491f"},
+					{"uuid": "8ae72bd6-4a77-4d57-bc2c-b5c5b0bd12c6", "text": "reply 2", "parent_uuid": "916c984f-e3fe-4638-8683-71f05501491f"},
+				}}, nil)
+
+			server := NewServer(Config{
+				Addr:                    "service.url",
+				Logger:                  logger,
+				AuthService:             as,
+				ListingService:          lister,
+				ExternalLocationAddress: "http://service.url",
+			})
+
+			req := httptest.NewRequest("GET", "/comments?entity=request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e&replies="+replies, nil)
+			req.Header.Set("grpc-metadata-space", channelID)
+			req.Header.Set("authorization", bearerToken)
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			resp := w.Result()
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("could not read response: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+			var body map[string]interface{}
+			err = json.Unmarshal(b, &body)
+			assert.NoError(t, err)
+
+			result, err := json.Marshal(body["result"])
+			assert.NoError(t, err)
+			assert.JSONEq(t, expectedResult, string(result), "result does not match for replies=%s", replies)
+		}
+	})
+
+	t.Run("when replies param is not valid", func(t *testing.T) {
+		assetType := comment.AssetTypeComment
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+		})
+
+		req := httptest.NewRequest("GET", "/comments?replies=all", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"invalid 'replies' param value 'all', allowed values are: count, nest"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
 }
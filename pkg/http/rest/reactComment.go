@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route POST /comments/{uuid}/reactions/{emoji} comments AddCommentReaction
+// Adds emoji reaction of the user to specified comment
+// responses:
+//	201: createdResponse
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route POST /worknotes/{uuid}/reactions/{emoji} worknotes AddWorknoteReaction
+// Adds emoji reaction of the user to specified worknote
+// responses:
+//	201: createdResponse
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// AddReaction returns handler for adding user's emoji reaction to comment|worknote
+func (s *Server) AddReaction(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("AddReaction handler called")
+
+		// user can react to comment if he is allowed to read it
+		if err := s.authorize("AddReaction", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		id, emoji, ok := s.reactionParams("AddReaction", w, params)
+		if !ok {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		reaction := comment.Reaction{
+			Emoji: emoji,
+			Time:  comment.Timestamp(nil),
+			User: comment.UserInfo{
+				UUID:           user.UUID,
+				Name:           user.Name,
+				Surname:        user.Surname,
+				OrgName:        user.OrgName,
+				OrgDisplayName: user.OrgDisplayName,
+			},
+		}
+
+		alreadyReacted, err := s.updater.AddReaction(r.Context(), id, reaction, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("AddReaction handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("AddReaction handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, assetType.Plural(), id)
+
+		w.Header().Set("Location", assetURI)
+
+		if alreadyReacted {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// swagger:route DELETE /comments/{uuid}/reactions/{emoji} comments RemoveCommentReaction
+// Removes emoji reaction of the user from specified comment
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route DELETE /worknotes/{uuid}/reactions/{emoji} worknotes RemoveWorknoteReaction
+// Removes emoji reaction of the user from specified worknote
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// RemoveReaction returns handler for removing user's emoji reaction from comment|worknote
+func (s *Server) RemoveReaction(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("RemoveReaction handler called")
+
+		if err := s.authorize("RemoveReaction", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		id, emoji, ok := s.reactionParams("RemoveReaction", w, params)
+		if !ok {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		reactedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		_, err = s.updater.RemoveReaction(r.Context(), id, emoji, reactedBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("RemoveReaction handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("RemoveReaction handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// reactionParams returns resource ID and emoji URL params; it writes error response if any of them is missing or invalid
+func (s *Server) reactionParams(handler string, w http.ResponseWriter, params httprouter.Params) (string, string, bool) {
+	id := params.ByName("id")
+	if id == "" {
+		eMsg := "malformed URL: missing resource ID param"
+		s.logger.Warn(handler+" handler failed", zap.String("error", eMsg))
+		s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+		return "", "", false
+	}
+
+	emoji := params.ByName("emoji")
+	if err := comment.ValidateEmoji(emoji); err != nil {
+		eMsg := fmt.Sprintf("malformed URL: %v", err)
+		s.logger.Warn(handler+" handler failed", zap.String("error", eMsg))
+		s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+		return "", "", false
+	}
+
+	return id, emoji, true
+}
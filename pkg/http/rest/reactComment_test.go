@@ -0,0 +1,285 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddReactionHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	isThumbsUp := func(r comment.Reaction) bool {
+		return r.Emoji == "thumbsup" && r.User.UUID == mockUserData.UUID && r.Time != ""
+	}
+
+	t.Run("when emoji is not valid", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/Thumbs%20Up", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"malformed URL: invalid emoji 'Thumbs Up'"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when user reacts to the comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On(
+			"AddReaction",
+			"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			mock.MatchedBy(isThumbsUp), channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/thumbsup", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		expectedLocation := "http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), "Location header")
+	})
+
+	t.Run("when user reacts to the worknote with the same emoji twice", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On(
+			"AddReaction",
+			"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			mock.MatchedBy(isThumbsUp), channelID, comment.AssetTypeWorknote).
+			Return(true, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		req := httptest.NewRequest("POST", "/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/thumbsup", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+		expectedLocation := "http://service.url/worknotes/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), "Location header")
+	})
+
+	t.Run("when comment is deleted", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On(
+			"AddReaction",
+			"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			mock.MatchedBy(isThumbsUp), channelID, comment.AssetTypeComment).
+			Return(false, couchdb.ErrorConflict("Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' is deleted"))
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/thumbsup", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' is deleted"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
+
+func TestRemoveReactionHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	reactedBy := comment.UserInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when user removes the reaction", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("RemoveReaction", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", "👍", reactedBy, channelID, comment.AssetTypeComment).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/%F0%9F%91%8D", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+		updater.AssertExpectations(t)
+	})
+
+	t.Run("when comment does not exist", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("RemoveReaction", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", "thumbsup", reactedBy, channelID, comment.AssetTypeComment).
+			Return(false, couchdb.ErrorNorFound("Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"))
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("DELETE", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/reactions/thumbsup", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
@@ -0,0 +1,36 @@
+// Package render converts comment text to HTML that is safe to be embedded in web pages and mobile apps
+package render
+
+import (
+	"html"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// policy strips scripts, styles, event handler attributes and URLs with other schemes than http, https and mailto;
+// links are marked as nofollow and opened in new tab
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// HTML returns sanitized HTML representation of the comment text,
+// markdown is rendered and plain text is escaped with line breaks preserved
+func HTML(c comment.Comment) string {
+	if c.IsMarkdown() {
+		unsafe := blackfriday.Run([]byte(c.Text), blackfriday.WithExtensions(blackfriday.CommonExtensions))
+		return string(policy.SanitizeBytes(unsafe))
+	}
+
+	text := strings.ReplaceAll(html.EscapeString(c.Text), "\n", "<br>\n")
+
+	return "<p>" + text + "</p>\n"
+}
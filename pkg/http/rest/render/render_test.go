@@ -0,0 +1,54 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		c    comment.Comment
+		want string
+	}{
+		{
+			name: "plain text is escaped",
+			c:    comment.Comment{Text: "a < b\n<script>alert(1)</script> **not bold**"},
+			want: "<p>a &lt; b<br>\n&lt;script&gt;alert(1)&lt;/script&gt; **not bold**</p>\n",
+		},
+		{
+			name: "markdown is rendered",
+			c:    comment.Comment{Text: "**bold** and `code`", ContentType: comment.ContentTypeMarkdown},
+			want: "<p><strong>bold</strong> and <code>code</code></p>\n",
+		},
+		{
+			name: "scripts are stripped",
+			c:    comment.Comment{Text: "hello <script>alert(1)</script>", ContentType: comment.ContentTypeMarkdown},
+			want: "<p>hello </p>\n",
+		},
+		{
+			name: "event handlers are stripped",
+			c:    comment.Comment{Text: `<img src="https://example.com/a.png" onerror="alert(1)">`, ContentType: comment.ContentTypeMarkdown},
+			want: `<p><img src="https://example.com/a.png"></p>` + "\n",
+		},
+		{
+			name: "dangerous URLs are stripped",
+			c:    comment.Comment{Text: "[click](javascript:alert) <a href=\"data:text/html,x\">x</a>", ContentType: comment.ContentTypeMarkdown},
+			want: "<p>click x</p>\n",
+		},
+		{
+			name: "links are marked as nofollow",
+			c:    comment.Comment{Text: "[docs](https://example.com/docs)", ContentType: comment.ContentTypeMarkdown},
+			want: `<p><a href="https://example.com/docs" rel="nofollow noopener" target="_blank">docs</a></p>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, render.HTML(tt.c))
+		})
+	}
+}
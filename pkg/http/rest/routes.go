@@ -5,8 +5,8 @@ import (
 	"net/http"
 
 	"github.com/KompiTech/go-toolkit/common"
-	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/go-openapi/runtime/middleware"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"github.com/opentracing/opentracing-go"
 )
@@ -29,19 +29,46 @@ func (s *Server) routes() {
 
 	chain.Then(router)
 
-	// comments
-	router.GET("/comments/:id", s.GetComment(comment.AssetTypeComment))
-	router.GET("/comments", s.QueryComments(comment.AssetTypeComment))
+	// routes for each registered asset type (e.g. /comments, /worknotes)
+	for _, assetType := range s.assetTypes {
+		path := "/" + assetType.Plural()
 
-	router.POST("/comments", s.AddUserInfo(s.AddComment(comment.AssetTypeComment), s.userService))
-	router.POST("/comments/:id/read_by", s.AddUserInfo(s.MarkCommentAsReadBy(comment.AssetTypeComment), s.userService))
+		// httprouter does not allow static /unread segment next to the /:id wildcard, so they share the route
+		router.GET(path+"/:id", staticOrID("unread", s.AddUserInfo(s.CountUnread(assetType), s.userService), s.GetComment(assetType)))
+		router.GET(path, s.QueryComments(assetType))
+		router.GET(path+"/:id/replies", s.ListReplies(assetType))
 
-	// worknotes
-	router.GET("/worknotes/:id", s.GetComment(comment.AssetTypeWorknote))
-	router.GET("/worknotes", s.QueryComments(comment.AssetTypeWorknote))
+		router.POST(path, s.AddUserInfo(s.AddComment(assetType), s.userService))
+		// POST /comments/read_by is registered the same way as GET /comments/unread, there is no POST /comments/:id
+		router.POST(path+"/:id", staticOrID("read_by", s.AddUserInfo(s.MarkAllAsReadBy(assetType), s.userService), s.notFound))
+		router.POST(path+"/:id/read_by", s.AddUserInfo(s.MarkCommentAsReadBy(assetType), s.userService))
+		router.POST(path+"/:id/reactions/:emoji", s.AddUserInfo(s.AddReaction(assetType), s.userService))
+		router.DELETE(path+"/:id/reactions/:emoji", s.AddUserInfo(s.RemoveReaction(assetType), s.userService))
+		router.POST(path+"/:id/pin", s.AddUserInfo(s.PinComment(assetType), s.userService))
+		router.DELETE(path+"/:id/pin", s.AddUserInfo(s.UnpinComment(assetType), s.userService))
+		router.POST(path+"/:id/convert", s.AddUserInfo(s.ConvertComment(assetType), s.userService))
 
-	router.POST("/worknotes", s.AddUserInfo(s.AddComment(comment.AssetTypeWorknote), s.userService))
-	router.POST("/worknotes/:id/read_by", s.AddUserInfo(s.MarkCommentAsReadBy(comment.AssetTypeWorknote), s.userService))
+		router.PATCH(path+"/:id", s.AddUserInfo(s.UpdateComment(assetType), s.userService))
+		router.PUT(path+"/external/:external_id", s.AddUserInfo(s.UpsertComment(assetType), s.userService))
+		router.GET(path+"/:id/history", s.GetCommentHistory(assetType))
+
+		router.DELETE(path+"/:id", s.AddUserInfo(s.DeleteComment(assetType), s.userService))
+		router.POST(path+"/:id/restore", s.AddUserInfo(s.RestoreComment(assetType), s.userService))
+	}
+
+	// entity thread locks
+	router.POST("/entities/:entity/lock", s.AddUserInfo(s.LockThread(), s.userService))
+	router.DELETE("/entities/:entity/lock", s.AddUserInfo(s.UnlockThread(), s.userService))
+
+	// merging of duplicate entities
+	router.POST("/entities/:entity/merge", s.AddUserInfo(s.MergeEntity(), s.userService))
+
+	// comment templates
+	router.GET("/templates", s.ListTemplates())
+	router.GET("/templates/:id", s.GetTemplate())
+	router.POST("/templates", s.AddUserInfo(s.CreateTemplate(), s.userService))
+	router.PUT("/templates/:id", s.AddUserInfo(s.UpdateTemplate(), s.userService))
+	router.DELETE("/templates/:id", s.DeleteTemplate())
 
 	// databases creation
 	router.POST("/databases", s.CreateDatabases())
@@ -57,6 +84,24 @@ func (s *Server) routes() {
 	router.NotFound = http.HandlerFunc(s.JSONNotFoundError)
 }
 
+// staticOrID returns handler calling the static handler when the :id param equals to the given name,
+// otherwise it calls the byID handler
+func staticOrID(name string, static, byID httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if params.ByName("id") == name {
+			static(w, r, params)
+			return
+		}
+
+		byID(w, r, params)
+	}
+}
+
+// notFound is the httprouter handler replying with the 404 page not found general error message
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.JSONNotFoundError(w, r)
+}
+
 // JSONNotFoundError replies to the request with the 404 page not found general error message
 // in JSON format and sets correct header and HTTP code
 func (s Server) JSONNotFoundError(w http.ResponseWriter, _ *http.Request) {
@@ -5,10 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/locking"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/templating"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/upserting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
@@ -20,34 +27,53 @@ import (
 
 // Server is a http.Handler with dependencies
 type Server struct {
-	Addr                    string
-	URISchema               string
-	router                  *httprouter.Router
-	logger                  *zap.Logger
-	authService             auth.Service
-	userService             usersvc.Service
-	adder                   adding.Service
-	lister                  listing.Service
-	updater                 updating.Service
-	repositoryService       repository.Service
-	payloadValidator        validation.PayloadValidator
-	presenter               Presenter
-	ExternalLocationAddress string
+	Addr                      string
+	URISchema                 string
+	router                    *httprouter.Router
+	assetTypes                comment.AssetTypeRegistry
+	entityTypes               *entity.Registry
+	logger                    *zap.Logger
+	authService               auth.Service
+	userService               usersvc.Service
+	adder                     adding.Service
+	lister                    listing.Service
+	updater                   updating.Service
+	deleter                   deleting.Service
+	upserter                  upserting.Service
+	locker                    locking.Service
+	templater                 templating.Service
+	repositoryService         repository.Service
+	idempotency               repository.IdempotencyService
+	idempotencyKeyTTL         time.Duration
+	idempotencyPendingTimeout time.Duration
+	payloadValidator          validation.PayloadValidator
+	presenter                 Presenter
+	ExternalLocationAddress   string
 }
 
 // Config contains server configuration and dependencies
 type Config struct {
-	Addr                    string
-	URISchema               string
-	Logger                  *zap.Logger
-	AuthService             auth.Service
-	UserService             usersvc.Service
-	AddingService           adding.Service
-	ListingService          listing.Service
-	UpdatingService         updating.Service
-	RepositoryService       repository.Service
-	PayloadValidator        validation.PayloadValidator
-	ExternalLocationAddress string
+	Addr               string
+	URISchema          string
+	AssetTypes         comment.AssetTypeRegistry
+	EntityTypes        *entity.Registry
+	Logger             *zap.Logger
+	AuthService        auth.Service
+	UserService        usersvc.Service
+	AddingService      adding.Service
+	ListingService     listing.Service
+	UpdatingService    updating.Service
+	DeletingService    deleting.Service
+	UpsertingService   upserting.Service
+	LockingService     locking.Service
+	TemplatingService  templating.Service
+	RepositoryService  repository.Service
+	IdempotencyService repository.IdempotencyService
+	IdempotencyKeyTTL  time.Duration
+	// IdempotencyPendingTimeout is the time the key stays reserved by the request being processed (default 1m)
+	IdempotencyPendingTimeout time.Duration
+	PayloadValidator          validation.PayloadValidator
+	ExternalLocationAddress   string
 }
 
 // NewServer creates new server with the necessary dependencies
@@ -59,20 +85,49 @@ func NewServer(cfg Config) *Server {
 		URISchema = cfg.URISchema
 	}
 
+	assetTypes := comment.DefaultAssetTypes()
+	if len(cfg.AssetTypes) > 0 {
+		assetTypes = cfg.AssetTypes
+	}
+
+	idempotencyKeyTTL := defaultIdempotencyKeyTTL
+	if cfg.IdempotencyKeyTTL > 0 {
+		idempotencyKeyTTL = cfg.IdempotencyKeyTTL
+	}
+
+	idempotencyPendingTimeout := defaultIdempotencyPendingTimeout
+	if cfg.IdempotencyPendingTimeout > 0 {
+		idempotencyPendingTimeout = cfg.IdempotencyPendingTimeout
+	}
+
+	entityTypes := entity.DefaultRegistry()
+	if cfg.EntityTypes != nil {
+		entityTypes = cfg.EntityTypes
+	}
+
 	s := &Server{
-		Addr:                    cfg.Addr,
-		URISchema:               URISchema,
-		router:                  r,
-		logger:                  cfg.Logger,
-		authService:             cfg.AuthService,
-		userService:             cfg.UserService,
-		adder:                   cfg.AddingService,
-		lister:                  cfg.ListingService,
-		updater:                 cfg.UpdatingService,
-		repositoryService:       cfg.RepositoryService,
-		payloadValidator:        cfg.PayloadValidator,
-		presenter:               NewPresenter(cfg.Logger, cfg.ExternalLocationAddress),
-		ExternalLocationAddress: cfg.ExternalLocationAddress,
+		Addr:                      cfg.Addr,
+		URISchema:                 URISchema,
+		router:                    r,
+		assetTypes:                assetTypes,
+		entityTypes:               entityTypes,
+		logger:                    cfg.Logger,
+		authService:               cfg.AuthService,
+		userService:               cfg.UserService,
+		adder:                     cfg.AddingService,
+		lister:                    cfg.ListingService,
+		updater:                   cfg.UpdatingService,
+		deleter:                   cfg.DeletingService,
+		upserter:                  cfg.UpsertingService,
+		locker:                    cfg.LockingService,
+		templater:                 cfg.TemplatingService,
+		repositoryService:         cfg.RepositoryService,
+		idempotency:               cfg.IdempotencyService,
+		idempotencyKeyTTL:         idempotencyKeyTTL,
+		idempotencyPendingTimeout: idempotencyPendingTimeout,
+		payloadValidator:          cfg.PayloadValidator,
+		presenter:                 NewPresenter(cfg.Logger, cfg.ExternalLocationAddress),
+		ExternalLocationAddress:   cfg.ExternalLocationAddress,
 	}
 	s.routes()
 
@@ -195,3 +250,17 @@ func (s *Server) authorize(handlerName, assetType string, action auth.Action, w
 
 	return nil
 }
+
+// writeRepositoryError replies to the request with the error and HTTP code of the repository error
+// or with 500 Internal Server Error
+func (s *Server) writeRepositoryError(handlerName string, w http.ResponseWriter, err error) {
+	var httpError *repository.Error
+	if errors.As(err, &httpError) {
+		s.logger.Warn(fmt.Sprintf("%s handler failed", handlerName), zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+		return
+	}
+
+	s.logger.Error(fmt.Sprintf("%s handler failed", handlerName), zap.Error(err))
+	s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,294 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// templateAsset is the asset name used in authorization of the template requests
+const templateAsset = "template"
+
+// swagger:route GET /templates templates ListTemplates
+// Returns all comment templates of the channel sorted by name
+// responses:
+//	200: templateListResponse
+//	401: errorResponse401
+//	403: errorResponse403
+
+// ListTemplates returns handler for listing comment templates
+func (s *Server) ListTemplates() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.logger.Info("ListTemplates handler called")
+
+		if err := s.authorize("ListTemplates", templateAsset, auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		templates, err := s.templater.ListTemplates(r.Context(), channelID)
+		if err != nil {
+			s.writeRepositoryError("ListTemplates", w, err)
+			return
+		}
+
+		s.presenter.WriteTemplateListResponse(w, templates)
+	}
+}
+
+// swagger:route GET /templates/{uuid} templates GetTemplate
+// Returns a single comment template
+// responses:
+//	200: templateResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+
+// GetTemplate returns handler for getting single comment template
+func (s *Server) GetTemplate() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("GetTemplate handler called")
+
+		if err := s.authorize("GetTemplate", templateAsset, auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		id, err := s.templateID("GetTemplate", w, params)
+		if err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		t, err := s.templater.GetTemplate(r.Context(), id, channelID)
+		if err != nil {
+			s.writeRepositoryError("GetTemplate", w, err)
+			return
+		}
+
+		s.presenter.WriteTemplateResponse(w, t)
+	}
+}
+
+// swagger:route POST /templates templates CreateTemplate
+// Creates a new comment template
+// responses:
+//	201: templateCreatedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	409: errorResponse409
+
+// CreateTemplate returns handler for creating comment template
+func (s *Server) CreateTemplate() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.logger.Info("CreateTemplate handler called")
+
+		if err := s.authorize("CreateTemplate", templateAsset, auth.CreateAction, w, r); err != nil {
+			return
+		}
+
+		t, err := s.readTemplatePayload(w, r)
+		if err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		t.CreatedBy = &comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		storedTemplate, err := s.templater.CreateTemplate(r.Context(), t, channelID)
+		if err != nil {
+			s.writeRepositoryError("CreateTemplate", w, err)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/templates/%s", s.ExternalLocationAddress, storedTemplate.UUID))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		s.presenter.WriteTemplateResponse(w, *storedTemplate)
+	}
+}
+
+// swagger:route PUT /templates/{uuid} templates UpdateTemplate
+// Replaces name, text and content type of the comment template
+// responses:
+//	200: templateResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// UpdateTemplate returns handler for updating comment template
+func (s *Server) UpdateTemplate() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("UpdateTemplate handler called")
+
+		if err := s.authorize("UpdateTemplate", templateAsset, auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		id, err := s.templateID("UpdateTemplate", w, params)
+		if err != nil {
+			return
+		}
+
+		t, err := s.readTemplatePayload(w, r)
+		if err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		t.UpdatedBy = &comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		updatedTemplate, err := s.templater.UpdateTemplate(r.Context(), id, t, channelID)
+		if err != nil {
+			s.writeRepositoryError("UpdateTemplate", w, err)
+			return
+		}
+
+		s.presenter.WriteTemplateResponse(w, *updatedTemplate)
+	}
+}
+
+// swagger:route DELETE /templates/{uuid} templates DeleteTemplate
+// Deletes the comment template, comments created from it are not affected
+// responses:
+//	204: noContentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+
+// DeleteTemplate returns handler for deleting comment template
+func (s *Server) DeleteTemplate() func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("DeleteTemplate handler called")
+
+		if err := s.authorize("DeleteTemplate", templateAsset, auth.DeleteAction, w, r); err != nil {
+			return
+		}
+
+		id, err := s.templateID("DeleteTemplate", w, params)
+		if err != nil {
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		err = s.templater.DeleteTemplate(r.Context(), id, channelID)
+		if err != nil {
+			s.writeRepositoryError("DeleteTemplate", w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// templateID returns template ID from URL path,
+// otherwise it writes error message to response and returns error to notify calling handler to stop execution
+func (s *Server) templateID(handlerName string, w http.ResponseWriter, params httprouter.Params) (string, error) {
+	id := params.ByName("id")
+	if id == "" {
+		eMsg := "malformed URL: missing resource ID param"
+		s.logger.Warn(fmt.Sprintf("%s handler failed", handlerName), zap.String("error", eMsg))
+		s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+		return "", errors.New(eMsg)
+	}
+
+	return id, nil
+}
+
+// readTemplatePayload returns validated template from request body,
+// otherwise it writes error message to response and returns error to notify calling handler to stop execution
+func (s *Server) readTemplatePayload(w http.ResponseWriter, r *http.Request) (comment.Template, error) {
+	var t comment.Template
+
+	defer func() { _ = r.Body.Close() }()
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.logger.Error("could not read request body", zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+		return t, err
+	}
+
+	err = s.payloadValidator.ValidatePayload(payload, "template.yaml")
+	if err != nil {
+		var errGeneral *validation.ErrGeneral
+		if errors.As(err, &errGeneral) {
+			s.logger.Error("payload validation", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return t, err
+		}
+
+		s.logger.Warn("invalid payload", zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+		return t, err
+	}
+
+	err = json.Unmarshal(payload, &t)
+	if err != nil {
+		eMsg := "could not decode JSON from request"
+		s.logger.Warn(eMsg, zap.Error(err))
+		s.presenter.WriteError(w, fmt.Sprintf("%s: %s", eMsg, err.Error()), http.StatusBadRequest)
+		return t, err
+	}
+
+	return t, nil
+}
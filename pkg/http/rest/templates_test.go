@@ -0,0 +1,437 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTemplatesHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when templates exist", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("ListTemplates", channelID).
+			Return([]comment.Template{{
+				UUID:      "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+				Name:      "Password reset",
+				Text:      "Hello, your password was reset. Regards, {{user.name}}",
+				CreatedAt: "2021-06-21T10:13:42+02:00",
+			}}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			TemplatingService:       templater,
+			ExternalLocationAddress: "http://localhost:8080",
+		})
+
+		req := httptest.NewRequest("GET", "/templates", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"result":[{
+				"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+				"name":"Password reset",
+				"text":"Hello, your password was reset. Regards, {{user.name}}",
+				"created_at":"2021-06-21T10:13:42+02:00"
+			}],
+			"_links":{"self":{"href":"http://localhost:8080/templates"}}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when user is not authorized", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.ReadAction, channelID, bearerToken).
+			Return(false, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+		})
+
+		req := httptest.NewRequest("GET", "/templates", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (template, read)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
+
+func TestGetTemplateHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when template does not exist", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("GetTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", channelID).
+			Return(comment.Template{}, couchdb.ErrorNorFound("Template could not be retrieved: Template with uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' does not exist"))
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			Logger:            logger,
+			AuthService:       as,
+			TemplatingService: templater,
+		})
+
+		req := httptest.NewRequest("GET", "/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Template could not be retrieved: Template with uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
+
+func TestCreateTemplateHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	pv, err := validation.NewPayloadValidator()
+	require.NoError(t, err)
+
+	t.Run("when template is being created", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		tpl := comment.Template{
+			Name:        "Password reset",
+			Text:        "Hello, your password was reset. Regards, {{user.name}}",
+			ContentType: comment.ContentTypeMarkdown,
+			CreatedBy: &comment.UserInfo{
+				UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+				Name: "Some test user 1",
+			},
+		}
+
+		stored := tpl
+		stored.UUID = "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+		stored.CreatedAt = "2021-06-21T10:13:42+02:00"
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("CreateTemplate", tpl, channelID).
+			Return(&stored, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			TemplatingService:       templater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://localhost:8080",
+		})
+
+		body := strings.NewReader(`{"name":"Password reset","text":"Hello, your password was reset. Regards, {{user.name}}","content_type":"text/markdown"}`)
+		req := httptest.NewRequest("POST", "/templates", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+		assert.Equal(t, "http://localhost:8080/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", resp.Header.Get("Location"), "Location header")
+
+		expectedJSON := `{
+			"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+			"name":"Password reset",
+			"text":"Hello, your password was reset. Regards, {{user.name}}",
+			"content_type":"text/markdown",
+			"created_at":"2021-06-21T10:13:42+02:00",
+			"created_by":{"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb","name":"Some test user 1"},
+			"_links":{"self":{"href":"http://localhost:8080/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"}}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+		templater.AssertExpectations(t)
+	})
+
+	t.Run("when template with the same name exists", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("CreateTemplate", mock.AnythingOfType("comment.Template"), channelID).
+			Return((*comment.Template)(nil), couchdb.ErrorConflict("Template could not be created: template with name='Password reset' already exists (uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52')"))
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			Logger:            logger,
+			AuthService:       as,
+			UserService:       us,
+			TemplatingService: templater,
+			PayloadValidator:  pv,
+		})
+
+		body := strings.NewReader(`{"name":"Password reset","text":"Hello"}`)
+		req := httptest.NewRequest("POST", "/templates", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Template could not be created: template with name='Password reset' already exists (uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52')"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when payload is not valid", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:             "service.url",
+			Logger:           logger,
+			AuthService:      as,
+			UserService:      us,
+			PayloadValidator: pv,
+		})
+
+		body := strings.NewReader(`{"name":"Password reset"}`)
+		req := httptest.NewRequest("POST", "/templates", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"/: 'text' value is required"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
+
+func TestUpdateTemplateHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	pv, err := validation.NewPayloadValidator()
+	require.NoError(t, err)
+
+	t.Run("when template is being updated", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		tpl := comment.Template{
+			Name: "Password reset",
+			Text: "Your password was reset",
+			UpdatedBy: &comment.UserInfo{
+				UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+				Name: "Some test user 1",
+			},
+		}
+
+		updated := tpl
+		updated.UUID = "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+		updated.UpdatedAt = "2021-06-22T10:13:42+02:00"
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("UpdateTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", tpl, channelID).
+			Return(&updated, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			TemplatingService:       templater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://localhost:8080",
+		})
+
+		body := strings.NewReader(`{"name":"Password reset","text":"Your password was reset"}`)
+		req := httptest.NewRequest("PUT", "/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", body)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52",
+			"name":"Password reset",
+			"text":"Your password was reset",
+			"updated_at":"2021-06-22T10:13:42+02:00",
+			"updated_by":{"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb","name":"Some test user 1"},
+			"_links":{"self":{"href":"http://localhost:8080/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"}}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+		templater.AssertExpectations(t)
+	})
+}
+
+func TestDeleteTemplateHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when template is being deleted", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "template", auth.DeleteAction, channelID, bearerToken).
+			Return(true, nil)
+
+		templater := new(mocks.TemplatingMock)
+		templater.On("DeleteTemplate", "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", channelID).
+			Return(nil)
+
+		server := NewServer(Config{
+			Addr:              "service.url",
+			Logger:            logger,
+			AuthService:       as,
+			TemplatingService: templater,
+		})
+
+		req := httptest.NewRequest("DELETE", "/templates/c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status code")
+		templater.AssertExpectations(t)
+	})
+}
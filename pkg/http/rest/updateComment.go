@@ -1,14 +1,18 @@
 package rest
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"time"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
 )
@@ -71,7 +75,7 @@ func (s *Server) MarkCommentAsReadBy(assetType comment.AssetType) func(w http.Re
 		}
 
 		readBy := comment.ReadBy{
-			Time: time.Now().Format(time.RFC3339),
+			Time: comment.Timestamp(nil),
 			User: comment.UserInfo{
 				UUID:           user.UUID,
 				Name:           user.Name,
@@ -95,7 +99,7 @@ func (s *Server) MarkCommentAsReadBy(assetType comment.AssetType) func(w http.Re
 			return
 		}
 
-		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, pluralize(assetType), id)
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, assetType.Plural(), id)
 
 		w.Header().Set("Location", assetURI)
 
@@ -107,3 +111,198 @@ func (s *Server) MarkCommentAsReadBy(assetType comment.AssetType) func(w http.Re
 		w.WriteHeader(http.StatusCreated)
 	}
 }
+
+// swagger:route POST /comments/read_by comments MarkAllCommentsAsReadByUser
+// Marks all comments of the entity as read by user
+// responses:
+//	200: markedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// swagger:route POST /worknotes/read_by worknotes MarkAllWorknotesAsReadByUser
+// Marks all worknotes of the entity as read by user
+// responses:
+//	200: markedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+
+// MarkAllAsReadBy returns handler for marking all comments|worknotes of the entity as read by user
+func (s *Server) MarkAllAsReadBy(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.logger.Info("MarkAllAsReadBy handler called")
+
+		// user can update comments if he is allowed to read them
+		if err := s.authorize("MarkAllAsReadBy", assetType.String(), auth.ReadAction, w, r); err != nil {
+			return
+		}
+
+		e, err := entity.Parse(r.URL.Query().Get("entity"))
+		if err != nil {
+			s.logger.Warn("MarkAllAsReadBy handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		upTo := r.URL.Query().Get("up_to")
+		if upTo != "" {
+			if _, err := time.Parse(time.RFC3339, upTo); err != nil {
+				eMsg := fmt.Sprintf("invalid 'up_to' query param: %s", err)
+				s.logger.Warn("MarkAllAsReadBy handler failed", zap.String("error", eMsg))
+				s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+				return
+			}
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		err = s.entityTypes.Validate(channelID, e)
+		if err != nil {
+			s.logger.Warn("invalid entity", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		readBy := comment.ReadBy{
+			Time: comment.Timestamp(nil),
+			User: comment.UserInfo{
+				UUID:           user.UUID,
+				Name:           user.Name,
+				Surname:        user.Surname,
+				OrgName:        user.OrgName,
+				OrgDisplayName: user.OrgDisplayName,
+			},
+		}
+
+		marked, err := s.updater.MarkAllAsReadByUser(r.Context(), e, upTo, readBy, channelID, assetType)
+		if err != nil {
+			s.writeRepositoryError("MarkAllAsReadBy", w, err)
+			return
+		}
+
+		s.presenter.WriteMarkedResponse(w, marked)
+	}
+}
+
+// swagger:route PATCH /comments/{uuid} comments UpdateComment
+// Changes the text of the specified comment; the previous text is kept in the comment's history
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// swagger:route PATCH /worknotes/{uuid} worknotes UpdateWorknote
+// Changes the text of the specified worknote; the previous text is kept in the worknote's history
+// responses:
+//	200: commentResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	404: errorResponse404
+//	409: errorResponse409
+
+// UpdateComment returns handler for changing the text of comment|worknote
+func (s *Server) UpdateComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	type requestBody struct {
+		Text string `json:"text"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("UpdateComment handler called")
+
+		if err := s.authorize("UpdateComment", assetType.String(), auth.UpdateAction, w, r); err != nil {
+			return
+		}
+
+		id := params.ByName("id")
+		if id == "" {
+			eMsg := "malformed URL: missing resource ID param"
+			s.logger.Warn("UpdateComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		defer func() { _ = r.Body.Close() }()
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.logger.Error("could not read request body", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.payloadValidator.ValidatePayload(payload, "update_comment.yaml")
+		if err != nil {
+			var errGeneral *validation.ErrGeneral
+			if errors.As(err, &errGeneral) {
+				s.logger.Error("payload validation", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.logger.Warn("invalid payload", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var request requestBody
+		err = json.Unmarshal(payload, &request)
+		if err != nil {
+			eMsg := "could not decode JSON from request"
+			s.logger.Warn(eMsg, zap.Error(err))
+			s.presenter.WriteError(w, fmt.Sprintf("%s: %s", eMsg, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user info from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		editedBy := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		updatedComment, err := s.updater.UpdateText(r.Context(), id, request.Text, editedBy, channelID, assetType)
+		if err != nil {
+			var httpError *repository.Error
+			if errors.As(err, &httpError) {
+				s.logger.Warn("UpdateComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+				return
+			}
+
+			s.logger.Error("UpdateComment handler failed", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.presenter.WriteGetResponse(r, w, *updatedComment, assetType)
+	}
+}
@@ -1,18 +1,23 @@
 package rest
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMarkAsReadByHandler(t *testing.T) {
@@ -219,3 +224,399 @@ func TestMarkAsReadByHandler(t *testing.T) {
 		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), "Location header")
 	})
 }
+
+func TestMarkAllAsReadByHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID: "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name: "Some test user 1",
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when up_to param is invalid", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:        "service.url",
+			Logger:      logger,
+			AuthService: as,
+			UserService: us,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/read_by?entity=incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444&up_to=yesterday", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+	})
+
+	t.Run("when worknotes are being marked as read", func(t *testing.T) {
+		assetType := comment.AssetTypeWorknote
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.ReadAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On(
+			"MarkAllAsReadByUser",
+			entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			"2021-04-01T12:34:56+02:00",
+			mock.AnythingOfType("comment.ReadBy"), channelID, assetType).
+			Return(12, nil)
+
+		server := NewServer(Config{
+			Addr:            "service.url",
+			Logger:          logger,
+			AuthService:     as,
+			UserService:     us,
+			UpdatingService: updater,
+		})
+
+		req := httptest.NewRequest("POST", "/worknotes/read_by?entity=incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444&up_to=2021-04-01T12:34:56%2B02:00", nil)
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.JSONEq(t, `{"marked":12}`, string(b), "response does not match")
+		updater.AssertExpectations(t)
+	})
+
+	t.Run("when POST is sent to comment ID", func(t *testing.T) {
+		server := NewServer(Config{
+			Addr:   "service.url",
+			Logger: logger,
+		})
+
+		req := httptest.NewRequest("POST", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", nil)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+	})
+}
+
+func TestUpdateCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Some test user 1",
+		Surname:        "Some surname",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	editedBy := comment.UserInfo{
+		UUID:           mockUserData.UUID,
+		Name:           mockUserData.Name,
+		Surname:        mockUserData.Surname,
+		OrgName:        mockUserData.OrgName,
+		OrgDisplayName: mockUserData.OrgDisplayName,
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	t.Run("when user is not authorized to UPDATE the comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{"text": "Updated text"}`)
+		req := httptest.NewRequest("PATCH", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (comment, update)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when request is not valid ('text' key missing, unknown key present)", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"}`)
+		req := httptest.NewRequest("PATCH", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{"error":"/: 'text' value is required\n/: additional properties are not allowed"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment does not exist", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("UpdateText", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", "Updated text", editedBy, channelID, comment.AssetTypeComment).
+			Return(nil, couchdb.ErrorNorFound("Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"))
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{"text": "Updated text"}`)
+		req := httptest.NewRequest("PATCH", "/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Comment with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' does not exist"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment text is being updated", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		uuid := "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		updatedC := &comment.Comment{
+			UUID:   uuid,
+			Text:   "Updated text",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			History: comment.HistoryList{
+				{Text: "Original text", EditedAt: "2021-04-02T10:00:00+02:00", EditedBy: editedBy},
+			},
+			CreatedBy: &comment.UserInfo{
+				UUID:           "8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+				Name:           "Alice",
+				Surname:        "Cooper",
+				OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				OrgDisplayName: "Kompitech",
+			},
+			CreatedAt: "2021-04-01T12:34:56+02:00",
+		}
+
+		updater := new(mocks.UpdatingMock)
+		updater.On("UpdateText", uuid, "Updated text", editedBy, channelID, comment.AssetTypeComment).
+			Return(updatedC, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{"text": "Updated text"}`)
+		req := httptest.NewRequest("PATCH", "/comments/"+uuid, bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type header")
+
+		expectedJSON := `{
+			"uuid":"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"text":"Updated text",
+			"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"history":[{
+				"text":"Original text",
+				"edited_at":"2021-04-02T10:00:00+02:00",
+				"edited_by":{
+					"uuid":"2af4f493-0bd5-4513-b440-6cbb465feadb",
+					"name":"Some test user 1",
+					"surname":"Some surname",
+					"org_name":"a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					"org_display_name":"Kompitech"
+				}
+			}],
+			"created_by":{
+				"uuid":"8540d943-8ccd-4ff1-8a08-0c3aa338c58e",
+				"name":"Alice",
+				"surname":"Cooper",
+				"org_name":"a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				"org_display_name":"Kompitech"
+			},
+			"created_at":"2021-04-01T12:34:56+02:00",
+			"_links":{
+				"self":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"},
+				"MarkCommentAsReadByUser":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/read_by"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		updater.AssertExpectations(t)
+	})
+
+	// worknote
+	t.Run("when worknote text is being updated", func(t *testing.T) {
+		assetType := comment.AssetTypeWorknote
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", assetType.String(), auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		uuid := "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+		updater := new(mocks.UpdatingMock)
+		updater.On("UpdateText", uuid, "Updated text", editedBy, channelID, assetType).
+			Return(&comment.Comment{UUID: uuid, Text: "Updated text"}, nil)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpdatingService:         updater,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{"text": "Updated text"}`)
+		req := httptest.NewRequest("PATCH", "/worknotes/"+uuid, bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		updater.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/usersvc"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/validation"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// swagger:route PUT /comments/external/{external_id} comments UpsertComment
+// Creates a new comment with the external ID for the entity or changes the text of the existing one,
+// so synchronization jobs can safely replay their requests
+// responses:
+//	200: commentResponse
+//	201: commentCreatedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	409: errorResponse409
+
+// swagger:route PUT /worknotes/external/{external_id} worknotes UpsertWorknote
+// Creates a new worknote with the external ID for the entity or changes the text of the existing one,
+// so synchronization jobs can safely replay their requests
+// responses:
+//	200: commentResponse
+//	201: commentCreatedResponse
+//	400: errorResponse400
+//	401: errorResponse401
+//	403: errorResponse403
+//	409: errorResponse409
+
+// UpsertComment returns handler for creating or updating comment|worknote identified by external ID and entity
+func (s *Server) UpsertComment(assetType comment.AssetType) func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		s.logger.Info("UpsertComment handler called")
+
+		if err := s.authorize("UpsertComment", assetType.String(), auth.CreateAction, w, r); err != nil {
+			return
+		}
+
+		externalID := params.ByName("external_id")
+		if externalID == "" {
+			eMsg := "malformed URL: missing external ID param"
+			s.logger.Warn("UpsertComment handler failed", zap.String("error", eMsg))
+			s.presenter.WriteError(w, eMsg, http.StatusBadRequest)
+			return
+		}
+
+		defer func() { _ = r.Body.Close() }()
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.logger.Error("could not read request body", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.payloadValidator.ValidatePayload(payload, "upsert_comment.yaml")
+		if err != nil {
+			var errGeneral *validation.ErrGeneral
+			if errors.As(err, &errGeneral) {
+				s.logger.Error("payload validation", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.logger.Warn("invalid payload", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var newComment comment.Comment
+		err = json.Unmarshal(payload, &newComment)
+		if err != nil {
+			eMsg := "could not decode JSON from request"
+			s.logger.Warn(eMsg, zap.Error(err))
+			s.presenter.WriteError(w, fmt.Sprintf("%s: %s", eMsg, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		newComment.ExternalID = externalID
+
+		channelID, err := s.assertChannelID(w, r)
+		if err != nil {
+			return
+		}
+
+		err = s.entityTypes.Validate(channelID, newComment.Entity)
+		if err != nil {
+			s.logger.Warn("invalid entity", zap.Error(err))
+			s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, ok := s.UserInfoFromRequest(r)
+		if !ok {
+			eMsg := "could not get invoking user from context"
+			s.logger.Error(eMsg)
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+
+		userInfo := comment.UserInfo{
+			UUID:           user.UUID,
+			Name:           user.Name,
+			Surname:        user.Surname,
+			OrgName:        user.OrgName,
+			OrgDisplayName: user.OrgDisplayName,
+		}
+
+		newComment.Origin = r.Header.Get("X-Origin")
+		newComment.CreatedBy = &userInfo
+
+		newComment.Mentions, err = s.resolveMentions(r, comment.MentionedUUIDs(newComment.Text))
+		if err != nil {
+			if errors.Is(err, usersvc.ErrUserNotFound) {
+				s.logger.Warn("UpsertComment handler failed", zap.Error(err))
+				s.presenter.WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			s.writeUpsertError(w, err)
+			return
+		}
+
+		// the existing comment is changed only if the user is allowed to update it
+		var forbidden bool
+		storedComment, created, err := s.upserter.UpsertComment(r.Context(), newComment, channelID, assetType, func() error {
+			err := s.authorize("UpsertComment", assetType.String(), auth.UpdateAction, w, r)
+			forbidden = err != nil
+			return err
+		})
+		if forbidden {
+			// the response is already written
+			return
+		}
+		if err != nil {
+			s.writeUpsertError(w, err)
+			return
+		}
+
+		if !created {
+			s.presenter.WriteGetResponse(r, w, *storedComment, assetType)
+			return
+		}
+
+		assetURI := fmt.Sprintf("%s/%s/%s", s.ExternalLocationAddress, assetType.Plural(), storedComment.UUID)
+
+		w.Header().Set("Location", assetURI)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(storedComment)
+		if err != nil {
+			eMsg := "could not encode JSON response"
+			s.logger.Error(eMsg, zap.Error(err))
+			s.presenter.WriteError(w, eMsg, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// writeUpsertError replies to the upsert request with the error and HTTP code of the repository error
+// or with 500 Internal Server Error
+func (s *Server) writeUpsertError(w http.ResponseWriter, err error) {
+	var lockedError *comment.ThreadLockedError
+	if errors.As(err, &lockedError) {
+		s.logger.Warn("UpsertComment handler failed", zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	var httpError *repository.Error
+	if errors.As(err, &httpError) {
+		s.logger.Warn("UpsertComment handler failed", zap.Error(err))
+		s.presenter.WriteError(w, err.Error(), httpError.StatusCode())
+		return
+	}
+
+	s.logger.Error("UpsertComment handler failed", zap.Error(err))
+	s.presenter.WriteError(w, err.Error(), http.StatusInternalServerError)
+}
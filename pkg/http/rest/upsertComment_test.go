@@ -0,0 +1,342 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/validation"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertCommentHandler(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	mockUserData := user.BasicInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	userInfo := comment.UserInfo{
+		UUID:           mockUserData.UUID,
+		Name:           mockUserData.Name,
+		Surname:        mockUserData.Surname,
+		OrgName:        mockUserData.OrgName,
+		OrgDisplayName: mockUserData.OrgDisplayName,
+	}
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	bearerToken := "some valid Bearer token"
+
+	// authorizeUpdate calls the authorization callback of the upsert like the service does for existing comments
+	authorizeUpdate := func(args mock.Arguments) {
+		_ = args.Get(3).(func() error)()
+	}
+
+	t.Run("when request is not valid ('external_id' key present)", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"external_id": "SN-0002",
+			"text": "Synchronized text"
+		}`)
+		req := httptest.NewRequest("PUT", "/comments/external/SN-0001", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"/: additional properties are not allowed"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when comment with external ID does not exist yet", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		expectedComment := comment.Comment{
+			Entity:     entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			Text:       "Synchronized text",
+			ExternalID: "SN-0001",
+			Origin:     "ServiceNow",
+			CreatedBy:  &userInfo,
+		}
+
+		upserter := new(mocks.UpsertingMock)
+		upserter.On("UpsertComment", expectedComment, channelID, comment.AssetTypeComment, mock.Anything).
+			Return(&comment.Comment{UUID: "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"}, true, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpsertingService:        upserter,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text": "Synchronized text"
+		}`)
+		req := httptest.NewRequest("PUT", "/comments/external/SN-0001", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+		req.Header.Set("X-Origin", "ServiceNow")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Status code")
+		assert.Equal(t, "http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e", resp.Header.Get("Location"), "Location header")
+
+		upserter.AssertExpectations(t)
+	})
+
+	t.Run("when comment with external ID already exists", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		updatedComment := &comment.Comment{
+			UUID:       "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			Entity:     entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			Text:       "Synchronized text",
+			ExternalID: "SN-0001",
+			CreatedAt:  "2021-04-01T12:34:56+02:00",
+		}
+
+		expectedComment := comment.Comment{
+			Entity:     entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			Text:       "Synchronized text",
+			ExternalID: "SN-0001",
+			CreatedBy:  &userInfo,
+		}
+
+		upserter := new(mocks.UpsertingMock)
+		upserter.On("UpsertComment", expectedComment, channelID, comment.AssetTypeComment, mock.Anything).
+			Run(authorizeUpdate).
+			Return(updatedComment, false, nil)
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpsertingService:        upserter,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text": "Synchronized text"
+		}`)
+		req := httptest.NewRequest("PUT", "/comments/external/SN-0001", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code")
+
+		expectedJSON := `{
+			"uuid":"7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+			"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text":"Synchronized text",
+			"external_id":"SN-0001",
+			"created_at":"2021-04-01T12:34:56+02:00",
+			"_links":{
+				"self":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"},
+				"MarkCommentAsReadByUser":{"href":"http://service.url/comments/7e0d38d1-e5f5-4211-b2aa-3b142e4da80e/read_by"}
+			}
+		}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+
+		mock.AssertExpectationsForObjects(t, as, upserter)
+	})
+
+	t.Run("when user is not allowed to update existing comment", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "comment", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "comment", auth.UpdateAction, channelID, bearerToken).
+			Return(false, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		upserter := new(mocks.UpsertingMock)
+		upserter.On("UpsertComment", mock.AnythingOfType("comment.Comment"), channelID, comment.AssetTypeComment, mock.Anything).
+			Run(authorizeUpdate).
+			Return(nil, false, errors.New("Authorization failed, action forbidden (comment, update)"))
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpsertingService:        upserter,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text": "Synchronized text"
+		}`)
+		req := httptest.NewRequest("PUT", "/comments/external/SN-0001", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Authorization failed, action forbidden (comment, update)"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+
+	t.Run("when existing comment with external ID is deleted", func(t *testing.T) {
+		as := new(mocks.AuthServiceMock)
+		as.On("Enforce", "worknote", auth.CreateAction, channelID, bearerToken).
+			Return(true, nil)
+		as.On("Enforce", "worknote", auth.UpdateAction, channelID, bearerToken).
+			Return(true, nil)
+
+		us := new(mocks.UserServiceMock)
+		us.On("UserBasicInfo", mock.AnythingOfType("*http.Request")).
+			Return(mockUserData, nil)
+
+		upserter := new(mocks.UpsertingMock)
+		upserter.On("UpsertComment", mock.AnythingOfType("comment.Comment"), channelID, comment.AssetTypeWorknote, mock.Anything).
+			Run(authorizeUpdate).
+			Return(nil, false, couchdb.ErrorConflict("Worknote with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' is deleted"))
+
+		pv, err := validation.NewPayloadValidator()
+		require.NoError(t, err)
+
+		server := NewServer(Config{
+			Addr:                    "service.url",
+			Logger:                  logger,
+			AuthService:             as,
+			UserService:             us,
+			UpsertingService:        upserter,
+			PayloadValidator:        pv,
+			ExternalLocationAddress: "http://service.url",
+		})
+
+		payload := []byte(`{
+			"entity": "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text": "Synchronized text"
+		}`)
+		req := httptest.NewRequest("PUT", "/worknotes/external/SN-0001", bytes.NewReader(payload))
+		req.Header.Set("grpc-metadata-space", channelID)
+		req.Header.Set("authorization", bearerToken)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		resp := w.Result()
+
+		defer func() { _ = resp.Body.Close() }()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response: %v", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Status code")
+
+		expectedJSON := `{"error":"Worknote with uuid='7e0d38d1-e5f5-4211-b2aa-3b142e4da80e' is deleted"}`
+		assert.JSONEq(t, expectedJSON, string(b), "response does not match")
+	})
+}
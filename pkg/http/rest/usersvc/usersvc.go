@@ -2,13 +2,16 @@ package usersvc
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-user-service/api/userservice"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -17,8 +20,15 @@ type Service interface {
 	// UserBasicInfo calls external use service and returns basic info about user who initiated the request
 	// or about user this request is made on behalf of
 	UserBasicInfo(r *http.Request) (user.BasicInfo, error)
+
+	// UserInfo calls external user service and returns basic info about user with specified UUID.
+	// It returns ErrUserNotFound if such user does not exist.
+	UserInfo(r *http.Request, uuid string) (user.BasicInfo, error)
 }
 
+// ErrUserNotFound represents the error when user does not exist in external user service
+var ErrUserNotFound = errors.New("user not found")
+
 // ServiceCloser provides Service functionality plus allows to close connection to external service
 type ServiceCloser interface {
 	Service
@@ -53,12 +63,7 @@ func (s userService) Close() error {
 }
 
 func (s userService) UserBasicInfo(r *http.Request) (user.BasicInfo, error) {
-	md := metadata.New(map[string]string{
-		"grpc-metadata-space": r.Header.Get("grpc-metadata-space"),
-		"authorization":       r.Header.Get("authorization"),
-	})
-
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	ctx := outgoingContext(r)
 
 	var resp *usermanagement.UserPersonalDetailsResponse
 	var err error
@@ -75,15 +80,40 @@ func (s userService) UserBasicInfo(r *http.Request) (user.BasicInfo, error) {
 		}
 	}
 
+	return basicInfo(resp), nil
+}
+
+func (s userService) UserInfo(r *http.Request, uuid string) (user.BasicInfo, error) {
+	resp, err := s.client.UserGet(outgoingContext(r), &usermanagement.UserRequest{Uuid: uuid})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return user.BasicInfo{}, ErrUserNotFound
+		}
+
+		return user.BasicInfo{}, err
+	}
+
+	return basicInfo(resp), nil
+}
+
+// outgoingContext returns context with metadata for calling external user service on behalf of the request's user
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.New(map[string]string{
+		"grpc-metadata-space": r.Header.Get("grpc-metadata-space"),
+		"authorization":       r.Header.Get("authorization"),
+	})
+
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+func basicInfo(resp *usermanagement.UserPersonalDetailsResponse) user.BasicInfo {
 	u := resp.GetResult()
 
-	userData := user.BasicInfo{
+	return user.BasicInfo{
 		UUID:           u.Uuid,
 		Name:           u.Name,
 		Surname:        u.Surname,
 		OrgName:        u.OrgName,
 		OrgDisplayName: u.OrgDisplayName,
 	}
-
-	return userData, nil
 }
@@ -2,10 +2,13 @@ package mocks
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 
-	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/go-kivik/couchdb/v3/chttp"
 	"github.com/go-kivik/kivikmock/v3"
 	"go.uber.org/zap"
 )
@@ -13,23 +16,88 @@ import (
 // GeneratedCommentUUID is UUID of the newly created comment/worknote generated by pseudorandom generator
 var GeneratedCommentUUID = "38316161-3035-4864-ad30-6231392d3433"
 
+// NewRand returns deterministic UUID generator,
+// repository.GenerateUUID(rand) returns always GeneratedCommentUUID
+func NewRand() io.Reader {
+	return strings.NewReader("81aa058d-0b19-43e9-82ae-a7bca2457f10") // pseudo-random seed
+}
+
 // NewCouchDBMock creates new CouchDB mock
-func NewCouchDBMock(ctx context.Context, logger *zap.Logger, validator couchdb.Validator, events event.Service) (*kivikmock.Client, *couchdb.DBStorage) {
+func NewCouchDBMock(ctx context.Context, logger *zap.Logger) (*kivikmock.Client, *couchdb.DBStorage) {
 	client, mock, err := kivikmock.New()
 	if err != nil {
 		panic(err)
 	}
 
-	// rand is used as deterministic UUID generator
-	// repository.GenerateUID(rand) returns always "38316161-3035-4864-ad30-6231392d3433"
-	rand := strings.NewReader("81aa058d-0b19-43e9-82ae-a7bca2457f10") // pseudo-random seed
-
 	storage := couchdb.NewStorage(ctx, logger, couchdb.Config{
-		Client:       client,
-		Rand:         rand,
-		Validator:    validator,
-		EventService: events,
+		Client: client,
+		Rand:   NewRand(),
+		// short delay between attempts keeps tests of concurrent changes fast
+		ConflictBackoff: time.Millisecond,
 	})
 
 	return mock, storage
 }
+
+// ExpectThreadNotLocked sets expectation of the lookup of entity thread lock, which is done before comment is added,
+// returning that the thread is not locked
+func ExpectThreadNotLocked(mock *kivikmock.Client, dbName, entity string) {
+	db := mock.NewDB()
+	mock.ExpectDB().WithName(dbName).WillReturn(db)
+	db.ExpectGet().WithDocID("_local/lock_" + entity).WillReturnError(&chttp.HTTPError{
+		Response: &http.Response{
+			StatusCode: http.StatusNotFound,
+		},
+		Reason: "missing",
+	})
+}
+
+// ExpectIndexesCreated sets expectations of the creation of indexes of the asset type database,
+// which is done also when the database already exists
+func ExpectIndexesCreated(mock *kivikmock.Client, dbName string) *kivikmock.DB {
+	db := mock.NewDB()
+	mock.ExpectDB().WithName(dbName).WillReturn(db)
+	for i := 0; i < 9; i++ {
+		db.ExpectCreateIndex()
+	}
+
+	return db
+}
+
+// ExpectReadStateDatabaseCreated sets expectations of the read state database creation,
+// which is done together with the creation of the asset type database
+func ExpectReadStateDatabaseCreated(mock *kivikmock.Client, readStateDBName string) {
+	mock.ExpectDBExists().WithName(readStateDBName).WillReturn(false)
+	mock.ExpectCreateDB().WithName(readStateDBName)
+	db := mock.NewDB()
+	mock.ExpectDB().WithName(readStateDBName).WillReturn(db)
+	db.ExpectPut().WithDocID("_design/read_state")
+}
+
+// ExpectReadStateReady sets expectations of the check of the counters design document of the asset type database
+// and of the read state database, which is done before the read state of the database is used for the first time
+func ExpectReadStateReady(mock *kivikmock.Client, db *kivikmock.DB, readStateDBName string) {
+	db.ExpectGetMeta().WithDocID("_design/counters").WillReturn(0, "1-967a00dff5e02add41819138abb3284d")
+	mock.ExpectDBExists().WithName(readStateDBName).WillReturn(true)
+}
+
+// ExpectReadStateMigrated sets expectations of the read state migration of the existing asset type database,
+// which does not contain any comments with read_by list
+func ExpectReadStateMigrated(mock *kivikmock.Client, dbName, readStateDBName string) {
+	mock.ExpectDBExists().WithName(readStateDBName).WillReturn(true)
+	db := mock.NewDB()
+	mock.ExpectDB().WithName(dbName).WillReturn(db)
+	db.ExpectGetMeta().WithDocID("_design/counters").WillReturn(0, "1-967a00dff5e02add41819138abb3284d")
+	db.ExpectPut().WithDocID("_design/counters")
+	mock.ExpectDB().WithName(readStateDBName).WillReturn(mock.NewDB())
+	db.ExpectFind().WillReturn(kivikmock.NewRows())
+}
+
+// ExpectEmptyReadState sets expectations of the read state lookup, which is done when comments are retrieved,
+// returning that comments were not read by anybody
+func ExpectEmptyReadState(mock *kivikmock.Client, readStateDBName string) {
+	db := mock.NewDB()
+	mock.ExpectDB().WithName(readStateDBName).WillReturn(db)
+	db.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+	db.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows())
+}
@@ -7,9 +7,11 @@ import (
 	"github.com/KompiTech/go-toolkit/natswatcher"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/user"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/http/rest/auth"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -30,6 +32,12 @@ func (l *ListingMock) QueryComments(ctx context.Context, query map[string]interf
 	return args.Get(0).(listing.QueryResult), args.Error(1)
 }
 
+// CountUnread returns the number of comments of each entity not read by the user
+func (l *ListingMock) CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error) {
+	args := l.Called(entities, userUUID, channelID, assetType)
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
 // AddingMock is a mock of adding service
 type AddingMock struct {
 	mock.Mock
@@ -41,6 +49,18 @@ func (a *AddingMock) AddComment(ctx context.Context, c comment.Comment, channelI
 	return &comment.Comment{UUID: args.String(0)}, args.Error(1)
 }
 
+// UpsertingMock is a mock of upserting service
+type UpsertingMock struct {
+	mock.Mock
+}
+
+// UpsertComment adds the comment with external ID or changes the text of the existing one
+func (u *UpsertingMock) UpsertComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, authorizeUpdate func() error) (*comment.Comment, bool, error) {
+	args := u.Called(c, channelID, assetType, authorizeUpdate)
+	stored, _ := args.Get(0).(*comment.Comment)
+	return stored, args.Bool(1), args.Error(2)
+}
+
 // UpdatingMock is a mock of adding service
 type UpdatingMock struct {
 	mock.Mock
@@ -52,6 +72,150 @@ func (u *UpdatingMock) MarkAsReadByUser(ctx context.Context, id string, readBy c
 	return args.Bool(0), args.Error(1)
 }
 
+// MarkAllAsReadByUser adds user info to read_by array in all comments of the entity in the storage
+func (u *UpdatingMock) MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (int, error) {
+	args := u.Called(e, upTo, readBy, channelID, assetType)
+	return args.Int(0), args.Error(1)
+}
+
+// UpdateText replaces the text of the comment in the storage
+func (u *UpdatingMock) UpdateText(ctx context.Context, id, text string, editedBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
+	args := u.Called(id, text, editedBy, channelID, assetType)
+	c, _ := args.Get(0).(*comment.Comment)
+	return c, args.Error(1)
+}
+
+// AddReaction adds the user's emoji reaction to the comment in the storage
+func (u *UpdatingMock) AddReaction(ctx context.Context, id string, reaction comment.Reaction, channelID string, assetType comment.AssetType) (bool, error) {
+	args := u.Called(id, reaction, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// RemoveReaction removes the user's emoji reaction from the comment in the storage
+func (u *UpdatingMock) RemoveReaction(ctx context.Context, id, emoji string, user comment.UserInfo, channelID string, assetType comment.AssetType) (bool, error) {
+	args := u.Called(id, emoji, user, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// PinComment pins the comment in the storage
+func (u *UpdatingMock) PinComment(ctx context.Context, id string, pinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (bool, error) {
+	args := u.Called(id, pinnedBy, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// UnpinComment unpins the comment in the storage
+func (u *UpdatingMock) UnpinComment(ctx context.Context, id string, unpinnedBy comment.UserInfo, channelID string, assetType comment.AssetType) (bool, error) {
+	args := u.Called(id, unpinnedBy, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// ConvertComment moves the comment to another asset type in the storage
+func (u *UpdatingMock) ConvertComment(ctx context.Context, id string, convertedBy comment.UserInfo, channelID string, from, to comment.AssetType) (*comment.Comment, error) {
+	args := u.Called(id, convertedBy, channelID, from, to)
+	c, _ := args.Get(0).(*comment.Comment)
+	return c, args.Error(1)
+}
+
+// MergeEntity moves all comments of the merged entity to the target entity in the storage
+func (u *UpdatingMock) MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType) (int, error) {
+	args := u.Called(m, channelID, assetType)
+	return args.Int(0), args.Error(1)
+}
+
+// DeletingMock is a mock of deleting service
+type DeletingMock struct {
+	mock.Mock
+}
+
+// DeleteComment marks the comment in the storage as deleted
+func (d *DeletingMock) DeleteComment(ctx context.Context, id string, deletedBy comment.UserInfo, channelID string, assetType comment.AssetType) (bool, error) {
+	args := d.Called(id, deletedBy, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// RestoreComment removes the deleted mark from the comment in the storage
+func (d *DeletingMock) RestoreComment(ctx context.Context, id string, restoredBy comment.UserInfo, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
+	args := d.Called(id, restoredBy, channelID, assetType)
+	c, _ := args.Get(0).(*comment.Comment)
+	return c, args.Error(1)
+}
+
+// LockingMock is a mock of locking service
+type LockingMock struct {
+	mock.Mock
+}
+
+// LockThread stores the lock of the entity thread
+func (l *LockingMock) LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (bool, error) {
+	args := l.Called(lock, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// UnlockThread removes the lock of the entity thread
+func (l *LockingMock) UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (bool, error) {
+	args := l.Called(e, channelID, assetType)
+	return args.Bool(0), args.Error(1)
+}
+
+// TemplatingMock is a mock of templating service
+type TemplatingMock struct {
+	mock.Mock
+}
+
+// CreateTemplate saves a given template to the repository
+func (t *TemplatingMock) CreateTemplate(ctx context.Context, tpl comment.Template, channelID string) (*comment.Template, error) {
+	args := t.Called(tpl, channelID)
+	return args.Get(0).(*comment.Template), args.Error(1)
+}
+
+// GetTemplate returns the template with given ID
+func (t *TemplatingMock) GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error) {
+	args := t.Called(id, channelID)
+	return args.Get(0).(comment.Template), args.Error(1)
+}
+
+// ListTemplates returns all templates of the channel sorted by name
+func (t *TemplatingMock) ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error) {
+	args := t.Called(channelID)
+	return args.Get(0).([]comment.Template), args.Error(1)
+}
+
+// UpdateTemplate replaces name, text and content type of the template with given ID
+func (t *TemplatingMock) UpdateTemplate(ctx context.Context, id string, tpl comment.Template, channelID string) (*comment.Template, error) {
+	args := t.Called(id, tpl, channelID)
+	return args.Get(0).(*comment.Template), args.Error(1)
+}
+
+// DeleteTemplate removes the template with given ID
+func (t *TemplatingMock) DeleteTemplate(ctx context.Context, id, channelID string) error {
+	args := t.Called(id, channelID)
+	return args.Error(0)
+}
+
+// IdempotencyMock is a mock of idempotency service
+type IdempotencyMock struct {
+	mock.Mock
+}
+
+// ReserveIdempotencyKey stores pending record of the key or returns already stored record
+func (i *IdempotencyMock) ReserveIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) (*repository.IdempotencyRecord, error) {
+	args := i.Called(record, channelID, assetType)
+	stored, _ := args.Get(0).(*repository.IdempotencyRecord)
+	return stored, args.Error(1)
+}
+
+// CompleteIdempotencyKey stores the result of the request made with the reserved key
+func (i *IdempotencyMock) CompleteIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	args := i.Called(record, channelID, assetType)
+	return args.Error(0)
+}
+
+// ReleaseIdempotencyKey removes the reserved key
+func (i *IdempotencyMock) ReleaseIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	args := i.Called(record, channelID, assetType)
+	return args.Error(0)
+}
+
 // AuthServiceMock is a mock of authentication service
 type AuthServiceMock struct {
 	mock.Mock
@@ -74,6 +238,12 @@ func (s *UserServiceMock) UserBasicInfo(r *http.Request) (user.BasicInfo, error)
 	return args.Get(0).(user.BasicInfo), args.Error(1)
 }
 
+// UserInfo returns info about user with specified UUID
+func (s *UserServiceMock) UserInfo(r *http.Request, uuid string) (user.BasicInfo, error) {
+	args := s.Called(r, uuid)
+	return args.Get(0).(user.BasicInfo), args.Error(1)
+}
+
 // ValidatorMock is a mock of validation service
 type ValidatorMock struct {
 	mock.Mock
@@ -129,6 +299,85 @@ func (q *QueueMock) AddCreateEvent(c comment.Comment, assetType comment.AssetTyp
 	return args.Error(0)
 }
 
+// AddMentionEvent prepares new event of type MENTIONED for the mentioned user
+func (q *QueueMock) AddMentionEvent(c comment.Comment, mentioned comment.UserInfo, assetType comment.AssetType) error {
+	args := q.Called(c, mentioned, assetType)
+	return args.Error(0)
+}
+
+// AddUpdateEvent prepares new event of type UPDATED
+func (q *QueueMock) AddUpdateEvent(c comment.Comment, editedBy comment.UserInfo, assetType comment.AssetType) error {
+	args := q.Called(c, editedBy, assetType)
+	return args.Error(0)
+}
+
+// AddReactEvent prepares new event of type REACTED for the user's reaction
+func (q *QueueMock) AddReactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error {
+	args := q.Called(c, reaction, assetType)
+	return args.Error(0)
+}
+
+// AddUnreactEvent prepares new event of type UNREACTED for the removed user's reaction
+func (q *QueueMock) AddUnreactEvent(c comment.Comment, reaction comment.Reaction, assetType comment.AssetType) error {
+	args := q.Called(c, reaction, assetType)
+	return args.Error(0)
+}
+
+// AddReadEvent prepares new event of type READ
+func (q *QueueMock) AddReadEvent(c comment.Comment, readBy comment.ReadBy, assetType comment.AssetType) error {
+	args := q.Called(c, readBy, assetType)
+	return args.Error(0)
+}
+
+// AddReadAllEvent prepares new event of type READ for all comments of the entity
+func (q *QueueMock) AddReadAllEvent(e entity.Entity, upTo string, readBy comment.ReadBy, assetType comment.AssetType) error {
+	args := q.Called(e, upTo, readBy, assetType)
+	return args.Error(0)
+}
+
+// AddPinEvent prepares new event of type PINNED
+func (q *QueueMock) AddPinEvent(c comment.Comment, pinnedBy comment.UserInfo, assetType comment.AssetType) error {
+	args := q.Called(c, pinnedBy, assetType)
+	return args.Error(0)
+}
+
+// AddUnpinEvent prepares new event of type UNPINNED
+func (q *QueueMock) AddUnpinEvent(c comment.Comment, unpinnedBy comment.UserInfo, assetType comment.AssetType) error {
+	args := q.Called(c, unpinnedBy, assetType)
+	return args.Error(0)
+}
+
+// AddDeleteEvent prepares new event of type DELETE
+func (q *QueueMock) AddDeleteEvent(c comment.Comment, assetType comment.AssetType) error {
+	args := q.Called(c, assetType)
+	return args.Error(0)
+}
+
+// AddRestoreEvent prepares new event of type RESTORE
+func (q *QueueMock) AddRestoreEvent(c comment.Comment, assetType comment.AssetType) error {
+	args := q.Called(c, assetType)
+	return args.Error(0)
+}
+
+// AddConvertEvent prepares new event of type CONVERTED
+func (q *QueueMock) AddConvertEvent(c comment.Comment, convertedBy comment.UserInfo, assetType comment.AssetType) error {
+	args := q.Called(c, convertedBy, assetType)
+	return args.Error(0)
+}
+
+// AddMergeEvent prepares new event of type MERGED
+func (q *QueueMock) AddMergeEvent(m comment.EntityMerge, uuids []string, assetType comment.AssetType) error {
+	args := q.Called(m, uuids, assetType)
+	return args.Error(0)
+}
+
+// Message returns the message of all prepared events not published yet
+func (q *QueueMock) Message() (*event.Message, error) {
+	args := q.Called()
+	m, _ := args.Get(0).(*event.Message)
+	return m, args.Error(1)
+}
+
 // PublishEvents publishes all prepared events not published yet
 func (q *QueueMock) PublishEvents() error {
 	args := q.Called()
@@ -0,0 +1,229 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// ConvertComment moves the comment with specified ID changed by convert function from the database of one asset type
+// to the database of another one (e.g. customer comment posted as worknote by mistake). The comment keeps its UUID,
+// author and read state. Comments with replies cannot be converted, the thread would be split. The message returned
+// by events function (if not nil) is stored to the outbox of the target database by the same request as the comment.
+func (s *DBStorage) ConvertComment(ctx context.Context, id, channelID string, from, to comment.AssetType,
+	convert func(c *comment.Comment) error, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
+	srcDB := s.client.DB(ctx, databaseName(channelID, from))
+	dstDB := s.client.DB(ctx, databaseName(channelID, to))
+
+	var original revisedComment
+	var converted comment.Comment
+
+	err := s.retryOnConflict(ctx, fmt.Sprintf("%s:%s", from, id), func() error {
+		var err error
+
+		original, err = s.getRevisedComment(ctx, srcDB, id, from, "converted")
+		if err != nil {
+			return err
+		}
+
+		converted, err = s.convertedComment(ctx, srcDB, original.Comment, convert, channelID, from)
+		if err != nil {
+			return err
+		}
+
+		msg, err := eventMessage(converted, events)
+		if err != nil {
+			return err
+		}
+
+		return s.moveComment(ctx, srcDB, dstDB, original, converted, msg, channelID, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("%s %s converted to %s", strings.Title(from.String()), id, to))
+
+	// read records left in the source read state database would count the comment as read there
+	s.deleteReadRecords(ctx, id, channelID, from)
+
+	return &converted, nil
+}
+
+// convertedComment returns the comment changed by convert function with read_by list projected from the source read state
+func (s *DBStorage) convertedComment(ctx context.Context, srcDB *kivik.DB, c comment.Comment, convert func(c *comment.Comment) error, channelID string, from comment.AssetType) (comment.Comment, error) {
+	if err := convert(&c); err != nil {
+		return c, err
+	}
+
+	if err := s.assertNoReplies(ctx, srcDB, c.UUID, from); err != nil {
+		return c, err
+	}
+
+	if err := s.projectReadBy(ctx, &c, channelID, from); err != nil {
+		s.logger.Warn("read state retrieval failed", zap.Error(err))
+		eMsg := fmt.Sprintf("%s could not be converted: read state could not be retrieved", strings.Title(from.String()))
+		return c, repository.NewError(eMsg, http.StatusInternalServerError)
+	}
+
+	return c, nil
+}
+
+// moveComment stores the converted comment with its read records and the outbox document of the message (if not nil)
+// to the target databases and deletes the original one. Read state is not stored in the comment document,
+// only its legacy read_by list (comments not migrated yet) is moved with it. The databases cannot be changed atomically
+// and nothing is rolled back: if the original comment cannot be deleted, its copy stays in the target database
+// and it is overwritten (with another outbox document) when the conversion is repeated.
+func (s *DBStorage) moveComment(ctx context.Context, srcDB, dstDB *kivik.DB, original revisedComment, converted comment.Comment, msg *event.Message, channelID string, from, to comment.AssetType) error {
+	title := strings.Title(from.String())
+
+	doc := bulkComment{ID: original.UUID, Comment: converted}
+	doc.ReadBy = original.ReadBy
+
+	_, _, err := s.putWithOutbox(ctx, dstDB, original.UUID, doc, msg)
+	if kivik.StatusCode(err) == http.StatusConflict {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		doc.Rev, err = s.unfinishedCopyRev(ctx, dstDB, original, from, to)
+		if err != nil {
+			return err
+		}
+
+		_, _, err = s.putWithOutbox(ctx, dstDB, original.UUID, doc, msg)
+	}
+	if err != nil {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		if kivik.StatusCode(err) == http.StatusConflict {
+			// the copy was changed by the concurrent conversion in the meantime
+			return revisionConflict(ErrorConflict(fmt.Sprintf("%s could not be converted", title)))
+		}
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("%s could not be converted: %s", title, httpError.Reason)
+			return repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return err
+	}
+
+	var records []interface{}
+	for _, rb := range converted.ReadBy {
+		if !readByUser(original.ReadBy, rb.User.UUID) {
+			records = append(records, newReadRecord(converted, rb))
+		}
+	}
+
+	_, err = s.bulkUpdate(ctx, s.client.DB(ctx, readStateDatabaseName(channelID, to)), records)
+	if err != nil {
+		return err
+	}
+
+	_, err = srcDB.Delete(ctx, original.UUID, original.Rev)
+	if err != nil {
+		s.logger.Warn("CouchDB DELETE failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			if httpError.StatusCode() == http.StatusConflict {
+				// the original comment was changed in the meantime, the changed one is converted
+				return revisionConflict(ErrorConflict(fmt.Sprintf("%s could not be converted", title)))
+			}
+
+			eMsg := fmt.Sprintf("%s could not be converted: %s", title, httpError.Reason)
+			return repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// unfinishedCopyRev returns the revision ID of the copy of the original comment left in the target database
+// by the conversion that was not finished. It fails with 409 Conflict if the target database contains
+// another comment with the same UUID (e.g. with the same external ID).
+func (s *DBStorage) unfinishedCopyRev(ctx context.Context, dstDB *kivik.DB, original revisedComment, from, to comment.AssetType) (string, error) {
+	stored, err := s.getRevisedComment(ctx, dstDB, original.UUID, to, "converted")
+	if err != nil {
+		return "", err
+	}
+
+	if stored.ConvertedFrom != from || stored.CreatedAt != original.CreatedAt {
+		eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' already exists", strings.Title(from.String()), to, original.UUID)
+		return "", ErrorConflict(eMsg)
+	}
+
+	return stored.Rev, nil
+}
+
+// assertNoReplies returns error if some comment replies to the comment with specified ID
+func (s *DBStorage) assertNoReplies(ctx context.Context, db *kivik.DB, id string, assetType comment.AssetType) error {
+	title := strings.Title(assetType.String())
+
+	rows, err := db.Find(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{"parent_uuid": id},
+		"fields":   []string{"uuid"},
+		"limit":    1,
+	})
+	if err != nil {
+		s.logger.Warn("CouchDB FIND failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("%s could not be converted: %s", title, httpError.Reason)
+			return repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if rows.Next() {
+		eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' has replies", title, assetType, id)
+		return ErrorConflict(eMsg)
+	}
+
+	return rows.Err()
+}
+
+// deleteReadRecords deletes read records of the converted or deleted comment, failures are only logged
+func (s *DBStorage) deleteReadRecords(ctx context.Context, id, channelID string, assetType comment.AssetType) {
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+
+	rows, err := rsDB.Query(ctx, readStateDesignDocID, "_view/"+readsByCommentView, kivik.Options{
+		"key":          id,
+		"include_docs": true,
+	})
+	if err != nil {
+		s.logger.Warn("read records could not be deleted", zap.Error(err))
+		return
+	}
+
+	var docs []interface{}
+	for rows.Next() {
+		var rr readRecord
+		if err := rows.ScanDoc(&rr); err != nil {
+			s.logger.Warn("read records could not be deleted", zap.Error(err))
+			_ = rows.Close()
+			return
+		}
+
+		docs = append(docs, map[string]interface{}{"_id": rr.ID, "_rev": rr.Rev, "_deleted": true})
+	}
+	_ = rows.Close()
+
+	if _, err := s.bulkUpdate(ctx, rsDB, docs); err != nil {
+		s.logger.Warn("read records could not be deleted", zap.Error(err))
+	}
+}
@@ -0,0 +1,313 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertComment(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+	readerUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+
+	convertedBy := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	storedDoc := map[string]interface{}{
+		"_rev":       "2-5a3d",
+		"uuid":       uuid,
+		"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+		"text":       "Internal note",
+		"created_at": "2021-04-01T12:00:00+02:00",
+		"created_by": map[string]interface{}{"uuid": "f49d5fd5-8da4-4779-b5ba-32e78aa2c444", "name": "Joseph"},
+		"pinned_at":  "2021-04-01T12:10:00+02:00",
+		"pinned_by":  map[string]interface{}{"uuid": "f49d5fd5-8da4-4779-b5ba-32e78aa2c444", "name": "Joseph"},
+	}
+
+	readRecordDoc := []byte(`{
+		"_id":"read:` + readerUUID + `:` + uuid + `",
+		"_rev":"1-a",
+		"type":"read",
+		"comment_uuid":"` + uuid + `",
+		"comment_created_at":"2021-04-01T12:00:00+02:00",
+		"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+		"time":"2021-04-01T12:20:00+02:00",
+		"user":{"uuid":"` + readerUUID + `","name":"Jane"}
+	}`)
+
+	// convert changes the comment the same way as the updating service does
+	convert := func(c *comment.Comment) error {
+		c.PinnedAt = ""
+		c.PinnedBy = nil
+		c.ConvertedFrom = comment.AssetTypeComment
+		c.ConvertedAt = "2021-04-01T12:30:00+02:00"
+		c.ConvertedBy = &convertedBy
+		return nil
+	}
+
+	t.Run("when comment is converted to worknote", func(t *testing.T) {
+		var published comment.Comment
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		srcRS := couchMock.NewDB()
+		dstRS := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		// no replies
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows())
+
+		// read state of the comment
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{ID: "read:" + readerUUID + ":" + uuid, Doc: readRecordDoc}))
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").
+			WillReturn(kivikmock.NewRows())
+
+		expectBulkDocsWithOutbox(t, dstDB, uuid, "1-7b2e")
+
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstRS)
+		dstRS.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: "read:" + readerUUID + ":" + uuid, Rev: "1-b"}))
+
+		srcDB.ExpectDelete().WithDocID(uuid).WithRev("2-5a3d")
+
+		// read records of the original comment are deleted
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").
+			WithOptions(map[string]interface{}{"key": uuid, "include_docs": true}).
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{ID: "read:" + readerUUID + ":" + uuid, Doc: readRecordDoc}))
+		srcRS.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: "read:" + readerUUID + ":" + uuid, Rev: "2-a"}))
+
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+			published = c
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uuid, converted.UUID)
+		assert.Equal(t, "Joseph", converted.CreatedBy.Name)
+		assert.Equal(t, comment.AssetTypeComment, converted.ConvertedFrom)
+		assert.Equal(t, &convertedBy, converted.ConvertedBy)
+		assert.NotEmpty(t, converted.ConvertedAt)
+		assert.Empty(t, converted.PinnedAt)
+		require.Len(t, converted.ReadBy, 1)
+		assert.Equal(t, readerUUID, converted.ReadBy[0].User.UUID)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+		assert.Equal(t, *converted, published)
+	})
+
+	t.Run("when comment has replies", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Doc: []byte(`{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb"}`)}))
+
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+		assert.Nil(t, converted)
+		assert.EqualError(t, err, "Comment could not be converted: comment with uuid='cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0' has replies")
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comment was converted concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		srcRS := couchMock.NewDB()
+		dstRS := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows())
+		expectBulkDocsWithOutbox(t, dstDB, uuid, "1-7b2e")
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstRS)
+
+		// the original comment was deleted by the concurrent conversion, nothing is rolled back
+		srcDB.ExpectDelete().WithDocID(uuid).WithRev("2-5a3d").WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+		})
+
+		srcDB.ExpectGet().WithDocID(uuid).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		})
+
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.Nil(t, converted)
+		assert.EqualError(t, err, "Comment with uuid='cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0' does not exist")
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when previous conversion was not finished", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		srcRS := couchMock.NewDB()
+		dstRS := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows())
+
+		// the copy left by the previous conversion already exists
+		dstDB.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			require.Len(t, docs, 2)
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: uuid, Error: &chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusConflict}}},
+				{ID: bulkDocID(t, docs[1]), Rev: "0-1"},
+			}}, nil
+		})
+		dstDB.ExpectDelete().WithRev("0-1")
+
+		leftover := map[string]interface{}{"_rev": "1-7b2e", "converted_from": "comment"}
+		for k, v := range storedDoc {
+			if k != "_rev" {
+				leftover[k] = v
+			}
+		}
+		row, err = kivikmock.Document(leftover)
+		require.NoError(t, err)
+		dstDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		// the copy is overwritten
+		dstDB.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			require.Len(t, docs, 2)
+			b, err := json.Marshal(docs[0])
+			require.NoError(t, err)
+			assert.Contains(t, string(b), `"_rev":"1-7b2e"`)
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: uuid, Rev: "2-8c3f"},
+				{ID: bulkDocID(t, docs[1]), Rev: "0-1"},
+			}}, nil
+		})
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstRS)
+		srcDB.ExpectDelete().WithDocID(uuid).WithRev("2-5a3d")
+
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uuid, converted.UUID)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when target database contains another comment with the same UUID", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		srcRS := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows())
+
+		dstDB.ExpectPut().WithDocID(uuid).WillReturnError(&chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusConflict}})
+
+		row, err = kivikmock.Document(map[string]interface{}{
+			"_rev":       "1-7b2e",
+			"uuid":       uuid,
+			"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text":       "Worknote with the same external ID",
+			"created_at": "2021-04-01T11:00:00+02:00",
+		})
+		require.NoError(t, err)
+		dstDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+		assert.Nil(t, converted)
+		assert.EqualError(t, err, "Comment could not be converted: worknote with uuid='cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0' already exists")
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when events are not prepared", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		srcDB := couchMock.NewDB()
+		dstDB := couchMock.NewDB()
+		srcRS := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcDB)
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(dstDB)
+
+		row, err := kivikmock.Document(storedDoc)
+		require.NoError(t, err)
+		srcDB.ExpectGet().WithDocID(uuid).WillReturn(row)
+		srcDB.ExpectFind().WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(srcRS)
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows())
+		srcRS.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows())
+
+		// nothing is moved
+		converted, err := s.ConvertComment(context.Background(), uuid, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+			return nil, errors.New("could not prepare events: invalid orgID")
+		})
+		assert.Nil(t, converted)
+		assert.EqualError(t, err, "could not prepare events: invalid orgID")
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,196 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// idempotencyDocPrefix is the prefix of IDs of local documents with idempotency records
+const idempotencyDocPrefix = "_local/idempotency_"
+
+// idempotencyCleanupInterval is the minimal interval between two deletions of expired keys of the database
+const idempotencyCleanupInterval = time.Hour
+
+// idempotencyDoc is the idempotency record stored as local (non-replicated and non-indexed) document,
+// so it does not appear in comment queries
+type idempotencyDoc struct {
+	ID  string `json:"_id,omitempty"`
+	Rev string `json:"_rev,omitempty"`
+	repository.IdempotencyRecord
+}
+
+// ReserveIdempotencyKey stores pending record of the key; if the key is already stored and not expired,
+// the stored record is returned instead
+func (s *DBStorage) ReserveIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) (*repository.IdempotencyRecord, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	stored, err := s.getIdempotencyDoc(ctx, db, record.ScopedKey())
+	if err != nil {
+		return nil, err
+	}
+
+	var rev string
+	if stored != nil {
+		if time.Now().Before(stored.ExpiresAt) {
+			return &stored.IdempotencyRecord, nil
+		}
+
+		// expired key is reserved again
+		rev = stored.Rev
+	}
+
+	_, err = db.Put(ctx, idempotencyDocID(record.ScopedKey()), idempotencyDoc{Rev: rev, IdempotencyRecord: record})
+	if err != nil {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			if httpError.StatusCode() == http.StatusConflict {
+				eMsg := fmt.Sprintf("request with Idempotency-Key '%s' is already being processed", record.Key)
+				return nil, ErrorConflict(eMsg)
+			}
+
+			eMsg := fmt.Sprintf("Idempotency-Key could not be reserved: %s", httpError.Reason)
+			return nil, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return nil, err
+	}
+
+	s.deleteExpiredIdempotencyDocs(ctx, db)
+
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the result of the request made with the reserved key
+func (s *DBStorage) CompleteIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	return s.retryOnConflict(ctx, idempotencyDocID(record.ScopedKey()), func() error {
+		stored, err := s.getIdempotencyDoc(ctx, db, record.ScopedKey())
+		if err != nil {
+			return err
+		}
+
+		if stored == nil {
+			return ErrorNorFound(fmt.Sprintf("Idempotency-Key '%s' is not reserved", record.Key))
+		}
+
+		_, err = db.Put(ctx, idempotencyDocID(record.ScopedKey()), idempotencyDoc{Rev: stored.Rev, IdempotencyRecord: record})
+		if err != nil {
+			s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+			err = fmt.Errorf("idempotency key could not be stored: %w", err)
+			if kivik.StatusCode(err) == http.StatusConflict {
+				return revisionConflict(err)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ReleaseIdempotencyKey removes the reserved key, so the failed request can be retried
+func (s *DBStorage) ReleaseIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+	key := record.ScopedKey()
+
+	return s.retryOnConflict(ctx, idempotencyDocID(key), func() error {
+		stored, err := s.getIdempotencyDoc(ctx, db, key)
+		if err != nil || stored == nil {
+			return err
+		}
+
+		_, err = db.Delete(ctx, idempotencyDocID(key), stored.Rev)
+		if err != nil {
+			s.logger.Warn("CouchDB DELETE failed", zap.Error(err))
+
+			err = fmt.Errorf("idempotency key could not be released: %w", err)
+			if kivik.StatusCode(err) == http.StatusConflict {
+				return revisionConflict(err)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// getIdempotencyDoc returns stored idempotency document of the key or nil if it does not exist
+func (s *DBStorage) getIdempotencyDoc(ctx context.Context, db *kivik.DB, key string) (*idempotencyDoc, error) {
+	var doc idempotencyDoc
+
+	err := db.Get(ctx, idempotencyDocID(key)).ScanDoc(&doc)
+	if err != nil {
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			return nil, nil
+		}
+
+		s.logger.Warn("CouchDB GET failed", zap.Error(err))
+		return nil, fmt.Errorf("idempotency key could not be retrieved: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// deleteExpiredIdempotencyDocs deletes expired idempotency documents of the database at most once
+// per idempotencyCleanupInterval, the documents are kept if it fails as they are reserved again
+// when used after expiration anyway
+func (s *DBStorage) deleteExpiredIdempotencyDocs(ctx context.Context, db *kivik.DB) {
+	if cleanedAt, ok := s.idempotencyCleanedAt.Load(db.Name()); ok && time.Since(cleanedAt.(time.Time)) < idempotencyCleanupInterval {
+		return
+	}
+	s.idempotencyCleanedAt.Store(db.Name(), time.Now())
+
+	rows, err := db.LocalDocs(ctx, kivik.Options{
+		"startkey":     idempotencyDocPrefix,
+		"endkey":       idempotencyDocPrefix + "\ufff0",
+		"include_docs": true,
+	})
+	if err != nil {
+		s.logger.Warn("expired idempotency keys could not be listed", zap.String("db", db.Name()), zap.Error(err))
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	var expired []idempotencyDoc
+	for rows.Next() {
+		var doc idempotencyDoc
+		if err := rows.ScanDoc(&doc); err != nil {
+			s.logger.Warn("expired idempotency keys could not be listed", zap.String("db", db.Name()), zap.Error(err))
+			return
+		}
+
+		if !time.Now().Before(doc.ExpiresAt) {
+			expired = append(expired, doc)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		s.logger.Warn("expired idempotency keys could not be listed", zap.String("db", db.Name()), zap.Error(err))
+		return
+	}
+
+	for _, doc := range expired {
+		// the key reserved again in the meantime has a new revision and it is not deleted
+		if _, err := db.Delete(ctx, doc.ID, doc.Rev); err != nil && kivik.StatusCode(err) != http.StatusConflict {
+			s.logger.Warn("expired idempotency key could not be deleted", zap.String("id", doc.ID), zap.Error(err))
+		}
+	}
+}
+
+func idempotencyDocID(key string) string {
+	return idempotencyDocPrefix + key
+}
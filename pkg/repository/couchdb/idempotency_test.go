@@ -0,0 +1,251 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	key := "5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10"
+	userUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+	docID := "_local/idempotency_" + userUUID + "_" + key
+
+	notFound := func(ctx context.Context, arg0 string, options map[string]interface{}) (*driver.Document, error) {
+		return &driver.Document{}, &chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		}
+	}
+
+	record := repository.IdempotencyRecord{
+		Key:         key,
+		UserUUID:    userUUID,
+		RequestHash: "someHash",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	t.Run("when key is not stored yet", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID)
+		db.ExpectLocalDocs().WillReturn(kivikmock.NewRows())
+
+		stored, err := s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when expired keys are stored", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		expiredID := "_local/idempotency_" + userUUID + "_0ac5ebce-17e7-4edc-9552-fefe16e127fb"
+		validID := "_local/idempotency_" + userUUID + "_3a5e2f10-4c0d-4f4e-a7d8-8b2c6f1e9d07"
+
+		idempotencyRow := func(id string, expiresAt time.Time) *driver.Row {
+			doc := `{"_id":"` + id + `","_rev":"0-1","key":"k","user_uuid":"` + userUUID + `","request_hash":"h","status_code":201,"expires_at":"` + expiresAt.UTC().Format(time.RFC3339Nano) + `"}`
+			return &driver.Row{ID: id, Doc: []byte(doc)}
+		}
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID)
+		db.ExpectLocalDocs().WillReturn(kivikmock.NewRows().
+			AddRow(idempotencyRow(expiredID, time.Now().Add(-time.Minute))).
+			AddRow(idempotencyRow(validID, time.Now().Add(time.Hour))))
+		db.ExpectDelete().WithDocID(expiredID).WithRev("0-1")
+
+		stored, err := s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+
+		// expired keys are not listed again until the next cleanup interval
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID)
+
+		stored, err = s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet(), "only expired key is deleted")
+	})
+
+	t.Run("when key is already stored", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		completed := record
+		completed.UUID = "38316161-3035-4864-ad30-6231392d3433"
+		completed.StatusCode = http.StatusCreated
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(completed)
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+
+		stored, err := s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, completed.UUID, stored.UUID)
+		assert.Equal(t, http.StatusCreated, stored.StatusCode)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when stored key is expired", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		expired := record
+		expired.StatusCode = http.StatusCreated
+		expired.ExpiresAt = time.Now().Add(-time.Hour)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(expired)
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectPut().WithDocID(docID)
+		db.ExpectLocalDocs().WillReturn(kivikmock.NewRows())
+
+		stored, err := s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when key is being reserved concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+			Reason: "Document update conflict.",
+		})
+
+		stored, err := s.ReserveIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.EqualError(t, err, "request with Idempotency-Key '5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10' is already being processed")
+		assert.Nil(t, stored)
+	})
+}
+
+func TestCompleteIdempotencyKey(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	key := "5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10"
+	userUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+	docID := "_local/idempotency_" + userUUID + "_" + key
+
+	record := repository.IdempotencyRecord{
+		Key:         key,
+		UserUUID:    userUUID,
+		RequestHash: "someHash",
+		UUID:        "38316161-3035-4864-ad30-6231392d3433",
+		StatusCode:  http.StatusCreated,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	t.Run("when key is reserved", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(repository.IdempotencyRecord{Key: key, RequestHash: "someHash"})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectPut().WithDocID(docID)
+
+		err = s.CompleteIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when key record was changed concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(repository.IdempotencyRecord{Key: key, RequestHash: "someHash"})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectPut().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+		})
+		row, err = kivikmock.Document(repository.IdempotencyRecord{Key: key, RequestHash: "someHash"})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectPut().WithDocID(docID)
+
+		err = s.CompleteIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when key is not reserved", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(func(ctx context.Context, arg0 string, options map[string]interface{}) (*driver.Document, error) {
+			return &driver.Document{}, &chttp.HTTPError{
+				Response: &http.Response{
+					StatusCode: http.StatusNotFound,
+				},
+			}
+		})
+
+		err := s.CompleteIdempotencyKey(context.Background(), record, channelID, comment.AssetTypeComment)
+		assert.EqualError(t, err, "Idempotency-Key '5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10' is not reserved")
+	})
+}
+
+func TestReleaseIdempotencyKey(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	key := "5f2b7c1e-8a6d-4c1b-9a43-0c5e2d4f7a10"
+	userUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+	docID := "_local/idempotency_" + userUUID + "_" + key
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+	row, err := kivikmock.Document(map[string]interface{}{"_rev": "1-abc", "key": key})
+	require.NoError(t, err)
+	db.ExpectGet().WithDocID(docID).WillReturn(row)
+	db.ExpectDelete().WithDocID(docID).WithRev("1-abc")
+
+	err = s.ReleaseIdempotencyKey(context.Background(), repository.IdempotencyRecord{Key: key, UserUUID: userUUID}, channelID, comment.AssetTypeComment)
+	assert.NoError(t, err)
+	assert.NoError(t, couchMock.ExpectationsWereMet())
+}
@@ -0,0 +1,151 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// lockDoc is the thread lock stored as local (non-replicated and non-indexed) document
+// in the database of the asset type, so it does not appear in comment queries
+type lockDoc struct {
+	Rev string `json:"_rev,omitempty"`
+	comment.ThreadLock
+}
+
+// LockThread stores the lock of the entity thread.
+// It returns true if thread was already locked to notify that resource was not changed.
+func (s *DBStorage) LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (bool, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	stored, err := s.getLockDoc(ctx, db, lock.Entity)
+	if err != nil {
+		return false, err
+	}
+
+	if stored != nil {
+		return true, nil
+	}
+
+	lock.LockedAt = time.Now().Format(time.RFC3339)
+
+	_, err = db.Put(ctx, lockDocID(lock.Entity), lockDoc{ThreadLock: lock})
+	if err != nil {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			if httpError.StatusCode() == http.StatusConflict {
+				// thread was locked concurrently
+				return true, nil
+			}
+
+			eMsg := fmt.Sprintf("Thread could not be locked: %s", httpError.Reason)
+			return false, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return false, err
+	}
+
+	s.logger.Info(fmt.Sprintf("%s thread locked %#v", assetType.Title(), lock))
+
+	return false, nil
+}
+
+// UnlockThread removes the lock of the entity thread.
+// It returns true if thread was not locked to notify that resource was not changed.
+func (s *DBStorage) UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (bool, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	notLocked := false
+	err := s.retryOnConflict(ctx, lockDocID(e), func() error {
+		stored, err := s.getLockDoc(ctx, db, e)
+		if err != nil {
+			return err
+		}
+
+		if stored == nil {
+			notLocked = true
+			return nil
+		}
+
+		_, err = db.Delete(ctx, lockDocID(e), stored.Rev)
+		if err != nil {
+			s.logger.Warn("CouchDB DELETE failed", zap.Error(err))
+
+			var httpError *chttp.HTTPError
+			if errors.As(err, &httpError) {
+				eMsg := fmt.Sprintf("Thread could not be unlocked: %s", httpError.Reason)
+				if httpError.StatusCode() == http.StatusConflict {
+					return revisionConflict(repository.NewError(eMsg, http.StatusConflict))
+				}
+
+				return repository.NewError(eMsg, httpError.StatusCode())
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if notLocked {
+		return true, nil
+	}
+
+	s.logger.Info(fmt.Sprintf("%s thread of entity '%s' unlocked", assetType.Title(), e))
+
+	return false, nil
+}
+
+// GetThreadLock returns the lock of the entity thread or nil if the thread is not locked
+func (s *DBStorage) GetThreadLock(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (*comment.ThreadLock, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	stored, err := s.getLockDoc(ctx, db, e)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+
+	return &stored.ThreadLock, nil
+}
+
+// getLockDoc returns stored lock document of the entity thread or nil if it does not exist
+func (s *DBStorage) getLockDoc(ctx context.Context, db *kivik.DB, e entity.Entity) (*lockDoc, error) {
+	var doc lockDoc
+
+	err := db.Get(ctx, lockDocID(e)).ScanDoc(&doc)
+	if err != nil {
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			return nil, nil
+		}
+
+		s.logger.Warn("CouchDB GET failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Thread lock could not be retrieved: %s", httpError.Reason)
+			return nil, repository.NewError(eMsg, httpError.StatusCode())
+		}
+
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+func lockDocID(e entity.Entity) string {
+	return "_local/lock_" + e.String()
+}
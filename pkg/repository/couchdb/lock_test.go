@@ -0,0 +1,161 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockThread(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	docID := "_local/lock_incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
+
+	notFound := func(ctx context.Context, arg0 string, options map[string]interface{}) (*driver.Document, error) {
+		return &driver.Document{}, &chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		}
+	}
+
+	lock := comment.ThreadLock{
+		Entity: e,
+		Reason: "Incident is closed",
+		LockedBy: &comment.UserInfo{
+			UUID: "439e2d19-8d50-405d-ad8e-cd33df344086",
+			Name: "Joe",
+		},
+	}
+
+	t.Run("when thread is not locked yet", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID)
+
+		alreadyLocked, err := s.LockThread(context.Background(), lock, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.False(t, alreadyLocked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when thread is already locked", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		stored := lock
+		stored.LockedAt = time.Now().Format(time.RFC3339)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(stored)
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+
+		alreadyLocked, err := s.LockThread(context.Background(), lock, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.True(t, alreadyLocked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when thread is locked concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillExecute(notFound)
+		db.ExpectPut().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+			Reason: "Document update conflict.",
+		})
+
+		alreadyLocked, err := s.LockThread(context.Background(), lock, channelID, comment.AssetTypeComment)
+		assert.NoError(t, err)
+		assert.True(t, alreadyLocked)
+	})
+}
+
+func TestUnlockThread(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	docID := "_local/lock_incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
+
+	t.Run("when thread is locked", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(db)
+		row, err := kivikmock.Document(map[string]interface{}{"_rev": "1-abc", "entity": e.String()})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectDelete().WithDocID(docID).WithRev("1-abc")
+
+		notLocked, err := s.UnlockThread(context.Background(), e, channelID, comment.AssetTypeWorknote)
+		assert.NoError(t, err)
+		assert.False(t, notLocked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when thread is unlocked concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(db)
+		row, err := kivikmock.Document(map[string]interface{}{"_rev": "1-abc", "entity": e.String()})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectDelete().WithDocID(docID).WithRev("1-abc").WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+		})
+		db.ExpectGet().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		})
+
+		notLocked, err := s.UnlockThread(context.Background(), e, channelID, comment.AssetTypeWorknote)
+		assert.NoError(t, err)
+		assert.True(t, notLocked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when thread is not locked", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeWorknote)).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		})
+
+		notLocked, err := s.UnlockThread(context.Background(), e, channelID, comment.AssetTypeWorknote)
+		assert.NoError(t, err)
+		assert.True(t, notLocked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
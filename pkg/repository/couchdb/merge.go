@@ -0,0 +1,327 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// mergeBatch is the number of comments read and stored by one request when entities are merged
+const mergeBatch = 200
+
+// mergedComment is the pair of the comment of the merged entity and its stored version in the target entity
+type mergedComment struct {
+	original bulkComment
+	stored   bulkComment
+}
+
+// MergeEntity moves all comments of the merged entity to the target entity, or stores their copies when merge mode
+// is copy. Merged comments are unpinned and their original_entity field keeps the merged entity (the first one
+// if the comment was merged repeatedly). Moved comments keep their UUIDs and read state, copies get new UUIDs
+// and replies are linked to the copies of their parents. The message returned by events function (if not nil)
+// for UUIDs of the merged comments is stored to the outbox once all comments are merged. It is the only change
+// whose events are not stored by the same request (comments are merged in batches), so the merge is reverted
+// if they cannot be stored. Either all comments are merged or none, comments changed concurrently are merged again.
+// It returns the number of merged comments.
+func (s *DBStorage) MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType,
+	events func(uuids []string) (*event.Message, error)) (int, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	var merged []mergedComment
+	err := s.retryOnConflict(ctx, fmt.Sprintf("%s of %s", assetType.Plural(), m.Source), func() error {
+		docs, err := s.entityComments(ctx, db, m, assetType)
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start < len(docs); start += mergeBatch {
+			end := start + mergeBatch
+			if end > len(docs) {
+				end = len(docs)
+			}
+
+			stored, conflicts, err := s.storeMerged(ctx, db, docs[start:end], m, assetType)
+			merged = append(merged, stored...)
+			if err != nil {
+				return err
+			}
+
+			if conflicts > 0 {
+				// moved comments do not belong to the merged entity anymore, only the changed ones are merged again
+				eMsg := fmt.Sprintf("%s of entity '%s' could not be merged", strings.Title(assetType.Plural()), m.Source)
+				return revisionConflict(ErrorConflict(eMsg))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.revertMerge(ctx, db, merged, m, assetType)
+		return 0, err
+	}
+
+	if len(merged) == 0 {
+		return 0, nil
+	}
+
+	uuids := make([]string, 0, len(merged))
+	for _, mc := range merged {
+		uuids = append(uuids, mc.stored.UUID)
+	}
+
+	if events != nil {
+		if err := s.putMergeEvents(ctx, db, uuids, m, events); err != nil {
+			s.revertMerge(ctx, db, merged, m, assetType)
+			return 0, err
+		}
+	}
+
+	if !m.IsCopy() {
+		s.mergeReadState(ctx, merged, m, channelID, assetType)
+	}
+
+	s.logger.Info(fmt.Sprintf("%d %s of %s merged into %s (%s)", len(merged), assetType.Plural(), m.Source, m.Target, m.Mode))
+
+	return len(merged), nil
+}
+
+// entityComments returns all comments of the merged entity changed by the merge (copies when merge mode is copy)
+func (s *DBStorage) entityComments(ctx context.Context, db *kivik.DB, m comment.EntityMerge, assetType comment.AssetType) ([]mergedComment, error) {
+	var docs []mergedComment
+
+	for {
+		rows, err := db.Find(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{"entity": m.Source.String()},
+			"limit":    mergeBatch,
+			"skip":     len(docs),
+		})
+		if err != nil {
+			return nil, s.mergeError(err, assetType)
+		}
+
+		n := 0
+		for rows.Next() {
+			var c bulkComment
+			if err := rows.ScanDoc(&c); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+
+			docs = append(docs, mergedComment{original: c})
+			n++
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, s.mergeError(err, assetType)
+		}
+
+		if n < mergeBatch {
+			break
+		}
+	}
+
+	copies := map[string]string{}
+	for i := range docs {
+		c := docs[i].original
+		c.Entity = m.Target
+		c.PinnedAt = ""
+		c.PinnedBy = nil
+		if c.OriginalEntity == nil {
+			source := m.Source
+			c.OriginalEntity = &source
+		}
+
+		if m.IsCopy() {
+			uuid, err := repository.GenerateUUID(s.rand)
+			if err != nil {
+				return nil, err
+			}
+
+			copies[c.UUID] = uuid
+			c.ID = uuid
+			c.UUID = uuid
+			c.Rev = ""
+			// read state is not copied, legacy read_by list would be the only one left
+			c.ReadBy = nil
+		}
+
+		docs[i].stored = c
+	}
+
+	for i := range docs {
+		if parent, ok := copies[docs[i].stored.ParentUUID]; ok {
+			docs[i].stored.ParentUUID = parent
+		}
+	}
+
+	return docs, nil
+}
+
+// storeMerged stores the merged comments by one _bulk_docs request and returns the stored ones with their new
+// revision IDs. Comments changed concurrently by another request (conflicts) are skipped and counted.
+func (s *DBStorage) storeMerged(ctx context.Context, db *kivik.DB, docs []mergedComment, m comment.EntityMerge, assetType comment.AssetType) ([]mergedComment, int, error) {
+	bulk := make([]interface{}, 0, len(docs))
+	byID := make(map[string]mergedComment, len(docs))
+	for _, mc := range docs {
+		bulk = append(bulk, mc.stored)
+		byID[mc.stored.ID] = mc
+	}
+
+	results, err := db.BulkDocs(ctx, bulk)
+	if err != nil {
+		return nil, 0, s.mergeError(err, assetType)
+	}
+	defer func() { _ = results.Close() }()
+
+	var stored []mergedComment
+	conflicts := 0
+	var failed error
+	for results.Next() {
+		if err := results.UpdateErr(); err != nil {
+			s.logger.Warn(fmt.Sprintf("%s %s was not merged", assetType, results.ID()), zap.Error(err))
+
+			if kivik.StatusCode(err) == http.StatusConflict && !m.IsCopy() {
+				conflicts++
+				continue
+			}
+
+			failed = s.mergeError(err, assetType)
+			continue
+		}
+
+		mc := byID[results.ID()]
+		mc.stored.Rev = results.Rev()
+		stored = append(stored, mc)
+	}
+
+	if failed != nil {
+		return stored, conflicts, failed
+	}
+
+	return stored, conflicts, results.Err()
+}
+
+// putMergeEvents stores the message returned by events function for UUIDs of the merged comments to the outbox.
+// Comments are merged by several requests, so the message cannot be stored by the same request as them.
+func (s *DBStorage) putMergeEvents(ctx context.Context, db *kivik.DB, uuids []string, m comment.EntityMerge, events func(uuids []string) (*event.Message, error)) error {
+	msg, err := events(uuids)
+	if err != nil || msg == nil {
+		return err
+	}
+
+	if err := s.putOutboxDoc(ctx, db, m.Source.String(), *msg); err != nil {
+		return s.outboxError(err, "Events of the merge could not be stored")
+	}
+
+	return nil
+}
+
+// revertMerge returns already moved comments to the merged entity or deletes already stored copies
+func (s *DBStorage) revertMerge(ctx context.Context, db *kivik.DB, merged []mergedComment, m comment.EntityMerge, assetType comment.AssetType) {
+	docs := make([]interface{}, 0, len(merged))
+	for _, mc := range merged {
+		if m.IsCopy() {
+			docs = append(docs, map[string]interface{}{"_id": mc.stored.ID, "_rev": mc.stored.Rev, "_deleted": true})
+			continue
+		}
+
+		original := mc.original
+		original.Rev = mc.stored.Rev
+		docs = append(docs, original)
+	}
+
+	n, err := s.bulkUpdate(ctx, db, docs)
+	if err != nil || n < len(docs) {
+		s.logger.Error(fmt.Sprintf("could not revert merge of %s of %s (rollback)", assetType.Plural(), m.Source), zap.Error(err))
+	}
+}
+
+// mergeReadState moves read state of the moved comments to the target entity: their read records get the target
+// entity and the watermarks of the merged entity are turned to read records of the moved comments they covered.
+// Failures are only logged, the comments would be counted as unread by some users.
+func (s *DBStorage) mergeReadState(ctx context.Context, merged []mergedComment, m comment.EntityMerge, channelID string, assetType comment.AssetType) {
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+
+	uuids := make([]string, 0, len(merged))
+	for _, mc := range merged {
+		uuids = append(uuids, mc.stored.UUID)
+	}
+
+	rows, err := rsDB.Query(ctx, readStateDesignDocID, "_view/"+readsByCommentView, kivik.Options{
+		"keys":         uuids,
+		"include_docs": true,
+	})
+	if err != nil {
+		s.logger.Warn("read state could not be merged", zap.Error(err))
+		return
+	}
+
+	var docs []interface{}
+	recorded := map[string]bool{}
+	for rows.Next() {
+		var rr readRecord
+		if err := rows.ScanDoc(&rr); err != nil {
+			s.logger.Warn("read state could not be merged", zap.Error(err))
+			_ = rows.Close()
+			return
+		}
+
+		rr.Entity = m.Target.String()
+		docs = append(docs, rr)
+		recorded[rr.ID] = true
+	}
+	_ = rows.Close()
+
+	rows, err = rsDB.Query(ctx, readStateDesignDocID, "_view/"+watermarksByEntityView, kivik.Options{
+		"key":          m.Source.String(),
+		"include_docs": true,
+	})
+	if err != nil {
+		s.logger.Warn("read state could not be merged", zap.Error(err))
+		return
+	}
+
+	for rows.Next() {
+		var wm watermark
+		if err := rows.ScanDoc(&wm); err != nil {
+			s.logger.Warn("read state could not be merged", zap.Error(err))
+			_ = rows.Close()
+			return
+		}
+
+		for _, mc := range merged {
+			c := mc.stored.Comment
+			if c.CreatedAt == "" || wm.ReadUpTo < c.CreatedAt || recorded[readRecordID(wm.User.UUID, c.UUID)] {
+				continue
+			}
+
+			docs = append(docs, newReadRecord(c, wm.ReadBy))
+		}
+	}
+	_ = rows.Close()
+
+	if _, err := s.bulkUpdate(ctx, rsDB, docs); err != nil {
+		s.logger.Warn("read state could not be merged", zap.Error(err))
+	}
+}
+
+func (s *DBStorage) mergeError(err error, assetType comment.AssetType) error {
+	s.logger.Warn("CouchDB request failed", zap.Error(err))
+
+	var httpError *chttp.HTTPError
+	if errors.As(err, &httpError) {
+		eMsg := fmt.Sprintf("%s could not be merged: %s", strings.Title(assetType.Plural()), httpError.Reason)
+		return repository.NewError(eMsg, http.StatusInternalServerError)
+	}
+
+	return err
+}
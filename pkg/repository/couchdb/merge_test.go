@@ -0,0 +1,343 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkResults returns results of _bulk_docs request executed by the test
+type bulkResults struct {
+	results []driver.BulkResult
+}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+
+	*result = r.results[0]
+	r.results = r.results[1:]
+
+	return nil
+}
+
+func (r *bulkResults) Close() error {
+	return nil
+}
+
+func TestMergeEntity(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	parentUUID := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+	replyUUID := "0ac5ebce-17e7-4edc-9552-fefe16e127fb"
+	readerUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+
+	source := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	target := entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
+
+	mergedBy := &comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	parentDoc := []byte(`{
+		"_id":"` + parentUUID + `",
+		"_rev":"2-a",
+		"uuid":"` + parentUUID + `",
+		"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+		"text":"Printer is broken",
+		"created_at":"2021-04-01T12:00:00+02:00",
+		"pinned_at":"2021-04-01T12:10:00+02:00",
+		"pinned_by":{"uuid":"f49d5fd5-8da4-4779-b5ba-32e78aa2c444","name":"Joseph"}
+	}`)
+	replyDoc := []byte(`{
+		"_id":"` + replyUUID + `",
+		"_rev":"1-b",
+		"uuid":"` + replyUUID + `",
+		"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+		"parent_uuid":"` + parentUUID + `",
+		"text":"Still broken",
+		"created_at":"2021-04-02T12:00:00+02:00"
+	}`)
+
+	// storedDocs decodes comments sent by _bulk_docs request
+	storedDocs := func(t *testing.T, docs []interface{}) []map[string]interface{} {
+		b, err := json.Marshal(docs)
+		require.NoError(t, err)
+
+		var stored []map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &stored))
+
+		return stored
+	}
+
+	t.Run("when comments are moved", func(t *testing.T) {
+		m := comment.EntityMerge{Source: source, Target: target, Mode: comment.MergeModeMove, MergedBy: mergedBy}
+
+		var published []string
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: parentUUID, Doc: parentDoc}).
+			AddRow(&driver.Row{ID: replyUUID, Doc: replyDoc}))
+
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			stored := storedDocs(t, docs)
+			require.Len(t, stored, 2)
+
+			assert.Equal(t, parentUUID, stored[0]["_id"])
+			assert.Equal(t, "2-a", stored[0]["_rev"])
+			assert.Equal(t, target.String(), stored[0]["entity"])
+			assert.Equal(t, source.String(), stored[0]["original_entity"])
+			assert.NotContains(t, stored[0], "pinned_at")
+			assert.Equal(t, parentUUID, stored[1]["parent_uuid"])
+
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: parentUUID, Rev: "3-a"},
+				{ID: replyUUID, Rev: "2-b"},
+			}}, nil
+		})
+
+		// events of the merge are stored to the outbox once all comments are merged
+		db.ExpectPut().WillExecute(func(_ context.Context, docID string, doc interface{}, _ map[string]interface{}) (string, error) {
+			assert.True(t, strings.HasPrefix(docID, "_local/outbox:"))
+			assert.True(t, strings.HasSuffix(docID, ":"+source.String()))
+
+			stored := storedDocs(t, []interface{}{doc})
+			assert.Equal(t, channelID, stored[0]["channel_id"])
+			assert.Equal(t, map[string]interface{}{"events": []interface{}{}}, stored[0]["data"])
+
+			return "0-1", nil
+		})
+
+		// read state follows the comments
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "read:" + readerUUID + ":" + replyUUID, Doc: []byte(`{
+				"_id":"read:` + readerUUID + `:` + replyUUID + `",
+				"_rev":"1-c",
+				"type":"read",
+				"comment_uuid":"` + replyUUID + `",
+				"comment_created_at":"2021-04-02T12:00:00+02:00",
+				"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+				"time":"2021-04-02T13:00:00+02:00",
+				"user":{"uuid":"` + readerUUID + `","name":"Jane"}
+			}`)}))
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_entity").WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "watermark:439e2d19-8d50-405d-ad8e-cd33df344086:" + source.String(), Doc: []byte(`{
+				"_id":"watermark:439e2d19-8d50-405d-ad8e-cd33df344086:incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+				"_rev":"1-d",
+				"type":"watermark",
+				"entity":"incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+				"read_up_to":"2021-04-01T12:00:00+02:00",
+				"time":"2021-04-01T14:00:00+02:00",
+				"user":{"uuid":"439e2d19-8d50-405d-ad8e-cd33df344086","name":"Joe"}
+			}`)}))
+		rsDB.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			stored := storedDocs(t, docs)
+			require.Len(t, stored, 2)
+
+			// existing read record is moved to the target entity
+			assert.Equal(t, "read:"+readerUUID+":"+replyUUID, stored[0]["_id"])
+			assert.Equal(t, target.String(), stored[0]["entity"])
+
+			// watermark of the merged entity covered the parent comment only
+			assert.Equal(t, "read:439e2d19-8d50-405d-ad8e-cd33df344086:"+parentUUID, stored[1]["_id"])
+			assert.Equal(t, target.String(), stored[1]["entity"])
+
+			return &bulkResults{}, nil
+		})
+
+		merged, err := s.MergeEntity(context.Background(), m, channelID, comment.AssetTypeComment, func(uuids []string) (*event.Message, error) {
+			published = uuids
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, merged)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+		assert.Equal(t, []string{parentUUID, replyUUID}, published)
+	})
+
+	t.Run("when comments are copied", func(t *testing.T) {
+		m := comment.EntityMerge{Source: source, Target: target, Mode: comment.MergeModeCopy, MergedBy: mergedBy}
+
+		var published []string
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: parentUUID, Doc: parentDoc}).
+			AddRow(&driver.Row{ID: replyUUID, Doc: replyDoc}))
+
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			stored := storedDocs(t, docs)
+			require.Len(t, stored, 2)
+
+			assert.Equal(t, mocks.GeneratedCommentUUID, stored[0]["_id"])
+			assert.Equal(t, mocks.GeneratedCommentUUID, stored[0]["uuid"])
+			assert.NotContains(t, stored[0], "_rev")
+			assert.Equal(t, target.String(), stored[0]["entity"])
+			assert.Equal(t, source.String(), stored[0]["original_entity"])
+
+			// reply is linked to the copy of its parent
+			assert.NotEqual(t, replyUUID, stored[1]["_id"])
+			assert.Equal(t, mocks.GeneratedCommentUUID, stored[1]["parent_uuid"])
+
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: stored[0]["_id"].(string), Rev: "1-a"},
+				{ID: stored[1]["_id"].(string), Rev: "1-b"},
+			}}, nil
+		})
+
+		merged, err := s.MergeEntity(context.Background(), m, channelID, comment.AssetTypeComment, func(uuids []string) (*event.Message, error) {
+			published = uuids
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, merged)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+		assert.Len(t, published, 2)
+	})
+
+	t.Run("when comment was changed concurrently", func(t *testing.T) {
+		m := comment.EntityMerge{Source: source, Target: target, Mode: comment.MergeModeMove, MergedBy: mergedBy}
+
+		var published []string
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: parentUUID, Doc: parentDoc}).
+			AddRow(&driver.Row{ID: replyUUID, Doc: replyDoc}))
+		db.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: parentUUID, Rev: "3-a"}).
+			AddResult(&driver.BulkResult{ID: replyUUID, Error: &chttp.HTTPError{
+				Response: &http.Response{
+					StatusCode: http.StatusConflict,
+				},
+			}}))
+
+		// only the changed comment is left in the merged entity
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: replyUUID, Doc: replyDoc}))
+		db.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: replyUUID, Rev: "3-b"}))
+
+		mocks.ExpectEmptyReadState(couchMock, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+		merged, err := s.MergeEntity(context.Background(), m, channelID, comment.AssetTypeComment, func(uuids []string) (*event.Message, error) {
+			published = uuids
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, merged)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+		assert.Equal(t, []string{parentUUID, replyUUID}, published)
+	})
+
+	t.Run("when events are not prepared", func(t *testing.T) {
+		m := comment.EntityMerge{Source: source, Target: target, Mode: comment.MergeModeMove, MergedBy: mergedBy}
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: parentUUID, Doc: parentDoc}))
+		db.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: parentUUID, Rev: "3-a"}))
+
+		// the moved comment is returned to the merged entity
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			stored := storedDocs(t, docs)
+			require.Len(t, stored, 1)
+
+			assert.Equal(t, "3-a", stored[0]["_rev"])
+			assert.Equal(t, source.String(), stored[0]["entity"])
+			assert.NotContains(t, stored[0], "original_entity")
+			assert.Contains(t, stored[0], "pinned_at")
+
+			return &bulkResults{results: []driver.BulkResult{{ID: parentUUID, Rev: "4-a"}}}, nil
+		})
+
+		merged, err := s.MergeEntity(context.Background(), m, channelID, comment.AssetTypeComment, func(uuids []string) (*event.Message, error) {
+			assert.Equal(t, []string{parentUUID}, uuids)
+			return nil, assert.AnError
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 0, merged)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when events of the merge are not stored", func(t *testing.T) {
+		m := comment.EntityMerge{Source: source, Target: target, Mode: comment.MergeModeMove, MergedBy: mergedBy}
+
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: parentUUID, Doc: parentDoc}))
+		db.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: parentUUID, Rev: "3-a"}))
+
+		// comments are merged by several requests, so the outbox document is stored separately
+		db.ExpectPut().WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+			},
+		})
+
+		// the moved comment is returned to the merged entity
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			stored := storedDocs(t, docs)
+			require.Len(t, stored, 1)
+
+			assert.Equal(t, "3-a", stored[0]["_rev"])
+			assert.Equal(t, source.String(), stored[0]["entity"])
+
+			return &bulkResults{results: []driver.BulkResult{{ID: parentUUID, Rev: "4-a"}}}, nil
+		})
+
+		merged, err := s.MergeEntity(context.Background(), m, channelID, comment.AssetTypeComment, func(uuids []string) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "Events of the merge could not be stored"))
+		assert.Equal(t, 0, merged)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,331 @@
+package couchdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	// outboxDocPrefix is the prefix of IDs of outbox documents, the rest of the ID starts with the time
+	// the document was created at, so _local_docs returns them in the order they were stored
+	outboxDocPrefix = "_local/outbox:"
+
+	// outboxTimeFormat is sortable format of the creation time in outbox document ID
+	outboxTimeFormat = "20060102T150405.000000000Z"
+
+	// defaultOutboxScanInterval is the default interval of checks of all databases for pending messages
+	defaultOutboxScanInterval = time.Hour
+)
+
+// outboxDoc is the message of events stored as local (non-replicated and non-indexed) document
+// in the database of the changed comment, so it does not appear in comment queries.
+// It is deleted once the message is published.
+type outboxDoc struct {
+	ID  string `json:"_id"`
+	Rev string `json:"_rev,omitempty"`
+	event.Message
+	CreatedAt string `json:"created_at"`
+	// SentAt is set only in documents of published messages stored by older versions of the service
+	SentAt string `json:"sent_at,omitempty"`
+}
+
+// newOutboxDoc returns outbox document of the message of events of the change of the document with specified ID
+func newOutboxDoc(docID string, msg event.Message) outboxDoc {
+	now := time.Now().UTC()
+
+	return outboxDoc{
+		ID:        fmt.Sprintf("%s%s:%s", outboxDocPrefix, now.Format(outboxTimeFormat), docID),
+		Message:   msg,
+		CreatedAt: now.Format(time.RFC3339Nano),
+	}
+}
+
+// putWithOutbox stores the document (with _id field) and the outbox document of the message (if not nil) by one
+// _bulk_docs request and returns the new revision ID of the document and the stored outbox document. CouchDB stores
+// documents of the request one by one, so the outbox document is removed again if the document was not stored
+// and it is stored again if only the document was stored. If that fails too, the error is returned, so the change
+// is not acknowledged without its events; the document created by the request is removed again, so the request
+// can be retried.
+func (s *DBStorage) putWithOutbox(ctx context.Context, db *kivik.DB, id string, doc interface{}, msg *event.Message) (string, *outboxDoc, error) {
+	if msg == nil {
+		rev, err := db.Put(ctx, id, doc)
+		return rev, nil, err
+	}
+
+	od := newOutboxDoc(id, *msg)
+
+	results, err := db.BulkDocs(ctx, []interface{}{doc, od})
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = results.Close() }()
+
+	var rev string
+	docErr := fmt.Errorf("document %s was not stored", id)
+	outboxErr := fmt.Errorf("document %s was not stored", od.ID)
+	for results.Next() {
+		switch results.ID() {
+		case id:
+			rev, docErr = results.Rev(), results.UpdateErr()
+		case od.ID:
+			od.Rev, outboxErr = results.Rev(), results.UpdateErr()
+		}
+	}
+
+	if err := results.Err(); err != nil {
+		return "", nil, err
+	}
+
+	if docErr != nil {
+		if outboxErr == nil {
+			s.removeOutboxDoc(ctx, db, od)
+		}
+
+		return "", nil, docErr
+	}
+
+	if outboxErr != nil {
+		s.logger.Warn(fmt.Sprintf("outbox document of %s was not stored with it", id), zap.Error(outboxErr))
+
+		od.Rev = ""
+		if od.Rev, err = db.Put(ctx, od.ID, od); err != nil {
+			s.logger.Error(fmt.Sprintf("events of %s could not be stored to the outbox", id), zap.Error(err))
+
+			if strings.HasPrefix(rev, "1-") {
+				s.removeDoc(ctx, db, id, rev)
+			}
+
+			eMsg := fmt.Sprintf("events of %s could not be stored to the outbox", id)
+			return "", nil, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+	}
+
+	s.addOutboxDatabase(db.Name())
+
+	return rev, &od, nil
+}
+
+// putOutboxDoc stores the outbox document of the message of events of the change of the document with specified ID
+func (s *DBStorage) putOutboxDoc(ctx context.Context, db *kivik.DB, id string, msg event.Message) error {
+	od := newOutboxDoc(id, msg)
+
+	if _, err := db.Put(ctx, od.ID, od); err != nil {
+		return err
+	}
+
+	s.addOutboxDatabase(db.Name())
+
+	return nil
+}
+
+// removeOutboxDoc deletes the outbox document of the change that was not stored (rollback)
+func (s *DBStorage) removeOutboxDoc(ctx context.Context, db *kivik.DB, od outboxDoc) {
+	if _, err := db.Delete(ctx, od.ID, od.Rev); err != nil {
+		s.logger.Error(fmt.Sprintf("could not delete %s (rollback)", od.ID), zap.Error(err))
+	}
+}
+
+// removeDoc deletes the document created by the change whose events were not stored (rollback)
+func (s *DBStorage) removeDoc(ctx context.Context, db *kivik.DB, id, rev string) {
+	if _, err := db.Delete(ctx, id, rev); err != nil {
+		s.logger.Error(fmt.Sprintf("could not delete %s (rollback)", id), zap.Error(err))
+	}
+}
+
+// deleteOutboxDoc deletes the outbox document of the published message, failures are only logged
+// as the document is deleted again by the next check of the database
+func (s *DBStorage) deleteOutboxDoc(ctx context.Context, db *kivik.DB, od outboxDoc) {
+	if _, err := db.Delete(ctx, od.ID, od.Rev); err != nil {
+		s.logger.Warn(fmt.Sprintf("could not delete %s", od.ID), zap.Error(err))
+	}
+}
+
+// addOutboxDatabase records the database with messages not published yet
+func (s *DBStorage) addOutboxDatabase(dbName string) {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	if s.outboxDBs == nil {
+		s.outboxDBs = make(map[string]bool)
+	}
+
+	s.outboxDBs[dbName] = true
+}
+
+// outboxDatabases returns databases that may contain messages not published yet and forgets them, they are
+// recorded again if they still contain some. All comment and read state databases are returned by the first call
+// and then once per outboxScanInterval (see Config).
+func (s *DBStorage) outboxDatabases(ctx context.Context) ([]string, error) {
+	s.outboxMu.Lock()
+	scan := time.Since(s.outboxScannedAt) >= s.outboxScanInterval
+	dbs := make([]string, 0, len(s.outboxDBs))
+	for name := range s.outboxDBs {
+		dbs = append(dbs, name)
+	}
+	s.outboxDBs = nil
+	s.outboxMu.Unlock()
+
+	if !scan {
+		// the same order as returned by _all_dbs
+		sort.Strings(dbs)
+		return dbs, nil
+	}
+
+	all, err := s.client.AllDBs(ctx)
+	if err != nil {
+		// recorded databases are not forgotten
+		for _, name := range dbs {
+			s.addOutboxDatabase(name)
+		}
+
+		return nil, err
+	}
+
+	dbs = dbs[:0]
+	for _, name := range all {
+		if isOutboxDatabase(name) {
+			dbs = append(dbs, name)
+		}
+	}
+
+	s.outboxMu.Lock()
+	s.outboxScannedAt = time.Now()
+	s.outboxMu.Unlock()
+
+	return dbs, nil
+}
+
+// isOutboxDatabase returns true if the database name is the name of the database of comments or read state
+// of some asset type, the outbox documents are stored there
+func isOutboxDatabase(name string) bool {
+	return strings.HasPrefix(name, "p_") && !strings.HasSuffix(name, "_templates")
+}
+
+// PendingMessages returns at most limit messages of the outbox not marked as sent yet, the oldest first.
+// Outbox documents are kept in databases of the changed comments or their read state, IDs of the messages consist
+// of the database name and the document ID.
+func (s *DBStorage) PendingMessages(ctx context.Context, limit int) ([]event.OutboxMessage, error) {
+	dbs, err := s.outboxDatabases(ctx)
+	if err != nil {
+		return nil, s.outboxError(err, "Outbox messages could not be retrieved")
+	}
+
+	var pending []event.OutboxMessage
+	for i, name := range dbs {
+		msgs, err := s.pendingOutboxMessages(ctx, name, limit)
+		if err != nil {
+			for _, name := range dbs[i:] {
+				s.addOutboxDatabase(name)
+			}
+
+			return nil, s.outboxError(err, "Outbox messages could not be retrieved")
+		}
+
+		if len(msgs) > 0 {
+			s.addOutboxDatabase(name)
+			pending = append(pending, msgs...)
+		}
+	}
+
+	// document IDs start with the creation time
+	sort.SliceStable(pending, func(i, j int) bool {
+		return outboxDocID(pending[i].ID) < outboxDocID(pending[j].ID)
+	})
+
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	return pending, nil
+}
+
+// pendingOutboxMessages returns at most limit messages of the database not published yet, the oldest first.
+// Documents of published messages stored by older versions of the service are deleted.
+func (s *DBStorage) pendingOutboxMessages(ctx context.Context, dbName string, limit int) ([]event.OutboxMessage, error) {
+	db := s.client.DB(ctx, dbName)
+
+	rows, err := db.LocalDocs(ctx, kivik.Options{
+		"startkey":     outboxDocPrefix,
+		"endkey":       outboxDocPrefix + "\ufff0",
+		"include_docs": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var msgs []event.OutboxMessage
+	var sent []outboxDoc
+	for rows.Next() && len(msgs) < limit {
+		var od outboxDoc
+		if err := rows.ScanDoc(&od); err != nil {
+			return nil, err
+		}
+
+		if od.SentAt != "" {
+			sent = append(sent, od)
+			continue
+		}
+
+		msgs = append(msgs, event.OutboxMessage{ID: dbName + "/" + od.ID, Message: od.Message})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, od := range sent {
+		s.deleteOutboxDoc(ctx, db, od)
+	}
+
+	return msgs, nil
+}
+
+// MarkSent deletes the outbox document of the published message
+func (s *DBStorage) MarkSent(ctx context.Context, m event.OutboxMessage) error {
+	dbName := strings.SplitN(m.ID, "/", 2)[0]
+	db := s.client.DB(ctx, dbName)
+
+	var od outboxDoc
+	err := db.Get(ctx, outboxDocID(m.ID)).ScanDoc(&od)
+	if kivik.StatusCode(err) == http.StatusNotFound {
+		// the message was marked concurrently (by another instance of the service)
+		return nil
+	}
+	if err != nil {
+		return s.outboxError(err, "Outbox message could not be marked as sent")
+	}
+
+	_, err = db.Delete(ctx, od.ID, od.Rev)
+	if code := kivik.StatusCode(err); code == http.StatusConflict || code == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return s.outboxError(err, "Outbox message could not be marked as sent")
+	}
+
+	return nil
+}
+
+// outboxDocID returns ID of the outbox document from ID of the outbox message
+func outboxDocID(messageID string) string {
+	parts := strings.SplitN(messageID, "/", 2)
+
+	return parts[len(parts)-1]
+}
+
+// outboxError logs the failed request and returns internal server error with the message prefix
+func (s *DBStorage) outboxError(err error, prefix string) error {
+	s.logger.Warn("CouchDB request failed", zap.Error(err))
+
+	return repository.NewError(fmt.Sprintf("%s: %s", prefix, err), http.StatusInternalServerError)
+}
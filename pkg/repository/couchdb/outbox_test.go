@@ -0,0 +1,146 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	commentsDB := testutils.DatabaseName(channelID, comment.AssetTypeComment)
+	worknotesDB := testutils.DatabaseName(channelID, comment.AssetTypeWorknote)
+
+	outboxRow := func(id, data, sentAt string) *driver.Row {
+		doc := `{"_id":"` + id + `","_rev":"0-1","channel_id":"` + channelID + `","data":` + data + `,"created_at":"2021-04-01T12:00:00Z"`
+		if sentAt != "" {
+			doc += `,"sent_at":"` + sentAt + `"`
+		}
+
+		return &driver.Row{ID: id, Doc: []byte(doc + "}")}
+	}
+
+	t.Run("pending messages of all comment and read state databases", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		readStateDB := testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)
+		couchMock.ExpectAllDBs().WillReturn([]string{
+			"_users",
+			commentsDB,
+			readStateDB,
+			testutils.TemplateDatabaseName(channelID),
+			worknotesDB,
+		})
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(commentsDB).WillReturn(db)
+		db.ExpectLocalDocs().WillReturn(kivikmock.NewRows().
+			AddRow(outboxRow("_local/outbox:20210401T120000.000000000Z:a", `{"events":[1]}`, "2021-04-01T12:00:01Z")).
+			AddRow(outboxRow("_local/outbox:20210401T120002.000000000Z:b", `{"events":[3]}`, "")))
+
+		// the message published by older version of the service is deleted
+		db.ExpectDelete().WithDocID("_local/outbox:20210401T120000.000000000Z:a").WithRev("0-1")
+
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(readStateDB).WillReturn(rsDB)
+		rsDB.ExpectLocalDocs().WillReturn(kivikmock.NewRows())
+
+		wnDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(worknotesDB).WillReturn(wnDB)
+		wnDB.ExpectLocalDocs().WillReturn(kivikmock.NewRows().
+			AddRow(outboxRow("_local/outbox:20210401T120001.000000000Z:c", `{"events":[2]}`, "")))
+
+		msgs, err := s.PendingMessages(context.Background(), 10)
+		require.NoError(t, err)
+		require.Len(t, msgs, 2)
+
+		// the oldest first
+		assert.Equal(t, worknotesDB+"/_local/outbox:20210401T120001.000000000Z:c", msgs[0].ID)
+		assert.Equal(t, event.UUID(channelID), msgs[0].ChannelID)
+		assert.JSONEq(t, `{"events":[2]}`, string(msgs[0].Data))
+		assert.Equal(t, commentsDB+"/_local/outbox:20210401T120002.000000000Z:b", msgs[1].ID)
+
+		// only databases with pending messages are checked until the next scan
+		couchMock.ExpectDB().WithName(commentsDB).WillReturn(db)
+		db.ExpectLocalDocs().WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(worknotesDB).WillReturn(wnDB)
+		wnDB.ExpectLocalDocs().WillReturn(kivikmock.NewRows())
+
+		msgs, err = s.PendingMessages(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Empty(t, msgs)
+
+		msgs, err = s.PendingMessages(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Empty(t, msgs)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("message is marked as sent", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		docID := "_local/outbox:20210401T120002.000000000Z:b"
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(commentsDB).WillReturn(db)
+		row, err := kivikmock.Document(json.RawMessage(outboxRow(docID, `{"events":[3]}`, "").Doc))
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+
+		// the outbox document is deleted, so it is not read again by the next check
+		db.ExpectDelete().WithDocID(docID).WithRev("0-1")
+
+		err = s.MarkSent(context.Background(), event.OutboxMessage{ID: commentsDB + "/" + docID})
+		require.NoError(t, err)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("message marked as sent concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		docID := "_local/outbox:20210401T120002.000000000Z:b"
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(commentsDB).WillReturn(db)
+		row, err := kivikmock.Document(json.RawMessage(outboxRow(docID, `{"events":[3]}`, "").Doc))
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(docID).WillReturn(row)
+		db.ExpectDelete().WithDocID(docID).WithRev("0-1").WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+		})
+
+		err = s.MarkSent(context.Background(), event.OutboxMessage{ID: commentsDB + "/" + docID})
+		assert.NoError(t, err)
+
+		// the document was already deleted
+		couchMock.ExpectDB().WithName(commentsDB).WillReturn(db)
+		db.ExpectGet().WithDocID(docID).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		})
+
+		err = s.MarkSent(context.Background(), event.OutboxMessage{ID: commentsDB + "/" + docID})
+		assert.NoError(t, err)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
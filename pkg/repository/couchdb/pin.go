@@ -0,0 +1,128 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// pinLockTTL is the longest time the pin lock of the entity is held, the lock left by a stopped instance
+// of the service expires after it
+const pinLockTTL = 30 * time.Second
+
+// pinLockDoc is the lock of pinning of comments of one entity stored as local (non-replicated and non-indexed)
+// document in the database of the asset type while a comment of the entity is being pinned
+type pinLockDoc struct {
+	Rev       string `json:"_rev,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// PinComment lets modify function pin the comment with specified ID like UpdateComment does, modify gets the number
+// of pinned comments of its entity that are not deleted. Comments of one entity are pinned one by one: the pin lock
+// of the entity is held until the comment is stored, so the number does not change in the meantime.
+func (s *DBStorage) PinComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment, pinned int) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	rc, err := s.getRevisedComment(ctx, db, id, assetType, "pinned")
+	if err != nil {
+		return rc.Comment, false, err
+	}
+
+	unlock, err := s.lockPins(ctx, db, rc.Entity, assetType)
+	if err != nil {
+		return rc.Comment, false, err
+	}
+	defer unlock()
+
+	pinned, err := s.countPinned(ctx, db, rc.Entity, assetType)
+	if err != nil {
+		return rc.Comment, false, err
+	}
+
+	rc, stored, err := s.modifyComment(ctx, db, id, assetType, "pinned", func(c *comment.Comment) (bool, error) {
+		return modify(c, pinned)
+	}, events)
+	if err != nil {
+		return rc.Comment, false, err
+	}
+
+	if stored == nil {
+		return rc.Comment, false, nil
+	}
+
+	s.logger.Info(fmt.Sprintf("%s pinned %s", strings.Title(assetType.String()), id))
+
+	return stored.Comment, true, nil
+}
+
+// lockPins stores the pin lock of the entity, it is retried (see retryOnConflict) while the lock is held
+// by another request. It returns the function removing the lock.
+func (s *DBStorage) lockPins(ctx context.Context, db *kivik.DB, e entity.Entity, assetType comment.AssetType) (func(), error) {
+	id := pinLockDocID(e)
+	title := strings.Title(assetType.String())
+
+	var rev string
+	err := s.retryOnConflict(ctx, id, func() error {
+		lock := pinLockDoc{ExpiresAt: time.Now().Add(pinLockTTL).UTC().Format(time.RFC3339Nano)}
+
+		var err error
+		rev, err = db.Put(ctx, id, lock)
+		if kivik.StatusCode(err) == http.StatusConflict {
+			var stored pinLockDoc
+			if err = db.Get(ctx, id).ScanDoc(&stored); err == nil {
+				if expiresAt, _ := time.Parse(time.RFC3339Nano, stored.ExpiresAt); time.Now().Before(expiresAt) {
+					eMsg := fmt.Sprintf("%s could not be pinned: %s of entity '%s' are being pinned", title, assetType.Plural(), e)
+					return revisionConflict(ErrorConflict(eMsg))
+				}
+
+				// the lock was left by a stopped instance of the service
+				lock.Rev = stored.Rev
+				rev, err = db.Put(ctx, id, lock)
+			}
+		}
+
+		if err != nil {
+			s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+			var httpError *chttp.HTTPError
+			if errors.As(err, &httpError) {
+				eMsg := fmt.Sprintf("%s could not be pinned: %s", title, httpError.Reason)
+				if httpError.StatusCode() == http.StatusConflict || httpError.StatusCode() == http.StatusNotFound {
+					// the lock was changed concurrently
+					return revisionConflict(ErrorConflict(eMsg))
+				}
+
+				return repository.NewError(eMsg, http.StatusInternalServerError)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if _, err := db.Delete(ctx, id, rev); err != nil {
+			s.logger.Warn(fmt.Sprintf("could not delete %s, it expires in %s", id, pinLockTTL), zap.Error(err))
+		}
+	}, nil
+}
+
+func pinLockDocID(e entity.Entity) string {
+	return "_local/pin_lock_" + e.String()
+}
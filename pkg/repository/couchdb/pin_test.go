@@ -0,0 +1,161 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinComment(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+	lockID := "_local/pin_lock_incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
+
+	dbC := comment.Comment{
+		UUID:   uuid,
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		Text:   "Some comment",
+	}
+
+	pinnedQuery := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"pinned_at":  map[string]interface{}{"$exists": true},
+			"deleted_at": map[string]interface{}{"$exists": false},
+		},
+		"fields": []string{"uuid"},
+		"limit":  1000,
+	}
+
+	conflict := &chttp.HTTPError{
+		Response: &http.Response{
+			StatusCode: http.StatusConflict,
+		},
+	}
+
+	pin := func(c *comment.Comment, pinned int) (bool, error) {
+		if pinned >= 1 {
+			return false, repository.NewError("Comment could not be pinned: maximum number of pinned comments (1) reached", http.StatusConflict)
+		}
+
+		c.PinnedAt = "2021-04-01T12:34:56Z"
+		return true, nil
+	}
+
+	expectComment := func(db *kivikmock.DB) {
+		row, err := kivikmock.Document(dbC)
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+	}
+
+	expectLock := func(db *kivikmock.DB, expiresAt time.Time) {
+		row, err := kivikmock.Document(map[string]interface{}{
+			"_id":        lockID,
+			"_rev":       "0-1",
+			"expires_at": expiresAt.UTC().Format(time.RFC3339Nano),
+		})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(lockID).WillReturn(row)
+	}
+
+	t.Run("when entity has no pinned comments", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		expectComment(db)
+		db.ExpectPut().WithDocID(lockID).WillReturn("0-1")
+		db.ExpectFind().WithQuery(pinnedQuery).WillReturn(kivikmock.NewRows())
+		expectComment(db)
+		expectBulkDocsWithOutbox(t, db, uuid, "2-a")
+		db.ExpectDelete().WithDocID(lockID).WithRev("0-1")
+
+		res, changed, err := s.PinComment(context.Background(), uuid, channelID, comment.AssetTypeComment, pin, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "2021-04-01T12:34:56Z", res.PinnedAt)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when limit of pinned comments is reached", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		expectComment(db)
+		db.ExpectPut().WithDocID(lockID).WillReturn("0-1")
+		db.ExpectFind().WithQuery(pinnedQuery).WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Doc: []byte(`{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb"}`)}))
+		expectComment(db)
+		db.ExpectDelete().WithDocID(lockID).WithRev("0-1")
+
+		_, _, err := s.PinComment(context.Background(), uuid, channelID, comment.AssetTypeComment, pin, nil)
+		assert.EqualError(t, err, "Comment could not be pinned: maximum number of pinned comments (1) reached")
+
+		assert.NoError(t, couchMock.ExpectationsWereMet(), "the lock is removed")
+	})
+
+	t.Run("when lock was left by stopped instance of the service", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		expectComment(db)
+		db.ExpectPut().WithDocID(lockID).WillReturnError(conflict)
+		expectLock(db, time.Now().Add(-time.Minute))
+		db.ExpectPut().WithDocID(lockID).WillReturn("0-2")
+		db.ExpectFind().WithQuery(pinnedQuery).WillReturn(kivikmock.NewRows())
+		expectComment(db)
+		db.ExpectPut().WithDocID(uuid)
+		db.ExpectDelete().WithDocID(lockID).WithRev("0-2")
+
+		_, changed, err := s.PinComment(context.Background(), uuid, channelID, comment.AssetTypeComment, pin, nil)
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comments of entity keep being pinned concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		expectComment(db)
+
+		// default number of attempts
+		for i := 0; i < 5; i++ {
+			db.ExpectPut().WithDocID(lockID).WillReturnError(conflict)
+			expectLock(db, time.Now().Add(time.Minute))
+		}
+
+		_, _, err := s.PinComment(context.Background(), uuid, channelID, comment.AssetTypeComment, pin, nil)
+		assert.EqualError(t, err, "Comment could not be pinned: comments of entity 'incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444' are being pinned")
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusConflict, httpError.StatusCode())
+
+		assert.NoError(t, couchMock.ExpectationsWereMet(), "nothing is counted or stored")
+	})
+}
@@ -0,0 +1,256 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// MarkAllAsReadByUser moves the user's read watermark of the entity to upTo (to the newest comment if upTo is empty),
+// so all comments of the entity created at or before upTo are read by the user. The message returned by events
+// function (if not nil) for upTo is stored to the outbox of the read state database by the same request
+// as the watermark if some comments were not read by the user before.
+// It returns the number of comments which were not read by the user before.
+func (s *DBStorage) MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(upTo string) (*event.Message, error)) (int, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+	userUUID := readBy.User.UUID
+
+	if err := s.ensureReadState(ctx, db, channelID, assetType); err != nil {
+		return 0, s.markAllError(err, assetType)
+	}
+
+	if upTo == "" {
+		newest, err := newestCreatedAt(ctx, db, e.String())
+		if err != nil {
+			return 0, s.markAllError(err, assetType)
+		}
+
+		if newest == "" {
+			// no comments
+			return 0, nil
+		}
+
+		upTo = newest
+	}
+
+	marked := 0
+	covered := false
+	err := s.retryOnConflict(ctx, watermarkID(userUUID, e.String()), func() error {
+		wm, err := s.getWatermark(ctx, userUUID, e.String(), channelID, assetType)
+		if err != nil {
+			return err
+		}
+
+		if wm == nil {
+			wm = &watermark{
+				ID:     watermarkID(userUUID, e.String()),
+				Type:   watermarkType,
+				Entity: e.String(),
+			}
+		}
+
+		if wm.ReadUpTo >= upTo {
+			covered = true
+			return nil
+		}
+
+		// comments created between the previous and the new watermark minus the ones read one by one
+		created, err := countAfter(ctx, db, countersDesignDocID, createdView, []interface{}{e.String()}, wm.ReadUpTo)
+		if err != nil {
+			return s.markAllError(err, assetType)
+		}
+		createdAfterUpTo, err := countAfter(ctx, db, countersDesignDocID, createdView, []interface{}{e.String()}, upTo)
+		if err != nil {
+			return s.markAllError(err, assetType)
+		}
+		read, err := countAfter(ctx, rsDB, readStateDesignDocID, readsByUserView, []interface{}{userUUID, e.String()}, wm.ReadUpTo)
+		if err != nil {
+			return s.markAllError(err, assetType)
+		}
+		readAfterUpTo, err := countAfter(ctx, rsDB, readStateDesignDocID, readsByUserView, []interface{}{userUUID, e.String()}, upTo)
+		if err != nil {
+			return s.markAllError(err, assetType)
+		}
+
+		marked = (created - createdAfterUpTo) - (read - readAfterUpTo)
+		if marked < 0 {
+			marked = 0
+		}
+
+		wm.ReadUpTo = upTo
+		wm.ReadBy = readBy
+
+		var msg *event.Message
+		if marked > 0 && events != nil {
+			if msg, err = events(upTo); err != nil {
+				return err
+			}
+		}
+
+		_, _, err = s.putWithOutbox(ctx, rsDB, wm.ID, wm, msg)
+		if err != nil {
+			s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+			if kivik.StatusCode(err) == http.StatusConflict {
+				// the same user marked the entity concurrently
+				return revisionConflict(ErrorConflict(fmt.Sprintf("%s could not be marked as read", strings.Title(assetType.Plural()))))
+			}
+
+			var httpError *chttp.HTTPError
+			if errors.As(err, &httpError) {
+				return s.markAllError(err, assetType)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil || covered {
+		return 0, err
+	}
+
+	// read records covered by the watermark are not needed anymore
+	s.pruneReadRecords(ctx, rsDB, userUUID, e.String(), upTo)
+
+	s.logger.Info(fmt.Sprintf("%d %s of %s marked as read", marked, assetType.Plural(), e))
+
+	return marked, nil
+}
+
+func (s *DBStorage) markAllError(err error, assetType comment.AssetType) error {
+	s.logger.Warn("CouchDB QUERY failed", zap.Error(err))
+
+	var httpError *chttp.HTTPError
+	if errors.As(err, &httpError) {
+		eMsg := fmt.Sprintf("%s could not be marked as read: %s", strings.Title(assetType.Plural()), httpError.Reason)
+		return repository.NewError(eMsg, http.StatusInternalServerError)
+	}
+
+	return err
+}
+
+// newestCreatedAt returns created_at of the newest not deleted comment of the entity or empty string if there is none
+func newestCreatedAt(ctx context.Context, db *kivik.DB, e string) (string, error) {
+	rows, err := db.Query(ctx, countersDesignDocID, "_view/"+createdView, kivik.Options{
+		"reduce":     false,
+		"descending": true,
+		"startkey":   []interface{}{e, map[string]interface{}{}},
+		"endkey":     []interface{}{e},
+		"limit":      1,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+
+	var key []string
+	if err := rows.ScanKey(&key); err != nil {
+		return "", err
+	}
+
+	if len(key) != 2 {
+		return "", nil
+	}
+
+	return key[1], nil
+}
+
+// pruneReadRecords deletes the user's read records of the entity comments created at or before upTo,
+// failures are only logged as the records are redundant
+func (s *DBStorage) pruneReadRecords(ctx context.Context, rsDB *kivik.DB, userUUID, e, upTo string) {
+	rows, err := rsDB.Query(ctx, readStateDesignDocID, "_view/"+readsByUserView, kivik.Options{
+		"reduce":   false,
+		"startkey": []interface{}{userUUID, e},
+		"endkey":   []interface{}{userUUID, e, upTo},
+	})
+	if err != nil {
+		s.logger.Warn("read records could not be pruned", zap.Error(err))
+		return
+	}
+
+	var docs []interface{}
+	for rows.Next() {
+		var rev string
+		if err := rows.ScanValue(&rev); err != nil {
+			s.logger.Warn("read records could not be pruned", zap.Error(err))
+			_ = rows.Close()
+			return
+		}
+
+		docs = append(docs, map[string]interface{}{"_id": rows.ID(), "_rev": rev, "_deleted": true})
+	}
+	_ = rows.Close()
+
+	if _, err := s.bulkUpdate(ctx, rsDB, docs); err != nil {
+		s.logger.Warn("read records could not be pruned", zap.Error(err))
+	}
+}
+
+// bulkUpdate stores the documents by one _bulk_docs request and returns the number of updated documents,
+// documents changed concurrently by another request (conflicts) are skipped
+func (s *DBStorage) bulkUpdate(ctx context.Context, db *kivik.DB, docs []interface{}) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	results, err := db.BulkDocs(ctx, docs)
+	if err != nil {
+		s.logger.Warn("CouchDB BULK DOCS failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Documents could not be updated: %s", httpError.Reason)
+			return 0, repository.NewError(eMsg, httpError.StatusCode())
+		}
+
+		return 0, err
+	}
+	defer func() { _ = results.Close() }()
+
+	updated := 0
+	for results.Next() {
+		if err := results.UpdateErr(); err != nil {
+			s.logger.Warn(fmt.Sprintf("document %s was not updated", results.ID()), zap.Error(err))
+			continue
+		}
+
+		updated++
+	}
+
+	return updated, results.Err()
+}
+
+// bulkComment is the comment with document ID and revision ID required by _bulk_docs request
+type bulkComment struct {
+	ID  string `json:"_id"`
+	Rev string `json:"_rev,omitempty"`
+	comment.Comment
+}
+
+// readByUser returns true if the user is in the read_by list
+func readByUser(list comment.ReadByList, userUUID string) bool {
+	for _, rb := range list {
+		if rb.User.UUID == userUUID {
+			return true
+		}
+	}
+
+	return false
+}
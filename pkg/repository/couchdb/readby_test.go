@@ -0,0 +1,133 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkAllAsReadByUser(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	userUUID := "439e2d19-8d50-405d-ad8e-cd33df344086"
+	newest := "2021-04-01T12:34:56+02:00"
+
+	readBy := comment.ReadBy{
+		Time: "2021-04-01T12:40:00+02:00",
+		User: comment.UserInfo{
+			UUID: userUUID,
+			Name: "Joe",
+		},
+	}
+
+	t.Run("when up_to is not set", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		mocks.ExpectReadStateReady(couchMock, db, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+		// up_to is not set, the newest comment is used
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{ID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Key: []byte(`["` + e.String() + `","` + newest + `"]`), Value: []byte(`null`)}))
+
+		// no previous watermark
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		rsDB.ExpectGet().WithDocID("watermark:" + userUUID + ":" + e.String()).
+			WillReturnError(&chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusNotFound}})
+
+		// 5 comments, 2 of them read one by one
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`5`)}))
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows())
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`2`)}))
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+			WillReturn(kivikmock.NewRows())
+
+		expectBulkDocsWithOutbox(t, rsDB, "watermark:"+userUUID+":"+e.String(), "1-w")
+
+		// read records covered by the watermark are deleted
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+			WithOptions(map[string]interface{}{
+				"reduce":   false,
+				"startkey": []interface{}{userUUID, e.String()},
+				"endkey":   []interface{}{userUUID, e.String(), newest},
+			}).
+			WillReturn(kivikmock.NewRows().
+				AddRow(&driver.Row{ID: "read:" + userUUID + ":c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", Value: []byte(`"1-a"`)}).
+				AddRow(&driver.Row{ID: "read:" + userUUID + ":cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0", Value: []byte(`"1-b"`)}))
+		rsDB.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().
+			AddResult(&driver.BulkResult{ID: "read:" + userUUID + ":c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", Rev: "2-a"}).
+			AddResult(&driver.BulkResult{ID: "read:" + userUUID + ":cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0", Rev: "2-b"}))
+
+		marked, err := s.MarkAllAsReadByUser(context.Background(), e, "", readBy, channelID, comment.AssetTypeComment, func(upTo string) (*event.Message, error) {
+			assert.Equal(t, newest, upTo)
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, marked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when watermark was moved concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		upTo := "2021-04-01T12:00:00+02:00"
+		wmID := "watermark:" + userUUID + ":" + e.String()
+
+		db := couchMock.NewDB()
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		mocks.ExpectReadStateReady(couchMock, db, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+		// first attempt creates the watermark, which was created by another request of the user in the meantime
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		rsDB.ExpectGet().WithDocID(wmID).
+			WillReturnError(&chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusNotFound}})
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`2`)}))
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows())
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+			WillReturn(kivikmock.NewRows())
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+			WillReturn(kivikmock.NewRows())
+		rsDB.ExpectPut().WithDocID(wmID).
+			WillReturnError(&chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusConflict}})
+
+		// second attempt finds the watermark already covering up_to
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		row, err := kivikmock.Document(map[string]interface{}{
+			"_id":        wmID,
+			"_rev":       "1-a",
+			"type":       "watermark",
+			"entity":     e.String(),
+			"read_up_to": upTo,
+		})
+		assert.NoError(t, err)
+		rsDB.ExpectGet().WithDocID(wmID).WillReturn(row)
+
+		marked, err := s.MarkAllAsReadByUser(context.Background(), e, upTo, readBy, channelID, comment.AssetTypeComment, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, marked)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,568 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// Read state of the comments is not stored in the comments (read_by array rewritten on every mark led to conflicts),
+// but in the dedicated database of the asset type containing two document types:
+//  - watermark: all comments of the entity created at or before read_up_to were read by the user
+//  - read: single comment created after the watermark was read by the user
+// Each document is written by its user only, so parallel readers do not conflict.
+const (
+	readRecordType = "read"
+	watermarkType  = "watermark"
+
+	readStateDesignDocID    = "_design/read_state"
+	readsByCommentView      = "reads_by_comment"
+	readsByUserView         = "reads_by_user"
+	watermarksByUserView    = "watermarks_by_user"
+	watermarksByEntityView  = "watermarks_by_entity"
+	readStateMigrationBatch = 200
+)
+
+// readStateDesignDoc contains views of the read state database
+var readStateDesignDoc = map[string]interface{}{
+	"language": "javascript",
+	"views": map[string]interface{}{
+		readsByCommentView: map[string]interface{}{
+			"map": `function (doc) {
+  if (doc.type === "read") {
+    emit(doc.comment_uuid, null);
+  }
+}`,
+		},
+		readsByUserView: map[string]interface{}{
+			"map": `function (doc) {
+  if (doc.type === "read") {
+    emit([doc.user.uuid, doc.entity, doc.comment_created_at], doc._rev);
+  }
+}`,
+			"reduce": "_count",
+		},
+		watermarksByUserView: map[string]interface{}{
+			"map": `function (doc) {
+  if (doc.type === "watermark") {
+    emit([doc.user.uuid, doc.entity], doc.read_up_to);
+  }
+}`,
+		},
+		watermarksByEntityView: map[string]interface{}{
+			"map": `function (doc) {
+  if (doc.type === "watermark") {
+    emit(doc.entity, null);
+  }
+}`,
+		},
+	},
+}
+
+// readRecord marks the single comment as read by the user
+type readRecord struct {
+	ID               string `json:"_id"`
+	Rev              string `json:"_rev,omitempty"`
+	Type             string `json:"type"`
+	CommentUUID      string `json:"comment_uuid"`
+	CommentCreatedAt string `json:"comment_created_at"`
+	Entity           string `json:"entity"`
+	comment.ReadBy
+}
+
+// watermark marks all comments of the entity created at or before ReadUpTo as read by the user
+type watermark struct {
+	ID       string `json:"_id"`
+	Rev      string `json:"_rev,omitempty"`
+	Type     string `json:"type"`
+	Entity   string `json:"entity"`
+	ReadUpTo string `json:"read_up_to"`
+	comment.ReadBy
+}
+
+func newReadRecord(c comment.Comment, readBy comment.ReadBy) readRecord {
+	return readRecord{
+		ID:               readRecordID(readBy.User.UUID, c.UUID),
+		Type:             readRecordType,
+		CommentUUID:      c.UUID,
+		CommentCreatedAt: c.CreatedAt,
+		Entity:           c.Entity.String(),
+		ReadBy:           readBy,
+	}
+}
+
+func readRecordID(userUUID, commentUUID string) string {
+	return fmt.Sprintf("read:%s:%s", userUUID, commentUUID)
+}
+
+func watermarkID(userUUID, entity string) string {
+	return fmt.Sprintf("watermark:%s:%s", userUUID, entity)
+}
+
+func readStateDatabaseName(channelID string, assetType comment.AssetType) string {
+	return fmt.Sprintf("p_%s_%s_read_state", channelID, assetType.Plural())
+}
+
+// createReadStateDatabase creates the read state database of the asset type with its views if it does not exist
+func (s *DBStorage) createReadStateDatabase(ctx context.Context, channelID string, assetType comment.AssetType) error {
+	dbName := readStateDatabaseName(channelID, assetType)
+
+	dbExists, err := s.client.DBExists(ctx, dbName)
+	if err != nil {
+		s.logger.Error("couchdb connection failed", zap.Error(err))
+		return err
+	}
+
+	if dbExists {
+		return nil
+	}
+
+	err = s.client.CreateDB(ctx, dbName)
+	if kivik.StatusCode(err) == http.StatusPreconditionFailed {
+		// created concurrently together with its views
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("couchdb database creation failed", zap.Error(err))
+		return err
+	}
+
+	_, err = s.client.DB(ctx, dbName).Put(ctx, readStateDesignDocID, readStateDesignDoc)
+	if err != nil {
+		s.logger.Error("couchdb design document creation failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// getWatermark returns the user's watermark of the entity or nil if the user did not mark the entity as read
+func (s *DBStorage) getWatermark(ctx context.Context, userUUID, entity, channelID string, assetType comment.AssetType) (*watermark, error) {
+	var wm watermark
+
+	err := s.client.DB(ctx, readStateDatabaseName(channelID, assetType)).Get(ctx, watermarkID(userUUID, entity)).ScanDoc(&wm)
+	if err != nil {
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			return nil, nil
+		}
+
+		s.logger.Warn("CouchDB GET failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Read state could not be retrieved: %s", httpError.Reason)
+			return nil, repository.NewError(eMsg, httpError.StatusCode())
+		}
+
+		return nil, err
+	}
+
+	return &wm, nil
+}
+
+// userWatermarks returns read_up_to values of the user's watermarks of the entities
+func (s *DBStorage) userWatermarks(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]string, error) {
+	keys := make([]interface{}, 0, len(entities))
+	for _, e := range entities {
+		keys = append(keys, []string{userUUID, e})
+	}
+
+	db := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+
+	rows, err := db.Query(ctx, readStateDesignDocID, "_view/"+watermarksByUserView, kivik.Options{"keys": keys})
+	if err != nil {
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			return map[string]string{}, nil
+		}
+
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	watermarks := make(map[string]string, len(entities))
+	for rows.Next() {
+		var key []string
+		if err := rows.ScanKey(&key); err != nil {
+			return nil, err
+		}
+
+		var readUpTo string
+		if err := rows.ScanValue(&readUpTo); err != nil {
+			return nil, err
+		}
+
+		if len(key) == 2 {
+			watermarks[key[1]] = readUpTo
+		}
+	}
+
+	return watermarks, rows.Err()
+}
+
+// readState contains read records of the comments and watermarks of their entities
+type readState struct {
+	reads      map[string][]comment.ReadBy // by comment UUID
+	watermarks map[string][]watermark      // by entity
+}
+
+// readBy returns projection of the read state to read_by list of the comment, legacy read_by list
+// (stored in comments not migrated yet) is merged into it
+func (rs readState) readBy(uuid, entity, createdAt string, legacy comment.ReadByList) comment.ReadByList {
+	list := append(comment.ReadByList{}, legacy...)
+	for _, wm := range rs.watermarks[entity] {
+		if createdAt != "" && wm.ReadUpTo >= createdAt {
+			list = append(list, wm.ReadBy)
+		}
+	}
+	list = append(list, rs.reads[uuid]...)
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time < list[j].Time
+	})
+
+	seen := map[string]bool{}
+	readBy := comment.ReadByList{}
+	for _, rb := range list {
+		if !seen[rb.User.UUID] {
+			seen[rb.User.UUID] = true
+			readBy = append(readBy, rb)
+		}
+	}
+
+	if len(readBy) == 0 {
+		return nil
+	}
+
+	return readBy
+}
+
+// loadReadState returns read records of the comments and all watermarks of the entities
+func (s *DBStorage) loadReadState(ctx context.Context, uuids, entities []string, channelID string, assetType comment.AssetType) (readState, error) {
+	rs := readState{
+		reads:      map[string][]comment.ReadBy{},
+		watermarks: map[string][]watermark{},
+	}
+
+	if len(uuids) == 0 {
+		return rs, nil
+	}
+
+	db := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+
+	rows, err := db.Query(ctx, readStateDesignDocID, "_view/"+readsByCommentView, kivik.Options{
+		"keys":         uuids,
+		"include_docs": true,
+	})
+	if err != nil {
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			// read state database was not created yet
+			return rs, nil
+		}
+
+		return rs, err
+	}
+
+	for rows.Next() {
+		var rr readRecord
+		if err := rows.ScanDoc(&rr); err != nil {
+			_ = rows.Close()
+			return rs, err
+		}
+
+		rs.reads[rr.CommentUUID] = append(rs.reads[rr.CommentUUID], rr.ReadBy)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return rs, err
+	}
+
+	rows, err = db.Query(ctx, readStateDesignDocID, "_view/"+watermarksByEntityView, kivik.Options{
+		"keys":         entities,
+		"include_docs": true,
+	})
+	if err != nil {
+		return rs, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var wm watermark
+		if err := rows.ScanDoc(&wm); err != nil {
+			return rs, err
+		}
+
+		rs.watermarks[wm.Entity] = append(rs.watermarks[wm.Entity], wm)
+	}
+
+	return rs, rows.Err()
+}
+
+// projectReadBy replaces read_by list of the comment by the projection of the read state
+func (s *DBStorage) projectReadBy(ctx context.Context, c *comment.Comment, channelID string, assetType comment.AssetType) error {
+	rs, err := s.loadReadState(ctx, []string{c.UUID}, []string{c.Entity.String()}, channelID, assetType)
+	if err != nil {
+		return err
+	}
+
+	c.ReadBy = rs.readBy(c.UUID, c.Entity.String(), c.CreatedAt, c.ReadBy)
+
+	return nil
+}
+
+// projectReadByDocs replaces read_by field of the queried documents by the projection of the read state,
+// documents must contain uuid, entity and created_at fields
+func (s *DBStorage) projectReadByDocs(ctx context.Context, docs []map[string]interface{}, channelID string, assetType comment.AssetType) error {
+	var uuids, entities []string
+	seen := map[string]bool{}
+
+	for _, doc := range docs {
+		uuid, _ := doc["uuid"].(string)
+		e, _ := doc["entity"].(string)
+		if uuid == "" {
+			continue
+		}
+
+		uuids = append(uuids, uuid)
+		if e != "" && !seen[e] {
+			seen[e] = true
+			entities = append(entities, e)
+		}
+	}
+
+	rs, err := s.loadReadState(ctx, uuids, entities, channelID, assetType)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		uuid, _ := doc["uuid"].(string)
+		e, _ := doc["entity"].(string)
+		createdAt, _ := doc["created_at"].(string)
+
+		var legacy comment.ReadByList
+		if v, ok := doc["read_by"]; ok {
+			if err := convert(v, &legacy); err != nil {
+				return err
+			}
+		}
+
+		readBy := rs.readBy(uuid, e, createdAt, legacy)
+		if readBy == nil {
+			delete(doc, "read_by")
+			continue
+		}
+
+		var v interface{}
+		if err := convert(readBy, &v); err != nil {
+			return err
+		}
+		doc["read_by"] = v
+	}
+
+	return nil
+}
+
+// readByProjectionQuery returns true if the query result contains read_by field which must be projected
+// from the read state. Fields needed for the projection are added to the returned copy of the query,
+// they are returned too to be removed from the result.
+func readByProjectionQuery(query map[string]interface{}) (map[string]interface{}, bool, []string) {
+	fieldsValue, ok := query["fields"]
+	if !ok {
+		return query, true, nil
+	}
+
+	var fields []string
+	if err := convert(fieldsValue, &fields); err != nil {
+		return query, false, nil
+	}
+
+	has := map[string]bool{}
+	for _, f := range fields {
+		has[f] = true
+	}
+
+	if !has["read_by"] {
+		return query, false, nil
+	}
+
+	var added []string
+	for _, f := range []string{"uuid", "entity", "created_at"} {
+		if !has[f] {
+			added = append(added, f)
+			fields = append(fields, f)
+		}
+	}
+
+	if len(added) == 0 {
+		return query, true, nil
+	}
+
+	q := make(map[string]interface{}, len(query))
+	for k, v := range query {
+		q[k] = v
+	}
+	q["fields"] = fields
+
+	return q, true, added
+}
+
+// MigrateReadState moves read_by lists stored in the comments (before the read state database was introduced)
+// to the read state database, it creates the read state database and updates views if needed.
+// It returns the number of migrated comments; it is safe to run it repeatedly.
+func (s *DBStorage) MigrateReadState(ctx context.Context, channelID string, assetType comment.AssetType) (int, error) {
+	err := s.createReadStateDatabase(ctx, channelID, assetType)
+	if err != nil {
+		return 0, err
+	}
+
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	// design document of the comments database was changed together with the read state introduction
+	err = s.putDesignDoc(ctx, db, countersDesignDocID, countersDesignDoc)
+	if err != nil {
+		return 0, err
+	}
+	s.readStateReady.Store(db.Name(), true)
+
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+	migrated := 0
+
+	for {
+		rows, err := db.Find(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{
+				"read_by": map[string]interface{}{"$exists": true},
+			},
+			"limit": readStateMigrationBatch,
+		})
+		if err != nil {
+			s.logger.Warn("CouchDB FIND failed", zap.Error(err))
+			return migrated, err
+		}
+
+		var records, comments []interface{}
+		for rows.Next() {
+			var c bulkComment
+			if err := rows.ScanDoc(&c); err != nil {
+				_ = rows.Close()
+				return migrated, err
+			}
+
+			for _, rb := range c.ReadBy {
+				records = append(records, newReadRecord(c.Comment, rb))
+			}
+
+			c.ID = c.UUID
+			c.ReadBy = nil
+			comments = append(comments, c)
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return migrated, err
+		}
+
+		if len(comments) == 0 {
+			break
+		}
+
+		// already existing read records (of previous interrupted migration) are skipped as conflicts
+		if _, err := s.bulkUpdate(ctx, rsDB, records); err != nil {
+			return migrated, err
+		}
+
+		n, err := s.bulkUpdate(ctx, db, comments)
+		migrated += n
+		if err != nil {
+			return migrated, err
+		}
+
+		if len(comments) < readStateMigrationBatch || n == 0 {
+			break
+		}
+	}
+
+	s.logger.Info(fmt.Sprintf("read state of %d %s migrated", migrated, assetType.Plural()))
+
+	return migrated, nil
+}
+
+// ensureReadState creates the counters design document of the asset type database and the read state database
+// if they are missing, so the read state of databases created before it was introduced can be used before
+// MigrateReadState is run. Each database is checked once per process.
+func (s *DBStorage) ensureReadState(ctx context.Context, db *kivik.DB, channelID string, assetType comment.AssetType) error {
+	if _, ok := s.readStateReady.Load(db.Name()); ok {
+		return nil
+	}
+
+	_, _, err := db.GetMeta(ctx, countersDesignDocID)
+	if kivik.StatusCode(err) == http.StatusNotFound {
+		// fails with 404 Not Found if the asset type database does not exist either
+		_, err = db.Put(ctx, countersDesignDocID, countersDesignDoc)
+		if kivik.StatusCode(err) == http.StatusConflict {
+			// created concurrently
+			err = nil
+		}
+	}
+	if err != nil {
+		s.logger.Error("couchdb design document creation failed", zap.Error(err))
+		return err
+	}
+
+	if err := s.createReadStateDatabase(ctx, channelID, assetType); err != nil {
+		return err
+	}
+
+	s.readStateReady.Store(db.Name(), true)
+
+	return nil
+}
+
+// putDesignDoc creates or replaces the design document
+func (s *DBStorage) putDesignDoc(ctx context.Context, db *kivik.DB, id string, doc map[string]interface{}) error {
+	return s.retryOnConflict(ctx, id, func() error {
+		stored := map[string]interface{}{}
+		for k, v := range doc {
+			stored[k] = v
+		}
+
+		_, rev, err := db.GetMeta(ctx, id)
+		if err != nil && kivik.StatusCode(err) != http.StatusNotFound {
+			s.logger.Error("couchdb design document retrieval failed", zap.Error(err))
+			return err
+		}
+		if rev != "" {
+			stored["_rev"] = rev
+		}
+
+		_, err = db.Put(ctx, id, stored)
+		if err != nil {
+			s.logger.Error("couchdb design document update failed", zap.Error(err))
+
+			if kivik.StatusCode(err) == http.StatusConflict {
+				return revisionConflict(err)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// convert converts the value to another type using its JSON representation
+func convert(from, to interface{}) error {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, to)
+}
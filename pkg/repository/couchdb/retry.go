@@ -0,0 +1,72 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultConflictRetries is the default number of attempts of read-modify-write operation
+	// when the document is changed concurrently
+	defaultConflictRetries = 5
+
+	// defaultConflictBackoff is the default delay before the second attempt, it is doubled for each next attempt
+	defaultConflictBackoff = 10 * time.Millisecond
+
+	// maxConflictBackoffShift bounds the delay between attempts to 32 times the initial delay
+	maxConflictBackoffShift = 5
+)
+
+// revisionConflictError marks the error of storing the document which was changed concurrently (409 Conflict),
+// the read-modify-write operation which failed by it can be repeated
+type revisionConflictError struct {
+	err error
+}
+
+func (e *revisionConflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *revisionConflictError) Unwrap() error {
+	return e.err
+}
+
+// revisionConflict wraps the error returned when the stored document revision is not the current one
+func revisionConflict(err error) error {
+	return &revisionConflictError{err: err}
+}
+
+// retryOnConflict calls fn, which reads the document, applies the change and stores it, until it succeeds,
+// fails by an error other than revision conflict or the number of attempts is reached.
+// Attempts are delayed by exponential backoff. The last error is returned without the revision conflict mark.
+// Name identifies the changed document in log.
+func (s *DBStorage) retryOnConflict(ctx context.Context, name string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		var conflict *revisionConflictError
+		if !errors.As(err, &conflict) {
+			return err
+		}
+
+		if attempt >= s.conflictRetries {
+			return conflict.err
+		}
+
+		shift := attempt - 1
+		if shift > maxConflictBackoffShift {
+			shift = maxConflictBackoffShift
+		}
+		delay := s.conflictBackoff << shift
+
+		s.logger.Info(fmt.Sprintf("%s changed concurrently, retrying in %s", name, delay))
+
+		select {
+		case <-ctx.Done():
+			return conflict.err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -10,10 +10,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/go-kivik/couchdb/v3" // The CouchDB driver
@@ -26,28 +28,53 @@ import (
 const (
 	// defaultPageSize is the default couchDB value for 'limit' in 'find' query
 	defaultPageSize = 25
+
+	// maxPinnedCount is the limit of the query counting pinned comments of the entity, there are only few of them
+	maxPinnedCount = 1000
 )
 
 // DBStorage storage stores data in couchdb
 type DBStorage struct {
-	client    *kivik.Client
-	logger    *zap.Logger
-	rand      io.Reader
-	validator Validator
-	events    event.Service
+	client *kivik.Client
+	logger *zap.Logger
+	rand   io.Reader
+
+	conflictRetries int
+	conflictBackoff time.Duration
+
+	// outboxDBs are databases that may contain messages not published yet, all databases are checked
+	// once per outboxScanInterval
+	outboxMu           sync.Mutex
+	outboxDBs          map[string]bool
+	outboxScannedAt    time.Time
+	outboxScanInterval time.Duration
+
+	// readStateReady are asset type databases with the read state database and the counters design document
+	readStateReady sync.Map
+
+	// idempotencyCleanedAt is the time of the last deletion of expired idempotency keys per database
+	idempotencyCleanedAt sync.Map
 }
 
 // Config contains values for the data source
 type Config struct {
-	Client       *kivik.Client
-	CaPath       string
-	Rand         io.Reader
-	Validator    Validator
-	EventService event.Service
-	Host         string
-	Port         string
-	Username     string
-	Passwd       string
+	Client   *kivik.Client
+	CaPath   string
+	Rand     io.Reader
+	Host     string
+	Port     string
+	Username string
+	Passwd   string
+
+	// ConflictRetries is the number of attempts of an update of the document changed concurrently (default 5)
+	ConflictRetries int
+
+	// ConflictBackoff is the delay before the second attempt of the update, doubled for each next one (default 10ms)
+	ConflictBackoff time.Duration
+
+	// OutboxScanInterval is the interval of checks of all databases for messages not published yet,
+	// e.g. stored by another instance of the service stopped before they were published (default 1h)
+	OutboxScanInterval time.Duration
 }
 
 // NewStorage creates new couchdb storage with initialized client
@@ -100,12 +127,28 @@ func NewStorage(ctx context.Context, logger *zap.Logger, cfg Config) *DBStorage
 		client = cfg.Client
 	}
 
+	conflictRetries := cfg.ConflictRetries
+	if conflictRetries == 0 {
+		conflictRetries = defaultConflictRetries
+	}
+
+	conflictBackoff := cfg.ConflictBackoff
+	if conflictBackoff == 0 {
+		conflictBackoff = defaultConflictBackoff
+	}
+
+	outboxScanInterval := cfg.OutboxScanInterval
+	if outboxScanInterval == 0 {
+		outboxScanInterval = defaultOutboxScanInterval
+	}
+
 	return &DBStorage{
-		client:    client,
-		logger:    logger,
-		rand:      cfg.Rand,
-		validator: cfg.Validator,
-		events:    cfg.EventService,
+		client:             client,
+		logger:             logger,
+		rand:               cfg.Rand,
+		conflictRetries:    conflictRetries,
+		conflictBackoff:    conflictBackoff,
+		outboxScanInterval: outboxScanInterval,
 	}
 }
 
@@ -114,39 +157,35 @@ func (s *DBStorage) Client() *kivik.Client {
 	return s.client
 }
 
-// AddComment saves the given comment to the database and returns it
-func (s *DBStorage) AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType) (*comment.Comment, error) {
+// AddComment saves the given comment to the database and returns it. The message returned by events function
+// (if not nil) is stored to the outbox by the same request as the comment.
+func (s *DBStorage) AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
 	dbName := databaseName(channelID, assetType)
 
 	db := s.client.DB(ctx, dbName)
 
-	uuid, err := repository.GenerateUUID(s.rand)
+	msg, err := eventMessage(c, events)
 	if err != nil {
-		s.logger.Error("could not generate UUID", zap.Error(err))
 		return nil, err
 	}
 
-	c.UUID = uuid
-	c.CreatedAt = time.Now().Format(time.RFC3339)
-
-	err = s.validator.Validate(c)
-	if err != nil {
-		s.logger.Error(fmt.Sprintf("invalid %s", assetType), zap.Error(err))
-		return nil, err
-	}
-
-	rev, err := db.Put(ctx, uuid, c)
+	rev, _, err := s.putWithOutbox(ctx, db, c.UUID, bulkComment{ID: c.UUID, Comment: c}, msg)
 	if err != nil {
 		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
 
+		if kivik.StatusCode(err) == http.StatusConflict {
+			reason := fmt.Sprintf("%s already exists", strings.Title(assetType.String()))
+			eMsg := fmt.Sprintf("%s could not be added: %s", strings.Title(assetType.String()), reason)
+			return nil, ErrorConflict(eMsg)
+		}
+
+		if kivik.StatusCode(err) == http.StatusNotFound {
+			eMsg := fmt.Sprintf("%s could not be added: database of %s does not exist", strings.Title(assetType.String()), assetType.Plural())
+			return nil, ErrorNorFound(eMsg)
+		}
+
 		var httpError *chttp.HTTPError
 		if errors.As(err, &httpError) {
-			if httpError.StatusCode() == http.StatusConflict {
-				reason := fmt.Sprintf("%s already exists", strings.Title(assetType.String()))
-				eMsg := fmt.Sprintf("%s could not be added: %s", strings.Title(assetType.String()), reason)
-				return nil, ErrorConflict(eMsg)
-			}
-
 			eMsg := fmt.Sprintf("%s could not be added: %s", strings.Title(assetType.String()), httpError.Reason)
 			return nil, repository.NewError(eMsg, http.StatusInternalServerError)
 		}
@@ -156,44 +195,9 @@ func (s *DBStorage) AddComment(ctx context.Context, c comment.Comment, channelID
 
 	s.logger.Info(fmt.Sprintf("%s inserted with revision %s", strings.Title(assetType.String()), rev))
 
-	q, err := s.events.NewQueue(event.UUID(channelID), event.UUID(c.CreatedBy.OrgID()))
-	if err != nil {
-		msg := "could not create event queue"
-		s.logger.Error(msg, zap.Error(err))
-		s.rollback(ctx, db, uuid, rev, assetType)
-
-		return nil, fmt.Errorf("%s: %v", msg, err)
-	}
-
-	if err = q.AddCreateEvent(c, assetType); err != nil {
-		msg := "could not create event"
-		s.logger.Error(msg, zap.Error(err))
-		s.rollback(ctx, db, uuid, rev, assetType)
-
-		return nil, fmt.Errorf("%s: %v", msg, err)
-	}
-
-	if err = q.PublishEvents(); err != nil {
-		msg := "could not publish events"
-		s.logger.Error(msg, zap.Error(err))
-		s.rollback(ctx, db, uuid, rev, assetType)
-
-		return nil, fmt.Errorf("%s: %v", msg, err)
-	}
-
 	return &c, nil
 }
 
-func (s *DBStorage) rollback(ctx context.Context, db *kivik.DB, uuid string, rev string, assetType comment.AssetType) {
-	_, err := db.Delete(ctx, uuid, rev)
-	if err != nil {
-		s.logger.Error(fmt.Sprintf("could not delete %s:%s (rollback)", assetType, uuid), zap.Error(err))
-		return
-	}
-
-	s.logger.Info(fmt.Sprintf("%s:%s deleted (rollback)", assetType, uuid))
-}
-
 // GetComment returns comment with the specified ID
 func (s *DBStorage) GetComment(ctx context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error) {
 	dbName := databaseName(channelID, assetType)
@@ -222,6 +226,13 @@ func (s *DBStorage) GetComment(ctx context.Context, id, channelID string, assetT
 		return c, err
 	}
 
+	err = s.projectReadBy(ctx, &c, channelID, assetType)
+	if err != nil {
+		s.logger.Warn("read state could not be retrieved", zap.Error(err))
+		eMsg := fmt.Sprintf("%s could not be retrieved: read state could not be retrieved", strings.Title(assetType.String()))
+		return comment.Comment{}, repository.NewError(eMsg, http.StatusInternalServerError)
+	}
+
 	s.logger.Info(fmt.Sprintf("%s fetched %v", strings.Title(assetType.String()), c))
 
 	return c, nil
@@ -238,6 +249,8 @@ func (s *DBStorage) QueryComments(ctx context.Context, query map[string]interfac
 
 	db := s.client.DB(ctx, dbName)
 
+	query, projectReadBy, addedFields := readByProjectionQuery(query)
+
 	rows, err := db.Find(ctx, query)
 	if err != nil {
 		s.logger.Warn("CouchDB FIND failed", zap.Error(err))
@@ -279,6 +292,21 @@ func (s *DBStorage) QueryComments(ctx context.Context, query map[string]interfac
 		bookmark = rows.Bookmark()
 	}
 
+	if projectReadBy {
+		err = s.projectReadByDocs(ctx, docs, channelID, assetType)
+		if err != nil {
+			s.logger.Warn("read state could not be retrieved", zap.Error(err))
+			eMsg := fmt.Sprintf("%s could not be queried: read state could not be retrieved", strings.Title(assetType.Plural()))
+			return listing.QueryResult{}, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		for _, doc := range docs {
+			for _, f := range addedFields {
+				delete(doc, f)
+			}
+		}
+	}
+
 	result := listing.QueryResult{
 		Result:   docs,
 		Bookmark: bookmark,
@@ -287,17 +315,19 @@ func (s *DBStorage) QueryComments(ctx context.Context, query map[string]interfac
 	return result, err
 }
 
-// MarkAsReadByUser adds user info to read_by array in the comment with specified ID.
-// It returns true if comment was already marked before to notify that resource was not changed.
-func (s *DBStorage) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType) (bool, error) {
+// MarkAsReadByUser stores the read record of the comment with specified ID in the read state database.
+// The message returned by events function (if not nil) is stored to the outbox of the read state database
+// by the same request as the read record. It returns true if comment was already marked before to notify
+// that resource was not changed.
+func (s *DBStorage) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(c comment.Comment) (*event.Message, error)) (bool, error) {
 	dbName := databaseName(channelID, assetType)
 
 	var c comment.Comment
 
 	db := s.client.DB(ctx, dbName)
 
-	row := db.Get(ctx, id)
-	err := row.ScanDoc(&c)
+	err := db.Get(ctx, id).ScanDoc(&c)
 	if err != nil {
 		s.logger.Warn("CouchDB GET failed", zap.Error(err))
 
@@ -317,54 +347,231 @@ func (s *DBStorage) MarkAsReadByUser(ctx context.Context, id string, readBy comm
 
 	currentUserID := readBy.User.UUID
 
-	for _, rb := range c.ReadBy {
-		if rb.User.UUID == currentUserID {
-			// comment was already read by user in the past
-			return true, nil
-		}
+	// comment was already read by user in the past (not migrated read_by list)
+	if readByUser(c.ReadBy, currentUserID) {
+		return true, nil
 	}
 
-	c.ReadBy = append(c.ReadBy, readBy)
+	if err := s.ensureReadState(ctx, db, channelID, assetType); err != nil {
+		eMsg := fmt.Sprintf("%s could not be marked as read: read state could not be created", strings.Title(assetType.String()))
+		return false, repository.NewError(eMsg, http.StatusInternalServerError)
+	}
 
-	err = s.validator.Validate(c)
+	wm, err := s.getWatermark(ctx, currentUserID, c.Entity.String(), channelID, assetType)
 	if err != nil {
-		s.logger.Error("invalid comment", zap.Error(err))
 		return false, err
 	}
 
-	// updated comment with revision ID
-	var uc struct {
-		Rev string `json:"_rev"`
-		comment.Comment
+	// comment is covered by the user's watermark of the entity
+	if wm != nil && wm.ReadUpTo >= c.CreatedAt {
+		return true, nil
+	}
+
+	msg, err := eventMessage(c, events)
+	if err != nil {
+		return false, err
 	}
 
-	uc.Comment = c
-	uc.Rev = row.Rev
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
 
-	_, err = db.Put(ctx, uc.UUID, uc)
+	_, _, err = s.putWithOutbox(ctx, rsDB, readRecordID(currentUserID, c.UUID), newReadRecord(c, readBy), msg)
 	if err != nil {
 		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
 
+		if kivik.StatusCode(err) == http.StatusConflict {
+			// read record exists, comment was already read by user
+			return true, nil
+		}
+
 		var httpError *chttp.HTTPError
 		if errors.As(err, &httpError) {
-			reason := httpError.Reason
+			eMsg := fmt.Sprintf("%s could not be marked as read: %s", strings.Title(assetType.String()), httpError.Reason)
+			return false, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return false, err
+	}
+
+	s.logger.Info(fmt.Sprintf("%s %s marked as read by %s", strings.Title(assetType.String()), c.UUID, currentUserID))
+
+	return false, nil
+}
+
+// UpdateComment lets modify function change the comment with specified ID and stores the changed comment.
+// Modify function returns false if there is nothing to store, it is called again if the comment was changed
+// concurrently. The message returned by events function (if not nil) is stored to the outbox by the same request
+// as the changed comment. It returns the comment after the change and true if it was stored.
+// Read records of the deleted comment are deleted, so the comment is not read by anyone when it is restored.
+func (s *DBStorage) UpdateComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+
+	rc, stored, err := s.modifyComment(ctx, db, id, assetType, "updated", modify, events)
+	if err != nil {
+		return rc.Comment, false, err
+	}
+
+	if stored == nil {
+		return rc.Comment, false, nil
+	}
+
+	if stored.IsDeleted() && !rc.IsDeleted() {
+		// unread counters subtract read records from not deleted comments, see CountUnread
+		s.deleteReadRecords(ctx, id, channelID, assetType)
+	}
+
+	s.logger.Info(fmt.Sprintf("%s updated %#v", strings.Title(assetType.String()), stored.Comment))
+
+	return stored.Comment, true, nil
+}
+
+// CountPinned returns the number of pinned comments of the entity that are not deleted
+func (s *DBStorage) CountPinned(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (int, error) {
+	return s.countPinned(ctx, s.client.DB(ctx, databaseName(channelID, assetType)), e, assetType)
+}
 
-			if httpError.StatusCode() == http.StatusConflict {
-				reason = fmt.Sprintf("%s could not be mark as read", strings.Title(assetType.String()))
+func (s *DBStorage) countPinned(ctx context.Context, db *kivik.DB, e entity.Entity, assetType comment.AssetType) (int, error) {
+	rows, err := db.Find(ctx, pinnedQuery(e.String(), maxPinnedCount))
+	if err != nil {
+		s.logger.Warn("CouchDB FIND failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Pinned %s could not be counted: %s", assetType.Plural(), httpError.Reason)
+			return 0, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	pinned := 0
+	for rows.Next() {
+		pinned++
+	}
+
+	return pinned, rows.Err()
+}
+
+// pinnedQuery returns query of pinned comments of the entity that are not deleted
+func pinnedQuery(entity string, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"selector": map[string]interface{}{
+			"entity":     entity,
+			"pinned_at":  map[string]interface{}{"$exists": true},
+			"deleted_at": map[string]interface{}{"$exists": false},
+		},
+		"fields": []string{"uuid"},
+		"limit":  limit,
+	}
+}
+
+// modifyComment gets the comment with specified ID, lets modify function change it and stores the changed comment
+// with the message returned by events function (if not nil). Modify function returns false if there is nothing
+// to store. The whole get-modify-put flow is repeated if the comment was changed concurrently (409 Conflict).
+// It returns the original comment and the stored changed comment with its new revision ID (nil if nothing was stored).
+// Operation describes the change and is used in error message.
+func (s *DBStorage) modifyComment(ctx context.Context, db *kivik.DB, id string, assetType comment.AssetType, operation string,
+	modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (revisedComment, *revisedComment, error) {
+	var rc revisedComment
+	var stored *revisedComment
+
+	err := s.retryOnConflict(ctx, fmt.Sprintf("%s:%s", assetType, id), func() error {
+		var err error
+
+		rc, err = s.getRevisedComment(ctx, db, id, assetType, operation)
+		if err != nil {
+			return err
+		}
+
+		c := rc.Comment
+		changed, err := modify(&c)
+		if err != nil || !changed {
+			return err
+		}
+
+		msg, err := eventMessage(c, events)
+		if err != nil {
+			return err
+		}
+
+		rev, err := s.putRevisedComment(ctx, db, revisedComment{Rev: rc.Rev, Comment: c}, msg, assetType, operation)
+		if err != nil {
+			return err
+		}
+
+		stored = &revisedComment{Rev: rev, Comment: c}
+
+		return nil
+	})
+	if err != nil {
+		return rc, nil, err
+	}
+
+	return rc, stored, nil
+}
+
+// revisedComment represents stored comment with its revision ID
+type revisedComment struct {
+	Rev string `json:"_rev"`
+	comment.Comment
+}
+
+// getRevisedComment returns the comment with specified ID together with its current revision ID.
+// Operation describes the intended change and is used in error message.
+func (s *DBStorage) getRevisedComment(ctx context.Context, db *kivik.DB, id string, assetType comment.AssetType, operation string) (revisedComment, error) {
+	var rc revisedComment
+
+	row := db.Get(ctx, id)
+	err := row.ScanDoc(&rc.Comment)
+	if err != nil {
+		s.logger.Warn("CouchDB GET failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			if httpError.StatusCode() == http.StatusNotFound {
+				reason := fmt.Sprintf("%s with uuid='%s' does not exist", strings.Title(assetType.String()), id)
+				return rc, ErrorNorFound(reason)
 			}
 
-			return false, ErrorConflict(reason)
+			eMsg := fmt.Sprintf("%s could not be %s: %s", strings.Title(assetType.String()), operation, httpError.Reason)
+			return rc, repository.NewError(eMsg, http.StatusInternalServerError)
 		}
 
-		return false, err
+		return rc, err
 	}
 
-	s.logger.Info(fmt.Sprintf("%s updated %#v", strings.Title(assetType.String()), c))
+	rc.Rev = row.Rev
 
-	return false, nil
+	return rc, nil
+}
+
+// putRevisedComment stores the changed comment with the outbox document of the message of its events (if not nil)
+// and returns its new revision ID. Operation describes the change and is used in error message.
+func (s *DBStorage) putRevisedComment(ctx context.Context, db *kivik.DB, rc revisedComment, msg *event.Message, assetType comment.AssetType, operation string) (string, error) {
+	rev, _, err := s.putWithOutbox(ctx, db, rc.UUID, bulkComment{ID: rc.UUID, Rev: rc.Rev, Comment: rc.Comment}, msg)
+	if err != nil {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		if kivik.StatusCode(err) == http.StatusConflict {
+			reason := fmt.Sprintf("%s could not be %s", strings.Title(assetType.String()), operation)
+			return "", revisionConflict(ErrorConflict(reason))
+		}
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			return "", ErrorConflict(httpError.Reason)
+		}
+
+		return "", err
+	}
+
+	return rev, nil
 }
 
 // CreateDatabase creates new DB if it does not exist. It returns true if database already existed.
+// Indexes are created in the existing database too (CouchDB skips the existing ones),
+// so indexes added by newer versions of the service are available in databases of existing channels.
 func (s *DBStorage) CreateDatabase(ctx context.Context, channelID string, assetType comment.AssetType) (bool, error) {
 	dbName := databaseName(channelID, assetType)
 
@@ -375,7 +582,7 @@ func (s *DBStorage) CreateDatabase(ctx context.Context, channelID string, assetT
 	}
 
 	if dbExists {
-		return true, nil
+		return true, s.createIndexes(ctx, s.client.DB(ctx, dbName))
 	}
 
 	err = s.client.CreateDB(ctx, dbName)
@@ -384,31 +591,63 @@ func (s *DBStorage) CreateDatabase(ctx context.Context, channelID string, assetT
 		return false, err
 	}
 
-	// create indexes
 	db := s.client.DB(ctx, dbName)
+	err = s.createIndexes(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	// create view used for counting unread comments
+	_, err = db.Put(ctx, countersDesignDocID, countersDesignDoc)
+	if err != nil {
+		s.logger.Error("couchdb design document creation failed", zap.Error(err))
+		return false, err
+	}
+
+	err = s.createReadStateDatabase(ctx, channelID, assetType)
+	if err != nil {
+		return false, err
+	}
+	s.readStateReady.Store(dbName, true)
+
+	return false, nil
+}
+
+// createIndexes creates Mango indexes of the comments database, creating an index that already exists does nothing
+func (s *DBStorage) createIndexes(ctx context.Context, db *kivik.DB) error {
 	indexes := []map[string]interface{}{
 		{"fields": []map[string]string{{"uuid": "asc"}}},
 		{"fields": []map[string]string{{"created_at": "asc"}}},
 		{"fields": []map[string]string{{"entity": "asc"}}},
 		{"fields": []map[string]string{{"created_at": "asc"}, {"entity": "asc"}}},
+		{"fields": []map[string]string{{"parent_uuid": "asc"}}},
+		{"fields": []map[string]string{{"created_at": "asc"}, {"parent_uuid": "asc"}}},
+		{"fields": []map[string]string{{"external_id": "asc"}}},
+		{"fields": []map[string]string{{"entity": "asc"}, {"external_id": "asc"}}},
+		{"fields": []map[string]string{{"pinned_at": "asc"}, {"entity": "asc"}}},
 	}
 	for _, index := range indexes {
-		err = db.CreateIndex(ctx, "", "", index)
+		err := db.CreateIndex(ctx, "", "", index)
 		if err != nil {
 			s.logger.Error("couchdb database index creation failed", zap.Error(err))
-			return false, err
+			return err
 		}
 	}
 
-	return false, nil
+	return nil
 }
 
-func databaseName(channelID string, assetType comment.AssetType) string {
-	return fmt.Sprintf("p_%s_%s", channelID, pluralize(assetType))
+// eventMessage returns the message returned by events function for the comment, nil if the function is nil
+func eventMessage(c comment.Comment, events func(c comment.Comment) (*event.Message, error)) (*event.Message, error) {
+	if events == nil {
+		return nil, nil
+	}
+
+	return events(c)
 }
 
-func pluralize(assetType comment.AssetType) string {
-	return fmt.Sprintf("%ss", assetType)
+func databaseName(channelID string, assetType comment.AssetType) string {
+	return fmt.Sprintf("p_%s_%s", channelID, assetType.Plural())
 }
 
 // waitForCouchDB repeatedly tries to ping DB server until it is ready for requests or timeout expires
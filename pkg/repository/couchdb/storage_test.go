@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
 	"github.com/KompiTech/itsm-commenting-service/testutils"
 	"github.com/go-kivik/couchdb/v3/chttp"
 	"github.com/go-kivik/kivik/v3/driver"
@@ -22,30 +24,52 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// expectBulkDocsWithOutbox expects the document with specified ID stored by _bulk_docs request together with
+// the outbox document of its events, the document gets specified revision ID
+func expectBulkDocsWithOutbox(t *testing.T, db *kivikmock.DB, docID, rev string) {
+	db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+		require.Len(t, docs, 2)
+		assert.Equal(t, docID, bulkDocID(t, docs[0]))
+
+		outboxID := bulkDocID(t, docs[1])
+		assert.True(t, strings.HasPrefix(outboxID, "_local/outbox:"))
+		assert.True(t, strings.HasSuffix(outboxID, ":"+docID))
+
+		return &bulkResults{results: []driver.BulkResult{
+			{ID: docID, Rev: rev},
+			{ID: outboxID, Rev: "0-1"},
+		}}, nil
+	})
+}
+
+// bulkDocID returns ID of the document sent by _bulk_docs request
+func bulkDocID(t *testing.T, doc interface{}) string {
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	var d struct {
+		ID string `json:"_id"`
+	}
+	require.NoError(t, json.Unmarshal(b, &d))
+
+	return d.ID
+}
+
 func TestAddComment(t *testing.T) {
 	logger, _ := testutils.NewTestLogger()
 	defer func() { _ = logger.Sync() }()
 
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
-	orgID := "a897a407-e41b-4b14-924a-39f5d5a8038f"
 
 	t.Run("with valid comment", func(t *testing.T) {
-		validator := new(mocks.ValidatorMock)
-		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
-
-		events := new(mocks.EventServiceMock)
-		queue := new(mocks.QueueMock)
-		events.On("NewQueue", event.UUID(channelID), event.UUID(orgID)).Return(queue, nil)
-		queue.On("AddCreateEvent", mock.AnythingOfType("comment.Comment"), comment.AssetTypeComment).Return(nil)
-		queue.On("PublishEvents").Return(nil)
-
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, events)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		db := couchMock.NewDB()
 		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
-		db.ExpectPut()
+		db.ExpectPut().WithDocID(mocks.GeneratedCommentUUID)
 
 		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
 			Text:   "Test comment 1",
 			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
 			CreatedBy: &comment.UserInfo{
@@ -57,43 +81,126 @@ func TestAddComment(t *testing.T) {
 			},
 		}
 
-		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment)
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, nil)
 		assert.Nil(t, err)
 		assert.Equal(t, "38316161-3035-4864-ad30-6231392d3433", newC.UUID)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when events are stored to the outbox", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		expectBulkDocsWithOutbox(t, db, mocks.GeneratedCommentUUID, "1-a")
+
+		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
+			Text:   "Test comment 1",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, c, *newC)
 
-		validator.AssertExpectations(t)
-		events.AssertExpectations(t)
-		queue.AssertExpectations(t)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
 	})
 
-	t.Run("with invalid comment", func(t *testing.T) {
-		validator := new(mocks.ValidatorMock)
-		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(errors.New("invalid comment"))
+	t.Run("when events are not prepared", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
 
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, nil)
+		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
+			Text:   "Test comment 1",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, func(c comment.Comment) (*event.Message, error) {
+			return nil, errors.New("could not prepare events: invalid orgID")
+		})
+		assert.EqualError(t, err, "could not prepare events: invalid orgID")
+		assert.Nil(t, newC)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet(), "comment is not stored")
+	})
+
+	t.Run("when comment is not stored with its events", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		db := couchMock.NewDB()
 		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: mocks.GeneratedCommentUUID, Error: &chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusConflict}}},
+				{ID: bulkDocID(t, docs[1]), Rev: "0-1"},
+			}}, nil
+		})
+		// the outbox document is removed again
+		db.ExpectDelete().WithRev("0-1")
 
 		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
 			Text:   "Test comment 1",
 			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
 		}
 
-		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment)
-		assert.Error(t, err)
-		assert.EqualErrorf(t, err, "invalid comment", "errors are not equal")
+		_, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.EqualError(t, err, "Comment could not be added: Comment already exists")
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusConflict, httpError.StatusCode())
 
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when events of stored comment could not be stored", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		storeError := &chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectBulkDocs().WillExecute(func(_ context.Context, docs []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+			return &bulkResults{results: []driver.BulkResult{
+				{ID: mocks.GeneratedCommentUUID, Rev: "1-a"},
+				{ID: bulkDocID(t, docs[1]), Error: storeError},
+			}}, nil
+		})
+		// the outbox document is stored again
+		db.ExpectPut().WillReturnError(storeError)
+		// the comment is removed again, so the request can be retried
+		db.ExpectDelete().WithDocID(mocks.GeneratedCommentUUID).WithRev("1-a")
+
+		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
+			Text:   "Test comment 1",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.EqualError(t, err, "events of "+mocks.GeneratedCommentUUID+" could not be stored to the outbox")
 		assert.Nil(t, newC)
 
-		validator.AssertNumberOfCalls(t, "Validate", 1)
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusInternalServerError, httpError.StatusCode())
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
 	})
 
 	t.Run("when comment with the same UUID already exists", func(t *testing.T) {
-		validator := new(mocks.ValidatorMock)
-		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
-
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		db := couchMock.NewDB()
 		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
@@ -105,16 +212,101 @@ func TestAddComment(t *testing.T) {
 		})
 
 		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
 			Text:   "Test comment 1",
 			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
 		}
 
-		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment)
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, nil)
 		assert.Error(t, err)
 		assert.EqualErrorf(t, err, "Comment could not be added: Comment already exists", "errors are not equal")
 		assert.Nil(t, newC)
+	})
+
+	t.Run("when database does not exist", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
 
-		validator.AssertNumberOfCalls(t, "Validate", 1)
+		db.ExpectPut().WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: 404,
+			},
+		})
+
+		c := comment.Comment{
+			UUID:   mocks.GeneratedCommentUUID,
+			Text:   "Test comment 1",
+			Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, nil)
+		assert.EqualError(t, err, "Comment could not be added: database of comments does not exist")
+		assert.Nil(t, newC)
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusNotFound, httpError.StatusCode())
+	})
+
+	t.Run("with reply", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		parentUUID := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+
+		// the parent is checked by the adding service
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectPut()
+
+		c := comment.Comment{
+			UUID:       mocks.GeneratedCommentUUID,
+			Text:       "Reply 1",
+			Entity:     entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			ParentUUID: parentUUID,
+			CreatedBy: &comment.UserInfo{
+				UUID:           "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+				Name:           "Andy",
+				Surname:        "Orange",
+				OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				OrgDisplayName: "Kompitech",
+			},
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, parentUUID, newC.ParentUUID)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("with external ID", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		// uniqueness of external IDs is guaranteed by UUIDs derived from them, so there is no query
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectPut()
+
+		c := comment.Comment{
+			UUID:       mocks.GeneratedCommentUUID,
+			Text:       "Test comment 1",
+			Entity:     entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+			ExternalID: "SN-0001",
+			CreatedBy: &comment.UserInfo{
+				UUID:           "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e",
+				Name:           "Andy",
+				Surname:        "Orange",
+				OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+				OrgDisplayName: "Kompitech",
+			},
+		}
+
+		newC, err := s.AddComment(context.Background(), c, channelID, comment.AssetTypeComment, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "SN-0001", newC.ExternalID)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
 	})
 }
 
@@ -125,7 +317,7 @@ func TestGetComment(t *testing.T) {
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
 
 	t.Run("when comment does not exist", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
 
@@ -147,7 +339,7 @@ func TestGetComment(t *testing.T) {
 	})
 
 	t.Run("when comment exists", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
 		dbC := comment.Comment{
@@ -169,11 +361,29 @@ func TestGetComment(t *testing.T) {
 		row, err := kivikmock.Document(dbC)
 		assert.Nil(t, err)
 		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		mocks.ExpectEmptyReadState(couchMock, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
 
 		res, err := s.GetComment(context.Background(), uuid, channelID, comment.AssetTypeComment)
 		assert.NoError(t, err)
 		assert.Equal(t, dbC, res)
 	})
+
+	t.Run("when stored entity reference is malformed", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(json.RawMessage(`{"_id":"` + uuid + `","uuid":"` + uuid + `","entity":"incident","text":"Some comment"}`))
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		mocks.ExpectEmptyReadState(couchMock, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+		res, err := s.GetComment(context.Background(), uuid, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+		assert.Equal(t, "incident", res.Entity.String(), "stored reference is kept as is")
+	})
 }
 
 func TestQueryComments(t *testing.T) {
@@ -183,7 +393,7 @@ func TestQueryComments(t *testing.T) {
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
 
 	t.Run("with invalid query", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		db := couchMock.NewDB()
 		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
@@ -203,7 +413,7 @@ func TestQueryComments(t *testing.T) {
 	})
 
 	t.Run("with valid query", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		db := couchMock.NewDB()
 		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
@@ -246,6 +456,7 @@ func TestQueryComments(t *testing.T) {
 		db.ExpectFind().WithQuery(query).WillReturn(kivikmock.NewRows().
 			AddRow(&driver.Row{ID: uuid, Doc: doc}).
 			AddRow(&driver.Row{ID: uuid, Doc: doc}))
+		mocks.ExpectEmptyReadState(couchMock, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
 
 		res, err := s.QueryComments(context.Background(), query, channelID, comment.AssetTypeComment)
 		assert.NoError(t, err)
@@ -264,7 +475,7 @@ func TestMarkAsReadByUser(t *testing.T) {
 		validator := new(mocks.ValidatorMock)
 		validator.On("Validate", mock.AnythingOfType("comment.Comment")).Return(nil)
 
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, validator, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
 
@@ -287,6 +498,7 @@ func TestMarkAsReadByUser(t *testing.T) {
 		row, err := kivikmock.Document(dbC)
 		assert.Nil(t, err)
 		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		mocks.ExpectReadStateReady(couchMock, db, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
 
 		readBy := comment.ReadBy{
 			Time: time.Now().Format(time.RFC3339),
@@ -299,15 +511,65 @@ func TestMarkAsReadByUser(t *testing.T) {
 			},
 		}
 
-		db.ExpectPut().WithDocID(uuid)
-
-		res, err := s.MarkAsReadByUser(context.Background(), uuid, readBy, channelID, comment.AssetTypeComment)
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		rsDB.ExpectGet().WithDocID("watermark:439e2d19-8d50-405d-ad8e-cd33df344086:incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444").
+			WillReturnError(&chttp.HTTPError{Response: &http.Response{StatusCode: http.StatusNotFound}})
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		expectBulkDocsWithOutbox(t, rsDB, "read:439e2d19-8d50-405d-ad8e-cd33df344086:cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0", "1-a")
+
+		var read comment.Comment
+		res, err := s.MarkAsReadByUser(context.Background(), uuid, readBy, channelID, comment.AssetTypeComment, func(c comment.Comment) (*event.Message, error) {
+			read = c
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
 		assert.NoError(t, err)
 		assert.False(t, res)
+		assert.Equal(t, uuid, read.UUID)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comment is covered by user's watermark", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(map[string]interface{}{
+			"uuid":       uuid,
+			"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"text":       "Some comment",
+			"created_at": "2021-04-01T12:34:56+02:00",
+		})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		mocks.ExpectReadStateReady(couchMock, db, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		wm, err := kivikmock.Document(map[string]interface{}{
+			"_rev":       "1-a",
+			"type":       "watermark",
+			"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"read_up_to": "2021-04-01T12:40:00+02:00",
+		})
+		require.NoError(t, err)
+		rsDB.ExpectGet().WithDocID("watermark:439e2d19-8d50-405d-ad8e-cd33df344086:incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444").WillReturn(wm)
+
+		readBy := comment.ReadBy{
+			Time: time.Now().Format(time.RFC3339),
+			User: comment.UserInfo{UUID: "439e2d19-8d50-405d-ad8e-cd33df344086", Name: "Joe"},
+		}
+
+		res, err := s.MarkAsReadByUser(context.Background(), uuid, readBy, channelID, comment.AssetTypeComment, nil)
+		assert.NoError(t, err)
+		assert.True(t, res)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
 	})
 
 	t.Run("when comment does not exist", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
 
@@ -333,14 +595,14 @@ func TestMarkAsReadByUser(t *testing.T) {
 			},
 		}
 
-		res, err := s.MarkAsReadByUser(context.Background(), uuid, readBy, channelID, comment.AssetTypeComment)
+		res, err := s.MarkAsReadByUser(context.Background(), uuid, readBy, channelID, comment.AssetTypeComment, nil)
 		assert.Error(t, err)
 		assert.EqualErrorf(t, err, "Comment with uuid='cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0' does not exist", "errors are not equal")
 		assert.False(t, res)
 	})
 
 	t.Run("when comment was already read by user", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		commentUUID := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
 		userUUID := "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
@@ -384,7 +646,7 @@ func TestMarkAsReadByUser(t *testing.T) {
 			User: userInfo,
 		}
 
-		res, err := s.MarkAsReadByUser(context.Background(), commentUUID, readBy, channelID, comment.AssetTypeComment)
+		res, err := s.MarkAsReadByUser(context.Background(), commentUUID, readBy, channelID, comment.AssetTypeComment, nil)
 		assert.NoError(t, err)
 		assert.True(t, res)
 	})
@@ -397,29 +659,313 @@ func TestCreateDatabase(t *testing.T) {
 	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
 
 	t.Run("when database already exists", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(true)
 
+		// indexes added by newer versions are created in existing databases too
+		mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, comment.AssetTypeComment))
+
 		existed, err := s.CreateDatabase(context.Background(), channelID, comment.AssetTypeComment)
 		assert.Nil(t, err)
 		assert.Equal(t, true, existed)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
 	})
 
 	t.Run("when database does not exist", func(t *testing.T) {
-		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger, nil, nil)
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
 
 		couchMock.ExpectDBExists().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(false)
 		couchMock.ExpectCreateDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment))
-		db := couchMock.NewDB()
-		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
-		db.ExpectCreateIndex()
-		db.ExpectCreateIndex()
-		db.ExpectCreateIndex()
-		db.ExpectCreateIndex()
+		db := mocks.ExpectIndexesCreated(couchMock, testutils.DatabaseName(channelID, comment.AssetTypeComment))
+		db.ExpectPut().WithDocID("_design/counters")
+		mocks.ExpectReadStateDatabaseCreated(couchMock, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
 
 		existed, err := s.CreateDatabase(context.Background(), channelID, comment.AssetTypeComment)
 		assert.Nil(t, err)
 		assert.Equal(t, false, existed)
 	})
 }
+
+func TestUpdateComment(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	uuid := "cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0"
+
+	editedBy := comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+
+	dbC := comment.Comment{
+		UUID:   uuid,
+		Entity: entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444"),
+		Text:   "Some coment",
+	}
+
+	fixText := func(c *comment.Comment) (bool, error) {
+		if c.Text == "Some comment" {
+			return false, nil
+		}
+
+		c.Text = "Some comment"
+		return true, nil
+	}
+
+	t.Run("when comment exists", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(dbC)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		expectBulkDocsWithOutbox(t, db, uuid, "2-a")
+
+		var published comment.Comment
+		res, changed, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, func(c comment.Comment) (*event.Message, error) {
+			published = c
+			return &event.Message{ChannelID: event.UUID(channelID), Data: []byte(`{"events":[]}`)}, nil
+		})
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "Some comment", res.Text)
+		assert.Equal(t, res, published)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comment is deleted", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(dbC)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		db.ExpectPut().WithDocID(uuid)
+
+		// read records of the comment are deleted, so they are not subtracted from unread counters
+		readRecordID := "read:" + editedBy.UUID + ":" + uuid
+		rsDB := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_comment").
+			WithOptions(map[string]interface{}{"key": uuid, "include_docs": true}).
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{
+				ID:  readRecordID,
+				Doc: []byte(`{"_id":"` + readRecordID + `","_rev":"1-a","type":"read","comment_uuid":"` + uuid + `"}`),
+			}))
+		rsDB.ExpectBulkDocs().WillReturn(kivikmock.NewBulkResults().AddResult(&driver.BulkResult{ID: readRecordID, Rev: "2-a"}))
+
+		res, changed, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, func(c *comment.Comment) (bool, error) {
+			c.DeletedAt = "2021-04-01T10:34:56Z"
+			c.DeletedBy = &editedBy
+			return true, nil
+		}, nil)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.True(t, res.IsDeleted())
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comment is not changed", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		fixed := dbC
+		fixed.Text = "Some comment"
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(fixed)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		res, changed, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, func(c comment.Comment) (*event.Message, error) {
+			t.Error("there are no events when the comment is not changed")
+			return nil, nil
+		})
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, fixed, res)
+	})
+
+	t.Run("when comment does not exist", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+
+		db.ExpectGet().WithDocID(uuid).WillExecute(func(ctx context.Context, arg0 string, options map[string]interface{}) (*driver.Document, error) {
+			return &driver.Document{}, &chttp.HTTPError{
+				Response: &http.Response{
+					StatusCode: 404,
+				},
+			}
+		})
+
+		_, _, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, nil)
+		assert.Error(t, err)
+		assert.EqualErrorf(t, err, "Comment with uuid='cb2fe2a7-ab9f-4f6d-9fd6-c7c209403cf0' does not exist", "errors are not equal")
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusNotFound, httpError.StatusCode())
+	})
+
+	t.Run("when modify function fails", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(dbC)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		_, _, err = s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, func(c *comment.Comment) (bool, error) {
+			return false, errors.New("invalid comment")
+		}, nil)
+		assert.EqualError(t, err, "invalid comment")
+
+		assert.NoError(t, couchMock.ExpectationsWereMet(), "nothing is stored")
+	})
+
+	t.Run("when comment was changed concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(dbC)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		db.ExpectPut().WithDocID(uuid).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: 409,
+			},
+		})
+
+		// the change is applied again to the comment reacted by another user in the meantime
+		reacted := dbC
+		reacted.Reactions = comment.ReactionList{{Emoji: "thumbsup", User: editedBy}}
+		row, err = kivikmock.Document(reacted)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		db.ExpectPut().WithDocID(uuid)
+
+		res, changed, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, nil)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "Some comment", res.Text)
+		assert.Len(t, res.Reactions, 1)
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when comment keeps being changed concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+
+		// default number of attempts
+		for i := 0; i < 5; i++ {
+			row, err := kivikmock.Document(dbC)
+			assert.Nil(t, err)
+			db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+			db.ExpectPut().WithDocID(uuid).WillReturnError(&chttp.HTTPError{
+				Response: &http.Response{
+					StatusCode: 409,
+				},
+			})
+		}
+
+		_, _, err := s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, nil)
+		assert.Error(t, err)
+		assert.EqualErrorf(t, err, "Comment could not be updated", "errors are not equal")
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusConflict, httpError.StatusCode())
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when events could not be prepared", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		row, err := kivikmock.Document(dbC)
+		assert.Nil(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+
+		_, _, err = s.UpdateComment(context.Background(), uuid, channelID, comment.AssetTypeComment, fixText, func(c comment.Comment) (*event.Message, error) {
+			return nil, errors.New("could not prepare events: invalid orgID")
+		})
+		assert.Error(t, err)
+		assert.EqualErrorf(t, err, "could not prepare events: invalid orgID", "errors are not equal")
+
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+}
+
+func TestCountPinned(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	pinnedQuery := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"entity":     "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444",
+			"pinned_at":  map[string]interface{}{"$exists": true},
+			"deleted_at": map[string]interface{}{"$exists": false},
+		},
+		"fields": []string{"uuid"},
+		"limit":  1000,
+	}
+
+	t.Run("when comments are pinned", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WithQuery(pinnedQuery).WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Doc: []byte(`{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb"}`)}).
+			AddRow(&driver.Row{ID: "1c4a3c6b-3e0a-4a5e-8d1c-08bd0a3a6f4e", Doc: []byte(`{"uuid":"1c4a3c6b-3e0a-4a5e-8d1c-08bd0a3a6f4e"}`)}))
+
+		pinned, err := s.CountPinned(context.Background(), e, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+		assert.Equal(t, 2, pinned)
+	})
+
+	t.Run("when query fails", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+		db.ExpectFind().WithQuery(pinnedQuery).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: 500,
+			},
+			Reason: "database is down",
+		})
+
+		_, err := s.CountPinned(context.Background(), e, channelID, comment.AssetTypeComment)
+		assert.EqualError(t, err, "Pinned comments could not be counted: database is down")
+
+		var httpError *repository.Error
+		require.True(t, errors.As(err, &httpError))
+		assert.Equal(t, http.StatusInternalServerError, httpError.StatusCode())
+	})
+}
@@ -0,0 +1,312 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+// templateDoc is the comment template stored in the templates database of the channel
+type templateDoc struct {
+	Rev string `json:"_rev,omitempty"`
+	comment.Template
+}
+
+// CreateTemplate saves a given template to the templates database of the channel
+func (s *DBStorage) CreateTemplate(ctx context.Context, t comment.Template, channelID string) (*comment.Template, error) {
+	db := s.client.DB(ctx, templateDatabaseName(channelID))
+
+	uuid, err := repository.GenerateUUID(s.rand)
+	if err != nil {
+		s.logger.Error("could not generate UUID", zap.Error(err))
+		return nil, err
+	}
+
+	t.UUID = uuid
+	t.CreatedAt = time.Now().Format(time.RFC3339)
+
+	err = s.assertTemplateNameUnique(ctx, db, t, "created")
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := db.Put(ctx, uuid, t)
+	if err != nil {
+		s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Template could not be created: %s", httpError.Reason)
+			return nil, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("Template inserted with revision %s", rev))
+
+	return &t, nil
+}
+
+// GetTemplate returns the template with the specified ID
+func (s *DBStorage) GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error) {
+	db := s.client.DB(ctx, templateDatabaseName(channelID))
+
+	doc, err := s.getTemplateDoc(ctx, db, id, "retrieved")
+	if err != nil {
+		return comment.Template{}, err
+	}
+
+	return doc.Template, nil
+}
+
+// ListTemplates returns all templates of the channel sorted by name
+func (s *DBStorage) ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error) {
+	db := s.client.DB(ctx, templateDatabaseName(channelID))
+
+	rows, err := db.AllDocs(ctx, kivik.Options{"include_docs": true})
+	if err != nil {
+		s.logger.Warn("CouchDB ALL DOCS failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Templates could not be listed: %s", httpError.Reason)
+			return nil, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	templates := make([]comment.Template, 0)
+
+	for rows.Next() {
+		// skip design documents of the indexes
+		if strings.HasPrefix(rows.ID(), "_design/") {
+			continue
+		}
+
+		var t comment.Template
+		if err := rows.ScanDoc(&t); err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces name, text and content type of the template with the specified ID
+func (s *DBStorage) UpdateTemplate(ctx context.Context, id string, t comment.Template, channelID string) (*comment.Template, error) {
+	db := s.client.DB(ctx, templateDatabaseName(channelID))
+
+	var doc templateDoc
+	var rev string
+
+	err := s.retryOnConflict(ctx, "template:"+id, func() error {
+		var err error
+
+		doc, err = s.getTemplateDoc(ctx, db, id, "updated")
+		if err != nil {
+			return err
+		}
+
+		doc.Name = t.Name
+		doc.Text = t.Text
+		doc.ContentType = t.ContentType
+		doc.UpdatedBy = t.UpdatedBy
+		doc.UpdatedAt = time.Now().Format(time.RFC3339)
+
+		err = s.assertTemplateNameUnique(ctx, db, doc.Template, "updated")
+		if err != nil {
+			return err
+		}
+
+		rev, err = db.Put(ctx, id, doc)
+		if err != nil {
+			s.logger.Warn("CouchDB PUT failed", zap.Error(err))
+
+			var httpError *chttp.HTTPError
+			if errors.As(err, &httpError) {
+				if httpError.StatusCode() == http.StatusConflict {
+					return revisionConflict(ErrorConflict("Template could not be updated: Template was modified concurrently, try again"))
+				}
+
+				eMsg := fmt.Sprintf("Template could not be updated: %s", httpError.Reason)
+				return repository.NewError(eMsg, http.StatusInternalServerError)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("Template updated with revision %s", rev))
+
+	return &doc.Template, nil
+}
+
+// DeleteTemplate removes the template with the specified ID
+func (s *DBStorage) DeleteTemplate(ctx context.Context, id, channelID string) error {
+	db := s.client.DB(ctx, templateDatabaseName(channelID))
+
+	err := s.retryOnConflict(ctx, "template:"+id, func() error {
+		doc, err := s.getTemplateDoc(ctx, db, id, "deleted")
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Delete(ctx, id, doc.Rev)
+		if err != nil {
+			s.logger.Warn("CouchDB DELETE failed", zap.Error(err))
+
+			var httpError *chttp.HTTPError
+			if errors.As(err, &httpError) {
+				eMsg := fmt.Sprintf("Template could not be deleted: %s", httpError.Reason)
+				if httpError.StatusCode() == http.StatusConflict {
+					return revisionConflict(repository.NewError(eMsg, http.StatusConflict))
+				}
+
+				return repository.NewError(eMsg, httpError.StatusCode())
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info(fmt.Sprintf("Template '%s' deleted", id))
+
+	return nil
+}
+
+// CreateTemplateDatabase creates the templates database of the channel if it does not exist.
+// It returns true if database already existed.
+func (s *DBStorage) CreateTemplateDatabase(ctx context.Context, channelID string) (bool, error) {
+	dbName := templateDatabaseName(channelID)
+
+	dbExists, err := s.client.DBExists(ctx, dbName)
+	if err != nil {
+		s.logger.Error("couchdb connection failed", zap.Error(err))
+		return false, err
+	}
+
+	if dbExists {
+		return true, nil
+	}
+
+	err = s.client.CreateDB(ctx, dbName)
+	if err != nil {
+		s.logger.Error("couchdb database creation failed", zap.Error(err))
+		return false, err
+	}
+
+	db := s.client.DB(ctx, dbName)
+	err = db.CreateIndex(ctx, "", "", map[string]interface{}{"fields": []map[string]string{{"name": "asc"}}})
+	if err != nil {
+		s.logger.Error("couchdb database index creation failed", zap.Error(err))
+		return false, err
+	}
+
+	return false, nil
+}
+
+// getTemplateDoc returns stored template document with the revision needed for its update or deletion
+func (s *DBStorage) getTemplateDoc(ctx context.Context, db *kivik.DB, id, operation string) (templateDoc, error) {
+	var doc templateDoc
+
+	err := db.Get(ctx, id).ScanDoc(&doc)
+	if err != nil {
+		s.logger.Warn("CouchDB GET failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			if httpError.StatusCode() == http.StatusNotFound {
+				eMsg := fmt.Sprintf("Template could not be %s: Template with uuid='%s' does not exist", operation, id)
+				return doc, ErrorNorFound(eMsg)
+			}
+
+			eMsg := fmt.Sprintf("Template could not be %s: %s", operation, httpError.Reason)
+			return doc, repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+// assertTemplateNameUnique returns error if another template of the channel has the same name
+func (s *DBStorage) assertTemplateNameUnique(ctx context.Context, db *kivik.DB, t comment.Template, operation string) error {
+	rows, err := db.Find(ctx, templateNameQuery(t.Name))
+	if err != nil {
+		s.logger.Warn("CouchDB FIND failed", zap.Error(err))
+
+		var httpError *chttp.HTTPError
+		if errors.As(err, &httpError) {
+			eMsg := fmt.Sprintf("Template could not be %s: %s", operation, httpError.Reason)
+			return repository.NewError(eMsg, http.StatusInternalServerError)
+		}
+
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var existing comment.Template
+		if err := rows.ScanDoc(&existing); err != nil {
+			return err
+		}
+
+		if existing.UUID != t.UUID {
+			reason := fmt.Sprintf("template with name='%s' already exists (uuid='%s')", t.Name, existing.UUID)
+			eMsg := fmt.Sprintf("Template could not be %s: %s", operation, reason)
+			return ErrorConflict(eMsg)
+		}
+	}
+
+	return rows.Err()
+}
+
+// templateNameQuery returns Mango query finding the templates with the name,
+// two results are enough to find another template than the updated one
+func templateNameQuery(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"selector": map[string]interface{}{
+			"name": name,
+		},
+		"fields": []string{"uuid"},
+		"limit":  2,
+	}
+}
+
+func templateDatabaseName(channelID string) string {
+	return fmt.Sprintf("p_%s_templates", channelID)
+}
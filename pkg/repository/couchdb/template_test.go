@@ -0,0 +1,245 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTemplate(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	nameQuery := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"name": "Password reset",
+		},
+		"fields": []string{"uuid"},
+		"limit":  2,
+	}
+
+	tpl := comment.Template{
+		Name: "Password reset",
+		Text: "Hello, your password was reset. Regards, {{user.name}}",
+		CreatedBy: &comment.UserInfo{
+			UUID: "439e2d19-8d50-405d-ad8e-cd33df344086",
+			Name: "Joe",
+		},
+	}
+
+	t.Run("when template name is unique", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		db.ExpectFind().WithQuery(nameQuery).WillReturn(kivikmock.NewRows())
+		db.ExpectPut().WithDocID(mocks.GeneratedCommentUUID)
+
+		stored, err := s.CreateTemplate(context.Background(), tpl, channelID)
+		assert.NoError(t, err)
+		assert.Equal(t, mocks.GeneratedCommentUUID, stored.UUID)
+		assert.NotEmpty(t, stored.CreatedAt)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when template with the same name exists", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		db.ExpectFind().WithQuery(nameQuery).WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", Doc: []byte(`{"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"}`)}))
+
+		stored, err := s.CreateTemplate(context.Background(), tpl, channelID)
+		assert.Nil(t, stored)
+
+		var httpError *repository.Error
+		require.ErrorAs(t, err, &httpError)
+		assert.Equal(t, http.StatusConflict, httpError.StatusCode())
+		assert.EqualError(t, err, "Template could not be created: template with name='Password reset' already exists (uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52')")
+	})
+}
+
+func TestListTemplates(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+	db.ExpectAllDocs().WithOptions(map[string]interface{}{"include_docs": true}).WillReturn(kivikmock.NewRows().
+		AddRow(&driver.Row{ID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Doc: []byte(`{"uuid":"0ac5ebce-17e7-4edc-9552-fefe16e127fb","name":"resolved","text":"Resolved"}`)}).
+		AddRow(&driver.Row{ID: "_design/a5f4711fc9448864a13c81dc71e660b524d7410c", Doc: []byte(`{"language":"query"}`)}).
+		AddRow(&driver.Row{ID: "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", Doc: []byte(`{"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52","name":"Password reset","text":"Reset"}`)}))
+
+	templates, err := s.ListTemplates(context.Background(), channelID)
+	assert.NoError(t, err)
+	assert.Equal(t, []comment.Template{
+		{UUID: "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52", Name: "Password reset", Text: "Reset"},
+		{UUID: "0ac5ebce-17e7-4edc-9552-fefe16e127fb", Name: "resolved", Text: "Resolved"},
+	}, templates)
+}
+
+func TestUpdateTemplate(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	uuid := "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+
+	tpl := comment.Template{
+		Name: "Password reset",
+		Text: "Your password was reset",
+		UpdatedBy: &comment.UserInfo{
+			UUID: "439e2d19-8d50-405d-ad8e-cd33df344086",
+			Name: "Joe",
+		},
+	}
+
+	t.Run("when template exists", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		row, err := kivikmock.Document(map[string]interface{}{
+			"_rev": "1-f0a3eb4d4a9ec3ab3bbc4d7a3f6e6b2c",
+			"uuid": uuid,
+			"name": "Password reset",
+			"text": "Hello, your password was reset",
+		})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		db.ExpectFind().WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{ID: uuid, Doc: []byte(`{"uuid":"c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"}`)}))
+		db.ExpectPut().WithDocID(uuid)
+
+		updated, err := s.UpdateTemplate(context.Background(), uuid, tpl, channelID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Your password was reset", updated.Text)
+		assert.Equal(t, tpl.UpdatedBy, updated.UpdatedBy)
+		assert.NotEmpty(t, updated.UpdatedAt)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when template was changed concurrently", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		row, err := kivikmock.Document(map[string]interface{}{
+			"_rev": "1-f0a3eb4d4a9ec3ab3bbc4d7a3f6e6b2c",
+			"uuid": uuid,
+			"name": "Password reset",
+			"text": "Hello, your password was reset",
+		})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		db.ExpectFind().WillReturn(kivikmock.NewRows())
+		db.ExpectPut().WithDocID(uuid).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusConflict,
+			},
+		})
+
+		row, err = kivikmock.Document(map[string]interface{}{
+			"_rev": "2-7d1c4b0e2f3a9c8d6e5b4a3f2e1d0c9b",
+			"uuid": uuid,
+			"name": "Password reset",
+			"text": "Your password was reset by the service desk",
+		})
+		require.NoError(t, err)
+		db.ExpectGet().WithDocID(uuid).WillReturn(row)
+		db.ExpectFind().WillReturn(kivikmock.NewRows())
+		db.ExpectPut().WithDocID(uuid).WillExecute(func(_ context.Context, _ string, doc interface{}, _ map[string]interface{}) (string, error) {
+			b, err := json.Marshal(doc)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), `"_rev":"2-7d1c4b0e2f3a9c8d6e5b4a3f2e1d0c9b"`)
+			return "3-9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d", nil
+		})
+
+		updated, err := s.UpdateTemplate(context.Background(), uuid, tpl, channelID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Your password was reset", updated.Text)
+		assert.NoError(t, couchMock.ExpectationsWereMet())
+	})
+
+	t.Run("when template does not exist", func(t *testing.T) {
+		couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+		db := couchMock.NewDB()
+		couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+		db.ExpectGet().WithDocID(uuid).WillReturnError(&chttp.HTTPError{
+			Response: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+		})
+
+		updated, err := s.UpdateTemplate(context.Background(), uuid, tpl, channelID)
+		assert.Nil(t, updated)
+
+		var httpError *repository.Error
+		require.ErrorAs(t, err, &httpError)
+		assert.Equal(t, http.StatusNotFound, httpError.StatusCode())
+		assert.EqualError(t, err, "Template could not be updated: Template with uuid='c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52' does not exist")
+	})
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	uuid := "c8b94a70-8a5a-4a4c-9a0f-7b0a6b3b6a52"
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+	row, err := kivikmock.Document(map[string]interface{}{
+		"_rev": "1-f0a3eb4d4a9ec3ab3bbc4d7a3f6e6b2c",
+		"uuid": uuid,
+	})
+	require.NoError(t, err)
+	db.ExpectGet().WithDocID(uuid).WillReturn(row)
+	db.ExpectDelete().WithDocID(uuid).WithRev("1-f0a3eb4d4a9ec3ab3bbc4d7a3f6e6b2c")
+
+	err = s.DeleteTemplate(context.Background(), uuid, channelID)
+	assert.NoError(t, err)
+	assert.NoError(t, couchMock.ExpectationsWereMet())
+}
+
+func TestCreateTemplateDatabase(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	couchMock.ExpectDBExists().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(false)
+	couchMock.ExpectCreateDB().WithName(testutils.TemplateDatabaseName(channelID))
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.TemplateDatabaseName(channelID)).WillReturn(db)
+	db.ExpectCreateIndex()
+
+	existed, err := s.CreateTemplateDatabase(context.Background(), channelID)
+	assert.NoError(t, err)
+	assert.False(t, existed)
+	assert.NoError(t, couchMock.ExpectationsWereMet())
+}
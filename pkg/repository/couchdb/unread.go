@@ -0,0 +1,111 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	countersDesignDocID = "_design/counters"
+	createdView         = "created"
+)
+
+// countersDesignDoc contains view of not deleted comments by [entity, created_at]
+// used for counting comments created after the read watermark
+var countersDesignDoc = map[string]interface{}{
+	"language": "javascript",
+	"views": map[string]interface{}{
+		createdView: map[string]interface{}{
+			"map": `function (doc) {
+  if (doc.entity && doc.created_at && !doc.deleted_at) {
+    emit([doc.entity, doc.created_at], null);
+  }
+}`,
+			"reduce": "_count",
+		},
+	},
+}
+
+// CountUnread returns the number of comments of each entity not read by the user,
+// i.e. not deleted comments created after the user's read watermark of the entity minus comments read one by one
+func (s *DBStorage) CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error) {
+	db := s.client.DB(ctx, databaseName(channelID, assetType))
+	if err := s.ensureReadState(ctx, db, channelID, assetType); err != nil {
+		return nil, s.unreadError(err, assetType)
+	}
+
+	watermarks, err := s.userWatermarks(ctx, entities, userUUID, channelID, assetType)
+	if err != nil {
+		return nil, s.unreadError(err, assetType)
+	}
+
+	rsDB := s.client.DB(ctx, readStateDatabaseName(channelID, assetType))
+
+	unread := make(map[string]int, len(entities))
+	for _, e := range entities {
+		created, err := countAfter(ctx, db, countersDesignDocID, createdView, []interface{}{e}, watermarks[e])
+		if err != nil {
+			return nil, s.unreadError(err, assetType)
+		}
+
+		read, err := countAfter(ctx, rsDB, readStateDesignDocID, readsByUserView, []interface{}{userUUID, e}, watermarks[e])
+		if err != nil && kivik.StatusCode(err) != http.StatusNotFound {
+			return nil, s.unreadError(err, assetType)
+		}
+
+		// read records of deleted comments are deleted together with the comments (see UpdateComment),
+		// the counter is never negative even if they were not
+		unread[e] = created - read
+		if unread[e] < 0 {
+			unread[e] = 0
+		}
+	}
+
+	return unread, nil
+}
+
+func (s *DBStorage) unreadError(err error, assetType comment.AssetType) error {
+	s.logger.Warn("CouchDB QUERY failed", zap.Error(err))
+
+	var httpError *chttp.HTTPError
+	if errors.As(err, &httpError) {
+		eMsg := fmt.Sprintf("Unread %s could not be counted: %s", assetType.Plural(), httpError.Reason)
+		return repository.NewError(eMsg, http.StatusInternalServerError)
+	}
+
+	return err
+}
+
+// countAfter returns the number of rows of the reduced view with keys [prefix..., value] where value > after
+func countAfter(ctx context.Context, db *kivik.DB, ddocID, view string, prefix []interface{}, after string) (int, error) {
+	startKey := append(append([]interface{}{}, prefix...), map[string]interface{}{})
+	endKey := append(append([]interface{}{}, prefix...), after)
+
+	rows, err := db.Query(ctx, ddocID, "_view/"+view, kivik.Options{
+		"descending":    true,
+		"startkey":      startKey,
+		"endkey":        endKey,
+		"inclusive_end": false,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	count := 0
+	if rows.Next() {
+		if err := rows.ScanValue(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, rows.Err()
+}
@@ -0,0 +1,124 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/mocks"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/go-kivik/couchdb/v3/chttp"
+	"github.com/go-kivik/kivik/v3/driver"
+	"github.com/go-kivik/kivikmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountUnread(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	userUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+	incident := "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
+	request := "request:7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"
+	readUpTo := "2021-04-01T12:34:56+02:00"
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+	mocks.ExpectReadStateReady(couchMock, db, testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment))
+
+	rsDB := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+	rsDB.ExpectQuery().
+		WithDDocID("read_state").
+		WithView("watermarks_by_user").
+		WithOptions(map[string]interface{}{
+			"keys": []interface{}{[]string{userUUID, incident}, []string{userUUID, request}},
+		}).
+		WillReturn(kivikmock.NewRows().
+			AddRow(&driver.Row{Key: []byte(`["` + userUUID + `","` + incident + `"]`), Value: []byte(`"` + readUpTo + `"`)}))
+
+	couchMock.ExpectDB().WithName(testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)).WillReturn(rsDB)
+
+	// incident: 5 comments after the watermark, 2 of them read one by one
+	db.ExpectQuery().
+		WithDDocID("counters").
+		WithView("created").
+		WithOptions(map[string]interface{}{
+			"descending":    true,
+			"startkey":      []interface{}{incident, map[string]interface{}{}},
+			"endkey":        []interface{}{incident, readUpTo},
+			"inclusive_end": false,
+		}).
+		WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`5`)}))
+	rsDB.ExpectQuery().
+		WithDDocID("read_state").
+		WithView("reads_by_user").
+		WithOptions(map[string]interface{}{
+			"descending":    true,
+			"startkey":      []interface{}{userUUID, incident, map[string]interface{}{}},
+			"endkey":        []interface{}{userUUID, incident, readUpTo},
+			"inclusive_end": false,
+		}).
+		WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`2`)}))
+
+	// request: no watermark, 1 comment not read
+	db.ExpectQuery().WithDDocID("counters").WithView("created").
+		WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`1`)}))
+	rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").
+		WillReturn(kivikmock.NewRows())
+
+	unread, err := s.CountUnread(context.Background(), []string{incident, request}, userUUID, channelID, comment.AssetTypeComment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{incident: 3, request: 1}, unread)
+	assert.NoError(t, couchMock.ExpectationsWereMet())
+}
+
+func TestCountUnreadBeforeReadStateMigration(t *testing.T) {
+	logger, _ := testutils.NewTestLogger()
+	defer func() { _ = logger.Sync() }()
+
+	channelID := "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+	userUUID := "2af4f493-0bd5-4513-b440-6cbb465feadb"
+	incident := "incident:f49d5fd5-8da4-4779-b5ba-32e78aa2c444"
+	rsDBName := testutils.ReadStateDatabaseName(channelID, comment.AssetTypeComment)
+
+	couchMock, s := mocks.NewCouchDBMock(context.Background(), logger)
+
+	expectCount := func(db, rsDB *kivikmock.DB) {
+		couchMock.ExpectDB().WithName(rsDBName).WillReturn(rsDB)
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("watermarks_by_user").WillReturn(kivikmock.NewRows())
+		couchMock.ExpectDB().WithName(rsDBName).WillReturn(rsDB)
+		db.ExpectQuery().WithDDocID("counters").WithView("created").
+			WillReturn(kivikmock.NewRows().AddRow(&driver.Row{Value: []byte(`2`)}))
+		rsDB.ExpectQuery().WithDDocID("read_state").WithView("reads_by_user").WillReturn(kivikmock.NewRows())
+	}
+
+	// the database was created before the read state was introduced and it was not migrated yet
+	db := couchMock.NewDB()
+	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+	db.ExpectGetMeta().WithDocID("_design/counters").WillReturnError(&chttp.HTTPError{
+		Response: &http.Response{
+			StatusCode: http.StatusNotFound,
+		},
+	})
+	db.ExpectPut().WithDocID("_design/counters")
+	mocks.ExpectReadStateDatabaseCreated(couchMock, rsDBName)
+	expectCount(db, couchMock.NewDB())
+
+	unread, err := s.CountUnread(context.Background(), []string{incident}, userUUID, channelID, comment.AssetTypeComment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{incident: 2}, unread)
+
+	// the database is checked only once
+	couchMock.ExpectDB().WithName(testutils.DatabaseName(channelID, comment.AssetTypeComment)).WillReturn(db)
+	expectCount(db, couchMock.NewDB())
+
+	unread, err = s.CountUnread(context.Background(), []string{incident}, userUUID, channelID, comment.AssetTypeComment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{incident: 2}, unread)
+	assert.NoError(t, couchMock.ExpectationsWereMet())
+}
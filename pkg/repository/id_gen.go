@@ -3,10 +3,14 @@ package repository
 import (
 	"io"
 
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	uuidgen "github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+// externalIDNamespace is the namespace of UUIDs derived from external IDs of comments
+var externalIDNamespace = uuidgen.MustParse("5b8a4ab6-3c5e-4f0e-9a43-1f8d1e1b6c2a")
+
 // GenerateUUID returns a random UUID
 func GenerateUUID(rand io.Reader) (string, error) {
 	uuidgen.SetRand(rand)
@@ -18,3 +22,9 @@ func GenerateUUID(rand io.Reader) (string, error) {
 
 	return uuid.String(), nil
 }
+
+// ExternalUUID returns UUID (version 5) derived from the entity and the external ID, so the comment synchronized
+// from an external system always gets the same UUID and the repository cannot store it twice
+func ExternalUUID(e entity.Entity, externalID string) string {
+	return uuidgen.NewSHA1(externalIDNamespace, []byte(e.String()+":"+externalID)).String()
+}
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,3 +14,15 @@ func TestGenerateID(t *testing.T) {
 	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
 	require.Regexp(t, uuidRe, id)
 }
+
+func TestExternalUUID(t *testing.T) {
+	e := entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+
+	id := ExternalUUID(e, "ext-1")
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	require.Regexp(t, uuidRe, id)
+
+	require.Equal(t, id, ExternalUUID(e, "ext-1"), "the same external ID of the entity gets the same UUID")
+	require.NotEqual(t, id, ExternalUUID(e, "ext-2"))
+	require.NotEqual(t, id, ExternalUUID(entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e"), "ext-1"))
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+)
+
+// IdempotencyRecord stores the result of the request made with Idempotency-Key header,
+// so it can be replayed when the request is retried
+type IdempotencyRecord struct {
+	// Key is the value of Idempotency-Key header
+	Key string `json:"key"`
+	// UserUUID of the user who sent the request, keys of different users do not collide
+	UserUUID string `json:"user_uuid"`
+	// RequestHash identifies the request payload, the key must not be reused for different requests
+	RequestHash string `json:"request_hash"`
+	// UUID of the resource created by the request
+	UUID string `json:"uuid,omitempty"`
+	// StatusCode of the response, zero while the request is being processed
+	StatusCode int `json:"status_code,omitempty"`
+	// Location header of the response
+	Location string `json:"location,omitempty"`
+	// Body of the response
+	Body string `json:"body,omitempty"`
+	// ExpiresAt is the time when the key can be used again; pending records expire sooner than completed ones,
+	// so the key reserved by a request which never finished (e.g. the service was stopped) does not block retries
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ScopedKey returns the key qualified by the user who sent the request
+func (r IdempotencyRecord) ScopedKey() string {
+	return r.UserUUID + "_" + r.Key
+}
+
+// IsPending returns true if the request with the key is still being processed
+func (r IdempotencyRecord) IsPending() bool {
+	return r.StatusCode == 0
+}
+
+// IdempotencyService stores idempotency keys with the results of the requests; expired records are deleted
+// by the implementation
+type IdempotencyService interface {
+	// ReserveIdempotencyKey stores pending record of the key; if the key is already stored and not expired,
+	// the stored record is returned instead
+	ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, channelID string, assetType comment.AssetType) (stored *IdempotencyRecord, err error)
+	// CompleteIdempotencyKey stores the result of the request made with the reserved key
+	CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord, channelID string, assetType comment.AssetType) error
+	// ReleaseIdempotencyKey removes the reserved key, so the failed request can be retried
+	ReleaseIdempotencyKey(ctx context.Context, record IdempotencyRecord, channelID string, assetType comment.AssetType) error
+}
@@ -0,0 +1,434 @@
+// Package mango evaluates the subset of CouchDB Mango queries used by the service, so repository backends
+// other than CouchDB accept the same queries and return the same errors.
+package mango
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// DefaultLimit is the number of documents returned by query without limit (as in CouchDB)
+const DefaultLimit = 25
+
+// Query is the parsed Mango query. Supported are selector with $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $regex, $and, $or, $nor and $not operators, sort, fields, limit, skip and bookmark.
+// Only null, boolean, number and string values can be compared.
+type Query struct {
+	Selector map[string]interface{}
+	Sort     []SortField
+	Fields   []string
+	Limit    int
+	// Skip is the number of skipped documents including the offset given by bookmark
+	Skip int
+}
+
+// SortField is one field of the sort syntax
+type SortField struct {
+	Path string
+	Desc bool
+}
+
+// Parse validates the query and returns its parsed form. Query built by the service contains typed values
+// ([]string, []map[string]string, int), it is turned to generic JSON values first as the queries sent by users.
+func Parse(query map[string]interface{}) (Query, error) {
+	q := Query{Limit: DefaultLimit}
+
+	b, err := json.Marshal(query)
+	if err != nil {
+		return q, badRequest(fmt.Sprintf("invalid query: %s", err))
+	}
+
+	var generic map[string]interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return q, badRequest(fmt.Sprintf("invalid query: %s", err))
+	}
+
+	selector, ok := generic["selector"]
+	if !ok {
+		return q, badRequest("Missing required key: selector")
+	}
+
+	q.Selector, ok = selector.(map[string]interface{})
+	if !ok {
+		return q, badRequest("Invalid selector: selector must be a JSON object")
+	}
+
+	if err := validateSelector(q.Selector); err != nil {
+		return q, err
+	}
+
+	if v, ok := generic["sort"]; ok {
+		q.Sort, err = parseSort(v)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	if v, ok := generic["fields"]; ok {
+		fields, ok := v.([]interface{})
+		if !ok {
+			return q, badRequest("Invalid fields: fields must be an array of strings")
+		}
+
+		for _, f := range fields {
+			s, ok := f.(string)
+			if !ok {
+				return q, badRequest("Invalid fields: fields must be an array of strings")
+			}
+
+			q.Fields = append(q.Fields, s)
+		}
+	}
+
+	if v, ok := generic["limit"]; ok {
+		q.Limit, err = parseCount("limit", v)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	if v, ok := generic["skip"]; ok {
+		q.Skip, err = parseCount("skip", v)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	if v, ok := generic["bookmark"]; ok && v != nil && v != "" && v != "nil" {
+		s, ok := v.(string)
+		if !ok {
+			return q, badRequest(fmt.Sprintf("Invalid bookmark value: %v", v))
+		}
+
+		offset, err := decodeBookmark(s)
+		if err != nil {
+			return q, badRequest(fmt.Sprintf("Invalid bookmark value: %s", s))
+		}
+
+		q.Skip += offset
+	}
+
+	return q, nil
+}
+
+// Find returns documents matching the query and the bookmark of the next page
+func Find(docs []map[string]interface{}, query map[string]interface{}) ([]map[string]interface{}, string, error) {
+	q, err := Parse(query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var found []map[string]interface{}
+	for _, doc := range docs {
+		if q.Matches(doc) && q.HasSortFields(doc) {
+			found = append(found, doc)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return q.Less(found[i], found[j])
+	})
+
+	return q.Page(found)
+}
+
+// Page returns the page of matching sorted documents given by skip and limit with the specified fields only
+// and the bookmark of the next page. The bookmark is returned only if the page is full as by CouchDB storage.
+func (q Query) Page(docs []map[string]interface{}) ([]map[string]interface{}, string, error) {
+	start := q.Skip
+	if start > len(docs) {
+		start = len(docs)
+	}
+
+	end := start + q.Limit
+	if end > len(docs) {
+		end = len(docs)
+	}
+
+	result := make([]map[string]interface{}, 0, end-start)
+	for _, doc := range docs[start:end] {
+		result = append(result, q.Project(doc))
+	}
+
+	return result, q.Bookmark(len(result)), nil
+}
+
+// Bookmark returns the bookmark of the page following the page with the specified number of documents,
+// empty if the page is not full. Bookmark is an opaque offset of the next page.
+func (q Query) Bookmark(pageSize int) string {
+	if q.Limit == 0 || pageSize < q.Limit {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(q.Skip + pageSize)))
+}
+
+// HasSortFields returns true if the document contains all sort fields. As with CouchDB indexes,
+// documents without some sort field are not returned by sorted query.
+func (q Query) HasSortFields(doc map[string]interface{}) bool {
+	for _, sf := range q.Sort {
+		if _, ok := Lookup(doc, sf.Path); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Less returns true if the document a is sorted before the document b
+func (q Query) Less(a, b map[string]interface{}) bool {
+	for _, sf := range q.Sort {
+		va, _ := Lookup(a, sf.Path)
+		vb, _ := Lookup(b, sf.Path)
+
+		c := Compare(va, vb)
+		if c == 0 {
+			continue
+		}
+
+		if sf.Desc {
+			return c > 0
+		}
+
+		return c < 0
+	}
+
+	return false
+}
+
+// Project returns the document with the query fields only, the whole document if no fields are specified
+func (q Query) Project(doc map[string]interface{}) map[string]interface{} {
+	if len(q.Fields) == 0 {
+		return doc
+	}
+
+	projected := map[string]interface{}{}
+	for _, path := range q.Fields {
+		value, ok := Lookup(doc, path)
+		if !ok {
+			continue
+		}
+
+		names := strings.Split(path, ".")
+		object := projected
+		for _, name := range names[:len(names)-1] {
+			nested, ok := object[name].(map[string]interface{})
+			if !ok {
+				nested = map[string]interface{}{}
+				object[name] = nested
+			}
+
+			object = nested
+		}
+
+		object[names[len(names)-1]] = value
+	}
+
+	return projected
+}
+
+// parseSort parses array of field names (ascending) and objects with one field name and direction
+func parseSort(v interface{}) ([]SortField, error) {
+	fields, ok := v.([]interface{})
+	if !ok {
+		return nil, badRequest("Invalid sort: sort must be an array")
+	}
+
+	var sortFields []SortField
+	for _, f := range fields {
+		switch sf := f.(type) {
+		case string:
+			sortFields = append(sortFields, SortField{Path: sf})
+		case map[string]interface{}:
+			if len(sf) != 1 {
+				return nil, badRequest("Invalid sort: each sort object must contain exactly one field")
+			}
+
+			for path, dir := range sf {
+				switch dir {
+				case "asc":
+					sortFields = append(sortFields, SortField{Path: path})
+				case "desc":
+					sortFields = append(sortFields, SortField{Path: path, Desc: true})
+				default:
+					return nil, badRequest(fmt.Sprintf("Invalid sort direction: %v", dir))
+				}
+			}
+		default:
+			return nil, badRequest("Invalid sort: sort must be an array of field names or objects")
+		}
+	}
+
+	return sortFields, nil
+}
+
+// parseCount returns non-negative integer value of limit or skip
+func parseCount(name string, v interface{}) (int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, badRequest(fmt.Sprintf("Invalid %s: %v is not a non-negative integer", name, v))
+	}
+
+	return int(f), nil
+}
+
+func decodeBookmark(bookmark string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(bookmark)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid offset '%s'", b)
+	}
+
+	return offset, nil
+}
+
+// validateSelector returns error if the selector contains unsupported operator or invalid operator argument
+func validateSelector(selector map[string]interface{}) error {
+	for _, key := range SortedKeys(selector) {
+		arg := selector[key]
+
+		switch key {
+		case "$and", "$or", "$nor":
+			conds, ok := arg.([]interface{})
+			if !ok {
+				return badArgument(key, arg)
+			}
+
+			for _, cond := range conds {
+				sub, ok := cond.(map[string]interface{})
+				if !ok {
+					return badArgument(key, arg)
+				}
+
+				if err := validateSelector(sub); err != nil {
+					return err
+				}
+			}
+		case "$not":
+			sub, ok := arg.(map[string]interface{})
+			if !ok {
+				return badArgument(key, arg)
+			}
+
+			if err := validateSelector(sub); err != nil {
+				return err
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				return badRequest(fmt.Sprintf("Invalid operator: %s", key))
+			}
+
+			if err := validateCondition(arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateCondition returns error if the field condition is not valid
+func validateCondition(cond interface{}) error {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		if !isScalar(cond) {
+			return badRequest(fmt.Sprintf("Invalid selector value: %v, only null, boolean, number and string values can be compared", cond))
+		}
+
+		return nil
+	}
+
+	for _, key := range SortedKeys(ops) {
+		arg := ops[key]
+
+		if !strings.HasPrefix(key, "$") {
+			// nested field
+			if err := validateCondition(arg); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		switch key {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			if !isScalar(arg) {
+				return badArgument(key, arg)
+			}
+		case "$exists":
+			if _, ok := arg.(bool); !ok {
+				return badArgument(key, arg)
+			}
+		case "$in", "$nin":
+			list, ok := arg.([]interface{})
+			if !ok {
+				return badArgument(key, arg)
+			}
+
+			for _, item := range list {
+				if !isScalar(item) {
+					return badArgument(key, arg)
+				}
+			}
+		case "$regex":
+			pattern, ok := arg.(string)
+			if !ok {
+				return badArgument(key, arg)
+			}
+
+			if _, err := regexp.Compile(pattern); err != nil {
+				return badArgument(key, arg)
+			}
+		case "$and", "$or", "$nor":
+			conds, ok := arg.([]interface{})
+			if !ok {
+				return badArgument(key, arg)
+			}
+
+			for _, c := range conds {
+				if err := validateCondition(c); err != nil {
+					return err
+				}
+			}
+		case "$not":
+			if err := validateCondition(arg); err != nil {
+				return err
+			}
+		default:
+			return badRequest(fmt.Sprintf("Invalid operator: %s", key))
+		}
+	}
+
+	return nil
+}
+
+// isScalar returns true for null, boolean, number and string values
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, bool, float64, string:
+		return true
+	default:
+		return false
+	}
+}
+
+func badArgument(op string, arg interface{}) error {
+	return badRequest(fmt.Sprintf("Bad argument for operator %s: %v", op, arg))
+}
+
+func badRequest(message string) error {
+	return repository.NewError(message, http.StatusBadRequest)
+}
@@ -0,0 +1,251 @@
+package mango
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches returns true if the document matches the query selector
+func (q Query) Matches(doc map[string]interface{}) bool {
+	return matchSelector(doc, q.Selector)
+}
+
+func matchSelector(doc map[string]interface{}, selector map[string]interface{}) bool {
+	for _, key := range SortedKeys(selector) {
+		arg := selector[key]
+
+		var ok bool
+		switch key {
+		case "$and", "$or", "$nor":
+			ok = matchCombination(key, arg, func(cond interface{}) bool {
+				return matchSelector(doc, cond.(map[string]interface{}))
+			})
+		case "$not":
+			ok = !matchSelector(doc, arg.(map[string]interface{}))
+		default:
+			value, exists := Lookup(doc, key)
+			ok = matchCondition(value, exists, arg)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchCondition returns true if the field value matches the condition. Condition is either a value compared
+// for equality or an object of operators and nested fields of the value.
+func matchCondition(value interface{}, exists bool, cond interface{}) bool {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return exists && Compare(value, cond) == 0
+	}
+
+	for _, key := range SortedKeys(ops) {
+		var ok bool
+		if strings.HasPrefix(key, "$") {
+			ok = matchOperator(value, exists, key, ops[key])
+		} else {
+			var nested interface{}
+			var nestedExists bool
+			if object, isObject := value.(map[string]interface{}); isObject {
+				nested, nestedExists = Lookup(object, key)
+			}
+
+			ok = matchCondition(nested, nestedExists, ops[key])
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchOperator returns true if the field value matches the condition operator.
+// Missing field matches only $exists false (and negations).
+func matchOperator(value interface{}, exists bool, op string, arg interface{}) bool {
+	switch op {
+	case "$exists":
+		return exists == arg.(bool)
+	case "$and", "$or", "$nor":
+		return matchCombination(op, arg, func(cond interface{}) bool {
+			return matchCondition(value, exists, cond)
+		})
+	case "$not":
+		return !matchCondition(value, exists, arg)
+	}
+
+	if !exists {
+		return false
+	}
+
+	switch op {
+	case "$eq":
+		return Compare(value, arg) == 0
+	case "$ne":
+		return Compare(value, arg) != 0
+	case "$gt":
+		return Compare(value, arg) > 0
+	case "$gte":
+		return Compare(value, arg) >= 0
+	case "$lt":
+		return Compare(value, arg) < 0
+	case "$lte":
+		return Compare(value, arg) <= 0
+	case "$in":
+		return contains(arg.([]interface{}), value)
+	case "$nin":
+		return !contains(arg.([]interface{}), value)
+	default: // $regex, validated by Parse
+		s, ok := value.(string)
+
+		return ok && regexp.MustCompile(arg.(string)).MatchString(s)
+	}
+}
+
+// matchCombination evaluates conditions of $and, $or and $nor operator
+func matchCombination(op string, arg interface{}, match func(cond interface{}) bool) bool {
+	for _, cond := range arg.([]interface{}) {
+		ok := match(cond)
+
+		switch {
+		case op == "$and" && !ok:
+			return false
+		case op == "$or" && ok:
+			return true
+		case op == "$nor" && ok:
+			return false
+		}
+	}
+
+	return op != "$or"
+}
+
+// contains returns true if the list contains the value or one of its elements if the value is array
+func contains(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if Compare(item, value) == 0 {
+			return true
+		}
+
+		if elements, ok := value.([]interface{}); ok {
+			for _, e := range elements {
+				if Compare(item, e) == 0 {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Lookup returns value of the field given by dot separated path
+func Lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// Compare compares JSON values by CouchDB collation: null < false < true < numbers < strings < arrays < objects
+func Compare(a, b interface{}) int {
+	ra, rb := CollationRank(a), CollationRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch va := a.(type) {
+	case bool:
+		vb := b.(bool)
+		switch {
+		case va == vb:
+			return 0
+		case !va:
+			return -1
+		default:
+			return 1
+		}
+	case float64:
+		vb := b.(float64)
+		switch {
+		case va < vb:
+			return -1
+		case va > vb:
+			return 1
+		default:
+			return 0
+		}
+	case string:
+		return strings.Compare(va, b.(string))
+	case []interface{}:
+		vb := b.([]interface{})
+		for i := 0; i < len(va) && i < len(vb); i++ {
+			if c := Compare(va[i], vb[i]); c != 0 {
+				return c
+			}
+		}
+
+		return len(va) - len(vb)
+	case map[string]interface{}:
+		vb := b.(map[string]interface{})
+		ka, kb := SortedKeys(va), SortedKeys(vb)
+		for i := 0; i < len(ka) && i < len(kb); i++ {
+			if c := strings.Compare(ka[i], kb[i]); c != 0 {
+				return c
+			}
+
+			if c := Compare(va[ka[i]], vb[kb[i]]); c != 0 {
+				return c
+			}
+		}
+
+		return len(ka) - len(kb)
+	default:
+		return 0
+	}
+}
+
+// CollationRank returns order of the JSON value type by CouchDB collation
+func CollationRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// SortedKeys returns keys of the object in deterministic order
+func SortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
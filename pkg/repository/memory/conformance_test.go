@@ -0,0 +1,12 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/repositorytest"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, &memory.Storage{}, nil)
+}
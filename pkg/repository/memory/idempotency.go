@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// ReserveIdempotencyKey stores pending record of the key; if the key is already stored and not expired,
+// the stored record is returned instead
+func (m *Storage) ReserveIdempotencyKey(_ context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) (*repository.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := idempotencyKey(record, channelID, assetType)
+	if stored, ok := m.idempotency[key]; ok && m.currentTime().Before(stored.ExpiresAt) {
+		return &stored, nil
+	}
+
+	if m.idempotency == nil {
+		m.idempotency = make(map[string]repository.IdempotencyRecord)
+	}
+
+	// expired keys are deleted, the reserved one is stored again
+	for k, stored := range m.idempotency {
+		if !m.currentTime().Before(stored.ExpiresAt) {
+			delete(m.idempotency, k)
+		}
+	}
+
+	m.idempotency[key] = record
+
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the result of the request made with the reserved key
+func (m *Storage) CompleteIdempotencyKey(_ context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := idempotencyKey(record, channelID, assetType)
+	if _, ok := m.idempotency[key]; !ok {
+		return errorNotFound(fmt.Sprintf("Idempotency-Key '%s' is not reserved", record.Key))
+	}
+
+	m.idempotency[key] = record
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the reserved key, so the failed request can be retried
+func (m *Storage) ReleaseIdempotencyKey(_ context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, idempotencyKey(record, channelID, assetType))
+
+	return nil
+}
+
+func idempotencyKey(record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) string {
+	return databaseName(channelID, assetType) + "/" + record.ScopedKey()
+}
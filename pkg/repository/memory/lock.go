@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+)
+
+// LockThread stores the lock of the entity thread.
+// It returns true if thread was already locked to notify that resource was not changed.
+func (m *Storage) LockThread(_ context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := lockKey(lock.Entity, channelID, assetType)
+	if _, ok := m.locks[key]; ok {
+		return true, nil
+	}
+
+	if m.locks == nil {
+		m.locks = make(map[string]comment.ThreadLock)
+	}
+
+	lock.LockedAt = m.now()
+	m.locks[key] = lock
+
+	return false, nil
+}
+
+// UnlockThread removes the lock of the entity thread.
+// It returns true if thread was not locked to notify that resource was not changed.
+func (m *Storage) UnlockThread(_ context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := lockKey(e, channelID, assetType)
+	if _, ok := m.locks[key]; !ok {
+		return true, nil
+	}
+
+	delete(m.locks, key)
+
+	return false, nil
+}
+
+// GetThreadLock returns the lock of the entity thread or nil if the thread is not locked
+func (m *Storage) GetThreadLock(_ context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (*comment.ThreadLock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.locks[lockKey(e, channelID, assetType)]
+	if !ok {
+		return nil, nil
+	}
+
+	return &lock, nil
+}
+
+func lockKey(e entity.Entity, channelID string, assetType comment.AssetType) string {
+	return databaseName(channelID, assetType) + "/" + e.String()
+}
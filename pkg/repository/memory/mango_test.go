@@ -0,0 +1,178 @@
+package memory_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryComments(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	texts := map[string]string{}
+	for _, c := range []comment.Comment{
+		{Entity: incident1, Text: "first", ExternalID: "ext-1", CreatedBy: &user},
+		{Entity: incident1, Text: "second", CreatedBy: &user},
+		{Entity: incident1, Text: "third"},
+		{Entity: incident2, Text: "fourth"},
+	} {
+		stored, err := addComment(ctx, s, c, assetType)
+		require.NoError(t, err)
+		texts[stored.UUID] = stored.Text
+	}
+
+	var first string
+	for id, text := range texts {
+		if text == "first" {
+			first = id
+		}
+	}
+
+	_, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "reply", ParentUUID: first}, assetType)
+	require.NoError(t, err)
+
+	_, _, err = s.UpdateComment(ctx, first, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		c.History = append(c.History, comment.HistoryEntry{Text: c.Text, EditedBy: user})
+		c.Text = "first edited"
+		return true, nil
+	}, nil)
+	require.NoError(t, err)
+
+	query := func(query map[string]interface{}) []string {
+		result, err := s.QueryComments(ctx, query, channelID, assetType)
+		require.NoError(t, err)
+
+		var found []string
+		for _, doc := range result.Result {
+			found = append(found, doc["text"].(string))
+		}
+
+		return found
+	}
+
+	sortByText := []map[string]string{{"text": "asc"}}
+
+	tests := []struct {
+		name     string
+		selector map[string]interface{}
+		expected []string
+	}{
+		{"implicit equality", map[string]interface{}{"entity": incident2.String()}, []string{"fourth"}},
+		{"$eq", map[string]interface{}{"text": map[string]interface{}{"$eq": "third"}}, []string{"third"}},
+		{"$gt null matches all", map[string]interface{}{"_id": map[string]interface{}{"$gt": nil}},
+			[]string{"first edited", "fourth", "reply", "second", "third"}},
+		{"$gt", map[string]interface{}{"text": map[string]interface{}{"$gt": "second"}}, []string{"third"}},
+		{"$lt", map[string]interface{}{"text": map[string]interface{}{"$lt": "reply"}}, []string{"first edited", "fourth"}},
+		{"$in", map[string]interface{}{"text": map[string]interface{}{"$in": []string{"second", "fourth"}}}, []string{"fourth", "second"}},
+		{"$exists", map[string]interface{}{"parent_uuid": map[string]interface{}{"$exists": true}}, []string{"reply"}},
+		{"$regex", map[string]interface{}{"text": map[string]interface{}{"$regex": "^f"}}, []string{"first edited", "fourth"}},
+		{"$and", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"entity": incident1.String()},
+			map[string]interface{}{"parent_uuid": map[string]interface{}{"$exists": false}},
+		}}, []string{"first edited", "second", "third"}},
+		{"$or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"external_id": "ext-1"},
+			map[string]interface{}{"entity": incident2.String()},
+		}}, []string{"first edited", "fourth"}},
+		{"nested field", map[string]interface{}{"created_by.uuid": user.UUID}, []string{"first edited", "second"}},
+		{"nested object", map[string]interface{}{"created_by": map[string]interface{}{"org_name": user.OrgName}}, []string{"first edited", "second"}},
+		{"array element field", map[string]interface{}{"history": map[string]interface{}{"$exists": true}}, []string{"first edited"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := query(map[string]interface{}{"selector": tt.selector, "sort": sortByText})
+			assert.Equal(t, tt.expected, found)
+		})
+	}
+
+	t.Run("sort, fields and limit", func(t *testing.T) {
+		result, err := s.QueryComments(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{"entity": incident1.String()},
+			"sort":     []map[string]string{{"text": "desc"}},
+			"fields":   []string{"text", "created_by.uuid"},
+			"limit":    2,
+		}, channelID, assetType)
+		require.NoError(t, err)
+
+		assert.Equal(t, []map[string]interface{}{
+			{"text": "third"},
+			{"text": "second", "created_by": map[string]interface{}{"uuid": user.UUID}},
+		}, result.Result)
+		assert.NotEmpty(t, result.Bookmark)
+
+		// the next page is given by the bookmark, it is the last one
+		result, err = s.QueryComments(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{"entity": incident1.String()},
+			"sort":     []interface{}{map[string]interface{}{"text": "desc"}},
+			"fields":   []interface{}{"text"},
+			"limit":    float64(2),
+			"bookmark": result.Bookmark,
+		}, channelID, assetType)
+		require.NoError(t, err)
+
+		assert.Equal(t, []map[string]interface{}{{"text": "reply"}, {"text": "first edited"}}, result.Result)
+		assert.NotEmpty(t, result.Bookmark)
+
+		result, err = s.QueryComments(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{"entity": incident1.String()},
+			"sort":     []interface{}{map[string]interface{}{"text": "desc"}},
+			"limit":    float64(2),
+			"bookmark": result.Bookmark,
+		}, channelID, assetType)
+		require.NoError(t, err)
+
+		assert.Empty(t, result.Result)
+		assert.Empty(t, result.Bookmark)
+	})
+
+	t.Run("documents without sort field are not returned", func(t *testing.T) {
+		found := query(map[string]interface{}{
+			"selector": map[string]interface{}{},
+			"sort":     []string{"external_id"},
+		})
+		assert.Equal(t, []string{"first edited"}, found)
+	})
+
+	t.Run("documents contain _id and _rev", func(t *testing.T) {
+		result, err := s.QueryComments(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{"text": "first edited"},
+		}, channelID, assetType)
+		require.NoError(t, err)
+		require.Len(t, result.Result, 1)
+
+		assert.Equal(t, first, result.Result[0]["_id"])
+		assert.Regexp(t, "^2-[0-9a-f]{32}$", result.Result[0]["_rev"])
+	})
+
+	for _, tt := range []struct {
+		name  string
+		query map[string]interface{}
+		err   string
+	}{
+		{"missing selector", map[string]interface{}{}, "Missing required key: selector"},
+		{"unknown operator", map[string]interface{}{"selector": map[string]interface{}{"text": map[string]interface{}{"$foo": 1}}},
+			"Invalid operator: $foo"},
+		{"bad regex", map[string]interface{}{"selector": map[string]interface{}{"text": map[string]interface{}{"$regex": "("}}},
+			"Bad argument for operator $regex: ("},
+		{"bad sort direction", map[string]interface{}{"selector": map[string]interface{}{}, "sort": []map[string]string{{"text": "up"}}},
+			"Invalid sort direction: up"},
+		{"bad bookmark", map[string]interface{}{"selector": map[string]interface{}{}, "bookmark": "%%%"},
+			"Invalid bookmark value: %%%"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.QueryComments(ctx, tt.query, channelID, assetType)
+			assert.EqualError(t, err, tt.err)
+			assertStatusCode(t, http.StatusBadRequest, err)
+		})
+	}
+}
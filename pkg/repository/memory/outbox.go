@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+)
+
+// outboxMessage is the message of events stored with the change it describes
+type outboxMessage struct {
+	db     string
+	sentAt string
+	event.OutboxMessage
+}
+
+// addToOutbox stores the message (if not nil) of events of the change of the database to the outbox,
+// it must be called with the lock held, so the message is stored together with the change
+func (m *Storage) addToOutbox(dbName string, msg *event.Message) {
+	if msg == nil {
+		return
+	}
+
+	m.outbox = append(m.outbox, outboxMessage{
+		db: dbName,
+		OutboxMessage: event.OutboxMessage{
+			ID:      fmt.Sprintf("%d", len(m.outbox)+1),
+			Message: *msg,
+		},
+	})
+}
+
+// PendingMessages returns at most limit messages of the outbox not marked as sent yet, the oldest first
+func (m *Storage) PendingMessages(_ context.Context, limit int) ([]event.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []event.OutboxMessage
+	for _, om := range m.outbox {
+		if len(pending) == limit {
+			break
+		}
+
+		if om.sentAt == "" {
+			pending = append(pending, om.OutboxMessage)
+		}
+	}
+
+	return pending, nil
+}
+
+// MarkSent marks the message of the outbox as sent
+func (m *Storage) MarkSent(_ context.Context, msg event.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.outbox {
+		if m.outbox[i].ID == msg.ID {
+			m.outbox[i].sentAt = m.now()
+			return nil
+		}
+	}
+
+	return errorNotFound(fmt.Sprintf("outbox message with id='%s' does not exist", msg.ID))
+}
+
+// GetOutboxMessages returns all messages of the outbox including the sent ones, the oldest first
+func (m *Storage) GetOutboxMessages() []event.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msgs := make([]event.Message, 0, len(m.outbox))
+	for _, om := range m.outbox {
+		msgs = append(msgs, om.Message)
+	}
+
+	return msgs
+}
@@ -2,13 +2,21 @@ package memory
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
 	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/mango"
 )
 
 // Clock provides Now method to enable mocking
@@ -16,141 +24,595 @@ type Clock interface {
 	Now() time.Time
 }
 
-// Storage keeps data in memory
+// Storage keeps data in memory. Comments are kept in separate databases per channel and asset type
+// as in CouchDB, so the storage can replace CouchDB in tests and local development.
+// Databases must be created by CreateDatabase (as in CouchDB), changes of databases never created fail with 404.
 type Storage struct {
-	Rand     io.Reader
-	Clock    Clock
-	comments []Comment
+	Rand  io.Reader
+	Clock Clock
+
+	mu          sync.Mutex
+	databases   map[string]*database
+	locks       map[string]comment.ThreadLock
+	templates   map[string]map[string]comment.Template
+	idempotency map[string]repository.IdempotencyRecord
+	outbox      []outboxMessage
+}
+
+// database keeps the comment documents of one channel and asset type by their IDs
+type database struct {
+	docs map[string]document
+}
+
+// document is the comment stored as JSON, so the stored data are not shared with callers, with its revision number
+type document struct {
+	rev  int
+	body []byte
+}
+
+// comment returns the stored comment
+func (d document) comment() comment.Comment {
+	var c comment.Comment
+	_ = json.Unmarshal(d.body, &c)
+
+	return c
+}
+
+// fields returns the stored comment as generic JSON object with _id and _rev fields as returned by CouchDB
+func (d document) fields(id string) map[string]interface{} {
+	doc := map[string]interface{}{}
+	_ = json.Unmarshal(d.body, &doc)
+
+	doc["_id"] = id
+	doc["_rev"] = fmt.Sprintf("%d-%x", d.rev, md5.Sum(d.body))
+
+	return doc
+}
+
+// get returns the stored comment with specified ID
+func (db *database) get(id string) (comment.Comment, bool) {
+	d, ok := db.docs[id]
+	if !ok {
+		return comment.Comment{}, false
+	}
+
+	return d.comment(), true
+}
+
+// put stores the comment under its UUID
+func (db *database) put(c comment.Comment) {
+	body, _ := json.Marshal(c)
+	db.docs[c.UUID] = document{rev: db.docs[c.UUID].rev + 1, body: body}
+}
+
+// ids returns IDs of all stored comments in ascending order (order of CouchDB _all_docs)
+func (db *database) ids() []string {
+	ids := make([]string, 0, len(db.docs))
+	for id := range db.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// comments returns all stored comments ordered by their IDs
+func (db *database) comments() []comment.Comment {
+	comments := make([]comment.Comment, 0, len(db.docs))
+	for _, id := range db.ids() {
+		comments = append(comments, db.docs[id].comment())
+	}
+
+	return comments
+}
+
+// database returns the database of the channel and asset type created by CreateDatabase
+func (m *Storage) database(channelID string, assetType comment.AssetType) (*database, error) {
+	db, ok := m.databases[databaseName(channelID, assetType)]
+	if !ok {
+		return nil, errorNotFound(fmt.Sprintf("database of %s does not exist", assetType.Plural()))
+	}
+
+	return db, nil
+}
+
+// now returns current time in the format of stored timestamps
+func (m *Storage) now() string {
+	return comment.FormatTimestamp(m.currentTime())
+}
+
+func (m *Storage) currentTime() time.Time {
+	if m.Clock == nil {
+		return time.Now()
+	}
+
+	return m.Clock.Now()
 }
 
-// AddComment saves the given asset to the repository and returns it's ID
-func (m *Storage) AddComment(_ context.Context, c comment.Comment, _ string, _ comment.AssetType) (*comment.Comment, error) {
-	id, err := repository.GenerateUUID(m.Rand)
+// AddComment saves the given comment to the database and returns it. The message returned by events function
+// (if not nil) is stored to the outbox together with the comment.
+func (m *Storage) AddComment(_ context.Context, c comment.Comment, channelID string, assetType comment.AssetType, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	title := strings.Title(assetType.String())
+
+	db, err := m.database(channelID, assetType)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errorNotFound(fmt.Sprintf("%s could not be added: %s", title, err))
 	}
 
-	createdBy := CreatedBy{}
-	if c.CreatedBy != nil {
-		createdBy.UUID = c.CreatedBy.UUID
-		createdBy.Name = c.CreatedBy.Name
-		createdBy.Surname = c.CreatedBy.Surname
+	if _, exists := db.get(c.UUID); exists {
+		return nil, errorConflict(fmt.Sprintf("%s could not be added: %s already exists", title, title))
 	}
 
-	newC := Comment{
-		ID:        id,
-		Entity:    c.Entity,
-		Text:      c.Text,
-		CreatedBy: createdBy,
-		CreatedAt: m.Clock.Now().Format(time.RFC3339),
+	msg, err := eventMessage(c, events)
+	if err != nil {
+		return nil, err
 	}
-	m.comments = append(m.comments, newC)
 
-	//extend original comment with generated stuff
-	c.UUID = id
-	c.CreatedAt = newC.CreatedAt
+	db.put(c)
+	m.addToOutbox(databaseName(channelID, assetType), msg)
 
 	return &c, nil
 }
 
 // GetComment returns a comment with the specified ID
-func (m *Storage) GetComment(ctx context.Context, id, _ string, _ comment.AssetType) (comment.Comment, error) {
+func (m *Storage) GetComment(_ context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the comment of database never created does not exist (as in CouchDB)
 	var c comment.Comment
+	ok := false
+	if db, err := m.database(channelID, assetType); err == nil {
+		c, ok = db.get(id)
+	}
+	if !ok {
+		title := strings.Title(assetType.String())
+		eMsg := fmt.Sprintf("%s could not be retrieved: %s with uuid='%s' does not exist", title, title, id)
+		return c, errorNotFound(eMsg)
+	}
 
-	for i := range m.comments {
-
-		if m.comments[i].ID == id {
-			sc := m.comments[i] // stored comment
-			c.UUID = sc.ID
-			c.Entity = sc.Entity
-			c.Text = sc.Text
-			c.ExternalID = sc.ExternalID
-
-			if len(sc.ReadBy) > 0 {
-				for _, rb := range sc.ReadBy {
-					c.ReadBy = append(c.ReadBy, comment.ReadBy{
-						Time: rb.Time,
-						User: comment.UserInfo{
-							UUID:           rb.User.UUID,
-							Name:           rb.User.Name,
-							Surname:        rb.User.Surname,
-							OrgDisplayName: rb.User.OrgDisplayName,
-							OrgName:        rb.User.OrgName,
-						},
-					})
-				}
-			}
+	return c, nil
+}
+
+// GetAllComments returns comments of all channels and asset types
+func (m *Storage) GetAllComments() []comment.Comment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.databases))
+	for name := range m.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-			c.CreatedAt = sc.CreatedAt
-			if sc.CreatedBy.UUID != "" {
-				createdBy := &comment.UserInfo{
-					UUID:    sc.CreatedBy.UUID,
-					Name:    sc.CreatedBy.Name,
-					Surname: sc.CreatedBy.Surname,
-				}
-				c.CreatedBy = createdBy
+	var comments []comment.Comment
+	for _, name := range names {
+		comments = append(comments, m.databases[name].comments()...)
+	}
+
+	return comments
+}
+
+// QueryComments finds comments using the subset of Mango query syntax (see mango.Query)
+func (m *Storage) QueryComments(_ context.Context, query map[string]interface{}, channelID string, assetType comment.AssetType) (listing.QueryResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	db, err := m.database(channelID, assetType)
+	if err != nil {
+		return listing.QueryResult{}, errorNotFound(fmt.Sprintf("%s could not be queried: %s", strings.Title(assetType.Plural()), err))
+	}
+
+	docs := make([]map[string]interface{}, 0, len(db.docs))
+	for _, id := range db.ids() {
+		docs = append(docs, db.docs[id].fields(id))
+	}
+
+	result, bookmark, err := mango.Find(docs, query)
+	if err != nil {
+		return listing.QueryResult{}, err
+	}
+
+	return listing.QueryResult{
+		Result:   result,
+		Bookmark: bookmark,
+	}, nil
+}
+
+// modifyComment lets modify function change the comment with specified ID and stores the changed comment.
+// Modify function returns false if there is nothing to store. It returns the comment after the change
+// and true if it was stored.
+func (m *Storage) modifyComment(id string, channelID string, assetType comment.AssetType, modify func(c *comment.Comment) (bool, error)) (comment.Comment, bool, error) {
+	// the comment of database never created does not exist (as in CouchDB)
+	var c comment.Comment
+	ok := false
+	db, err := m.database(channelID, assetType)
+	if err == nil {
+		c, ok = db.get(id)
+	}
+	if !ok {
+		reason := fmt.Sprintf("%s with uuid='%s' does not exist", strings.Title(assetType.String()), id)
+		return c, false, errorNotFound(reason)
+	}
+
+	changed, err := modify(&c)
+	if err != nil || !changed {
+		return c, false, err
+	}
+
+	db.put(c)
+
+	return c, true, nil
+}
+
+// MarkAsReadByUser adds user info to read_by array of the comment with specified ID. The message returned
+// by events function (if not nil) is stored to the outbox if the comment was marked. It returns true if comment
+// was already marked before to notify that resource was not changed.
+func (m *Storage) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(c comment.Comment) (*event.Message, error)) (bool, error) {
+	_, changed, err := m.UpdateComment(ctx, id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		return markAsRead(c, readBy), nil
+	}, events)
+
+	return !changed, err
+}
+
+// markAsRead adds user info to read_by array, it returns false if the user already read the comment
+func markAsRead(c *comment.Comment, readBy comment.ReadBy) bool {
+	if readByUser(c.ReadBy, readBy.User.UUID) {
+		return false
+	}
+
+	c.ReadBy = append(c.ReadBy, readBy)
+
+	return true
+}
+
+// readByUser returns true if the read_by array contains the user
+func readByUser(readBy comment.ReadByList, userUUID string) bool {
+	for _, rb := range readBy {
+		if rb.User.UUID == userUUID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MarkAllAsReadByUser adds user info to read_by array of all not deleted comments of the entity
+// created at or before upTo not read by the user yet. The message returned by events function (if not nil)
+// for upTo (created_at of the newest marked comment if empty) is stored to the outbox if some comments were marked.
+// It returns the number of marked comments.
+func (m *Storage) MarkAllAsReadByUser(_ context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(upTo string) (*event.Message, error)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	db, err := m.database(channelID, assetType)
+	if err != nil {
+		return 0, err
+	}
+
+	var marked []comment.Comment
+	newest := upTo
+	for _, c := range db.comments() {
+		if c.Entity.String() != e.String() || c.IsDeleted() || (upTo != "" && c.CreatedAt > upTo) {
+			continue
+		}
+
+		if markAsRead(&c, readBy) {
+			marked = append(marked, c)
+			if c.CreatedAt > newest {
+				newest = c.CreatedAt
 			}
+		}
+	}
+
+	if len(marked) == 0 {
+		return 0, nil
+	}
+
+	var msg *event.Message
+	if events != nil {
+		var err error
+		if msg, err = events(newest); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, c := range marked {
+		db.put(c)
+	}
+	m.addToOutbox(databaseName(channelID, assetType), msg)
+
+	return len(marked), nil
+}
+
+// UpdateComment lets modify function change the comment with specified ID and stores the changed comment.
+// Modify function returns false if there is nothing to store. The message returned by events function (if not nil)
+// is stored to the outbox together with the changed comment. It returns the comment after the change and true
+// if it was stored.
+func (m *Storage) UpdateComment(_ context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-			return c, nil
+	var msg *event.Message
+	c, changed, err := m.modifyComment(id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		changed, err := modify(c)
+		if err != nil || !changed {
+			return changed, err
 		}
+
+		if msg, err = eventMessage(*c, events); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
+	if err != nil || !changed {
+		return c, changed, err
 	}
 
-	return c, ErrNotFound
+	m.addToOutbox(databaseName(channelID, assetType), msg)
+
+	return c, true, nil
 }
 
-// GetAllComments return all comments
-func (m *Storage) GetAllComments() []comment.Comment {
-	var comments []comment.Comment
+// PinComment lets modify function pin the comment with specified ID like UpdateComment does, modify gets the number
+// of pinned comments of its entity counted under the same lock
+func (m *Storage) PinComment(_ context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment, pinned int) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	for i := range m.comments {
+	var msg *event.Message
+	c, changed, err := m.modifyComment(id, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		// the database exists, the comment was found there
+		db, _ := m.database(channelID, assetType)
 
-		c := comment.Comment{
-			UUID:      m.comments[i].ID,
-			Entity:    m.comments[i].Entity,
-			Text:      m.comments[i].Text,
-			CreatedAt: m.comments[i].CreatedAt,
+		changed, err := modify(c, countPinned(db, c.Entity))
+		if err != nil || !changed {
+			return changed, err
 		}
 
-		comments = append(comments, c)
+		if msg, err = eventMessage(*c, events); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
+	if err != nil || !changed {
+		return c, changed, err
 	}
 
-	return comments
+	m.addToOutbox(databaseName(channelID, assetType), msg)
+
+	return c, true, nil
 }
 
-// MarkAsReadByUser adds user info to read_by array to comment with specified ID
-func (m *Storage) MarkAsReadByUser(_ context.Context, id string, readBy comment.ReadBy, _ string, _ comment.AssetType) (bool, error) {
-	for i := range m.comments {
-		if m.comments[i].ID == id {
-			sc := m.comments[i] // stored comment
-			if sc.ReadBy == nil {
-				sc.ReadBy = make(ReadByList, 0)
-			}
+// CountPinned returns the number of pinned comments of the entity that are not deleted
+func (m *Storage) CountPinned(_ context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	db, err := m.database(channelID, assetType)
+	if err != nil {
+		return 0, err
+	}
+
+	return countPinned(db, e), nil
+}
+
+func countPinned(db *database, e entity.Entity) int {
+	pinned := 0
+	for _, c := range db.comments() {
+		if c.Entity.String() == e.String() && c.IsPinned() && !c.IsDeleted() {
+			pinned++
+		}
+	}
+
+	return pinned
+}
+
+// ConvertComment moves the comment with specified ID changed by convert function from the database of one asset type
+// to the database of another one. The comment keeps its UUID, author and read state. Comments with replies cannot
+// be converted. The message returned by events function (if not nil) is stored to the outbox together with the change.
+func (m *Storage) ConvertComment(_ context.Context, id, channelID string, from, to comment.AssetType,
+	convert func(c *comment.Comment) error, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	title := strings.Title(from.String())
+
+	// the comment of database never created does not exist (as in CouchDB)
+	srcDB, err := m.database(channelID, from)
+	if err != nil {
+		return nil, errorNotFound(fmt.Sprintf("%s with uuid='%s' does not exist", title, id))
+	}
+
+	original, ok := srcDB.docs[id]
+	if !ok {
+		return nil, errorNotFound(fmt.Sprintf("%s with uuid='%s' does not exist", title, id))
+	}
+
+	dstDB, err := m.database(channelID, to)
+	if err != nil {
+		return nil, errorNotFound(fmt.Sprintf("%s could not be converted: %s", title, err))
+	}
+
+	c := original.comment()
+	if err := convert(&c); err != nil {
+		return nil, err
+	}
+
+	for _, reply := range srcDB.comments() {
+		if reply.ParentUUID == id {
+			eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' has replies", title, from, id)
+			return nil, errorConflict(eMsg)
+		}
+	}
+
+	if _, exists := dstDB.get(id); exists {
+		eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' already exists", title, to, id)
+		return nil, errorConflict(eMsg)
+	}
+
+	msg, err := eventMessage(c, events)
+	if err != nil {
+		return nil, err
+	}
+
+	dstDB.put(c)
+	delete(srcDB.docs, id)
+	m.addToOutbox(databaseName(channelID, from), msg)
+
+	return &c, nil
+}
 
-			for _, rb := range sc.ReadBy {
-				if rb.User.UUID == readBy.User.UUID {
-					return true, nil
-				}
+// MergeEntity moves all comments of the merged entity to the target entity, or stores their copies when merge mode
+// is copy. Merged comments are unpinned and their original_entity field keeps the merged entity (the first one
+// if the comment was merged repeatedly). Copies get new UUIDs, no read state and replies are linked to the copies
+// of their parents. The message returned by events function (if not nil) for UUIDs of the merged comments is stored
+// to the outbox together with them. It returns the number of merged comments.
+func (m *Storage) MergeEntity(_ context.Context, merge comment.EntityMerge, channelID string, assetType comment.AssetType,
+	events func(uuids []string) (*event.Message, error)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	db, err := m.database(channelID, assetType)
+	if err != nil {
+		return 0, err
+	}
+
+	copies := map[string]string{}
+	var merged []comment.Comment
+	for _, c := range db.comments() {
+		if c.Entity.String() != merge.Source.String() {
+			continue
+		}
+
+		c.Entity = merge.Target
+		c.PinnedAt = ""
+		c.PinnedBy = nil
+		if c.OriginalEntity == nil {
+			source := merge.Source
+			c.OriginalEntity = &source
+		}
+
+		if merge.IsCopy() {
+			uuid, err := repository.GenerateUUID(m.Rand)
+			if err != nil {
+				return 0, err
 			}
 
-			sc.ReadBy = append(sc.ReadBy, ReadBy{
-				Time: readBy.Time,
-				User: UserInfo{
-					UUID:           readBy.User.UUID,
-					Name:           readBy.User.Name,
-					Surname:        readBy.User.Surname,
-					OrgDisplayName: readBy.User.OrgDisplayName,
-					OrgName:        readBy.User.OrgName,
-				},
-			})
+			copies[c.UUID] = uuid
+			c.UUID = uuid
+			c.ReadBy = nil
+		}
+
+		merged = append(merged, c)
+	}
+
+	if len(merged) == 0 {
+		return 0, nil
+	}
+
+	uuids := make([]string, 0, len(merged))
+	for i := range merged {
+		if parent, ok := copies[merged[i].ParentUUID]; ok {
+			merged[i].ParentUUID = parent
+		}
+
+		uuids = append(uuids, merged[i].UUID)
+	}
+
+	var msg *event.Message
+	if events != nil {
+		var err error
+		if msg, err = events(uuids); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, c := range merged {
+		db.put(c)
+	}
+	m.addToOutbox(databaseName(channelID, assetType), msg)
+
+	return len(merged), nil
+}
+
+// CountUnread returns the number of not deleted comments of each entity not read by the user
+func (m *Storage) CountUnread(_ context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unread := make(map[string]int, len(entities))
+	for _, e := range entities {
+		unread[e] = 0
+	}
+
+	db, err := m.database(channelID, assetType)
+	if err != nil {
+		return nil, err
+	}
 
-			m.comments[i] = sc
+	for _, c := range db.comments() {
+		if c.IsDeleted() {
+			continue
+		}
+
+		e := c.Entity.String()
+		if _, ok := unread[e]; !ok {
+			continue
+		}
+
+		if !readByUser(c.ReadBy, userUUID) {
+			unread[e]++
 		}
 	}
 
+	return unread, nil
+}
+
+// CreateDatabase creates the database of the channel and asset type if it does not exist.
+// It returns true if database already existed.
+func (m *Storage) CreateDatabase(_ context.Context, channelID string, assetType comment.AssetType) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.databases == nil {
+		m.databases = make(map[string]*database)
+	}
+
+	name := databaseName(channelID, assetType)
+	if _, exists := m.databases[name]; exists {
+		return true, nil
+	}
+
+	m.databases[name] = &database{docs: make(map[string]document)}
+
 	return false, nil
 }
 
-// QueryComments is not implemented
-func (m *Storage) QueryComments(_ context.Context, _ map[string]interface{}, _ string, _ comment.AssetType) (listing.QueryResult, error) {
-	panic("not implemented")
+// MigrateReadState does nothing as read state is kept in read_by array of the comments. It returns zero.
+func (m *Storage) MigrateReadState(_ context.Context, _ string, _ comment.AssetType) (int, error) {
+	return 0, nil
+}
+
+// eventMessage returns the message returned by events function for the comment, nil if the function is nil
+func eventMessage(c comment.Comment, events func(c comment.Comment) (*event.Message, error)) (*event.Message, error) {
+	if events == nil {
+		return nil, nil
+	}
+
+	return events(c)
+}
+
+func databaseName(channelID string, assetType comment.AssetType) string {
+	return fmt.Sprintf("p_%s_%s", channelID, assetType.Plural())
 }
@@ -0,0 +1,313 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/memory"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const channelID = "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+var (
+	incident1 = entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	incident2 = entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
+	user      = comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+)
+
+// addComment adds the comment with UUID and created_at set the same way as by the adding service
+func addComment(ctx context.Context, s *memory.Storage, c comment.Comment, assetType comment.AssetType) (*comment.Comment, error) {
+	c.UUID = uuid.New().String()
+	c.CreatedAt = testutils.FixedClock{}.NowFormatted()
+
+	return s.AddComment(ctx, c, channelID, assetType, nil)
+}
+
+func assertStatusCode(t *testing.T, expected int, err error) {
+	var repoErr *repository.Error
+	require.ErrorAs(t, err, &repoErr)
+	assert.Equal(t, expected, repoErr.StatusCode())
+}
+
+func TestCreateDatabase(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+
+	alreadyExisted, err := s.CreateDatabase(ctx, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateDatabase(ctx, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.True(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateDatabase(ctx, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateTemplateDatabase(ctx, channelID)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateTemplateDatabase(ctx, channelID)
+	require.NoError(t, err)
+	assert.True(t, alreadyExisted)
+}
+
+func TestChannelAndAssetTypeIsolation(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+	testutils.CreateDatabases(t, s, channelID)
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", CreatedBy: &user}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	stored, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Equal(t, *c, stored)
+	assert.Equal(t, &user, stored.CreatedBy, "org fields of the author are kept")
+
+	_, err = s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeWorknote)
+	assert.EqualError(t, err, "Worknote could not be retrieved: Worknote with uuid='"+c.UUID+"' does not exist")
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	_, err = s.GetComment(ctx, c.UUID, "another-channel", comment.AssetTypeComment)
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{}}, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.Empty(t, result.Result)
+}
+
+func TestAddCommentUniqueness(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", ExternalID: "ext-1"}, assetType)
+	require.NoError(t, err)
+
+	// uniqueness of external IDs is guaranteed by UUIDs derived from them (see adding.Service)
+	_, err = s.AddComment(ctx, *c, channelID, assetType, nil)
+	assert.EqualError(t, err, "Comment could not be added: Comment already exists")
+	assertStatusCode(t, http.StatusConflict, err)
+}
+
+func TestAddCommentEvents(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c := comment.Comment{UUID: uuid.New().String(), Entity: incident1, Text: "Test 1"}
+	_, err := s.AddComment(ctx, c, channelID, assetType, func(c comment.Comment) (*event.Message, error) {
+		return nil, errors.New("could not prepare events")
+	})
+	assert.EqualError(t, err, "could not prepare events")
+
+	_, err = s.GetComment(ctx, c.UUID, channelID, assetType)
+	assertStatusCode(t, http.StatusNotFound, err)
+	assert.Empty(t, s.GetOutboxMessages())
+
+	msg := event.Message{ChannelID: channelID, Data: []byte(`{"events":[]}`)}
+	_, err = s.AddComment(ctx, c, channelID, assetType, func(c comment.Comment) (*event.Message, error) {
+		return &msg, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []event.Message{msg}, s.GetOutboxMessages())
+
+	_, err = s.AddComment(ctx, c, channelID, assetType, nil)
+	assert.EqualError(t, err, "Comment could not be added: Comment already exists")
+	assertStatusCode(t, http.StatusConflict, err)
+}
+
+func TestUpdateComment(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c1, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1"}, assetType)
+	require.NoError(t, err)
+	c2, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 2"}, assetType)
+	require.NoError(t, err)
+
+	pin := func(c *comment.Comment) (bool, error) {
+		c.PinnedAt = testutils.FixedClock{}.NowFormatted()
+		c.PinnedBy = &user
+		return true, nil
+	}
+
+	updated, changed, err := s.UpdateComment(ctx, c1.UUID, channelID, assetType, pin, nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, updated.IsPinned())
+
+	// nothing is stored if events cannot be prepared
+	_, _, err = s.UpdateComment(ctx, c2.UUID, channelID, assetType, pin, func(c comment.Comment) (*event.Message, error) {
+		return nil, errors.New("could not prepare events")
+	})
+	assert.EqualError(t, err, "could not prepare events")
+
+	pinned, err := s.CountPinned(ctx, incident1, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pinned)
+
+	// nothing is stored if modify function does not change the comment
+	_, changed, err = s.UpdateComment(ctx, c2.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		return false, nil
+	}, nil)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	_, _, err = s.UpdateComment(ctx, "missing", channelID, assetType, pin, nil)
+	assert.EqualError(t, err, "Comment with uuid='missing' does not exist")
+	assertStatusCode(t, http.StatusNotFound, err)
+}
+
+func TestConvertComment(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{}
+	testutils.CreateDatabases(t, s, channelID)
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Posted by mistake"}, comment.AssetTypeComment)
+	require.NoError(t, err)
+	reply, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Reply", ParentUUID: c.UUID}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	convert := func(c *comment.Comment) error { return nil }
+
+	_, err = s.ConvertComment(ctx, c.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+	assert.EqualError(t, err, "Comment could not be converted: comment with uuid='"+c.UUID+"' has replies")
+	assertStatusCode(t, http.StatusConflict, err)
+
+	// the comment is not moved if events cannot be prepared
+	_, err = s.ConvertComment(ctx, reply.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+		return nil, errors.New("could not prepare events")
+	})
+	assert.EqualError(t, err, "could not prepare events")
+
+	_, err = s.GetComment(ctx, reply.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	converted, err := s.ConvertComment(ctx, reply.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+	require.NoError(t, err)
+	assert.Equal(t, reply.UUID, converted.UUID)
+
+	_, err = s.GetComment(ctx, reply.UUID, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+}
+
+func TestMergeEntity(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Parent"}, assetType)
+	require.NoError(t, err)
+	_, err = addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Reply", ParentUUID: c.UUID}, assetType)
+	require.NoError(t, err)
+
+	merged, err := s.MergeEntity(ctx, comment.EntityMerge{Source: incident1, Target: incident2, Mode: comment.MergeModeCopy}, channelID, assetType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, merged)
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{"entity": incident2.String(), "parent_uuid": map[string]interface{}{"$exists": true}},
+	}, channelID, assetType)
+	require.NoError(t, err)
+	require.Len(t, result.Result, 1)
+
+	copiedReply := result.Result[0]
+	assert.NotEqual(t, c.UUID, copiedReply["parent_uuid"], "reply is linked to the copy of its parent")
+	assert.Equal(t, incident1.String(), copiedReply["original_entity"])
+
+	parent, err := s.GetComment(ctx, copiedReply["parent_uuid"].(string), channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, incident2, parent.Entity)
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	s := &memory.Storage{Clock: testutils.FixedClock{}}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	for _, text := range []string{"Test 1", "Test 2", "Test 3"} {
+		c := comment.Comment{UUID: uuid.New().String(), Entity: incident1, Text: text}
+		_, err := s.AddComment(ctx, c, channelID, assetType, func(c comment.Comment) (*event.Message, error) {
+			return &event.Message{ChannelID: channelID, Data: []byte(`"` + c.Text + `"`)}, nil
+		})
+		require.NoError(t, err)
+	}
+
+	pending, err := s.PendingMessages(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, `"Test 1"`, string(pending[0].Data))
+	assert.Equal(t, `"Test 2"`, string(pending[1].Data))
+
+	require.NoError(t, s.MarkSent(ctx, pending[0]))
+
+	pending, err = s.PendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, `"Test 2"`, string(pending[0].Data))
+	assert.Equal(t, `"Test 3"`, string(pending[1].Data))
+
+	err = s.MarkSent(ctx, event.OutboxMessage{ID: "missing"})
+	assertStatusCode(t, http.StatusNotFound, err)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	clock := testutils.FixedClock{}
+	s := &memory.Storage{Clock: clock}
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	record := repository.IdempotencyRecord{Key: "key-1", UserUUID: "2af4f493-0bd5-4513-b440-6cbb465feadb", RequestHash: "hash", ExpiresAt: clock.Now().Add(1)}
+
+	stored, err := s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	stored, err = s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.True(t, stored.IsPending())
+
+	// the same key sent by another user
+	otherUser := record
+	otherUser.UserUUID = "0ac5ebce-17e7-4edc-9552-fefe16e127fb"
+	stored, err = s.ReserveIdempotencyKey(ctx, otherUser, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	err = s.CompleteIdempotencyKey(ctx, repository.IdempotencyRecord{Key: "key-2"}, channelID, assetType)
+	assert.EqualError(t, err, "Idempotency-Key 'key-2' is not reserved")
+
+	require.NoError(t, s.ReleaseIdempotencyKey(ctx, record, channelID, assetType))
+
+	stored, err = s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// CreateTemplate saves a given template to the templates of the channel
+func (m *Storage) CreateTemplate(_ context.Context, t comment.Template, channelID string) (*comment.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	templates := m.channelTemplates(channelID)
+
+	uuid, err := repository.GenerateUUID(m.Rand)
+	if err != nil {
+		return nil, err
+	}
+
+	t.UUID = uuid
+	t.CreatedAt = m.now()
+
+	if err := assertTemplateNameUnique(templates, t, "created"); err != nil {
+		return nil, err
+	}
+
+	templates[uuid] = t
+
+	return &t, nil
+}
+
+// GetTemplate returns the template with the specified ID
+func (m *Storage) GetTemplate(_ context.Context, id, channelID string) (comment.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.channelTemplates(channelID)[id]
+	if !ok {
+		return comment.Template{}, templateNotFound(id, "retrieved")
+	}
+
+	return t, nil
+}
+
+// ListTemplates returns all templates of the channel sorted by name
+func (m *Storage) ListTemplates(_ context.Context, channelID string) ([]comment.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	templates := make([]comment.Template, 0)
+	for _, t := range m.channelTemplates(channelID) {
+		templates = append(templates, t)
+	}
+
+	// templates are listed in the order of their IDs before sorting as in CouchDB
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].UUID < templates[j].UUID
+	})
+	sort.SliceStable(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces name, text and content type of the template with the specified ID
+func (m *Storage) UpdateTemplate(_ context.Context, id string, t comment.Template, channelID string) (*comment.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	templates := m.channelTemplates(channelID)
+
+	stored, ok := templates[id]
+	if !ok {
+		return nil, templateNotFound(id, "updated")
+	}
+
+	stored.Name = t.Name
+	stored.Text = t.Text
+	stored.ContentType = t.ContentType
+	stored.UpdatedBy = t.UpdatedBy
+	stored.UpdatedAt = m.now()
+
+	if err := assertTemplateNameUnique(templates, stored, "updated"); err != nil {
+		return nil, err
+	}
+
+	templates[id] = stored
+
+	return &stored, nil
+}
+
+// DeleteTemplate removes the template with the specified ID
+func (m *Storage) DeleteTemplate(_ context.Context, id, channelID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	templates := m.channelTemplates(channelID)
+	if _, ok := templates[id]; !ok {
+		return templateNotFound(id, "deleted")
+	}
+
+	delete(templates, id)
+
+	return nil
+}
+
+// CreateTemplateDatabase creates the templates of the channel if they do not exist.
+// It returns true if they already existed.
+func (m *Storage) CreateTemplateDatabase(_ context.Context, channelID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.templates[channelID]
+	m.channelTemplates(channelID)
+
+	return exists, nil
+}
+
+// channelTemplates returns templates of the channel by their IDs, they are created if they do not exist
+func (m *Storage) channelTemplates(channelID string) map[string]comment.Template {
+	if m.templates == nil {
+		m.templates = make(map[string]map[string]comment.Template)
+	}
+
+	templates, ok := m.templates[channelID]
+	if !ok {
+		templates = make(map[string]comment.Template)
+		m.templates[channelID] = templates
+	}
+
+	return templates
+}
+
+// assertTemplateNameUnique returns error if another template has the same name
+func assertTemplateNameUnique(templates map[string]comment.Template, t comment.Template, operation string) error {
+	for _, existing := range templates {
+		if existing.Name == t.Name && existing.UUID != t.UUID {
+			reason := fmt.Sprintf("template with name='%s' already exists (uuid='%s')", t.Name, existing.UUID)
+			return errorConflict(fmt.Sprintf("Template could not be %s: %s", operation, reason))
+		}
+	}
+
+	return nil
+}
+
+func templateNotFound(id, operation string) error {
+	return errorNotFound(fmt.Sprintf("Template could not be %s: Template with uuid='%s' does not exist", operation, id))
+}
@@ -0,0 +1,637 @@
+// Package repositorytest provides the conformance test suite of the repository backends. Every backend must behave
+// the same way as seen by the domain services and the HTTP handlers, so the suite asserts only the behavior
+// all of them share (CouchDB, in-memory and SQLite), including the error messages and status codes.
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/adding"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/deleting"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/updating"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Storage is the repository backend tested by the suite
+type Storage interface {
+	adding.Repository
+	listing.Repository
+	updating.Repository
+	deleting.Repository
+	repository.Service
+}
+
+// Run runs the conformance suite against the storage. Every test works in a new channel with its databases
+// created by CreateDatabase, so one storage can be shared by all tests. Cleanup (if not nil) is called
+// with the channel ID when the test finishes, e.g. to drop the channel databases.
+func Run(t *testing.T, s Storage, cleanup func(channelID string)) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Storage, channelID string)
+	}{
+		{"AddAndGet", testAddAndGet},
+		{"Isolation", testIsolation},
+		{"AddErrors", testAddErrors},
+		{"Query", testQuery},
+		{"QueryErrors", testQueryErrors},
+		{"Pagination", testPagination},
+		{"MarkAsRead", testMarkAsRead},
+		{"ConcurrentMarkAsRead", testConcurrentMarkAsRead},
+		{"ConcurrentExternalID", testConcurrentExternalID},
+		{"ConcurrentPin", testConcurrentPin},
+		{"UpdateErrors", testUpdateErrors},
+		{"MissingDatabase", testMissingDatabase},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			channelID := uuid.New().String()
+			if cleanup != nil {
+				t.Cleanup(func() { cleanup(channelID) })
+			}
+
+			for _, assetType := range []comment.AssetType{comment.AssetTypeComment, comment.AssetTypeWorknote} {
+				_, err := s.CreateDatabase(context.Background(), channelID, assetType)
+				require.NoError(t, err)
+			}
+
+			tt.test(t, s, channelID)
+		})
+	}
+}
+
+var (
+	author = comment.UserInfo{
+		UUID:           "2af4f493-0bd5-4513-b440-6cbb465feadb",
+		Name:           "Alfred",
+		Surname:        "Koletschko",
+		OrgName:        "cc4c7533-4e34-4890-a79c-c1fda3c1be1e.kompitech.com",
+		OrgDisplayName: "KompiTech",
+	}
+	reader = comment.UserInfo{
+		UUID:           "9abc8dc2-a894-40b1-81ea-22a476fe6d34",
+		Name:           "Anne",
+		Surname:        "Marie",
+		OrgName:        "cdad3201-12cb-4fdd-bdad-612b6c7f784b.cgi.com",
+		OrgDisplayName: "CGI",
+	}
+)
+
+// adder returns the adding service of the storage, the storage expects comments with UUID and created_at already set
+func adder(s Storage) adding.Service {
+	return adding.NewService(s, adding.Config{})
+}
+
+// updater returns the updating service of the storage with the default limit of pinned comments
+func updater(s Storage) updating.Service {
+	return updating.NewService(s, updating.Config{})
+}
+
+// deleter returns the deleting service of the storage
+func deleter(s Storage) deleting.Service {
+	return deleting.NewService(s, deleting.Config{})
+}
+
+// newEntity returns new incident, so the tests do not share entity threads
+func newEntity() entity.Entity {
+	return entity.NewEntity("incident", uuid.New().String())
+}
+
+// addComments adds comments with the texts to the entity and returns them in the same order
+func addComments(t *testing.T, s Storage, channelID string, e entity.Entity, texts ...string) []comment.Comment {
+	comments := make([]comment.Comment, 0, len(texts))
+	for _, text := range texts {
+		c, err := adder(s).AddComment(context.Background(), comment.Comment{Entity: e, Text: text, CreatedBy: &author}, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+
+		comments = append(comments, *c)
+	}
+
+	return comments
+}
+
+// query returns the result of the query, the query is passed through JSON as from HTTP request
+func query(t *testing.T, s Storage, channelID string, q map[string]interface{}) (listing.QueryResult, error) {
+	b, err := json.Marshal(q)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+
+	return s.QueryComments(context.Background(), decoded, channelID, comment.AssetTypeComment)
+}
+
+// texts returns sorted texts of the query result documents
+func texts(result listing.QueryResult) []string {
+	found := make([]string, 0, len(result.Result))
+	for _, doc := range result.Result {
+		text, _ := doc["text"].(string)
+		found = append(found, text)
+	}
+	sort.Strings(found)
+
+	return found
+}
+
+// assertError asserts the error is repository.Error with the status code and the message (if not empty)
+func assertError(t *testing.T, err error, statusCode int, msg string) {
+	t.Helper()
+
+	var repoErr *repository.Error
+	require.ErrorAs(t, err, &repoErr)
+	assert.Equal(t, statusCode, repoErr.StatusCode())
+
+	if msg != "" {
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func testAddAndGet(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	e := newEntity()
+
+	added, err := adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: "Hello", ExternalID: "ext-1", CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	_, err = uuid.Parse(added.UUID)
+	assert.NoError(t, err, "UUID is generated")
+
+	_, err = time.Parse(time.RFC3339, added.CreatedAt)
+	assert.NoError(t, err, "created_at is set")
+
+	stored, err := s.GetComment(ctx, added.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	assert.Equal(t, added.UUID, stored.UUID)
+	assert.Equal(t, e, stored.Entity)
+	assert.Equal(t, "Hello", stored.Text)
+	assert.Equal(t, "ext-1", stored.ExternalID)
+	assert.Equal(t, &author, stored.CreatedBy)
+	assert.Equal(t, added.CreatedAt, stored.CreatedAt)
+	assert.Empty(t, stored.ReadBy)
+
+	reply, err := adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: "Reply", ParentUUID: added.UUID, CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	stored, err = s.GetComment(ctx, reply.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Equal(t, added.UUID, stored.ParentUUID)
+}
+
+func testIsolation(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	c := addComments(t, s, channelID, newEntity(), "Hello")[0]
+
+	_, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeWorknote)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Worknote could not be retrieved: Worknote with uuid='%s' does not exist", c.UUID))
+
+	_, err = s.GetComment(ctx, c.UUID, uuid.New().String(), comment.AssetTypeComment)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment could not be retrieved: Comment with uuid='%s' does not exist", c.UUID))
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{}}, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.Empty(t, result.Result)
+}
+
+func testAddErrors(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	e := newEntity()
+	parent := addComments(t, s, channelID, e, "Parent")[0]
+
+	_, err := adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: "External", ExternalID: "ext-1", CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	missing := uuid.New().String()
+	_, err = adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: "Reply", ParentUUID: missing, CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusBadRequest, fmt.Sprintf("Comment could not be added: parent comment with uuid='%s' does not exist", missing))
+
+	another := newEntity()
+	_, err = adder(s).AddComment(ctx, comment.Comment{Entity: another, Text: "Reply", ParentUUID: parent.UUID, CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusBadRequest, fmt.Sprintf("Comment could not be added: parent comment with uuid='%s' belongs to different entity", parent.UUID))
+
+	_, err = adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: "Duplicate", ExternalID: "ext-1", CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusConflict, fmt.Sprintf("Comment could not be added: comment with external_id='ext-1' already exists for entity '%s' (uuid='%s')",
+		e, repository.ExternalUUID(e, "ext-1")))
+
+	// external ID is unique per entity
+	_, err = adder(s).AddComment(ctx, comment.Comment{Entity: another, Text: "Another entity", ExternalID: "ext-1", CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	assert.NoError(t, err)
+}
+
+func testQuery(t *testing.T, s Storage, channelID string) {
+	e1, e2 := newEntity(), newEntity()
+	comments := addComments(t, s, channelID, e1, "first", "second")
+	addComments(t, s, channelID, e2, "third")
+
+	_, err := adder(s).AddComment(context.Background(), comment.Comment{Entity: e1, Text: "reply", ParentUUID: comments[0].UUID, CreatedBy: &author},
+		channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		selector map[string]interface{}
+		expected []string
+	}{
+		{"all", map[string]interface{}{}, []string{"first", "reply", "second", "third"}},
+		{"equality", map[string]interface{}{"entity": e1.String()}, []string{"first", "reply", "second"}},
+		{"$and with $exists", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"entity": e1.String()},
+			map[string]interface{}{"parent_uuid": map[string]interface{}{"$exists": false}},
+		}}, []string{"first", "second"}},
+		{"$or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"text": "first"},
+			map[string]interface{}{"entity": e2.String()},
+		}}, []string{"first", "third"}},
+		{"$in", map[string]interface{}{"text": map[string]interface{}{"$in": []string{"second", "third", "fourth"}}}, []string{"second", "third"}},
+		{"$gt", map[string]interface{}{"text": map[string]interface{}{"$gt": "second"}}, []string{"third"}},
+		{"$regex", map[string]interface{}{"text": map[string]interface{}{"$regex": "^(f|t)"}}, []string{"first", "third"}},
+		{"nested field", map[string]interface{}{"created_by.uuid": author.UUID}, []string{"first", "reply", "second", "third"}},
+		{"no match", map[string]interface{}{"entity": newEntity().String()}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := query(t, s, channelID, map[string]interface{}{"selector": tt.selector})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, texts(result))
+		})
+	}
+
+	t.Run("documents contain _id", func(t *testing.T) {
+		result, err := query(t, s, channelID, map[string]interface{}{"selector": map[string]interface{}{"uuid": comments[0].UUID}})
+		require.NoError(t, err)
+		require.Len(t, result.Result, 1)
+
+		assert.Equal(t, comments[0].UUID, result.Result[0]["_id"])
+		assert.Equal(t, e1.String(), result.Result[0]["entity"])
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		result, err := query(t, s, channelID, map[string]interface{}{
+			"selector": map[string]interface{}{"uuid": comments[1].UUID},
+			"fields":   []string{"uuid", "text", "created_by.uuid"},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []map[string]interface{}{{
+			"uuid":       comments[1].UUID,
+			"text":       "second",
+			"created_by": map[string]interface{}{"uuid": author.UUID},
+		}}, result.Result)
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		result, err := query(t, s, channelID, map[string]interface{}{
+			"selector": map[string]interface{}{"created_at": map[string]interface{}{"$gt": nil}},
+			"sort":     []map[string]string{{"created_at": "desc"}},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Result, 4)
+
+		for i := 1; i < len(result.Result); i++ {
+			assert.GreaterOrEqual(t, result.Result[i-1]["created_at"], result.Result[i]["created_at"])
+		}
+	})
+}
+
+func testQueryErrors(t *testing.T, s Storage, channelID string) {
+	addComments(t, s, channelID, newEntity(), "Hello")
+
+	for _, tt := range []struct {
+		name  string
+		query map[string]interface{}
+	}{
+		{"missing selector", map[string]interface{}{}},
+		{"unknown operator", map[string]interface{}{"selector": map[string]interface{}{"text": map[string]interface{}{"$foo": 1}}}},
+		{"bad $in argument", map[string]interface{}{"selector": map[string]interface{}{"text": map[string]interface{}{"$in": "Hello"}}}},
+		{"bad sort direction", map[string]interface{}{"selector": map[string]interface{}{}, "sort": []map[string]string{{"created_at": "up"}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := query(t, s, channelID, tt.query)
+			assertError(t, err, http.StatusBadRequest, "")
+		})
+	}
+}
+
+func testPagination(t *testing.T, s Storage, channelID string) {
+	e := newEntity()
+	comments := addComments(t, s, channelID, e, "1", "2", "3", "4", "5")
+
+	var expected []string
+	for _, c := range comments {
+		expected = append(expected, c.UUID)
+	}
+	sort.Strings(expected)
+
+	// pages are listed by bookmarks until the page is not full
+	pageQuery := func(limit int, bookmark string) map[string]interface{} {
+		q := map[string]interface{}{
+			"selector": map[string]interface{}{"entity": e.String()},
+			"fields":   []string{"uuid"},
+			"limit":    limit,
+		}
+		if bookmark != "" {
+			q["bookmark"] = bookmark
+		}
+
+		return q
+	}
+
+	t.Run("last page is not full", func(t *testing.T) {
+		var found []string
+		var sizes []int
+		var bookmark string
+
+		for page := 0; page < 10; page++ {
+			result, err := query(t, s, channelID, pageQuery(2, bookmark))
+			require.NoError(t, err)
+
+			sizes = append(sizes, len(result.Result))
+			for _, doc := range result.Result {
+				found = append(found, doc["uuid"].(string))
+			}
+
+			if len(result.Result) < 2 {
+				assert.Empty(t, result.Bookmark, "no bookmark of the page that is not full")
+				break
+			}
+
+			require.NotEmpty(t, result.Bookmark, "bookmark of the full page")
+			bookmark = result.Bookmark
+		}
+
+		sort.Strings(found)
+		assert.Equal(t, []int{2, 2, 1}, sizes)
+		assert.Equal(t, expected, found, "every document is listed once")
+	})
+
+	t.Run("last page is full", func(t *testing.T) {
+		result, err := query(t, s, channelID, pageQuery(5, ""))
+		require.NoError(t, err)
+		assert.Len(t, result.Result, 5)
+		require.NotEmpty(t, result.Bookmark)
+
+		result, err = query(t, s, channelID, pageQuery(5, result.Bookmark))
+		require.NoError(t, err)
+		assert.Empty(t, result.Result)
+		assert.Empty(t, result.Bookmark)
+	})
+
+	t.Run("default page size", func(t *testing.T) {
+		result, err := query(t, s, channelID, map[string]interface{}{"selector": map[string]interface{}{"entity": e.String()}})
+		require.NoError(t, err)
+		assert.Len(t, result.Result, 5)
+		assert.Empty(t, result.Bookmark)
+	})
+}
+
+func testMarkAsRead(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	c := addComments(t, s, channelID, newEntity(), "Hello")[0]
+	readBy := comment.ReadBy{Time: time.Now().Format(time.RFC3339), User: reader}
+
+	alreadyMarked, err := s.MarkAsReadByUser(ctx, c.UUID, readBy, channelID, comment.AssetTypeComment, nil)
+	require.NoError(t, err)
+	assert.False(t, alreadyMarked)
+
+	alreadyMarked, err = s.MarkAsReadByUser(ctx, c.UUID, comment.ReadBy{Time: "2100-01-01T00:00:00Z", User: reader}, channelID, comment.AssetTypeComment, nil)
+	require.NoError(t, err)
+	assert.True(t, alreadyMarked)
+
+	stored, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Equal(t, comment.ReadByList{readBy}, stored.ReadBy, "the first read is kept")
+
+	result, err := query(t, s, channelID, map[string]interface{}{"selector": map[string]interface{}{"uuid": c.UUID}})
+	require.NoError(t, err)
+	require.Len(t, result.Result, 1)
+
+	var doc comment.Comment
+	b, err := json.Marshal(result.Result[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, comment.ReadByList{readBy}, doc.ReadBy, "read_by of the query result")
+
+	missing := uuid.New().String()
+	_, err = s.MarkAsReadByUser(ctx, missing, readBy, channelID, comment.AssetTypeComment, nil)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment with uuid='%s' does not exist", missing))
+}
+
+func testConcurrentExternalID(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	e := newEntity()
+
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = adder(s).AddComment(ctx, comment.Comment{Entity: e, Text: fmt.Sprintf("Synchronized %d", i), ExternalID: "ext-1", CreatedBy: &author},
+				channelID, comment.AssetTypeComment)
+		}(i)
+	}
+	wg.Wait()
+
+	var added int
+	for i := 0; i < n; i++ {
+		if errs[i] == nil {
+			added++
+			continue
+		}
+
+		assertError(t, errs[i], http.StatusConflict, "")
+	}
+	assert.Equal(t, 1, added, "only one request adds the comment")
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{"entity": e.String()}}, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Len(t, result.Result, 1)
+}
+
+func testConcurrentPin(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	e := newEntity()
+	comments := addComments(t, s, channelID, e, "1", "2", "3", "4", "5", "6", "7", "8")
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(comments))
+
+	for i := range comments {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = updater(s).PinComment(ctx, comments[i].UUID, author, channelID, comment.AssetTypeComment)
+		}(i)
+	}
+	wg.Wait()
+
+	// the requests that failed because of a concurrent request are repeated, so the limit is reached
+	for i := range comments {
+		if errs[i] != nil {
+			assertError(t, errs[i], http.StatusConflict, "")
+			_, errs[i] = updater(s).PinComment(ctx, comments[i].UUID, author, channelID, comment.AssetTypeComment)
+		}
+	}
+
+	var pinned int
+	for i, c := range comments {
+		stored, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+
+		if stored.PinnedAt != "" {
+			pinned++
+			assert.NoError(t, errs[i])
+			continue
+		}
+
+		assertError(t, errs[i], http.StatusConflict, fmt.Sprintf("Comment could not be pinned: maximum number of pinned comments (3) reached for entity '%s'", e))
+	}
+	assert.Equal(t, 3, pinned, "the limit of pinned comments is not exceeded")
+}
+
+func testConcurrentMarkAsRead(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	c := addComments(t, s, channelID, newEntity(), "Hello")[0]
+
+	const n = 10
+
+	users := make([]comment.UserInfo, n)
+	for i := range users {
+		users[i] = reader
+		users[i].UUID = uuid.New().String()
+	}
+
+	t.Run("the same user", func(t *testing.T) {
+		var wg sync.WaitGroup
+		marked := make([]bool, n)
+		errs := make([]error, n)
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var alreadyMarked bool
+				alreadyMarked, errs[i] = s.MarkAsReadByUser(ctx, c.UUID, comment.ReadBy{Time: time.Now().Format(time.RFC3339), User: users[0]},
+					channelID, comment.AssetTypeComment, nil)
+				marked[i] = !alreadyMarked
+			}(i)
+		}
+		wg.Wait()
+
+		var count int
+		for i := 0; i < n; i++ {
+			require.NoError(t, errs[i])
+			if marked[i] {
+				count++
+			}
+		}
+		assert.Equal(t, 1, count, "only one request marks the comment as read")
+	})
+
+	t.Run("different users", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		alreadyMarked := make([]bool, n)
+
+		for i := 1; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				alreadyMarked[i], errs[i] = s.MarkAsReadByUser(ctx, c.UUID, comment.ReadBy{Time: time.Now().Format(time.RFC3339), User: users[i]},
+					channelID, comment.AssetTypeComment, nil)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 1; i < n; i++ {
+			require.NoError(t, errs[i])
+			assert.False(t, alreadyMarked[i])
+		}
+
+		stored, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+
+		var readers []string
+		for _, rb := range stored.ReadBy {
+			readers = append(readers, rb.User.UUID)
+		}
+
+		var expected []string
+		for _, u := range users {
+			expected = append(expected, u.UUID)
+		}
+
+		assert.ElementsMatch(t, expected, readers, "no read is lost")
+	})
+}
+
+func testUpdateErrors(t *testing.T, s Storage, channelID string) {
+	ctx := context.Background()
+	e := newEntity()
+	comments := addComments(t, s, channelID, e, "1", "2", "3", "4")
+
+	missing := uuid.New().String()
+
+	_, err := updater(s).UpdateText(ctx, missing, "Edited", author, channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment with uuid='%s' does not exist", missing))
+
+	_, err = updater(s).PinComment(ctx, missing, author, channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment with uuid='%s' does not exist", missing))
+
+	_, err = deleter(s).DeleteComment(ctx, missing, author, channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment with uuid='%s' does not exist", missing))
+
+	alreadyDeleted, err := deleter(s).DeleteComment(ctx, comments[3].UUID, author, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.False(t, alreadyDeleted)
+
+	_, err = updater(s).UpdateText(ctx, comments[3].UUID, "Edited", author, channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusConflict, fmt.Sprintf("Comment with uuid='%s' is deleted", comments[3].UUID))
+
+	// the default limit of pinned comments is 3
+	for _, c := range comments[:3] {
+		_, err = updater(s).PinComment(ctx, c.UUID, author, channelID, comment.AssetTypeComment)
+		require.NoError(t, err)
+	}
+
+	other := addComments(t, s, channelID, e, "5")[0]
+	_, err = updater(s).PinComment(ctx, other.UUID, author, channelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusConflict, fmt.Sprintf("Comment could not be pinned: maximum number of pinned comments (3) reached for entity '%s'", e))
+}
+
+func testMissingDatabase(t *testing.T, s Storage, _ string) {
+	ctx := context.Background()
+	missingChannelID := uuid.New().String()
+	c := comment.Comment{UUID: uuid.New().String(), Entity: newEntity(), Text: "Hello", CreatedBy: &author}
+
+	_, err := s.AddComment(ctx, c, missingChannelID, comment.AssetTypeComment, nil)
+	assertError(t, err, http.StatusNotFound, "Comment could not be added: database of comments does not exist")
+
+	_, err = s.GetComment(ctx, c.UUID, missingChannelID, comment.AssetTypeComment)
+	assertError(t, err, http.StatusNotFound, fmt.Sprintf("Comment could not be retrieved: Comment with uuid='%s' does not exist", c.UUID))
+}
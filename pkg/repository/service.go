@@ -9,4 +9,6 @@ import (
 // Service provides functions to directly work with repository
 type Service interface {
 	CreateDatabase(ctx context.Context, channelID string, assetType comment.AssetType) (alreadyExisted bool, error error)
+	CreateTemplateDatabase(ctx context.Context, channelID string) (alreadyExisted bool, error error)
+	MigrateReadState(ctx context.Context, channelID string, assetType comment.AssetType) (migrated int, err error)
 }
@@ -0,0 +1,12 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/repositorytest"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/sqlite"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, newStorage(t, sqlite.Config{}), nil)
+}
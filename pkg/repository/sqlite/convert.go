@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+)
+
+// ConvertComment moves the comment with specified ID changed by convert function from the database of one asset type
+// to the database of another one (e.g. customer comment posted as worknote by mistake). The comment keeps its UUID,
+// author and read state. Comments with replies cannot be converted, the thread would be split. The message returned
+// by events function (if not nil) is stored to the outbox in the same transaction.
+func (s *Storage) ConvertComment(ctx context.Context, id, channelID string, from, to comment.AssetType,
+	convert func(c *comment.Comment) error, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
+	title := strings.Title(from.String())
+	srcDB := databaseName(channelID, from)
+	dstDB := databaseName(channelID, to)
+
+	var c comment.Comment
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		sc, err := getComment(ctx, tx, srcDB, id)
+		if err != nil {
+			return err
+		}
+
+		if sc == nil {
+			return errorNotFound(fmt.Sprintf("%s with uuid='%s' does not exist", title, id))
+		}
+
+		c = sc.Comment
+		if err := convert(&c); err != nil {
+			return err
+		}
+
+		eMsg := fmt.Sprintf("%s could not be converted: database of %s does not exist", title, to.Plural())
+		if err := assertDatabaseExists(ctx, tx, dstDB, eMsg); err != nil {
+			return err
+		}
+
+		if err := assertConvertible(ctx, tx, c, srcDB, dstDB, from, to); err != nil {
+			return err
+		}
+
+		if err := putComment(ctx, tx, dstDB, c, 0); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE db = ? AND id = ?", srcDB, id); err != nil {
+			return err
+		}
+
+		return addEventsToOutbox(ctx, tx, srcDB, c, events)
+	})
+	if err != nil {
+		return nil, s.storageError(err, fmt.Sprintf("%s could not be converted", title))
+	}
+
+	s.logger.Info(fmt.Sprintf("%s %s converted to %s", title, id, to))
+
+	return &c, nil
+}
+
+// assertConvertible returns error if the comment has replies or the comment with the same UUID already exists
+// in the target database
+func assertConvertible(ctx context.Context, q querier, c comment.Comment, srcDB, dstDB string, from, to comment.AssetType) error {
+	title := strings.Title(from.String())
+
+	replies, err := findComments(ctx, q, srcDB, `json_extract(doc, '$."parent_uuid"') = ?`, c.UUID)
+	if err != nil {
+		return err
+	}
+
+	if len(replies) > 0 {
+		eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' has replies", title, from, c.UUID)
+		return errorConflict(eMsg)
+	}
+
+	existing, err := getComment(ctx, q, dstDB, c.UUID)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		eMsg := fmt.Sprintf("%s could not be converted: %s with uuid='%s' already exists", title, to, c.UUID)
+		return errorConflict(eMsg)
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package sqlite
+
+import (
+	"net/http"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// errorBadRequest returns an error with the supplied message and HTTP 400 status code
+func errorBadRequest(message string) error {
+	return repository.NewError(message, http.StatusBadRequest)
+}
+
+// errorNotFound returns an error with the supplied message and HTTP 404 status code
+func errorNotFound(message string) error {
+	return repository.NewError(message, http.StatusNotFound)
+}
+
+// errorConflict returns an error with the supplied message and HTTP 409 status code
+func errorConflict(message string) error {
+	return repository.NewError(message, http.StatusConflict)
+}
@@ -0,0 +1,163 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"go.uber.org/zap"
+)
+
+// idempotencyCleanupInterval is the minimal interval between two deletions of expired keys of the database
+const idempotencyCleanupInterval = time.Hour
+
+// ReserveIdempotencyKey stores pending record of the key; if the key is already stored and not expired,
+// the stored record is returned instead
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) (*repository.IdempotencyRecord, error) {
+	dbName := databaseName(channelID, assetType)
+
+	var stored *repository.IdempotencyRecord
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		stored, err = getIdempotencyRecord(ctx, tx, dbName, record.ScopedKey())
+		if err != nil {
+			return err
+		}
+
+		if stored != nil && time.Now().Before(stored.ExpiresAt) {
+			return nil
+		}
+
+		// expired key is reserved again
+		stored = nil
+
+		return putIdempotencyRecord(ctx, tx, dbName, record)
+	})
+	if err != nil {
+		return nil, s.storageError(err, "Idempotency-Key could not be reserved")
+	}
+
+	if stored == nil {
+		s.deleteExpiredIdempotencyKeys(ctx, dbName)
+	}
+
+	return stored, nil
+}
+
+// CompleteIdempotencyKey stores the result of the request made with the reserved key
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	dbName := databaseName(channelID, assetType)
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := getIdempotencyRecord(ctx, tx, dbName, record.ScopedKey())
+		if err != nil {
+			return err
+		}
+
+		if stored == nil {
+			return errorNotFound(fmt.Sprintf("Idempotency-Key '%s' is not reserved", record.Key))
+		}
+
+		return putIdempotencyRecord(ctx, tx, dbName, record)
+	})
+	if err != nil {
+		return s.storageError(err, "Idempotency-Key could not be completed")
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the reserved key, so the failed request can be retried
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, record repository.IdempotencyRecord, channelID string, assetType comment.AssetType) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE db = ? AND key = ?", databaseName(channelID, assetType), record.ScopedKey())
+	if err != nil {
+		return s.storageError(err, "Idempotency-Key could not be released")
+	}
+
+	return nil
+}
+
+// getIdempotencyRecord returns stored record of the key or nil if it does not exist
+func getIdempotencyRecord(ctx context.Context, q querier, dbName, key string) (*repository.IdempotencyRecord, error) {
+	var doc string
+
+	err := q.QueryRowContext(ctx, "SELECT doc FROM idempotency_keys WHERE db = ? AND key = ?", dbName, key).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record repository.IdempotencyRecord
+	if err := json.Unmarshal([]byte(doc), &record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func putIdempotencyRecord(ctx context.Context, q querier, dbName string, record repository.IdempotencyRecord) error {
+	doc, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO idempotency_keys (db, key, doc) VALUES (?, ?, ?)
+		ON CONFLICT (db, key) DO UPDATE SET doc = excluded.doc`, dbName, record.ScopedKey(), string(doc))
+
+	return err
+}
+
+// deleteExpiredIdempotencyKeys deletes expired keys of the database at most once per idempotencyCleanupInterval,
+// the keys are kept if it fails as they are reserved again when used after expiration anyway
+func (s *Storage) deleteExpiredIdempotencyKeys(ctx context.Context, dbName string) {
+	if cleanedAt, ok := s.idempotencyCleanedAt.Load(dbName); ok && time.Since(cleanedAt.(time.Time)) < idempotencyCleanupInterval {
+		return
+	}
+	s.idempotencyCleanedAt.Store(dbName, time.Now())
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT key, doc FROM idempotency_keys WHERE db = ?", dbName)
+		if err != nil {
+			return err
+		}
+
+		var expired []string
+		for rows.Next() {
+			var key, doc string
+			if err := rows.Scan(&key, &doc); err != nil {
+				_ = rows.Close()
+				return err
+			}
+
+			var record repository.IdempotencyRecord
+			if err := json.Unmarshal([]byte(doc), &record); err != nil || !time.Now().Before(record.ExpiresAt) {
+				expired = append(expired, key)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE db = ? AND key = ?", dbName, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("expired idempotency keys could not be deleted", zap.String("db", dbName), zap.Error(err))
+	}
+}
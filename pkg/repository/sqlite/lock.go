@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+)
+
+// LockThread stores the lock of the entity thread.
+// It returns true if thread was already locked to notify that resource was not changed.
+func (s *Storage) LockThread(ctx context.Context, lock comment.ThreadLock, channelID string, assetType comment.AssetType) (bool, error) {
+	lock.LockedAt = time.Now().Format(time.RFC3339)
+
+	doc, err := json.Marshal(lock)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO thread_locks (db, entity, doc) VALUES (?, ?, ?)",
+		databaseName(channelID, assetType), lock.Entity.String(), string(doc))
+	if err != nil {
+		return false, s.storageError(err, "Thread could not be locked")
+	}
+
+	locked, err := result.RowsAffected()
+	if err != nil {
+		return false, s.storageError(err, "Thread could not be locked")
+	}
+
+	if locked == 0 {
+		return true, nil
+	}
+
+	s.logger.Info(fmt.Sprintf("%s thread locked %#v", assetType.Title(), lock))
+
+	return false, nil
+}
+
+// UnlockThread removes the lock of the entity thread.
+// It returns true if thread was not locked to notify that resource was not changed.
+func (s *Storage) UnlockThread(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM thread_locks WHERE db = ? AND entity = ?", databaseName(channelID, assetType), e.String())
+	if err != nil {
+		return false, s.storageError(err, "Thread could not be unlocked")
+	}
+
+	unlocked, err := result.RowsAffected()
+	if err != nil {
+		return false, s.storageError(err, "Thread could not be unlocked")
+	}
+
+	if unlocked == 0 {
+		return true, nil
+	}
+
+	s.logger.Info(fmt.Sprintf("%s thread of entity '%s' unlocked", assetType.Title(), e))
+
+	return false, nil
+}
+
+// GetThreadLock returns the lock of the entity thread or nil if the thread is not locked
+func (s *Storage) GetThreadLock(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (*comment.ThreadLock, error) {
+	var doc string
+
+	err := s.db.QueryRowContext(ctx, "SELECT doc FROM thread_locks WHERE db = ? AND entity = ?",
+		databaseName(channelID, assetType), e.String()).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.storageError(err, "Thread lock could not be retrieved")
+	}
+
+	var lock comment.ThreadLock
+	if err := json.Unmarshal([]byte(doc), &lock); err != nil {
+		return nil, err
+	}
+
+	return &lock, nil
+}
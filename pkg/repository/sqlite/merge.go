@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+)
+
+// MergeEntity moves all comments of the merged entity to the target entity, or stores their copies when merge mode
+// is copy. Merged comments are unpinned and their original_entity field keeps the merged entity (the first one
+// if the comment was merged repeatedly). Moved comments keep their UUIDs and read state, copies get new UUIDs,
+// no read state and replies are linked to the copies of their parents. The message returned by events function
+// (if not nil) for UUIDs of the merged comments is stored to the outbox in the same transaction. Either all comments
+// are merged or none. It returns the number of merged comments.
+func (s *Storage) MergeEntity(ctx context.Context, m comment.EntityMerge, channelID string, assetType comment.AssetType,
+	events func(uuids []string) (*event.Message, error)) (int, error) {
+	dbName := databaseName(channelID, assetType)
+
+	var uuids []string
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		comments, err := findComments(ctx, tx, dbName, `json_extract(doc, '$."entity"') = ?`, m.Source.String())
+		if err != nil {
+			return err
+		}
+
+		copies := map[string]string{}
+		for i := range comments {
+			c := &comments[i]
+			c.Entity = m.Target
+			c.PinnedAt = ""
+			c.PinnedBy = nil
+			if c.OriginalEntity == nil {
+				source := m.Source
+				c.OriginalEntity = &source
+			}
+
+			if m.IsCopy() {
+				uuid, err := repository.GenerateUUID(s.rand)
+				if err != nil {
+					return err
+				}
+
+				copies[c.UUID] = uuid
+				c.UUID = uuid
+				c.ReadBy = nil
+				c.rev = 0
+			}
+		}
+
+		for _, c := range comments {
+			if parent, ok := copies[c.ParentUUID]; ok {
+				c.ParentUUID = parent
+			}
+
+			if err := putComment(ctx, tx, dbName, c.Comment, c.rev); err != nil {
+				return err
+			}
+
+			uuids = append(uuids, c.UUID)
+		}
+
+		if len(uuids) == 0 || events == nil {
+			return nil
+		}
+
+		msg, err := events(uuids)
+		if err != nil {
+			return err
+		}
+
+		return addToOutbox(ctx, tx, dbName, msg)
+	})
+	if err != nil {
+		eMsg := fmt.Sprintf("%s of entity '%s' could not be merged", strings.Title(assetType.Plural()), m.Source)
+		return 0, s.storageError(err, eMsg)
+	}
+
+	if len(uuids) > 0 {
+		s.logger.Info(fmt.Sprintf("%d %s of %s merged into %s (%s)", len(uuids), assetType.Plural(), m.Source, m.Target, m.Mode))
+	}
+
+	return len(uuids), nil
+}
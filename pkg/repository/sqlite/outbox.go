@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+)
+
+// addEventsToOutbox stores the message returned by events function (if not nil) for the changed comment
+// to the outbox of the database
+func addEventsToOutbox(ctx context.Context, q querier, dbName string, c comment.Comment, events func(c comment.Comment) (*event.Message, error)) error {
+	if events == nil {
+		return nil
+	}
+
+	msg, err := events(c)
+	if err != nil {
+		return err
+	}
+
+	return addToOutbox(ctx, q, dbName, msg)
+}
+
+// addToOutbox stores the message (if not nil) of events of the change of the database to the outbox,
+// it is called in the transaction of the change, so the message is stored only together with the change
+func addToOutbox(ctx context.Context, q querier, dbName string, msg *event.Message) error {
+	if msg == nil {
+		return nil
+	}
+
+	_, err := q.ExecContext(ctx, "INSERT INTO outbox (db, message, created_at) VALUES (?, json_object('channel_id', ?, 'data', json(?)), ?)",
+		dbName, string(msg.ChannelID), string(msg.Data), time.Now().UTC().Format(time.RFC3339Nano))
+
+	return err
+}
+
+// PendingMessages returns at most limit messages of the outbox not marked as sent yet, the oldest first
+func (s *Storage) PendingMessages(ctx context.Context, limit int) ([]event.OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT seq, json_extract(message, '$.channel_id'), json_extract(message, '$.data')
+		FROM outbox WHERE sent_at IS NULL ORDER BY seq LIMIT ?`, limit)
+	if err != nil {
+		return nil, s.storageError(err, "Outbox messages could not be retrieved")
+	}
+	defer func() { _ = rows.Close() }()
+
+	var msgs []event.OutboxMessage
+	for rows.Next() {
+		var seq int64
+		var channelID, data string
+		if err := rows.Scan(&seq, &channelID, &data); err != nil {
+			return nil, s.storageError(err, "Outbox messages could not be retrieved")
+		}
+
+		msgs = append(msgs, event.OutboxMessage{
+			ID:      strconv.FormatInt(seq, 10),
+			Message: event.Message{ChannelID: event.UUID(channelID), Data: []byte(data)},
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, s.storageError(err, "Outbox messages could not be retrieved")
+	}
+
+	return msgs, nil
+}
+
+// MarkSent marks the message of the outbox as sent
+func (s *Storage) MarkSent(ctx context.Context, m event.OutboxMessage) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE outbox SET sent_at = ? WHERE seq = ?", time.Now().UTC().Format(time.RFC3339Nano), m.ID)
+	if err != nil {
+		return s.storageError(err, "Outbox message could not be marked as sent")
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/mango"
+)
+
+// condition is SQL expression of the Mango selector with its arguments. Exact condition matches the same documents
+// as the selector; inexact one matches more documents (e.g. $regex), which are filtered by mango.Query.Matches then.
+type condition struct {
+	sql   string
+	args  []interface{}
+	exact bool
+}
+
+var (
+	matchAll  = condition{sql: "1", exact: true}
+	matchNone = condition{sql: "0", exact: true}
+	// matchSome is used in place of the selector part that cannot be expressed in SQL
+	matchSome = condition{sql: "1", exact: false}
+)
+
+// sqlOperators are SQL comparison operators of Mango comparison operators
+var sqlOperators = map[string]string{
+	"$eq":  "=",
+	"$ne":  "!=",
+	"$gt":  ">",
+	"$gte": ">=",
+	"$lt":  "<",
+	"$lte": "<=",
+}
+
+// findSQL returns SQL statement selecting documents matching the query from the database with documents sorted
+// by the query sort fields (and by their IDs as in CouchDB). Exact statement returns only the requested page,
+// otherwise all candidate documents are returned to be filtered, sorted and paged by mango.Query.
+func findSQL(q mango.Query, dbName string) (string, []interface{}, bool) {
+	where := selectorCondition(q.Selector)
+
+	conds := []string{"db = ?", where.sql}
+	args := append([]interface{}{dbName}, where.args...)
+	exact := where.exact
+
+	var orderBy []string
+	for _, sf := range q.Sort {
+		path, ok := jsonPath(strings.Split(sf.Path, "."))
+		if !ok {
+			exact = false
+			continue
+		}
+
+		// as in CouchDB, documents without sort field are not indexed, so they are not found
+		conds = append(conds, fmt.Sprintf("json_type(doc, %s) IS NOT NULL", path))
+
+		dir := "ASC"
+		if sf.Desc {
+			dir = "DESC"
+		}
+
+		orderBy = append(orderBy,
+			fmt.Sprintf("%s %s", collationRank(typeOf(path)), dir),
+			fmt.Sprintf("%s %s", valueOf(path), dir))
+	}
+	orderBy = append(orderBy, "id ASC")
+
+	stmt := fmt.Sprintf("SELECT doc FROM comments WHERE %s ORDER BY %s", strings.Join(conds, " AND "), strings.Join(orderBy, ", "))
+	if exact {
+		stmt += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Skip)
+	}
+
+	return stmt, args, exact
+}
+
+// selectorCondition returns condition of the selector validated by mango.Parse
+func selectorCondition(selector map[string]interface{}) condition {
+	var conds []condition
+	for _, key := range mango.SortedKeys(selector) {
+		arg := selector[key]
+
+		switch key {
+		case "$and", "$or", "$nor":
+			var subs []condition
+			for _, sub := range arg.([]interface{}) {
+				subs = append(subs, selectorCondition(sub.(map[string]interface{})))
+			}
+
+			conds = append(conds, combination(key, subs))
+		case "$not":
+			conds = append(conds, not(selectorCondition(arg.(map[string]interface{}))))
+		default:
+			conds = append(conds, fieldCondition(strings.Split(key, "."), arg))
+		}
+	}
+
+	return and(conds)
+}
+
+// fieldCondition returns condition of the field given by path. Condition is either a value compared for equality
+// or an object of operators and nested fields of the value.
+func fieldCondition(path []string, cond interface{}) condition {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return operatorCondition(path, "$eq", cond)
+	}
+
+	var conds []condition
+	for _, key := range mango.SortedKeys(ops) {
+		if strings.HasPrefix(key, "$") {
+			conds = append(conds, operatorCondition(path, key, ops[key]))
+			continue
+		}
+
+		nested := append(append([]string{}, path...), strings.Split(key, ".")...)
+		conds = append(conds, fieldCondition(nested, ops[key]))
+	}
+
+	return and(conds)
+}
+
+// operatorCondition returns condition of the operator applied to the field given by path.
+// Missing field matches only $exists false (and negations).
+func operatorCondition(path []string, op string, arg interface{}) condition {
+	switch op {
+	case "$and", "$or", "$nor":
+		var subs []condition
+		for _, sub := range arg.([]interface{}) {
+			subs = append(subs, fieldCondition(path, sub))
+		}
+
+		return combination(op, subs)
+	case "$not":
+		return not(fieldCondition(path, arg))
+	}
+
+	p, ok := jsonPath(path)
+	if !ok {
+		return matchSome
+	}
+
+	switch op {
+	case "$exists":
+		if arg.(bool) {
+			return condition{sql: fmt.Sprintf("json_type(doc, %s) IS NOT NULL", p), exact: true}
+		}
+
+		return condition{sql: fmt.Sprintf("json_type(doc, %s) IS NULL", p), exact: true}
+	case "$in":
+		return in(p, arg.([]interface{}))
+	case "$nin":
+		exists := condition{sql: fmt.Sprintf("json_type(doc, %s) IS NOT NULL", p), exact: true}
+		return and([]condition{exists, not(in(p, arg.([]interface{})))})
+	case "$regex":
+		// only strings can match, the pattern is matched by mango.Query
+		return condition{sql: fmt.Sprintf("json_type(doc, %s) = 'text'", p), exact: false}
+	default:
+		return comparison(typeOf(p), valueOf(p), op, arg)
+	}
+}
+
+// in returns condition of $in operator: the field value or one of its elements if it is array is in the list
+func in(path string, list []interface{}) condition {
+	if len(list) == 0 {
+		return matchNone
+	}
+
+	var values, elements []condition
+	for _, item := range list {
+		values = append(values, comparison(typeOf(path), valueOf(path), "$eq", item))
+		elements = append(elements, comparison("e.type", "e.value", "$eq", item))
+	}
+
+	element := combination("$or", elements)
+	values = append(values, condition{
+		sql:   fmt.Sprintf("(json_type(doc, %s) = 'array' AND EXISTS (SELECT 1 FROM json_each(doc, %s) AS e WHERE %s))", path, path, element.sql),
+		args:  element.args,
+		exact: true,
+	})
+
+	return combination("$or", values)
+}
+
+// comparison returns condition comparing JSON value given by its type and value expression with the argument
+// by CouchDB collation (see mango.Compare). Only null, boolean, number and string arguments are allowed by mango.Parse.
+func comparison(typeExpr, valueExpr, op string, arg interface{}) condition {
+	rank := collationRank(typeExpr)
+	sqlOp := sqlOperators[op]
+	argRank := mango.CollationRank(arg)
+
+	if arg == nil {
+		// null is the only value of its rank
+		return condition{sql: fmt.Sprintf("%s %s 0", rank, sqlOp), exact: true}
+	}
+
+	value := arg
+	if b, ok := arg.(bool); ok {
+		// SQLite represents JSON booleans as integers 1 and 0
+		value = 0
+		if b {
+			value = 1
+		}
+	}
+
+	var sql string
+	switch op {
+	case "$eq":
+		sql = fmt.Sprintf("(%s = %d AND %s = ?)", rank, argRank, valueExpr)
+	case "$ne":
+		sql = fmt.Sprintf("(%s != %d OR %s != ?)", rank, argRank, valueExpr)
+	case "$gt", "$gte":
+		sql = fmt.Sprintf("(%s > %d OR (%s = %d AND %s %s ?))", rank, argRank, rank, argRank, valueExpr, sqlOp)
+	default: // $lt, $lte
+		sql = fmt.Sprintf("(%s < %d OR (%s = %d AND %s %s ?))", rank, argRank, rank, argRank, valueExpr, sqlOp)
+	}
+
+	return condition{sql: sql, args: []interface{}{value}, exact: true}
+}
+
+// combination returns condition of $and, $or and $nor operator
+func combination(op string, conds []condition) condition {
+	switch op {
+	case "$and":
+		return and(conds)
+	case "$or":
+		return or(conds)
+	default: // $nor
+		return not(or(conds))
+	}
+}
+
+func and(conds []condition) condition {
+	if len(conds) == 0 {
+		return matchAll
+	}
+
+	return join(conds, " AND ")
+}
+
+func or(conds []condition) condition {
+	if len(conds) == 0 {
+		return matchNone
+	}
+
+	return join(conds, " OR ")
+}
+
+func join(conds []condition, operator string) condition {
+	c := condition{exact: true}
+
+	parts := make([]string, 0, len(conds))
+	for _, cond := range conds {
+		parts = append(parts, cond.sql)
+		c.args = append(c.args, cond.args...)
+		c.exact = c.exact && cond.exact
+	}
+	c.sql = "(" + strings.Join(parts, operator) + ")"
+
+	return c
+}
+
+// not returns negation of the condition. Negation of inexact condition would not match some matching documents,
+// so all documents are matched instead.
+func not(c condition) condition {
+	if !c.exact {
+		return matchSome
+	}
+
+	// NULL result of comparison of missing field means no match
+	return condition{sql: fmt.Sprintf("NOT COALESCE(%s, 0)", c.sql), args: c.args, exact: true}
+}
+
+// jsonPath returns SQL string literal of JSON path of the field given by names of the nested fields.
+// Field names containing double quote cannot be expressed.
+func jsonPath(names []string) (string, bool) {
+	var b strings.Builder
+	b.WriteString("'$")
+	for _, name := range names {
+		if strings.Contains(name, `"`) {
+			return "", false
+		}
+
+		b.WriteString(`."`)
+		b.WriteString(strings.ReplaceAll(name, "'", "''"))
+		b.WriteString(`"`)
+	}
+	b.WriteString("'")
+
+	return b.String(), true
+}
+
+func typeOf(path string) string {
+	return fmt.Sprintf("json_type(doc, %s)", path)
+}
+
+func valueOf(path string) string {
+	return fmt.Sprintf("json_extract(doc, %s)", path)
+}
+
+// collationRank returns SQL expression of the rank of JSON type by CouchDB collation (see mango.CollationRank),
+// NULL for missing field
+func collationRank(typeExpr string) string {
+	return fmt.Sprintf("(CASE %s WHEN 'null' THEN 0 WHEN 'true' THEN 1 WHEN 'false' THEN 1 WHEN 'integer' THEN 2 "+
+		"WHEN 'real' THEN 2 WHEN 'text' THEN 3 WHEN 'array' THEN 4 WHEN 'object' THEN 5 END)", typeExpr)
+}
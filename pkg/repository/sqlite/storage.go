@@ -0,0 +1,648 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment/listing"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/mango"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // The SQLite driver
+)
+
+// schema creates the tables of the storage. All logical databases (one per channel and asset type as in CouchDB)
+// share the tables, their rows are distinguished by the database name.
+const schema = `
+CREATE TABLE IF NOT EXISTS databases (
+	name TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS comments (
+	db  TEXT NOT NULL,
+	id  TEXT NOT NULL,
+	rev INTEGER NOT NULL,
+	doc TEXT NOT NULL,
+	PRIMARY KEY (db, id)
+);
+CREATE INDEX IF NOT EXISTS comments_entity ON comments (db, json_extract(doc, '$."entity"'), json_extract(doc, '$."created_at"'));
+CREATE INDEX IF NOT EXISTS comments_parent ON comments (db, json_extract(doc, '$."parent_uuid"'));
+CREATE TABLE IF NOT EXISTS thread_locks (
+	db     TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	doc    TEXT NOT NULL,
+	PRIMARY KEY (db, entity)
+);
+CREATE TABLE IF NOT EXISTS templates (
+	db   TEXT NOT NULL,
+	id   TEXT NOT NULL,
+	name TEXT NOT NULL,
+	doc  TEXT NOT NULL,
+	PRIMARY KEY (db, id)
+);
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	db  TEXT NOT NULL,
+	key TEXT NOT NULL,
+	doc TEXT NOT NULL,
+	PRIMARY KEY (db, key)
+);
+CREATE TABLE IF NOT EXISTS outbox (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	db         TEXT NOT NULL,
+	message    TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	sent_at    TEXT
+);
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (sent_at, seq);
+`
+
+// Storage stores data in SQLite database file, so the service can run without CouchDB (e.g. on edge sites).
+// Comments are kept as JSON documents in logical databases per channel and asset type as in CouchDB
+// and they are queried by the subset of Mango query syntax (see mango.Query). Read state is kept
+// in read_by array of the comments. Logical databases must be created by CreateDatabase (as in CouchDB),
+// comments added to databases never created fail with 404.
+type Storage struct {
+	db     *sql.DB
+	logger *zap.Logger
+	rand   io.Reader
+
+	// idempotencyCleanedAt is the time of the last deletion of expired idempotency keys per logical database
+	idempotencyCleanedAt sync.Map
+}
+
+// Config contains values for the data source
+type Config struct {
+	// Path of the database file, ":memory:" keeps the database in memory
+	Path string
+	Rand io.Reader
+}
+
+// NewStorage opens the database file (it is created if it does not exist) and creates its tables
+func NewStorage(ctx context.Context, logger *zap.Logger, cfg Config) (*Storage, error) {
+	db, err := sql.Open("sqlite", cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open SQLite database: %w", err)
+	}
+
+	// one connection serializes the transactions (SQLite allows only one writer anyway)
+	// and keeps in-memory database alive
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 5000;"+schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not create SQLite schema: %w", err)
+	}
+
+	return &Storage{
+		db:     db,
+		logger: logger,
+		rand:   cfg.Rand,
+	}, nil
+}
+
+// Close closes the database
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// querier is implemented by both database and transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs the function in a transaction, the transaction is rolled back if the function returns error
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// storedComment is the comment with its revision number
+type storedComment struct {
+	rev int
+	comment.Comment
+}
+
+// getComment returns the comment with specified ID from the database, nil if it does not exist
+func getComment(ctx context.Context, q querier, dbName, id string) (*storedComment, error) {
+	var rev int
+	var doc string
+
+	err := q.QueryRowContext(ctx, "SELECT rev, doc FROM comments WHERE db = ? AND id = ?", dbName, id).Scan(&rev, &doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sc := storedComment{rev: rev}
+	if err := json.Unmarshal([]byte(doc), &sc.Comment); err != nil {
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// findComments returns comments of the database matching the SQL condition ordered by their IDs
+func findComments(ctx context.Context, q querier, dbName, where string, args ...interface{}) ([]storedComment, error) {
+	stmt := fmt.Sprintf("SELECT rev, doc FROM comments WHERE db = ? AND (%s) ORDER BY id", where)
+
+	rows, err := q.QueryContext(ctx, stmt, append([]interface{}{dbName}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var comments []storedComment
+	for rows.Next() {
+		var sc storedComment
+		var doc string
+		if err := rows.Scan(&sc.rev, &doc); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(doc), &sc.Comment); err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, sc)
+	}
+
+	return comments, rows.Err()
+}
+
+// putComment stores the comment under its UUID with the revision following the given one (zero for new comment).
+// The stored document contains _id and _rev fields as returned by CouchDB.
+func putComment(ctx context.Context, q querier, dbName string, c comment.Comment, rev int) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+
+	doc["_id"] = c.UUID
+	doc["_rev"] = fmt.Sprintf("%d-%x", rev+1, md5.Sum(body))
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO comments (db, id, rev, doc) VALUES (?, ?, ?, ?)
+		ON CONFLICT (db, id) DO UPDATE SET rev = excluded.rev, doc = excluded.doc`, dbName, c.UUID, rev+1, string(b))
+
+	return err
+}
+
+// registerDatabase records the logical database if it is not recorded yet
+func registerDatabase(ctx context.Context, q querier, dbName string) error {
+	_, err := q.ExecContext(ctx, "INSERT OR IGNORE INTO databases (name) VALUES (?)", dbName)
+	return err
+}
+
+// assertDatabaseExists returns not found error with the given message if the logical database
+// was not created by CreateDatabase
+func assertDatabaseExists(ctx context.Context, q querier, dbName, eMsg string) error {
+	var exists int
+	err := q.QueryRowContext(ctx, "SELECT 1 FROM databases WHERE name = ?", dbName).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errorNotFound(eMsg)
+	}
+
+	return err
+}
+
+// AddComment saves the given comment to the database and returns it. The message returned by events function
+// (if not nil) is stored to the outbox in the same transaction.
+func (s *Storage) AddComment(ctx context.Context, c comment.Comment, channelID string, assetType comment.AssetType, events func(c comment.Comment) (*event.Message, error)) (*comment.Comment, error) {
+	dbName := databaseName(channelID, assetType)
+	title := strings.Title(assetType.String())
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		eMsg := fmt.Sprintf("%s could not be added: database of %s does not exist", title, assetType.Plural())
+		if err := assertDatabaseExists(ctx, tx, dbName, eMsg); err != nil {
+			return err
+		}
+
+		existing, err := getComment(ctx, tx, dbName, c.UUID)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			return errorConflict(fmt.Sprintf("%s could not be added: %s already exists", title, title))
+		}
+
+		if err := putComment(ctx, tx, dbName, c, 0); err != nil {
+			return err
+		}
+
+		return addEventsToOutbox(ctx, tx, dbName, c, events)
+	})
+	if err != nil {
+		return nil, s.storageError(err, fmt.Sprintf("%s could not be added", title))
+	}
+
+	s.logger.Info(fmt.Sprintf("%s inserted %s", title, c.UUID))
+
+	return &c, nil
+}
+
+// GetComment returns comment with the specified ID
+func (s *Storage) GetComment(ctx context.Context, id, channelID string, assetType comment.AssetType) (comment.Comment, error) {
+	title := strings.Title(assetType.String())
+
+	sc, err := getComment(ctx, s.db, databaseName(channelID, assetType), id)
+	if err != nil {
+		return comment.Comment{}, s.storageError(err, fmt.Sprintf("%s could not be retrieved", title))
+	}
+
+	if sc == nil {
+		eMsg := fmt.Sprintf("%s could not be retrieved: %s with uuid='%s' does not exist", title, title, id)
+		return comment.Comment{}, errorNotFound(eMsg)
+	}
+
+	return sc.Comment, nil
+}
+
+// QueryComments finds comments using the subset of Mango query syntax (see mango.Query) translated to SQL
+func (s *Storage) QueryComments(ctx context.Context, query map[string]interface{}, channelID string, assetType comment.AssetType) (listing.QueryResult, error) {
+	q, err := mango.Parse(query)
+	if err != nil {
+		return listing.QueryResult{}, err
+	}
+
+	stmt, args, exact := findSQL(q, databaseName(channelID, assetType))
+
+	docs, err := s.findDocs(ctx, stmt, args, q, exact)
+	if err != nil {
+		eMsg := fmt.Sprintf("%s could not be queried", strings.Title(assetType.Plural()))
+		return listing.QueryResult{}, s.storageError(err, eMsg)
+	}
+
+	if !exact {
+		// the page is taken from all candidate documents
+		result, bookmark, err := q.Page(docs)
+		if err != nil {
+			return listing.QueryResult{}, err
+		}
+
+		return listing.QueryResult{Result: result, Bookmark: bookmark}, nil
+	}
+
+	result := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, q.Project(doc))
+	}
+
+	return listing.QueryResult{
+		Result:   result,
+		Bookmark: q.Bookmark(len(result)),
+	}, nil
+}
+
+// findDocs returns documents selected by the statement. Documents selected by inexact statement are filtered
+// and sorted by the query.
+func (s *Storage) findDocs(ctx context.Context, stmt string, args []interface{}, q mango.Query, exact bool) ([]map[string]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var docs []map[string]interface{}
+	for rows.Next() {
+		var b string
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(b), &doc); err != nil {
+			return nil, err
+		}
+
+		if exact || (q.Matches(doc) && q.HasSortFields(doc)) {
+			docs = append(docs, doc)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !exact {
+		sort.SliceStable(docs, func(i, j int) bool {
+			return q.Less(docs[i], docs[j])
+		})
+	}
+
+	return docs, nil
+}
+
+// modifyComment lets modify function change the comment with specified ID and stores the changed comment
+// in the transaction. Modify function returns false if there is nothing to store. It returns the comment
+// after the change and true if it was stored.
+func modifyComment(ctx context.Context, tx *sql.Tx, id, dbName string, assetType comment.AssetType, modify func(c *comment.Comment) (bool, error)) (comment.Comment, bool, error) {
+	sc, err := getComment(ctx, tx, dbName, id)
+	if err != nil {
+		return comment.Comment{}, false, err
+	}
+
+	if sc == nil {
+		reason := fmt.Sprintf("%s with uuid='%s' does not exist", strings.Title(assetType.String()), id)
+		return comment.Comment{}, false, errorNotFound(reason)
+	}
+
+	c := sc.Comment
+	changed, err := modify(&c)
+	if err != nil || !changed {
+		return c, false, err
+	}
+
+	if err := putComment(ctx, tx, dbName, c, sc.rev); err != nil {
+		return c, false, err
+	}
+
+	return c, true, nil
+}
+
+// update runs modifyComment in a transaction and stores the message returned by events function (if not nil)
+// to the outbox in the same transaction. Operation describes the change and is used in error message.
+func (s *Storage) update(ctx context.Context, id, channelID string, assetType comment.AssetType, operation string,
+	modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	return s.updateInTx(ctx, id, channelID, assetType, operation, func(_ *sql.Tx, c *comment.Comment) (bool, error) {
+		return modify(c)
+	}, events)
+}
+
+// updateInTx is update whose modify function gets the transaction to read other comments consistently with the change
+func (s *Storage) updateInTx(ctx context.Context, id, channelID string, assetType comment.AssetType, operation string,
+	modify func(tx *sql.Tx, c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	dbName := databaseName(channelID, assetType)
+
+	var c comment.Comment
+	var changed bool
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		c, changed, err = modifyComment(ctx, tx, id, dbName, assetType, func(c *comment.Comment) (bool, error) {
+			return modify(tx, c)
+		})
+		if err != nil || !changed {
+			return err
+		}
+
+		return addEventsToOutbox(ctx, tx, dbName, c, events)
+	})
+	if err != nil {
+		return c, false, s.storageError(err, fmt.Sprintf("%s could not be %s", strings.Title(assetType.String()), operation))
+	}
+
+	if changed {
+		s.logger.Info(fmt.Sprintf("%s %s %s", strings.Title(assetType.String()), operation, id))
+	}
+
+	return c, changed, nil
+}
+
+// MarkAsReadByUser adds user info to read_by array of the comment with specified ID. The message returned
+// by events function (if not nil) is stored to the outbox in the same transaction if the comment was marked.
+// It returns true if comment was already marked before to notify that resource was not changed.
+func (s *Storage) MarkAsReadByUser(ctx context.Context, id string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(c comment.Comment) (*event.Message, error)) (bool, error) {
+	_, changed, err := s.update(ctx, id, channelID, assetType, "marked as read", func(c *comment.Comment) (bool, error) {
+		return markAsRead(c, readBy), nil
+	}, events)
+
+	return !changed, err
+}
+
+// markAsRead adds user info to read_by array, it returns false if the user already read the comment
+func markAsRead(c *comment.Comment, readBy comment.ReadBy) bool {
+	for _, rb := range c.ReadBy {
+		if rb.User.UUID == readBy.User.UUID {
+			return false
+		}
+	}
+
+	c.ReadBy = append(c.ReadBy, readBy)
+
+	return true
+}
+
+// MarkAllAsReadByUser adds user info to read_by array of all not deleted comments of the entity
+// created at or before upTo not read by the user yet. The message returned by events function (if not nil)
+// for upTo (created_at of the newest marked comment if empty) is stored to the outbox in the same transaction
+// if some comments were marked. It returns the number of marked comments.
+func (s *Storage) MarkAllAsReadByUser(ctx context.Context, e entity.Entity, upTo string, readBy comment.ReadBy, channelID string, assetType comment.AssetType,
+	events func(upTo string) (*event.Message, error)) (int, error) {
+	dbName := databaseName(channelID, assetType)
+
+	where := `json_extract(doc, '$."entity"') = ? AND json_type(doc, '$."deleted_at"') IS NULL`
+	args := []interface{}{e.String()}
+	if upTo != "" {
+		where += ` AND json_extract(doc, '$."created_at"') <= ?`
+		args = append(args, upTo)
+	}
+
+	marked := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		comments, err := findComments(ctx, tx, dbName, where, args...)
+		if err != nil {
+			return err
+		}
+
+		newest := upTo
+		for _, sc := range comments {
+			if !markAsRead(&sc.Comment, readBy) {
+				continue
+			}
+
+			if err := putComment(ctx, tx, dbName, sc.Comment, sc.rev); err != nil {
+				return err
+			}
+			marked++
+
+			if sc.CreatedAt > newest {
+				newest = sc.CreatedAt
+			}
+		}
+
+		if marked == 0 || events == nil {
+			return nil
+		}
+
+		msg, err := events(newest)
+		if err != nil {
+			return err
+		}
+
+		return addToOutbox(ctx, tx, dbName, msg)
+	})
+	if err != nil {
+		eMsg := fmt.Sprintf("%s could not be marked as read", strings.Title(assetType.Plural()))
+		return 0, s.storageError(err, eMsg)
+	}
+
+	return marked, nil
+}
+
+// UpdateComment lets modify function change the comment with specified ID and stores the changed comment.
+// Modify function returns false if there is nothing to store. The message returned by events function (if not nil)
+// is stored to the outbox in the same transaction. It returns the comment after the change and true if it was stored.
+func (s *Storage) UpdateComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	return s.update(ctx, id, channelID, assetType, "updated", modify, events)
+}
+
+// PinComment lets modify function pin the comment with specified ID like UpdateComment does, modify gets the number
+// of pinned comments of its entity counted in the same transaction
+func (s *Storage) PinComment(ctx context.Context, id, channelID string, assetType comment.AssetType,
+	modify func(c *comment.Comment, pinned int) (bool, error), events func(c comment.Comment) (*event.Message, error)) (comment.Comment, bool, error) {
+	dbName := databaseName(channelID, assetType)
+
+	return s.updateInTx(ctx, id, channelID, assetType, "pinned", func(tx *sql.Tx, c *comment.Comment) (bool, error) {
+		pinned, err := countPinned(ctx, tx, dbName, c.Entity)
+		if err != nil {
+			return false, err
+		}
+
+		return modify(c, pinned)
+	}, events)
+}
+
+// CountPinned returns the number of pinned comments of the entity that are not deleted
+func (s *Storage) CountPinned(ctx context.Context, e entity.Entity, channelID string, assetType comment.AssetType) (int, error) {
+	pinned, err := countPinned(ctx, s.db, databaseName(channelID, assetType), e)
+	if err != nil {
+		return 0, s.storageError(err, fmt.Sprintf("Pinned %s could not be counted", assetType.Plural()))
+	}
+
+	return pinned, nil
+}
+
+func countPinned(ctx context.Context, q querier, dbName string, e entity.Entity) (int, error) {
+	var pinned int
+
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE db = ? AND json_extract(doc, '$."entity"') = ?
+		AND json_type(doc, '$."pinned_at"') IS NOT NULL AND json_type(doc, '$."deleted_at"') IS NULL`,
+		dbName, e.String()).Scan(&pinned)
+
+	return pinned, err
+}
+
+// CountUnread returns the number of not deleted comments of each entity not read by the user
+func (s *Storage) CountUnread(ctx context.Context, entities []string, userUUID, channelID string, assetType comment.AssetType) (map[string]int, error) {
+	unread := make(map[string]int, len(entities))
+	if len(entities) == 0 {
+		return unread, nil
+	}
+
+	args := []interface{}{databaseName(channelID, assetType)}
+	for _, e := range entities {
+		unread[e] = 0
+		args = append(args, e)
+	}
+	args = append(args, userUUID)
+
+	stmt := fmt.Sprintf(`SELECT json_extract(doc, '$."entity"') AS entity, COUNT(*) FROM comments
+		WHERE db = ? AND json_extract(doc, '$."entity"') IN (%s) AND json_type(doc, '$."deleted_at"') IS NULL
+		AND NOT EXISTS (SELECT 1 FROM json_each(doc, '$."read_by"') AS r WHERE json_extract(r.value, '$."user"."uuid"') = ?)
+		GROUP BY entity`, strings.TrimSuffix(strings.Repeat("?, ", len(entities)), ", "))
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, s.storageError(err, fmt.Sprintf("Unread %s could not be counted", assetType.Plural()))
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var e string
+		var count int
+		if err := rows.Scan(&e, &count); err != nil {
+			return nil, s.storageError(err, fmt.Sprintf("Unread %s could not be counted", assetType.Plural()))
+		}
+
+		unread[e] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, s.storageError(err, fmt.Sprintf("Unread %s could not be counted", assetType.Plural()))
+	}
+
+	return unread, nil
+}
+
+// CreateDatabase records the logical database of the channel and asset type if it does not exist.
+// It returns true if database already existed.
+func (s *Storage) CreateDatabase(ctx context.Context, channelID string, assetType comment.AssetType) (bool, error) {
+	return s.createDatabase(ctx, databaseName(channelID, assetType))
+}
+
+// createDatabase records the logical database, it returns true if it was already recorded
+func (s *Storage) createDatabase(ctx context.Context, dbName string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO databases (name) VALUES (?)", dbName)
+	if err != nil {
+		s.logger.Error("SQLite database creation failed", zap.Error(err))
+		return false, err
+	}
+
+	created, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return created == 0, nil
+}
+
+// MigrateReadState does nothing as read state is kept in read_by array of the comments. It returns zero.
+func (s *Storage) MigrateReadState(_ context.Context, _ string, _ comment.AssetType) (int, error) {
+	return 0, nil
+}
+
+// storageError returns repository error as is, other (database) errors are logged and returned
+// as internal server error with the message prefix
+func (s *Storage) storageError(err error, prefix string) error {
+	var repoErr *repository.Error
+	if errors.As(err, &repoErr) {
+		return err
+	}
+
+	s.logger.Warn("SQLite operation failed", zap.Error(err))
+
+	return repository.NewError(fmt.Sprintf("%s: %s", prefix, err), http.StatusInternalServerError)
+}
+
+func databaseName(channelID string, assetType comment.AssetType) string {
+	return fmt.Sprintf("p_%s_%s", channelID, assetType.Plural())
+}
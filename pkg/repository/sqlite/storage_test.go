@@ -0,0 +1,484 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
+	"github.com/KompiTech/itsm-commenting-service/pkg/event"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/sqlite"
+	"github.com/KompiTech/itsm-commenting-service/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const channelID = "e27ddcd0-0e1f-4bc5-93df-f6f04155beec"
+
+var (
+	incident1 = entity.NewEntity("incident", "f49d5fd5-8da4-4779-b5ba-32e78aa2c444")
+	incident2 = entity.NewEntity("incident", "7e0d38d1-e5f5-4211-b2aa-3b142e4da80e")
+	user      = comment.UserInfo{
+		UUID:           "439e2d19-8d50-405d-ad8e-cd33df344086",
+		Name:           "Joe",
+		Surname:        "Potato",
+		OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+		OrgDisplayName: "Kompitech",
+	}
+)
+
+func newStorage(t *testing.T, cfg sqlite.Config) *sqlite.Storage {
+	logger, _ := testutils.NewTestLogger()
+
+	if cfg.Path == "" {
+		cfg.Path = ":memory:"
+	}
+
+	s, err := sqlite.NewStorage(context.Background(), logger, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+// addComment adds the comment with UUID and created_at set the same way as by the adding service
+func addComment(ctx context.Context, s *sqlite.Storage, c comment.Comment, assetType comment.AssetType) (*comment.Comment, error) {
+	c.UUID = uuid.New().String()
+	c.CreatedAt = testutils.FixedClock{}.NowFormatted()
+
+	return s.AddComment(ctx, c, channelID, assetType, nil)
+}
+
+func assertStatusCode(t *testing.T, expected int, err error) {
+	var repoErr *repository.Error
+	require.ErrorAs(t, err, &repoErr)
+	assert.Equal(t, expected, repoErr.StatusCode())
+}
+
+func TestCreateDatabase(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+
+	alreadyExisted, err := s.CreateDatabase(ctx, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateDatabase(ctx, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.True(t, alreadyExisted)
+
+	// database is not created by the first write
+	_, err = addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1"}, comment.AssetTypeWorknote)
+	assert.EqualError(t, err, "Worknote could not be added: database of worknotes does not exist")
+
+	alreadyExisted, err = s.CreateDatabase(ctx, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+
+	alreadyExisted, err = s.CreateTemplateDatabase(ctx, channelID)
+	require.NoError(t, err)
+	assert.False(t, alreadyExisted)
+}
+
+func TestDataAreKeptInFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "comments.db")
+
+	s := newStorage(t, sqlite.Config{Path: path})
+	testutils.CreateDatabases(t, s, channelID)
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", CreatedBy: &user}, comment.AssetTypeComment)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s = newStorage(t, sqlite.Config{Path: path})
+	stored, err := s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+	assert.Equal(t, *c, stored)
+}
+
+func TestChannelAndAssetTypeIsolation(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", CreatedBy: &user}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	_, err = s.GetComment(ctx, c.UUID, channelID, comment.AssetTypeWorknote)
+	assert.EqualError(t, err, "Worknote could not be retrieved: Worknote with uuid='"+c.UUID+"' does not exist")
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	_, err = s.GetComment(ctx, c.UUID, "another-channel", comment.AssetTypeComment)
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{}}, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.Empty(t, result.Result)
+}
+
+func TestAddCommentUniqueness(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", ExternalID: "ext-1"}, assetType)
+	require.NoError(t, err)
+
+	// uniqueness of external IDs is guaranteed by UUIDs derived from them (see adding.Service)
+	_, err = s.AddComment(ctx, *c, channelID, assetType, nil)
+	assert.EqualError(t, err, "Comment could not be added: Comment already exists")
+	assertStatusCode(t, http.StatusConflict, err)
+}
+
+func TestChangeIsRolledBackWhenEventsFail(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	eventsFail := func(c comment.Comment) (*event.Message, error) {
+		return nil, errors.New("could not prepare events: invalid orgID")
+	}
+
+	_, err := s.AddComment(ctx, comment.Comment{UUID: uuid.New().String(), Entity: incident1, Text: "Test 0"}, channelID, assetType, eventsFail)
+	assert.EqualError(t, err, "Comment could not be added: could not prepare events: invalid orgID")
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{"selector": map[string]interface{}{}}, channelID, assetType)
+	require.NoError(t, err)
+	assert.Empty(t, result.Result)
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1", CreatedBy: &user}, assetType)
+	require.NoError(t, err)
+
+	_, _, err = s.UpdateComment(ctx, c.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		c.PinnedAt = testutils.FixedClock{}.NowFormatted()
+		c.PinnedBy = &user
+		return true, nil
+	}, eventsFail)
+	assert.EqualError(t, err, "Comment could not be updated: could not prepare events: invalid orgID")
+
+	stored, err := s.GetComment(ctx, c.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.False(t, stored.IsPinned())
+
+	pending, err := s.PendingMessages(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	events := func(c comment.Comment) (*event.Message, error) {
+		return &event.Message{ChannelID: channelID, Data: []byte(`{"text":"` + c.Text + `"}`)}, nil
+	}
+
+	c, err := s.AddComment(ctx, comment.Comment{UUID: uuid.New().String(), Entity: incident1, Text: "Test 1"}, channelID, assetType, events)
+	require.NoError(t, err)
+
+	_, changed, err := s.UpdateComment(ctx, c.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		c.Text = "Test 2"
+		return true, nil
+	}, events)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// no message is stored if nothing was changed
+	_, _, err = s.UpdateComment(ctx, c.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+		return false, nil
+	}, events)
+	require.NoError(t, err)
+
+	pending, err := s.PendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, event.UUID(channelID), pending[0].ChannelID)
+	assert.JSONEq(t, `{"text":"Test 1"}`, string(pending[0].Data))
+	assert.JSONEq(t, `{"text":"Test 2"}`, string(pending[1].Data))
+
+	require.NoError(t, s.MarkSent(ctx, pending[0]))
+
+	pending, err = s.PendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.JSONEq(t, `{"text":"Test 2"}`, string(pending[0].Data))
+}
+
+func TestUpdates(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c1, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 1"}, assetType)
+	require.NoError(t, err)
+	c2, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Test 2"}, assetType)
+	require.NoError(t, err)
+
+	t.Run("update and count pinned", func(t *testing.T) {
+		pin := func(c *comment.Comment) (bool, error) {
+			if c.IsPinned() {
+				return false, nil
+			}
+
+			c.PinnedAt = testutils.FixedClock{}.NowFormatted()
+			c.PinnedBy = &user
+			return true, nil
+		}
+
+		updated, changed, err := s.UpdateComment(ctx, c1.UUID, channelID, assetType, pin, nil)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.True(t, updated.IsPinned())
+
+		_, changed, err = s.UpdateComment(ctx, c1.UUID, channelID, assetType, pin, nil)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		pinned, err := s.CountPinned(ctx, incident1, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 1, pinned)
+
+		pinned, err = s.CountPinned(ctx, incident2, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, 0, pinned)
+
+		_, _, err = s.UpdateComment(ctx, "missing", channelID, assetType, pin, nil)
+		assert.EqualError(t, err, "Comment with uuid='missing' does not exist")
+		assertStatusCode(t, http.StatusNotFound, err)
+	})
+
+	t.Run("modify error", func(t *testing.T) {
+		_, _, err := s.UpdateComment(ctx, c2.UUID, channelID, assetType, func(c *comment.Comment) (bool, error) {
+			c.Text = "Not stored"
+			return true, repository.NewError("Comment is deleted", http.StatusConflict)
+		}, nil)
+		assert.EqualError(t, err, "Comment is deleted")
+		assertStatusCode(t, http.StatusConflict, err)
+
+		stored, err := s.GetComment(ctx, c2.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, "Test 2", stored.Text)
+	})
+
+	t.Run("read state", func(t *testing.T) {
+		readBy := comment.ReadBy{Time: "2021-04-01T12:34:56+02:00", User: user}
+
+		var read []string
+		events := func(c comment.Comment) (*event.Message, error) {
+			read = append(read, c.UUID)
+			return nil, nil
+		}
+
+		alreadyMarked, err := s.MarkAsReadByUser(ctx, c1.UUID, readBy, channelID, assetType, events)
+		require.NoError(t, err)
+		assert.False(t, alreadyMarked)
+
+		alreadyMarked, err = s.MarkAsReadByUser(ctx, c1.UUID, readBy, channelID, assetType, events)
+		require.NoError(t, err)
+		assert.True(t, alreadyMarked)
+		assert.Equal(t, []string{c1.UUID}, read, "events are prepared only when the comment is marked")
+
+		unread, err := s.CountUnread(ctx, []string{incident1.String(), incident2.String()}, user.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{incident1.String(): 1, incident2.String(): 0}, unread)
+
+		var readUpTo []string
+		marked, err := s.MarkAllAsReadByUser(ctx, incident1, "", readBy, channelID, assetType, func(upTo string) (*event.Message, error) {
+			readUpTo = append(readUpTo, upTo)
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+		require.Len(t, readUpTo, 1)
+		assert.NotEmpty(t, readUpTo[0], "created_at of the newest marked comment")
+
+		unread, err = s.CountUnread(ctx, []string{incident1.String()}, user.UUID, channelID, assetType)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{incident1.String(): 0}, unread)
+	})
+}
+
+func TestConvertComment(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Posted by mistake"}, comment.AssetTypeComment)
+	require.NoError(t, err)
+	_, err = addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Reply", ParentUUID: c.UUID}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	convert := func(c *comment.Comment) error {
+		c.ConvertedFrom = comment.AssetTypeComment
+		return nil
+	}
+
+	_, err = s.ConvertComment(ctx, c.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+	assert.EqualError(t, err, "Comment could not be converted: comment with uuid='"+c.UUID+"' has replies")
+	assertStatusCode(t, http.StatusConflict, err)
+
+	c2, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Internal"}, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	// the comment stays in place if events cannot be prepared
+	_, err = s.ConvertComment(ctx, c2.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, func(c comment.Comment) (*event.Message, error) {
+		return nil, errors.New("could not prepare events: invalid orgID")
+	})
+	assert.EqualError(t, err, "Comment could not be converted: could not prepare events: invalid orgID")
+
+	_, err = s.GetComment(ctx, c2.UUID, channelID, comment.AssetTypeComment)
+	require.NoError(t, err)
+
+	converted, err := s.ConvertComment(ctx, c2.UUID, channelID, comment.AssetTypeComment, comment.AssetTypeWorknote, convert, nil)
+	require.NoError(t, err)
+	assert.Equal(t, comment.AssetTypeComment, converted.ConvertedFrom)
+
+	_, err = s.GetComment(ctx, c2.UUID, channelID, comment.AssetTypeComment)
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	stored, err := s.GetComment(ctx, c2.UUID, channelID, comment.AssetTypeWorknote)
+	require.NoError(t, err)
+	assert.Equal(t, *converted, stored)
+}
+
+func TestMergeEntity(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	c, err := addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Parent"}, assetType)
+	require.NoError(t, err)
+	_, err = addComment(ctx, s, comment.Comment{Entity: incident1, Text: "Reply", ParentUUID: c.UUID}, assetType)
+	require.NoError(t, err)
+
+	merged, err := s.MergeEntity(ctx, comment.EntityMerge{Source: incident1, Target: incident2, Mode: comment.MergeModeCopy}, channelID, assetType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, merged)
+
+	result, err := s.QueryComments(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{"entity": incident2.String(), "parent_uuid": map[string]interface{}{"$exists": true}},
+	}, channelID, assetType)
+	require.NoError(t, err)
+	require.Len(t, result.Result, 1)
+
+	copiedReply := result.Result[0]
+	assert.NotEqual(t, c.UUID, copiedReply["parent_uuid"], "reply is linked to the copy of its parent")
+	assert.Equal(t, incident1.String(), copiedReply["original_entity"])
+
+	merged, err = s.MergeEntity(ctx, comment.EntityMerge{Source: incident1, Target: incident2}, channelID, assetType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, merged)
+
+	moved, err := s.GetComment(ctx, c.UUID, channelID, assetType)
+	require.NoError(t, err)
+	assert.Equal(t, incident2, moved.Entity)
+}
+
+func TestThreadLocks(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	lock, err := s.GetThreadLock(ctx, incident1, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, lock)
+
+	alreadyLocked, err := s.LockThread(ctx, comment.ThreadLock{Entity: incident1, LockedBy: &user}, channelID, assetType)
+	require.NoError(t, err)
+	assert.False(t, alreadyLocked)
+
+	alreadyLocked, err = s.LockThread(ctx, comment.ThreadLock{Entity: incident1, LockedBy: &user}, channelID, assetType)
+	require.NoError(t, err)
+	assert.True(t, alreadyLocked)
+
+	lock, err = s.GetThreadLock(ctx, incident1, channelID, assetType)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+	assert.Equal(t, &user, lock.LockedBy)
+
+	notLocked, err := s.UnlockThread(ctx, incident1, channelID, assetType)
+	require.NoError(t, err)
+	assert.False(t, notLocked)
+
+	notLocked, err = s.UnlockThread(ctx, incident1, channelID, assetType)
+	require.NoError(t, err)
+	assert.True(t, notLocked)
+}
+
+func TestTemplates(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+
+	greeting, err := s.CreateTemplate(ctx, comment.Template{Name: "greeting", Text: "Hello"}, channelID)
+	require.NoError(t, err)
+	_, err = s.CreateTemplate(ctx, comment.Template{Name: "Apology", Text: "Sorry"}, channelID)
+	require.NoError(t, err)
+
+	_, err = s.CreateTemplate(ctx, comment.Template{Name: "greeting", Text: "Hi"}, channelID)
+	assert.EqualError(t, err, "Template could not be created: template with name='greeting' already exists (uuid='"+greeting.UUID+"')")
+	assertStatusCode(t, http.StatusConflict, err)
+
+	templates, err := s.ListTemplates(ctx, channelID)
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "Apology", templates[0].Name)
+
+	updated, err := s.UpdateTemplate(ctx, greeting.UUID, comment.Template{Name: "greeting", Text: "Hi"}, channelID)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", updated.Text)
+	assert.Equal(t, greeting.CreatedAt, updated.CreatedAt)
+
+	require.NoError(t, s.DeleteTemplate(ctx, greeting.UUID, channelID))
+
+	_, err = s.GetTemplate(ctx, greeting.UUID, channelID)
+	assert.EqualError(t, err, "Template could not be retrieved: Template with uuid='"+greeting.UUID+"' does not exist")
+	assertStatusCode(t, http.StatusNotFound, err)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, sqlite.Config{})
+	testutils.CreateDatabases(t, s, channelID)
+	assetType := comment.AssetTypeComment
+
+	record := repository.IdempotencyRecord{Key: "key-1", UserUUID: "2af4f493-0bd5-4513-b440-6cbb465feadb", RequestHash: "hash", ExpiresAt: testutils.FixedClock{}.Now().AddDate(100, 0, 0)}
+
+	stored, err := s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	stored, err = s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.True(t, stored.IsPending())
+
+	// the same key sent by another user
+	otherUser := record
+	otherUser.UserUUID = "0ac5ebce-17e7-4edc-9552-fefe16e127fb"
+	stored, err = s.ReserveIdempotencyKey(ctx, otherUser, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	err = s.CompleteIdempotencyKey(ctx, repository.IdempotencyRecord{Key: "key-2"}, channelID, assetType)
+	assert.EqualError(t, err, "Idempotency-Key 'key-2' is not reserved")
+	assertStatusCode(t, http.StatusNotFound, err)
+
+	require.NoError(t, s.ReleaseIdempotencyKey(ctx, record, channelID, assetType))
+
+	stored, err = s.ReserveIdempotencyKey(ctx, record, channelID, assetType)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
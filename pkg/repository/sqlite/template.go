@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository"
+	"go.uber.org/zap"
+)
+
+// CreateTemplate saves a given template to the templates database of the channel
+func (s *Storage) CreateTemplate(ctx context.Context, t comment.Template, channelID string) (*comment.Template, error) {
+	dbName := templateDatabaseName(channelID)
+
+	uuid, err := repository.GenerateUUID(s.rand)
+	if err != nil {
+		s.logger.Error("could not generate UUID", zap.Error(err))
+		return nil, err
+	}
+
+	t.UUID = uuid
+	t.CreatedAt = time.Now().Format(time.RFC3339)
+
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := assertTemplateNameUnique(ctx, tx, dbName, t, "created"); err != nil {
+			return err
+		}
+
+		if err := registerDatabase(ctx, tx, dbName); err != nil {
+			return err
+		}
+
+		return putTemplate(ctx, tx, dbName, t)
+	})
+	if err != nil {
+		return nil, s.storageError(err, "Template could not be created")
+	}
+
+	s.logger.Info(fmt.Sprintf("Template '%s' inserted", uuid))
+
+	return &t, nil
+}
+
+// GetTemplate returns the template with the specified ID
+func (s *Storage) GetTemplate(ctx context.Context, id, channelID string) (comment.Template, error) {
+	t, err := getTemplate(ctx, s.db, templateDatabaseName(channelID), id, "retrieved")
+	if err != nil {
+		return comment.Template{}, s.storageError(err, "Template could not be retrieved")
+	}
+
+	return t, nil
+}
+
+// ListTemplates returns all templates of the channel sorted by name
+func (s *Storage) ListTemplates(ctx context.Context, channelID string) ([]comment.Template, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT doc FROM templates WHERE db = ? ORDER BY id", templateDatabaseName(channelID))
+	if err != nil {
+		return nil, s.storageError(err, "Templates could not be listed")
+	}
+	defer func() { _ = rows.Close() }()
+
+	templates := make([]comment.Template, 0)
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return nil, s.storageError(err, "Templates could not be listed")
+		}
+
+		var t comment.Template
+		if err := json.Unmarshal([]byte(doc), &t); err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, s.storageError(err, "Templates could not be listed")
+	}
+
+	// templates are listed in the order of their IDs before sorting as in CouchDB
+	sort.SliceStable(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces name, text and content type of the template with the specified ID
+func (s *Storage) UpdateTemplate(ctx context.Context, id string, t comment.Template, channelID string) (*comment.Template, error) {
+	dbName := templateDatabaseName(channelID)
+
+	var stored comment.Template
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		stored, err = getTemplate(ctx, tx, dbName, id, "updated")
+		if err != nil {
+			return err
+		}
+
+		stored.Name = t.Name
+		stored.Text = t.Text
+		stored.ContentType = t.ContentType
+		stored.UpdatedBy = t.UpdatedBy
+		stored.UpdatedAt = time.Now().Format(time.RFC3339)
+
+		if err := assertTemplateNameUnique(ctx, tx, dbName, stored, "updated"); err != nil {
+			return err
+		}
+
+		return putTemplate(ctx, tx, dbName, stored)
+	})
+	if err != nil {
+		return nil, s.storageError(err, "Template could not be updated")
+	}
+
+	s.logger.Info(fmt.Sprintf("Template '%s' updated", id))
+
+	return &stored, nil
+}
+
+// DeleteTemplate removes the template with the specified ID
+func (s *Storage) DeleteTemplate(ctx context.Context, id, channelID string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM templates WHERE db = ? AND id = ?", templateDatabaseName(channelID), id)
+	if err != nil {
+		return s.storageError(err, "Template could not be deleted")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return s.storageError(err, "Template could not be deleted")
+	}
+
+	if deleted == 0 {
+		return templateNotFound(id, "deleted")
+	}
+
+	s.logger.Info(fmt.Sprintf("Template '%s' deleted", id))
+
+	return nil
+}
+
+// CreateTemplateDatabase records the templates database of the channel if it does not exist.
+// It returns true if database already existed.
+func (s *Storage) CreateTemplateDatabase(ctx context.Context, channelID string) (bool, error) {
+	return s.createDatabase(ctx, templateDatabaseName(channelID))
+}
+
+// getTemplate returns stored template, operation is used in error message if it does not exist
+func getTemplate(ctx context.Context, q querier, dbName, id, operation string) (comment.Template, error) {
+	var t comment.Template
+	var doc string
+
+	err := q.QueryRowContext(ctx, "SELECT doc FROM templates WHERE db = ? AND id = ?", dbName, id).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, templateNotFound(id, operation)
+	}
+	if err != nil {
+		return t, err
+	}
+
+	err = json.Unmarshal([]byte(doc), &t)
+
+	return t, err
+}
+
+func putTemplate(ctx context.Context, q querier, dbName string, t comment.Template) error {
+	doc, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO templates (db, id, name, doc) VALUES (?, ?, ?, ?)
+		ON CONFLICT (db, id) DO UPDATE SET name = excluded.name, doc = excluded.doc`, dbName, t.UUID, t.Name, string(doc))
+
+	return err
+}
+
+// assertTemplateNameUnique returns error if another template of the channel has the same name
+func assertTemplateNameUnique(ctx context.Context, q querier, dbName string, t comment.Template, operation string) error {
+	var existing string
+
+	err := q.QueryRowContext(ctx, "SELECT id FROM templates WHERE db = ? AND name = ? AND id != ? ORDER BY id LIMIT 1",
+		dbName, t.Name, t.UUID).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("template with name='%s' already exists (uuid='%s')", t.Name, existing)
+
+	return errorConflict(fmt.Sprintf("Template could not be %s: %s", operation, reason))
+}
+
+func templateNotFound(id, operation string) error {
+	return errorNotFound(fmt.Sprintf("Template could not be %s: Template with uuid='%s' does not exist", operation, id))
+}
+
+func templateDatabaseName(channelID string) string {
+	return fmt.Sprintf("p_%s_templates", channelID)
+}
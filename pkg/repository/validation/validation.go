@@ -1,4 +1,5 @@
-package couchdb
+// Package validation validates comments against the schema of stored documents shared by all repository backends
+package validation
 
 import (
 	"embed"
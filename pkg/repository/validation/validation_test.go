@@ -1,19 +1,24 @@
-package couchdb_test
+package validation_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/entity"
-	"github.com/KompiTech/itsm-commenting-service/pkg/repository/couchdb"
+	"github.com/KompiTech/itsm-commenting-service/pkg/repository/validation"
 	"github.com/stretchr/testify/require"
 )
 
 func TestValidate(t *testing.T) {
 	e := entity.NewEntity("request", "2c26e43d-7cd4-41d9-aeae-395c47be0128")
 
+	// comments stored before the entity format was enforced must stay editable and deletable
+	var legacy entity.Entity
+	require.NoError(t, json.Unmarshal([]byte(`"request:SR 0042:copy"`), &legacy))
+
 	tests := []struct {
 		name       string
 		comment    comment.Comment
@@ -38,6 +43,85 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid comment with history",
+			comment: comment.Comment{
+				UUID:      "9445f50b-28c4-4c9e-a9a6-4b16d6506c33",
+				Entity:    e,
+				Text:      "Comment 1",
+				CreatedAt: time.Now().Format(time.RFC3339),
+				CreatedBy: &comment.UserInfo{
+					UUID:           "1e88630d-2457-4f60-a66c-34a542a2e1f4",
+					Name:           "Michael",
+					Surname:        "Jackson",
+					OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					OrgDisplayName: "Kompitech",
+				},
+				History: comment.HistoryList{
+					{
+						Text:     "Coment 1",
+						EditedAt: time.Now().Format(time.RFC3339),
+						EditedBy: comment.UserInfo{
+							UUID:           "1e88630d-2457-4f60-a66c-34a542a2e1f4",
+							Name:           "Michael",
+							Surname:        "Jackson",
+							OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+							OrgDisplayName: "Kompitech",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "history entry without editor",
+			comment: comment.Comment{
+				UUID:      "9445f50b-28c4-4c9e-a9a6-4b16d6506c33",
+				Entity:    e,
+				Text:      "Comment 1",
+				CreatedAt: time.Now().Format(time.RFC3339),
+				CreatedBy: &comment.UserInfo{
+					UUID:           "1e88630d-2457-4f60-a66c-34a542a2e1f4",
+					Name:           "Michael",
+					Surname:        "Jackson",
+					OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					OrgDisplayName: "Kompitech",
+				},
+				History: comment.HistoryList{
+					{
+						Text:     "Coment 1",
+						EditedAt: time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+			wantErr:    true,
+			wantErrMsg: `/history/0/edited_by: 'uuid' value is required`,
+		},
+		{
+			name: "valid comment with entity reference stored in older format",
+			comment: comment.Comment{
+				UUID:      "9445f50b-28c4-4c9e-a9a6-4b16d6506c33",
+				Entity:    legacy,
+				Text:      "Comment 1",
+				CreatedAt: time.Now().Format(time.RFC3339),
+				CreatedBy: &comment.UserInfo{
+					UUID:           "1e88630d-2457-4f60-a66c-34a542a2e1f4",
+					Name:           "Michael",
+					Surname:        "Jackson",
+					OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					OrgDisplayName: "Kompitech",
+				},
+				DeletedAt: time.Now().Format(time.RFC3339),
+				DeletedBy: &comment.UserInfo{
+					UUID:           "1e88630d-2457-4f60-a66c-34a542a2e1f4",
+					Name:           "Michael",
+					Surname:        "Jackson",
+					OrgName:        "a897a407-e41b-4b14-924a-39f5d5a8038f.kompitech.com",
+					OrgDisplayName: "Kompitech",
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "missing Entity",
 			comment: comment.Comment{
@@ -542,7 +626,7 @@ func TestValidate(t *testing.T) {
 		},
 	}
 
-	v, err := couchdb.NewValidator()
+	v, err := validation.NewValidator()
 	require.NoError(t, err)
 
 	for _, tt := range tests {
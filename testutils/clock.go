@@ -14,7 +14,7 @@ func (FixedClock) Now() time.Time {
 	return time.Date(2021, 4, 1, 12, 34, 56, 78, tz)
 }
 
-// NowFormatted returns fixed time string in RFC3339 format
+// NowFormatted returns fixed time string in the format of stored timestamps (RFC3339 in UTC)
 func (c FixedClock) NowFormatted() string {
-	return c.Now().Format(time.RFC3339)
+	return c.Now().UTC().Format(time.RFC3339)
 }
@@ -1,16 +1,41 @@
 package testutils
 
 import (
+	"context"
 	"fmt"
+	"testing"
 
 	"github.com/KompiTech/itsm-commenting-service/pkg/domain/comment"
 )
 
 // DatabaseName return database name
 func DatabaseName(channelID string, assetType comment.AssetType) string {
-	return fmt.Sprintf("p_%s_%s", channelID, pluralize(assetType))
+	return fmt.Sprintf("p_%s_%s", channelID, assetType.Plural())
 }
 
-func pluralize(assetType comment.AssetType) string {
-	return fmt.Sprintf("%ss", assetType)
+// TemplateDatabaseName return name of the comment templates database
+func TemplateDatabaseName(channelID string) string {
+	return fmt.Sprintf("p_%s_templates", channelID)
+}
+
+// ReadStateDatabaseName return name of the read state database of the asset type
+func ReadStateDatabaseName(channelID string, assetType comment.AssetType) string {
+	return fmt.Sprintf("p_%s_%s_read_state", channelID, assetType.Plural())
+}
+
+// DatabaseCreator creates the database of the channel and asset type, e.g. repository backend
+type DatabaseCreator interface {
+	CreateDatabase(ctx context.Context, channelID string, assetType comment.AssetType) (alreadyExisted bool, err error)
+}
+
+// CreateDatabases creates databases of the default asset types of the channel, the storage does not create them
+// on first write
+func CreateDatabases(t *testing.T, s DatabaseCreator, channelID string) {
+	t.Helper()
+
+	for _, assetType := range []comment.AssetType{comment.AssetTypeComment, comment.AssetTypeWorknote} {
+		if _, err := s.CreateDatabase(context.Background(), channelID, assetType); err != nil {
+			t.Fatalf("could not create database: %v", err)
+		}
+	}
 }